@@ -30,6 +30,17 @@ func main() {
 	rootCommand.AddCommand(cmd.BuildCmd())
 	rootCommand.AddCommand(cmd.PluginCmd())
 	rootCommand.AddCommand(cmd.Diff())
+	rootCommand.AddCommand(cmd.Extract())
+	rootCommand.AddCommand(cmd.Coredump())
+	rootCommand.AddCommand(cmd.ScanSecrets())
+	rootCommand.AddCommand(cmd.Redact())
+	rootCommand.AddCommand(cmd.Sign())
+	rootCommand.AddCommand(cmd.VerifySignature())
+	rootCommand.AddCommand(cmd.Manifest())
+	rootCommand.AddCommand(cmd.Repack())
+	rootCommand.AddCommand(cmd.Delta())
+	rootCommand.AddCommand(cmd.ApplyDelta())
+	rootCommand.AddCommand(cmd.StoreCmd())
 
 	// Discover and register external plugins from PATH.
 	// Plugins are executables named checkpointctl-<name> where <name>
@@ -17,6 +17,7 @@ func BuildCmd() *cobra.Command {
 		Short: "Create an OCI image from a container checkpoint archive",
 		Long: `The 'build' command converts a container checkpoint archive into an OCI-compatible image.
 Metadata from the checkpoint archive is extracted and applied as OCI image annotations.
+A signature created with 'checkpointctl sign' can be attached as an annotation.
 Example:
   checkpointctl build checkpoint.tar quay.io/foo/bar:latest
   buildah push quay.io/foo/bar:latest`,
@@ -24,6 +25,15 @@ Example:
 		RunE: convertArchive,
 	}
 
+	flags := cmd.Flags()
+
+	flags.StringVar(
+		signatureFile,
+		"signature",
+		"",
+		"Attach the signature file created by 'checkpointctl sign' as an image annotation",
+	)
+
 	return cmd
 }
 
@@ -35,7 +45,7 @@ func convertArchive(cmd *cobra.Command, args []string) error {
 	checkpointPath := args[0]
 	imageName := args[1]
 
-	ImageBuilder := internal.NewImageBuilder(imageName, checkpointPath)
+	ImageBuilder := internal.NewImageBuilder(imageName, checkpointPath, *signatureFile)
 
 	err := ImageBuilder.CreateImageFromCheckpoint(context.Background())
 	if err != nil {
@@ -0,0 +1,123 @@
+// SPDX-License-Identifier: Apache-2.0
+
+// This file is used to create core dumps of processes in container checkpoints
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/checkpoint-restore/checkpointctl/internal"
+	metadata "github.com/checkpoint-restore/checkpointctl/lib"
+	"github.com/checkpoint-restore/go-criu/v8/crit"
+	"github.com/spf13/cobra"
+)
+
+func Coredump() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "coredump <checkpoint-path>",
+		Short: "Create a core dump of a process in a container checkpoint",
+		Long: `The 'coredump' command creates an ELF core file of a process in a container
+checkpoint. The core file contains the memory, the registers of all threads,
+the command line, the auxiliary vector and the mapped files of the process.
+It can be loaded into gdb together with the binaries of the container:
+  checkpointctl coredump checkpoint.tar --pid 1 -o core.1
+  gdb --ex 'set sysroot /path/to/rootfs' /path/to/rootfs/usr/bin/app core.1`,
+		RunE: coredump,
+		Args: cobra.ExactArgs(1),
+	}
+
+	flags := cmd.Flags()
+
+	flags.Uint32VarP(
+		pID,
+		"pid",
+		"p",
+		0,
+		"Specify the PID of the process to dump",
+	)
+	flags.StringVarP(
+		outputFilePath,
+		"output",
+		"o",
+		"",
+		"Specify the output file to be written to (default \"core.<pid>\")",
+	)
+
+	return cmd
+}
+
+func coredump(cmd *cobra.Command, args []string) error {
+	if *pID == 0 {
+		return fmt.Errorf("please specify the process to dump with --pid")
+	}
+	if *outputFilePath == "" {
+		*outputFilePath = fmt.Sprintf("core.%d", *pID)
+	}
+
+	requiredFiles := []string{
+		metadata.SpecDumpFile, metadata.ConfigDumpFile,
+		filepath.Join(metadata.CheckpointDirectory, "pstree.img"),
+		// The registers of all threads are in the core-*.img files
+		filepath.Join(metadata.CheckpointDirectory, "core-"),
+		filepath.Join(metadata.CheckpointDirectory, fmt.Sprintf("pagemap-%d.img", *pID)),
+		filepath.Join(metadata.CheckpointDirectory, fmt.Sprintf("mm-%d.img", *pID)),
+		// The backing resources of the memory regions are in files.img and memfd.img
+		filepath.Join(metadata.CheckpointDirectory, "files.img"),
+		filepath.Join(metadata.CheckpointDirectory, "memfd.img"),
+	}
+
+	tasks, err := internal.CreateTasks(args, requiredFiles)
+	if err != nil {
+		return err
+	}
+	defer internal.CleanupTasks(tasks)
+
+	task := tasks[0]
+	memReader, err := newProcessMemoryReader(task)
+	if err != nil {
+		return err
+	}
+
+	c := crit.New(nil, nil, filepath.Join(task.OutputDir, metadata.CheckpointDirectory), false, false)
+	psTree, err := c.ExplorePs()
+	if err != nil {
+		return fmt.Errorf("failed to get process tree: %w", err)
+	}
+	ps := psTree.FindPs(*pID)
+
+	regions, err := internal.GetMemoryRegions(task.OutputDir, *pID)
+	if err != nil {
+		return fmt.Errorf("failed to get memory regions: %w", err)
+	}
+
+	cmdline, err := memReader.GetPsArgs()
+	if err != nil {
+		return fmt.Errorf("failed to get command line of process %d: %w", *pID, err)
+	}
+
+	pages, err := internal.OpenProcessPages(task.OutputDir, *pID)
+	if err != nil {
+		return fmt.Errorf("failed to open memory pages: %w", err)
+	}
+	defer pages.Close()
+
+	f, err := os.Create(*outputFilePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// The file is written directly to create holes for missing pages
+	if err := internal.WriteCoreDump(f, task.OutputDir, ps, regions, cmdline.Bytes(), pages); err != nil {
+		return fmt.Errorf("failed to write core file: %w", err)
+	}
+
+	fmt.Printf("Wrote core dump of process ID %d from checkpoint: %s to file: %s\n",
+		*pID, task.CheckpointFilePath, *outputFilePath,
+	)
+
+	return nil
+}
@@ -0,0 +1,137 @@
+// SPDX-License-Identifier: Apache-2.0
+
+// This file is used to create and apply deltas between container checkpoints
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/checkpoint-restore/checkpointctl/internal"
+	metadata "github.com/checkpoint-restore/checkpointctl/lib"
+	"github.com/spf13/cobra"
+)
+
+func Delta() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "delta <base-checkpoint-path> <checkpoint-path>",
+		Short: "Create a delta between two container checkpoints",
+		Long: `The 'delta' command creates a delta from which a container checkpoint can be
+reconstructed with an earlier checkpoint of the same container. Memory pages and
+files which are identical in the base checkpoint are not stored in the delta:
+  checkpointctl delta checkpoint1.tar checkpoint2.tar -o checkpoint2.delta
+  checkpointctl apply-delta checkpoint1.tar checkpoint2.delta -o checkpoint2.tar`,
+		RunE: delta,
+		Args: cobra.ExactArgs(2),
+	}
+
+	flags := cmd.Flags()
+
+	flags.StringVarP(
+		outputFilePath,
+		"output",
+		"o",
+		"",
+		"Specify the output file to be written to (default \"<checkpoint-path>.delta\")",
+	)
+
+	return cmd
+}
+
+func delta(cmd *cobra.Command, args []string) error {
+	if *outputFilePath == "" {
+		*outputFilePath = args[1] + ".delta"
+	}
+	if err := checkDifferentPaths(*outputFilePath, args...); err != nil {
+		return err
+	}
+
+	result, err := internal.CreateCheckpointDelta(args[0], args[1], *outputFilePath)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf(
+		"Created delta of checkpoint: %s against: %s in: %s (%s)\n",
+		args[1], args[0], *outputFilePath, metadata.ByteToString(result.DeltaSize),
+	)
+	fmt.Printf(
+		"Stored %s of %s, reused %d of %d memory pages\n",
+		metadata.ByteToString(result.StoredSize), metadata.ByteToString(result.Size),
+		result.MatchedPages, result.Pages,
+	)
+
+	return nil
+}
+
+func ApplyDelta() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "apply-delta <base-checkpoint-path> <delta-path>",
+		Short: "Reconstruct a container checkpoint from a delta",
+		Long: `The 'apply-delta' command reconstructs a container checkpoint from the base
+checkpoint and a delta created by the 'delta' command. Only the uncompressed
+tar stream of the reconstructed checkpoint is guaranteed to be identical to
+the original checkpoint and it is verified. A warning is printed if a
+compressed checkpoint is not compressed to the same bytes as the original
+archive:
+  checkpointctl apply-delta checkpoint1.tar checkpoint2.delta -o checkpoint2.tar`,
+		RunE: applyDelta,
+		Args: cobra.ExactArgs(2),
+	}
+
+	flags := cmd.Flags()
+
+	flags.StringVarP(
+		outputFilePath,
+		"output",
+		"o",
+		"",
+		"Specify the output file to be written to",
+	)
+
+	return cmd
+}
+
+func applyDelta(cmd *cobra.Command, args []string) error {
+	if *outputFilePath == "" {
+		return fmt.Errorf("please specify the output file with --output")
+	}
+	if err := checkDifferentPaths(*outputFilePath, args...); err != nil {
+		return err
+	}
+
+	result, err := internal.ApplyCheckpointDelta(args[0], args[1], *outputFilePath)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf(
+		"Reconstructed checkpoint: %s (%s) from: %s and delta: %s\n",
+		*outputFilePath, metadata.ByteToString(result.Size), args[0], args[1],
+	)
+	if !result.ArchiveIdentical {
+		fmt.Fprintf(
+			os.Stderr,
+			"Warning: the compressed archive %s differs from the original archive file; only the uncompressed tar stream is guaranteed to be identical\n",
+			*outputFilePath,
+		)
+	}
+
+	return nil
+}
+
+// checkDifferentPaths returns an error if the output path refers to one of
+// the input files.
+func checkDifferentPaths(output string, inputs ...string) error {
+	outputInfo, err := os.Stat(output)
+	if err != nil {
+		return nil
+	}
+	for _, input := range inputs {
+		if inputInfo, err := os.Stat(input); err == nil && os.SameFile(inputInfo, outputInfo) {
+			return fmt.Errorf("the output path must be different from %s", input)
+		}
+	}
+	return nil
+}
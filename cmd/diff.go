@@ -10,6 +10,7 @@ import (
 
 	"github.com/checkpoint-restore/checkpointctl/internal"
 	metadata "github.com/checkpoint-restore/checkpointctl/lib"
+	"github.com/checkpoint-restore/go-criu/v8/crit"
 	"github.com/spf13/cobra"
 	"github.com/xlab/treeprint"
 )
@@ -22,13 +23,19 @@ func Diff() *cobra.Command {
   - Process tree (new/removed/modified processes)
   - File descriptors (opened/closed files)
   - Sockets (new/removed network sockets)
-  - Memory usage (size changes)
+  - Memory usage (size changes, and with --memory the changed memory
+    mappings and pages of every process)
+  - Image, runtime, annotations, mounts and networks of the container
+  - Root file system (with --rootfs the changed files of the writable layer)
+  - CRIU dump statistics
 
 Example:
   checkpointctl diff checkpoint1.tar checkpoint2.tar
   checkpointctl diff --format json checkpoint1.tar checkpoint2.tar
   checkpointctl diff --files --ps-tree-cmd checkpoint1.tar checkpoint2.tar
-  checkpointctl diff --files --sockets checkpoint1.tar checkpoint2.tar`,
+  checkpointctl diff --files --sockets checkpoint1.tar checkpoint2.tar
+  checkpointctl diff --memory checkpoint1.tar checkpoint2.tar
+  checkpointctl diff --rootfs checkpoint1.tar checkpoint2.tar`,
 		Args: cobra.ExactArgs(2),
 		RunE: diff,
 	}
@@ -52,6 +59,18 @@ Example:
 		false,
 		"Include environment variables in process tree diff",
 	)
+	flags.StringArrayVar(
+		maskEnvVars,
+		"mask-env",
+		nil,
+		"Mask the values of environment variables matching a glob pattern in addition to *PASSWORD*, *TOKEN*, *SECRET* and *KEY* (can be specified multiple times)",
+	)
+	flags.BoolVar(
+		showSecrets,
+		"show-secrets",
+		false,
+		"Display the values of all environment variables without masking",
+	)
 	flags.BoolVar(
 		files,
 		"files",
@@ -64,6 +83,18 @@ Example:
 		false,
 		"Include sockets in the diff",
 	)
+	flags.BoolVar(
+		memory,
+		"memory",
+		false,
+		"Compare the memory mappings and the content of the memory pages of every process",
+	)
+	flags.BoolVar(
+		rootFs,
+		"rootfs",
+		false,
+		"Compare the files in the writable layer of the container and the deleted files",
+	)
 	flags.BoolVar(
 		showUnchanged,
 		"show-unchanged",
@@ -75,6 +106,10 @@ Example:
 }
 
 func diff(cmd *cobra.Command, args []string) error {
+	if err := internal.ValidateMaskEnvVars(); err != nil {
+		return err
+	}
+
 	checkpointA := args[0]
 	checkpointB := args[1]
 
@@ -82,6 +117,8 @@ func diff(cmd *cobra.Command, args []string) error {
 	requiredFiles := []string{
 		metadata.SpecDumpFile,
 		metadata.ConfigDumpFile,
+		metadata.NetworkStatusFile,
+		crit.StatsDump,
 	}
 
 	// Add process tree files
@@ -119,6 +156,16 @@ func diff(cmd *cobra.Command, args []string) error {
 		)
 	}
 
+	if *memory {
+		requiredFiles = append(
+			requiredFiles,
+			filepath.Join(metadata.CheckpointDirectory, "files.img"),
+			filepath.Join(metadata.CheckpointDirectory, "pagemap-"),
+			filepath.Join(metadata.CheckpointDirectory, "pages-"),
+			filepath.Join(metadata.CheckpointDirectory, "mm-"),
+		)
+	}
+
 	// Load checkpoint A
 	tasksA, err := internal.CreateTasks([]string{checkpointA}, requiredFiles)
 	if err != nil {
@@ -162,6 +209,26 @@ func diff(cmd *cobra.Command, args []string) error {
 	// Compute diff
 	result := computeDiff(jsonA[0], jsonB[0])
 
+	// Compare memory pages if requested
+	if *memory {
+		processes, err := internal.DiffProcessMemory(tasksA[0].OutputDir, tasksB[0].OutputDir)
+		if err != nil {
+			return fmt.Errorf("failed to compare memory: %w", err)
+		}
+		result.MemoryChanges.PageChanges = summarizeMemoryPages(processes)
+	}
+
+	// Compare root file system changes if requested
+	if *rootFs {
+		result.RootFsChanges, err = internal.DiffRootFs(checkpointA, checkpointB)
+		if err != nil {
+			return fmt.Errorf("failed to compare root file systems: %w", err)
+		}
+	}
+
+	// Generate summary
+	result.Summary = generateSummary(result)
+
 	// Render output
 	switch *format {
 	case "tree":
@@ -174,12 +241,23 @@ func diff(cmd *cobra.Command, args []string) error {
 	}
 }
 
-// getTaskJSON converts tasks to JSON format (same as internal.RenderJSONView)
+// getTaskJSON converts tasks to the JSON format of inspect
 func getTaskJSON(tasks []internal.Task) ([]CheckpointMetadata, error) {
 	var result []CheckpointMetadata
 
-	prevPsTree := internal.PsTree
-	defer func() { internal.PsTree = prevPsTree }()
+	prevPsTree, prevStats := internal.PsTree, internal.Stats
+	defer func() { internal.PsTree, internal.Stats = prevPsTree, prevStats }()
+
+	// The annotations and mounts are always compared
+	prevMetadata, prevMounts := internal.Metadata, internal.Mounts
+	internal.Metadata, internal.Mounts = true, true
+	defer func() { internal.Metadata, internal.Mounts = prevMetadata, prevMounts }()
+
+	// Environment variables are compared with their real values and
+	// masked when the differences are rendered
+	prevShowSecrets := internal.ShowSecrets
+	internal.ShowSecrets = true
+	defer func() { internal.ShowSecrets = prevShowSecrets }()
 
 	for _, task := range tasks {
 		// Enable process-tree extraction only when pstree.img is present; some
@@ -188,32 +266,23 @@ func getTaskJSON(tasks []internal.Task) ([]CheckpointMetadata, error) {
 		_, statErr := os.Stat(pstreePath)
 		internal.PsTree = statErr == nil
 
-		// Use the same rendering logic as inspect
-		var buf []byte
-		var err error
-
-		// Create a pipe to capture RenderJSONView output
-		oldStdout := os.Stdout
-		r, w, _ := os.Pipe()
-		os.Stdout = w
-
-		// Call the existing RenderJSONView
-		err = internal.RenderJSONView([]internal.Task{task})
-
-		w.Close()
-		os.Stdout = oldStdout
+		// The dump statistics are optional as well
+		_, statErr = os.Stat(filepath.Join(task.OutputDir, crit.StatsDump))
+		internal.Stats = statErr == nil
 
+		// Use the same data as inspect
+		nodes, err := internal.CollectCheckpointData([]internal.Task{task})
 		if err != nil {
 			return nil, err
 		}
 
-		// Read captured output
-		buf = make([]byte, 1024*1024) // 1MB buffer
-		n, _ := r.Read(buf)
+		jsonData, err := json.Marshal(nodes)
+		if err != nil {
+			return nil, err
+		}
 
-		// Parse JSON
 		var metadata []CheckpointMetadata
-		if err := json.Unmarshal(buf[:n], &metadata); err != nil {
+		if err := json.Unmarshal(jsonData, &metadata); err != nil {
 			return nil, err
 		}
 
@@ -227,16 +296,22 @@ func getTaskJSON(tasks []internal.Task) ([]CheckpointMetadata, error) {
 
 // Structs matching JSON output from inspect
 type CheckpointMetadata struct {
-	ContainerName   string                `json:"container_name"`
-	Image           string                `json:"image"`
-	ID              string                `json:"id"`
-	Runtime         string                `json:"runtime"`
-	Created         string                `json:"created"`
-	Engine          string                `json:"engine"`
-	CheckpointSize  CheckpointSize        `json:"checkpoint_size"`
-	ProcessTree     *internal.PsNode      `json:"process_tree,omitempty"`
-	FileDescriptors []FileDescriptorEntry `json:"file_descriptors,omitempty"`
-	Sockets         []internal.SkNode     `json:"sockets,omitempty"`
+	ContainerName      string                 `json:"container_name"`
+	Image              string                 `json:"image"`
+	ID                 string                 `json:"id"`
+	Runtime            string                 `json:"runtime"`
+	Created            string                 `json:"created"`
+	Engine             string                 `json:"engine"`
+	IP                 string                 `json:"ip,omitempty"`
+	MAC                string                 `json:"mac,omitempty"`
+	Networks           []internal.NetworkNode `json:"networks,omitempty"`
+	CheckpointSize     CheckpointSize         `json:"checkpoint_size"`
+	CriuDumpStatistics *internal.StatsNode    `json:"statistics,omitempty"`
+	Metadata           *internal.MetadataNode `json:"metadata,omitempty"`
+	ProcessTree        *internal.PsNode       `json:"process_tree,omitempty"`
+	FileDescriptors    []FileDescriptorEntry  `json:"file_descriptors,omitempty"`
+	Sockets            []internal.SkNode      `json:"sockets,omitempty"`
+	Mounts             []internal.MountNode   `json:"mounts,omitempty"`
 }
 
 type CheckpointSize struct {
@@ -257,16 +332,22 @@ type OpenFile struct {
 
 // Diff result structures
 type DiffResult struct {
-	ContainerID    string         `json:"container_id"`
-	ContainerName  string         `json:"container_name"`
-	Image          string         `json:"image"`
-	CheckpointA    CheckpointInfo `json:"checkpoint_a"`
-	CheckpointB    CheckpointInfo `json:"checkpoint_b"`
-	ProcessChanges *ProcessDiff   `json:"process_changes,omitempty"`
-	FileChanges    *FileDiff      `json:"file_changes,omitempty"`
-	MemoryChanges  *MemoryDiff    `json:"memory_changes"`
-	SocketChanges  *SocketDiff    `json:"socket_changes,omitempty"`
-	Summary        string         `json:"summary"`
+	ContainerID       string               `json:"container_id"`
+	ContainerName     string               `json:"container_name"`
+	Image             string               `json:"image"`
+	CheckpointA       CheckpointInfo       `json:"checkpoint_a"`
+	CheckpointB       CheckpointInfo       `json:"checkpoint_b"`
+	ContainerChanges  []ValueChange        `json:"container_changes,omitempty"`
+	AnnotationChanges []ValueChange        `json:"annotation_changes,omitempty"`
+	MountChanges      *MountDiff           `json:"mount_changes,omitempty"`
+	NetworkChanges    []ValueChange        `json:"network_changes,omitempty"`
+	DumpStatistics    *DumpStatsDiff       `json:"dump_statistics,omitempty"`
+	ProcessChanges    *ProcessDiff         `json:"process_changes,omitempty"`
+	FileChanges       *FileDiff            `json:"file_changes,omitempty"`
+	MemoryChanges     *MemoryDiff          `json:"memory_changes"`
+	SocketChanges     *SocketDiff          `json:"socket_changes,omitempty"`
+	RootFsChanges     *internal.RootFsDiff `json:"rootfs_changes,omitempty"`
+	Summary           string               `json:"summary"`
 
 	processTreeB *internal.PsNode
 }
@@ -284,11 +365,27 @@ type ProcessDiff struct {
 }
 
 type ProcessInfo struct {
-	PID     int    `json:"pid"`
-	Command string `json:"command"`
-	Cmdline string `json:"cmdline,omitempty"`
+	PID        int            `json:"pid"`
+	Command    string         `json:"command"`
+	Cmdline    string         `json:"cmdline,omitempty"`
+	EnvChanges []EnvVarChange `json:"environment_changes,omitempty"`
+
+	envVars map[string]string
+}
+
+// ValueChange describes a changed named value, such as an annotation or an
+// environment variable.
+type ValueChange struct {
+	Name   string              `json:"name"`
+	Status internal.DiffStatus `json:"status"`
+	Before string              `json:"before,omitempty"`
+	After  string              `json:"after,omitempty"`
 }
 
+// EnvVarChange describes a changed environment variable of a process. The
+// values of masked environment variables are replaced.
+type EnvVarChange = ValueChange
+
 type FileDiff struct {
 	Added     []FileInfo `json:"added,omitempty"`
 	Removed   []FileInfo `json:"removed,omitempty"`
@@ -302,9 +399,43 @@ type FileInfo struct {
 	FD   string `json:"fd"`
 }
 
+type MountDiff struct {
+	Added     []internal.MountNode `json:"added,omitempty"`
+	Removed   []internal.MountNode `json:"removed,omitempty"`
+	Modified  []MountChange        `json:"modified,omitempty"`
+	Unchanged []internal.MountNode `json:"unchanged,omitempty"`
+}
+
+// MountChange describes a mount at the same destination whose type, source
+// or options changed.
+type MountChange struct {
+	Destination string             `json:"destination"`
+	Before      internal.MountNode `json:"before"`
+	After       internal.MountNode `json:"after"`
+}
+
+// DumpStatsDiff contains the CRIU dump statistics of both checkpoints
+type DumpStatsDiff struct {
+	Before *internal.StatsNode `json:"before"`
+	After  *internal.StatsNode `json:"after"`
+}
+
 type MemoryDiff struct {
-	SizeChangeBytes int64   `json:"size_change_bytes"`
-	SizeChangeMB    float64 `json:"size_change_mb"`
+	SizeChangeBytes int64            `json:"size_change_bytes"`
+	SizeChangeMB    float64          `json:"size_change_mb"`
+	PageChanges     *MemoryPagesDiff `json:"page_changes,omitempty"`
+}
+
+// MemoryPagesDiff describes the changed memory pages of all processes. The
+// changed bytes are the memory a pre-copy migration has to transfer. The
+// changed pages include the unknown pages of lazy restore, whose content is
+// not stored in the checkpoints.
+type MemoryPagesDiff struct {
+	Pages        int                          `json:"pages"`
+	ChangedPages int                          `json:"changed_pages"`
+	UnknownPages int                          `json:"unknown_pages,omitempty"`
+	ChangedBytes uint64                       `json:"changed_bytes"`
+	Processes    []internal.ProcessMemoryDiff `json:"processes,omitempty"`
 }
 
 type SocketDiff struct {
@@ -340,6 +471,20 @@ func computeDiff(metadataA, metadataB CheckpointMetadata) *DiffResult {
 		},
 	}
 
+	// Compare the container configuration
+	result.ContainerChanges = compareValues(containerValues(metadataA), containerValues(metadataB), nil)
+	result.AnnotationChanges = compareValues(annotations(metadataA), annotations(metadataB), nil)
+	result.NetworkChanges = compareValues(networkValues(metadataA), networkValues(metadataB), nil)
+	if len(metadataA.Mounts) > 0 || len(metadataB.Mounts) > 0 {
+		result.MountChanges = compareMounts(metadataA.Mounts, metadataB.Mounts)
+	}
+	if metadataA.CriuDumpStatistics != nil && metadataB.CriuDumpStatistics != nil {
+		result.DumpStatistics = &DumpStatsDiff{
+			Before: metadataA.CriuDumpStatistics,
+			After:  metadataB.CriuDumpStatistics,
+		}
+	}
+
 	// Compare processes
 	result.ProcessChanges = compareProcessTrees(metadataA.ProcessTree, metadataB.ProcessTree)
 	result.processTreeB = metadataB.ProcessTree
@@ -361,12 +506,20 @@ func computeDiff(metadataA, metadataB CheckpointMetadata) *DiffResult {
 		SizeChangeMB:    float64(sizeChange) / 1024 / 1024,
 	}
 
-	// Generate summary
-	result.Summary = generateSummary(result)
-
 	return result
 }
 
+func summarizeMemoryPages(processes []internal.ProcessMemoryDiff) *MemoryPagesDiff {
+	diff := &MemoryPagesDiff{Processes: processes}
+	for _, process := range processes {
+		diff.Pages += process.Pages
+		diff.ChangedPages += process.ChangedPages
+		diff.UnknownPages += process.UnknownPages
+		diff.ChangedBytes += process.ChangedBytes
+	}
+	return diff
+}
+
 func compareProcessTrees(treeA, treeB *internal.PsNode) *ProcessDiff {
 	diff := &ProcessDiff{}
 
@@ -389,7 +542,8 @@ func compareProcessTrees(treeA, treeB *internal.PsNode) *ProcessDiff {
 	for pid, procB := range mapB {
 		if procA, exists := mapA[pid]; !exists {
 			diff.Added = append(diff.Added, procB)
-		} else if *psTreeCmd && procA.Cmdline != procB.Cmdline {
+		} else if envChanges := compareEnvVars(procA.envVars, procB.envVars); (*psTreeCmd && procA.Cmdline != procB.Cmdline) || len(envChanges) > 0 {
+			procB.EnvChanges = envChanges
 			diff.Modified = append(diff.Modified, procB)
 		} else {
 			diff.Unchanged = append(diff.Unchanged, procB)
@@ -425,6 +579,9 @@ func flattenProcessTree(tree *internal.PsNode) []ProcessInfo {
 		if *psTreeCmd {
 			proc.Cmdline = node.Cmdline
 		}
+		if *psTreeEnv {
+			proc.envVars = node.EnvVars
+		}
 		processes = append(processes, proc)
 
 		for i := range node.Children {
@@ -436,6 +593,154 @@ func flattenProcessTree(tree *internal.PsNode) []ProcessInfo {
 	return processes
 }
 
+// compareEnvVars returns the changed environment variables sorted by name.
+func compareEnvVars(envA, envB map[string]string) []EnvVarChange {
+	return compareValues(envA, envB, internal.MaskEnvValue)
+}
+
+// compareValues returns the changed values sorted by name. The values are
+// passed through mask if it is not nil.
+func compareValues(valuesA, valuesB map[string]string, mask func(name, value string) string) []ValueChange {
+	if mask == nil {
+		mask = func(_, value string) string { return value }
+	}
+	var changes []ValueChange
+	for name, after := range valuesB {
+		before, exists := valuesA[name]
+		switch {
+		case !exists:
+			changes = append(changes, ValueChange{Name: name, Status: internal.Added, After: mask(name, after)})
+		case before != after:
+			changes = append(changes, ValueChange{
+				Name:   name,
+				Status: internal.Modified,
+				Before: mask(name, before),
+				After:  mask(name, after),
+			})
+		}
+	}
+	for name, before := range valuesA {
+		if _, exists := valuesB[name]; !exists {
+			changes = append(changes, ValueChange{Name: name, Status: internal.Removed, Before: mask(name, before)})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Name < changes[j].Name })
+	return changes
+}
+
+// containerValues returns the image and the runtime of a container.
+func containerValues(m CheckpointMetadata) map[string]string {
+	values := make(map[string]string)
+	if m.Image != "" {
+		values["image"] = m.Image
+	}
+	if m.Runtime != "" {
+		values["runtime"] = m.Runtime
+	}
+	return values
+}
+
+func annotations(m CheckpointMetadata) map[string]string {
+	if m.Metadata == nil {
+		return nil
+	}
+	return m.Metadata.Annotations
+}
+
+// networkValues returns the addresses of every network interface of a
+// container, or its IP and MAC address if the networks are not known.
+func networkValues(m CheckpointMetadata) map[string]string {
+	values := make(map[string]string)
+	if len(m.Networks) == 0 {
+		if m.IP != "" {
+			values["ip"] = m.IP
+		}
+		if m.MAC != "" {
+			values["mac"] = m.MAC
+		}
+		return values
+	}
+	for _, network := range m.Networks {
+		for name, iface := range network.Interfaces {
+			var addresses []string
+			if iface.IP != "" {
+				addresses = append(addresses, "ip "+iface.IP)
+			}
+			if iface.MAC != "" {
+				addresses = append(addresses, "mac "+iface.MAC)
+			}
+			if iface.Gateway != "" {
+				addresses = append(addresses, "gateway "+iface.Gateway)
+			}
+			values[network.Name+"/"+name] = strings.Join(addresses, ", ")
+		}
+	}
+	return values
+}
+
+// compareMounts compares mounts by their destination. A mount is modified
+// if its type, source or options changed; the order of the options is not
+// compared. Mounts stacked on the same destination are matched in order.
+func compareMounts(mountsA, mountsB []internal.MountNode) *MountDiff {
+	diff := &MountDiff{}
+
+	keys := func(mounts []internal.MountNode) []string {
+		result := make([]string, len(mounts))
+		count := make(map[string]int)
+		for i, m := range mounts {
+			result[i] = fmt.Sprintf("%s\x00%d", m.Destination, count[m.Destination])
+			count[m.Destination]++
+		}
+		return result
+	}
+	keysA, keysB := keys(mountsA), keys(mountsB)
+	indexA := make(map[string]internal.MountNode)
+	for i, m := range mountsA {
+		indexA[keysA[i]] = m
+	}
+	setB := make(map[string]bool)
+	for _, key := range keysB {
+		setB[key] = true
+	}
+
+	for i, m := range mountsB {
+		previous, exists := indexA[keysB[i]]
+		switch {
+		case !exists:
+			diff.Added = append(diff.Added, m)
+		case previous.Type != m.Type || previous.Source != m.Source || !equalMountOptions(previous.Options, m.Options):
+			diff.Modified = append(diff.Modified, MountChange{Destination: m.Destination, Before: previous, After: m})
+		default:
+			diff.Unchanged = append(diff.Unchanged, m)
+		}
+	}
+	for i, m := range mountsA {
+		if !setB[keysA[i]] {
+			diff.Removed = append(diff.Removed, m)
+		}
+	}
+
+	return diff
+}
+
+// equalMountOptions reports whether two lists of mount options contain the
+// same options.
+func equalMountOptions(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	sortedA := append([]string(nil), a...)
+	sortedB := append([]string(nil), b...)
+	sort.Strings(sortedA)
+	sort.Strings(sortedB)
+	for i := range sortedA {
+		if sortedA[i] != sortedB[i] {
+			return false
+		}
+	}
+	return true
+}
+
 func compareFileDescriptors(fdsA, fdsB []FileDescriptorEntry) *FileDiff {
 	diff := &FileDiff{}
 
@@ -564,6 +869,30 @@ func compareSockets(sksA, sksB []internal.SkNode) *SocketDiff {
 func generateSummary(result *DiffResult) string {
 	summary := fmt.Sprintf("Checkpoint comparison for container %s", result.ContainerName)
 
+	for _, section := range []struct {
+		name    string
+		changes []ValueChange
+	}{
+		{"Container", result.ContainerChanges},
+		{"Annotations", result.AnnotationChanges},
+		{"Networks", result.NetworkChanges},
+	} {
+		if len(section.changes) > 0 {
+			added, removed, modified := countValueChanges(section.changes)
+			summary += fmt.Sprintf("\n%s: +%d -%d ~%d", section.name, added, removed, modified)
+		}
+	}
+
+	if result.MountChanges != nil {
+		added := len(result.MountChanges.Added)
+		removed := len(result.MountChanges.Removed)
+		modified := len(result.MountChanges.Modified)
+
+		if added > 0 || removed > 0 || modified > 0 {
+			summary += fmt.Sprintf("\nMounts: +%d -%d ~%d", added, removed, modified)
+		}
+	}
+
 	if result.ProcessChanges != nil {
 		added := len(result.ProcessChanges.Added)
 		removed := len(result.ProcessChanges.Removed)
@@ -592,13 +921,48 @@ func generateSummary(result *DiffResult) string {
 		}
 	}
 
+	if result.RootFsChanges != nil {
+		added := len(result.RootFsChanges.Added)
+		removed := len(result.RootFsChanges.Removed)
+		modified := len(result.RootFsChanges.Modified)
+
+		if added > 0 || removed > 0 || modified > 0 {
+			summary += fmt.Sprintf("\nRoot file system: +%d -%d ~%d (%s)", added, removed, modified, formatSizeChange(result.RootFsChanges.SizeChange))
+		}
+		if deleted := result.RootFsChanges.DeletedFiles; deleted != nil {
+			summary += fmt.Sprintf("\nDeleted files: +%d -%d", len(deleted.Added), len(deleted.Removed))
+		}
+	}
+
 	if result.MemoryChanges != nil && result.MemoryChanges.SizeChangeBytes != 0 {
 		summary += fmt.Sprintf("\nMemory: %+.2f MB", result.MemoryChanges.SizeChangeMB)
 	}
 
+	if result.MemoryChanges != nil && result.MemoryChanges.PageChanges != nil && result.MemoryChanges.PageChanges.ChangedPages > 0 {
+		pages := result.MemoryChanges.PageChanges
+		summary += fmt.Sprintf("\nChanged memory pages: %d of %d (%s)", pages.ChangedPages, pages.Pages, metadata.ByteToString(int64(pages.ChangedBytes)))
+		if pages.UnknownPages > 0 {
+			summary += fmt.Sprintf(", %d with unknown content", pages.UnknownPages)
+		}
+	}
+
 	return summary
 }
 
+func countValueChanges(changes []ValueChange) (added, removed, modified int) {
+	for _, change := range changes {
+		switch change.Status {
+		case internal.Added:
+			added++
+		case internal.Removed:
+			removed++
+		default:
+			modified++
+		}
+	}
+	return added, removed, modified
+}
+
 func renderTreeDiff(result *DiffResult) {
 	fmt.Printf("╔════════════════════════════════════════════════════════════════╗\n")
 	fmt.Printf("║ Checkpoint Diff                                                ║\n")
@@ -617,6 +981,62 @@ func renderTreeDiff(result *DiffResult) {
 	fmt.Printf("  Created: %s\n", result.CheckpointB.Created)
 	fmt.Printf("  Size:    %d bytes\n\n", result.CheckpointB.TotalSize)
 
+	// Container configuration changes
+	if len(result.ContainerChanges) > 0 {
+		fmt.Println("┌─ Container Changes ──────────────────────────────────────────┐")
+		renderValueChanges(result.ContainerChanges)
+		fmt.Println("└──────────────────────────────────────────────────────────────┘")
+	}
+
+	if len(result.AnnotationChanges) > 0 {
+		fmt.Println("┌─ Annotation Changes ─────────────────────────────────────────┐")
+		renderValueChanges(result.AnnotationChanges)
+		fmt.Println("└──────────────────────────────────────────────────────────────┘")
+	}
+
+	if result.MountChanges != nil {
+		hasChanges := len(result.MountChanges.Added) > 0 || len(result.MountChanges.Removed) > 0 || len(result.MountChanges.Modified) > 0
+		if hasChanges || *showUnchanged {
+			fmt.Println("┌─ Mount Changes ──────────────────────────────────────────────┐")
+			for _, mount := range result.MountChanges.Added {
+				fmt.Printf("│   + %-30s %-8s %s\n", truncate(mount.Destination, 30), mount.Type, truncate(mount.Source, 20))
+			}
+			for _, mount := range result.MountChanges.Removed {
+				fmt.Printf("│   - %-30s %-8s %s\n", truncate(mount.Destination, 30), mount.Type, truncate(mount.Source, 20))
+			}
+			for _, change := range result.MountChanges.Modified {
+				fmt.Printf("│   ~ %-30s %-8s %s\n", truncate(change.Destination, 30), change.After.Type, truncate(change.After.Source, 20))
+				for _, line := range mountChangeLines(change) {
+					fmt.Printf("│       %s\n", truncate(line, 55))
+				}
+			}
+			if *showUnchanged {
+				for _, mount := range result.MountChanges.Unchanged {
+					fmt.Printf("│   = %-30s %-8s %s\n", truncate(mount.Destination, 30), mount.Type, truncate(mount.Source, 20))
+				}
+			}
+			fmt.Println("└──────────────────────────────────────────────────────────────┘")
+		}
+	}
+
+	if len(result.NetworkChanges) > 0 {
+		fmt.Println("┌─ Network Changes ────────────────────────────────────────────┐")
+		renderValueChanges(result.NetworkChanges)
+		fmt.Println("└──────────────────────────────────────────────────────────────┘")
+	}
+
+	if result.DumpStatistics != nil {
+		before, after := result.DumpStatistics.Before, result.DumpStatistics.After
+		fmt.Println("┌─ CRIU Dump Statistics ───────────────────────────────────────┐")
+		fmt.Printf("│ Freezing time: %s → %s\n", internal.FormatTime(before.FreezingTime), internal.FormatTime(after.FreezingTime))
+		fmt.Printf("│ Frozen time:   %s → %s\n", internal.FormatTime(before.FrozenTime), internal.FormatTime(after.FrozenTime))
+		fmt.Printf("│ Memdump time:  %s → %s\n", internal.FormatTime(before.MemdumpTime), internal.FormatTime(after.MemdumpTime))
+		fmt.Printf("│ Memwrite time: %s → %s\n", internal.FormatTime(before.MemwriteTime), internal.FormatTime(after.MemwriteTime))
+		fmt.Printf("│ Pages scanned: %d → %d (%+d)\n", before.PagesScanned, after.PagesScanned, int64(after.PagesScanned)-int64(before.PagesScanned))
+		fmt.Printf("│ Pages written: %d → %d (%+d)\n", before.PagesWritten, after.PagesWritten, int64(after.PagesWritten)-int64(before.PagesWritten))
+		fmt.Println("└──────────────────────────────────────────────────────────────┘")
+	}
+
 	// Memory changes
 	if result.MemoryChanges != nil {
 		fmt.Println("┌─ Memory Changes ─────────────────────────────────────────────┐")
@@ -627,6 +1047,9 @@ func renderTreeDiff(result *DiffResult) {
 		} else {
 			fmt.Println("│ = No change")
 		}
+		if result.MemoryChanges.PageChanges != nil {
+			renderMemoryPagesDiff(result.MemoryChanges.PageChanges)
+		}
 		fmt.Println("└──────────────────────────────────────────────────────────────┘")
 	}
 
@@ -674,6 +1097,9 @@ func renderTreeDiff(result *DiffResult) {
 				fmt.Println("│ Modified:")
 				for _, proc := range result.ProcessChanges.Modified {
 					fmt.Printf("│   ~ PID %-5d %s\n", proc.PID, proc.Command)
+					for _, change := range proc.EnvChanges {
+						fmt.Printf("│             %s\n", truncate(formatValueChange(change), 55))
+					}
 				}
 			}
 		}
@@ -742,11 +1168,126 @@ func renderTreeDiff(result *DiffResult) {
 		fmt.Println("└───────────────────────────────────────────────────────────────────────┘")
 	}
 
+	// Root file system changes
+	if result.RootFsChanges != nil {
+		fmt.Println("┌─ Root File System Changes ───────────────────────────────────┐")
+		renderRootFsDiff(result.RootFsChanges)
+		fmt.Println("└──────────────────────────────────────────────────────────────┘")
+	}
+
 	// Summary
 	fmt.Println("Summary:")
 	fmt.Println(result.Summary)
 }
 
+func renderMemoryPagesDiff(diff *MemoryPagesDiff) {
+	fmt.Printf("│ Changed pages: %d of %d (%s)%s\n",
+		diff.ChangedPages, diff.Pages, metadata.ByteToString(int64(diff.ChangedBytes)), unknownPagesNote(diff.UnknownPages))
+	for _, process := range diff.Processes {
+		if process.Status == internal.Unchanged && !*showUnchanged {
+			continue
+		}
+		fmt.Printf("│   %s PID %-5d %s: %d of %d pages changed%s\n",
+			diffStatusMarker(process.Status), process.PID, truncate(process.Exe, 30), process.ChangedPages, process.Pages,
+			unknownPagesNote(process.UnknownPages))
+		for _, mapping := range process.Mappings {
+			if mapping.Status == internal.Unchanged && mapping.ChangedPages == 0 && !*showUnchanged {
+				continue
+			}
+			line := fmt.Sprintf("%s-%s %s", mapping.Start, mapping.End, mapping.Protection)
+			if mapping.Resource != "" {
+				line += " " + truncate(mapping.Resource, 30)
+			}
+			if mapping.Status == internal.Modified && mapping.SizeBefore != mapping.SizeAfter {
+				line += fmt.Sprintf(": %s → %s", metadata.ByteToString(int64(mapping.SizeBefore)), metadata.ByteToString(int64(mapping.SizeAfter)))
+			}
+			// Removed mappings have no pages in checkpoint B
+			if mapping.Status != internal.Removed {
+				line += fmt.Sprintf(", %d of %d pages changed", mapping.ChangedPages, mapping.Pages) + unknownPagesNote(mapping.UnknownPages)
+			}
+			fmt.Printf("│       %s %s\n", diffStatusMarker(mapping.Status), line)
+		}
+	}
+}
+
+// unknownPagesNote returns the note which is appended to the number of
+// changed pages if some of them have unknown content.
+func unknownPagesNote(unknown int) string {
+	if unknown == 0 {
+		return ""
+	}
+	return fmt.Sprintf(" (%d with unknown content)", unknown)
+}
+
+// diffStatusMarker returns the marker character of a status as used in the
+// process tree.
+func diffStatusMarker(status internal.DiffStatus) string {
+	switch status {
+	case internal.Added:
+		return "+"
+	case internal.Removed:
+		return "-"
+	case internal.Modified:
+		return "~"
+	default:
+		return "="
+	}
+}
+
+func renderRootFsDiff(diff *internal.RootFsDiff) {
+	hasChanges := len(diff.Added)+len(diff.Removed)+len(diff.Modified) > 0
+	if !hasChanges && diff.DeletedFiles == nil && !*showUnchanged {
+		fmt.Println("│ = No change")
+		return
+	}
+
+	for _, change := range diff.Added {
+		fmt.Printf("│   + %-40s %s\n", truncate(change.Path, 40), formatRootFsSize(change.Type, change.SizeAfter))
+	}
+	for _, change := range diff.Removed {
+		fmt.Printf("│   - %-40s %s\n", truncate(change.Path, 40), formatRootFsSize(change.Type, change.SizeBefore))
+	}
+	for _, change := range diff.Modified {
+		size := formatRootFsSize(change.Type, change.SizeAfter)
+		if change.SizeAfter != change.SizeBefore {
+			size += fmt.Sprintf(" (%s)", formatSizeChange(change.SizeAfter-change.SizeBefore))
+		}
+		fmt.Printf("│   ~ %-40s %s\n", truncate(change.Path, 40), size)
+	}
+	if *showUnchanged {
+		for _, change := range diff.Unchanged {
+			fmt.Printf("│   = %-40s %s\n", truncate(change.Path, 40), formatRootFsSize(change.Type, change.SizeAfter))
+		}
+	}
+
+	if diff.DeletedFiles != nil {
+		fmt.Println("│ Deleted files:")
+		for _, path := range diff.DeletedFiles.Added {
+			fmt.Printf("│   + %s\n", truncate(path, 57))
+		}
+		for _, path := range diff.DeletedFiles.Removed {
+			fmt.Printf("│   - %s\n", truncate(path, 57))
+		}
+	}
+}
+
+// formatRootFsSize returns the size of regular files and the type of other
+// files.
+func formatRootFsSize(fileType string, size int64) string {
+	if fileType != "file" {
+		return fileType
+	}
+	return metadata.ByteToString(size)
+}
+
+// formatSizeChange returns a size difference with its sign.
+func formatSizeChange(change int64) string {
+	if change < 0 {
+		return "-" + metadata.ByteToString(-change)
+	}
+	return "+" + metadata.ByteToString(change)
+}
+
 func renderJSONDiff(result *DiffResult) error {
 	encoder := json.NewEncoder(os.Stdout)
 	encoder.SetIndent("", "  ")
@@ -777,6 +1318,38 @@ func formatSocketColumns(socket SocketInfo) (state, local, peer string) {
 	return
 }
 
+// mountChangeLines describes the changed properties of a mount.
+func mountChangeLines(change MountChange) []string {
+	var lines []string
+	if change.Before.Type != change.After.Type {
+		lines = append(lines, fmt.Sprintf("type: %s → %s", change.Before.Type, change.After.Type))
+	}
+	if change.Before.Source != change.After.Source {
+		lines = append(lines, fmt.Sprintf("source: %s → %s", change.Before.Source, change.After.Source))
+	}
+	if !equalMountOptions(change.Before.Options, change.After.Options) {
+		lines = append(lines, fmt.Sprintf("options: %s → %s", strings.Join(change.Before.Options, ","), strings.Join(change.After.Options, ",")))
+	}
+	return lines
+}
+
+func renderValueChanges(changes []ValueChange) {
+	for _, change := range changes {
+		fmt.Printf("│   %s\n", truncate(formatValueChange(change), 59))
+	}
+}
+
+func formatValueChange(change ValueChange) string {
+	switch change.Status {
+	case internal.Added:
+		return fmt.Sprintf("+ %s=%s", change.Name, change.After)
+	case internal.Removed:
+		return fmt.Sprintf("- %s=%s", change.Name, change.Before)
+	default:
+		return fmt.Sprintf("~ %s=%s → %s", change.Name, change.Before, change.After)
+	}
+}
+
 func truncate(s string, maxLen int) string {
 	if len(s) <= maxLen {
 		return s
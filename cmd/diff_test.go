@@ -3,6 +3,7 @@
 package cmd
 
 import (
+	"reflect"
 	"testing"
 
 	"github.com/checkpoint-restore/checkpointctl/internal"
@@ -271,6 +272,29 @@ func TestGenerateSummaryWithSocketChanges(t *testing.T) {
 	}
 }
 
+// summary generation with changed memory pages
+func TestGenerateSummaryWithMemoryPageChanges(t *testing.T) {
+	result := &DiffResult{
+		ContainerName: "test-container",
+		MemoryChanges: &MemoryDiff{
+			PageChanges: summarizeMemoryPages([]internal.ProcessMemoryDiff{
+				{PID: 1, Status: internal.Modified, Pages: 10, ChangedPages: 2, UnknownPages: 1, ChangedBytes: 8192},
+				{PID: 2, Status: internal.Added, Pages: 3, ChangedPages: 3, ChangedBytes: 12288},
+			}),
+		},
+	}
+
+	pages := result.MemoryChanges.PageChanges
+	if pages.Pages != 13 || pages.ChangedPages != 5 || pages.UnknownPages != 1 || pages.ChangedBytes != 20480 {
+		t.Errorf("Unexpected memory page changes %+v", pages)
+	}
+
+	summary := generateSummary(result)
+	if !contains(summary, "Changed memory pages: 5 of 13 (20.0 KiB), 1 with unknown content") {
+		t.Errorf("Expected summary to contain the changed memory pages, got '%s'", summary)
+	}
+}
+
 // tests sockets with missing/empty field values
 func TestCompareSocketsWithEmptyFields(t *testing.T) {
 	socketA := internal.SkNode{
@@ -443,6 +467,43 @@ func TestCompareProcessTreesCmdlineIgnoredByDefault(t *testing.T) {
 	}
 }
 
+// environment changes with --ps-tree-env are masked
+func TestCompareProcessTreesModifiedEnv(t *testing.T) {
+	prevEnv, prevMask := internal.PsTreeEnv, internal.MaskEnvVars
+	internal.PsTreeEnv = true
+	internal.MaskEnvVars = []string{"db_*"}
+	defer func() { internal.PsTreeEnv, internal.MaskEnvVars = prevEnv, prevMask }()
+
+	treeA := &internal.PsNode{PID: 1, Comm: "server", EnvVars: map[string]string{
+		"API_TOKEN": "old", "DB_HOST": "db1", "LANG": "C", "MODE": "debug",
+	}}
+	treeB := &internal.PsNode{PID: 1, Comm: "server", EnvVars: map[string]string{
+		"API_TOKEN": "new", "DB_HOST": "db2", "LANG": "C", "PORT": "443",
+	}}
+
+	result := compareProcessTrees(treeA, treeB)
+
+	if len(result.Modified) != 1 {
+		t.Fatalf("Expected 1 modified process, got %+v", result.Modified)
+	}
+	expected := []EnvVarChange{
+		{Name: "API_TOKEN", Status: internal.Modified, Before: "********", After: "********"},
+		{Name: "DB_HOST", Status: internal.Modified, Before: "********", After: "********"},
+		{Name: "MODE", Status: internal.Removed, Before: "debug"},
+		{Name: "PORT", Status: internal.Added, After: "443"},
+	}
+	if !reflect.DeepEqual(result.Modified[0].EnvChanges, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, result.Modified[0].EnvChanges)
+	}
+
+	internal.ShowSecrets = true
+	defer func() { internal.ShowSecrets = false }()
+	result = compareProcessTrees(treeA, treeB)
+	if change := result.Modified[0].EnvChanges[0]; change.Before != "old" || change.After != "new" {
+		t.Errorf("Expected unmasked values with --show-secrets, got %+v", change)
+	}
+}
+
 // flattening a nested tree visits every node
 func TestFlattenProcessTreeNested(t *testing.T) {
 	tree := &internal.PsNode{
@@ -542,3 +603,142 @@ func TestRenderAnnotatedProcessTreeUnknownPID(t *testing.T) {
 		t.Errorf("Expected blank marker for unknown PID, got:\n%s", out)
 	}
 }
+
+func TestCompareMounts(t *testing.T) {
+	mountsA := []internal.MountNode{
+		{Destination: "/proc", Type: "proc", Source: "proc", Options: []string{"nosuid", "noexec"}},
+		{Destination: "/data", Type: "bind", Source: "/srv/old"},
+		{Destination: "/etc/hosts", Type: "bind", Source: "/run/hosts", Options: []string{"rbind", "ro", "rprivate"}},
+		{Destination: "/run", Type: "tmpfs", Source: "tmpfs"},
+	}
+	mountsB := []internal.MountNode{
+		{Destination: "/proc", Type: "proc", Source: "proc", Options: []string{"noexec", "nosuid"}},
+		{Destination: "/data", Type: "bind", Source: "/srv/new"},
+		{Destination: "/etc/hosts", Type: "bind", Source: "/run/hosts", Options: []string{"rbind", "rw", "rshared"}},
+		{Destination: "/tmp", Type: "tmpfs", Source: "tmpfs"},
+	}
+
+	// The order of the options is not compared
+	result := compareMounts(mountsA, mountsB)
+	expected := &MountDiff{
+		Added:   mountsB[3:],
+		Removed: mountsA[3:],
+		Modified: []MountChange{
+			{Destination: "/data", Before: mountsA[1], After: mountsB[1]},
+			{Destination: "/etc/hosts", Before: mountsA[2], After: mountsB[2]},
+		},
+		Unchanged: mountsB[:1],
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, result)
+	}
+
+	expectedLines := [][]string{
+		{"source: /srv/old → /srv/new"},
+		{"options: rbind,ro,rprivate → rbind,rw,rshared"},
+	}
+	for i, change := range result.Modified {
+		if lines := mountChangeLines(change); !reflect.DeepEqual(lines, expectedLines[i]) {
+			t.Errorf("Expected %v, got %v", expectedLines[i], lines)
+		}
+	}
+
+	summary := generateSummary(&DiffResult{MountChanges: result})
+	if !contains(summary, "Mounts: +1 -1 ~2") {
+		t.Errorf("Expected summary to contain the mount changes, got '%s'", summary)
+	}
+}
+
+func TestComputeDiffContainerChanges(t *testing.T) {
+	metadataA := CheckpointMetadata{
+		ID:      "abc",
+		Image:   "docker.io/library/nginx:1.26",
+		Runtime: "runc",
+		Metadata: &internal.MetadataNode{Annotations: map[string]string{
+			"io.container.manager": "libpod",
+			"version":              "1",
+		}},
+		Networks: []internal.NetworkNode{
+			{Name: "podman", Interfaces: map[string]internal.NetworkInterfaceNode{
+				"eth0": {IP: "10.88.0.2", MAC: "aa:bb:cc:dd:ee:01"},
+			}},
+		},
+		CriuDumpStatistics: &internal.StatsNode{FrozenTime: 1000, PagesWritten: 10},
+	}
+	metadataB := CheckpointMetadata{
+		ID:      "abc",
+		Image:   "docker.io/library/nginx:1.27",
+		Runtime: "runc",
+		Metadata: &internal.MetadataNode{Annotations: map[string]string{
+			"io.container.manager": "libpod",
+			"restored":             "true",
+		}},
+		Networks: []internal.NetworkNode{
+			{Name: "podman", Interfaces: map[string]internal.NetworkInterfaceNode{
+				"eth0": {IP: "10.88.0.3", MAC: "aa:bb:cc:dd:ee:01"},
+			}},
+		},
+		CriuDumpStatistics: &internal.StatsNode{FrozenTime: 2000, PagesWritten: 12},
+	}
+
+	result := computeDiff(metadataA, metadataB)
+
+	expectedContainer := []ValueChange{
+		{Name: "image", Status: internal.Modified, Before: "docker.io/library/nginx:1.26", After: "docker.io/library/nginx:1.27"},
+	}
+	if !reflect.DeepEqual(result.ContainerChanges, expectedContainer) {
+		t.Errorf("Expected %+v, got %+v", expectedContainer, result.ContainerChanges)
+	}
+	expectedAnnotations := []ValueChange{
+		{Name: "restored", Status: internal.Added, After: "true"},
+		{Name: "version", Status: internal.Removed, Before: "1"},
+	}
+	if !reflect.DeepEqual(result.AnnotationChanges, expectedAnnotations) {
+		t.Errorf("Expected %+v, got %+v", expectedAnnotations, result.AnnotationChanges)
+	}
+	expectedNetworks := []ValueChange{{
+		Name:   "podman/eth0",
+		Status: internal.Modified,
+		Before: "ip 10.88.0.2, mac aa:bb:cc:dd:ee:01",
+		After:  "ip 10.88.0.3, mac aa:bb:cc:dd:ee:01",
+	}}
+	if !reflect.DeepEqual(result.NetworkChanges, expectedNetworks) {
+		t.Errorf("Expected %+v, got %+v", expectedNetworks, result.NetworkChanges)
+	}
+	if result.DumpStatistics == nil || result.DumpStatistics.After.FrozenTime != 2000 {
+		t.Errorf("Unexpected dump statistics %+v", result.DumpStatistics)
+	}
+	if result.MountChanges != nil {
+		t.Errorf("Expected no mount changes without mounts, got %+v", result.MountChanges)
+	}
+
+	summary := generateSummary(result)
+	for _, expected := range []string{"Container: +0 -0 ~1", "Annotations: +1 -1 ~0", "Networks: +0 -0 ~1"} {
+		if !contains(summary, expected) {
+			t.Errorf("Expected summary to contain '%s', got '%s'", expected, summary)
+		}
+	}
+}
+
+func TestGenerateSummaryWithRootFsChanges(t *testing.T) {
+	result := &DiffResult{
+		ContainerName: "test-container",
+		RootFsChanges: &internal.RootFsDiff{
+			Added:        []internal.RootFsChange{{Path: "/var/log/app.log", Type: "file", Status: internal.Added, SizeAfter: 4096}},
+			Modified:     []internal.RootFsChange{{Path: "/etc/app.conf", Type: "file", Status: internal.Modified, SizeBefore: 10, SizeAfter: 8}},
+			DeletedFiles: &internal.DeletedFilesDiff{Removed: []string{"/etc/motd"}},
+			SizeChange:   4094,
+		},
+	}
+
+	summary := generateSummary(result)
+	for _, expected := range []string{"Root file system: +1 -0 ~1 (+4.0 KiB)", "Deleted files: +0 -1"} {
+		if !contains(summary, expected) {
+			t.Errorf("Expected summary to contain '%s', got '%s'", expected, summary)
+		}
+	}
+
+	if change := formatSizeChange(-2048); change != "-2.0 KiB" {
+		t.Errorf("Expected -2.0 KiB, got %s", change)
+	}
+}
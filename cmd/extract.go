@@ -0,0 +1,103 @@
+// SPDX-License-Identifier: Apache-2.0
+
+// This file is used to recover files stored in container checkpoints
+
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/checkpoint-restore/checkpointctl/internal"
+	metadata "github.com/checkpoint-restore/checkpointctl/lib"
+	"github.com/spf13/cobra"
+)
+
+func Extract() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "extract <checkpoint-path>",
+		Short: "Extract files and shared memory stored in a container checkpoint",
+		Long: `The 'extract' command recovers files and shared memory stored in a container checkpoint.
+Files which were deleted while still open are stored as ghost files and
+can be listed with 'checkpointctl inspect --ghost-files'. The contents of
+memfds and shared anonymous memory can be listed with
+'checkpointctl inspect --shmem'.
+Example:
+  checkpointctl extract checkpoint.tar --ghost-file 1 -o app.log
+  checkpointctl extract checkpoint.tar --shmem 12345 -o shmem.bin`,
+		RunE: extract,
+		Args: cobra.ExactArgs(1),
+	}
+
+	flags := cmd.Flags()
+
+	flags.Uint32Var(
+		ghostFileID,
+		"ghost-file",
+		0,
+		"Specify the ID of a ghost file to extract",
+	)
+	flags.Uint64Var(
+		shmemID,
+		"shmem",
+		0,
+		"Specify the ID of a memfd or shared anonymous memory to extract",
+	)
+	flags.StringVarP(
+		outputFilePath,
+		"output",
+		"o",
+		"",
+		"Specify the output file to be written to",
+	)
+
+	return cmd
+}
+
+func extract(cmd *cobra.Command, args []string) error {
+	extractGhostFile := cmd.Flags().Changed("ghost-file")
+	extractShmem := cmd.Flags().Changed("shmem")
+	if extractGhostFile == extractShmem {
+		return fmt.Errorf("please specify what to extract with either --ghost-file or --shmem")
+	}
+	if *outputFilePath == "" {
+		return fmt.Errorf("please specify the output file with --output")
+	}
+
+	requiredFiles := []string{metadata.SpecDumpFile, metadata.ConfigDumpFile}
+	if extractGhostFile {
+		requiredFiles = append(
+			requiredFiles,
+			filepath.Join(metadata.CheckpointDirectory, fmt.Sprintf("ghost-file-%x.img", *ghostFileID)),
+		)
+	} else {
+		requiredFiles = append(
+			requiredFiles,
+			filepath.Join(metadata.CheckpointDirectory, "memfd.img"),
+			filepath.Join(metadata.CheckpointDirectory, "mm-"),
+			filepath.Join(metadata.CheckpointDirectory, fmt.Sprintf("pagemap-shmem-%d.img", *shmemID)),
+			filepath.Join(metadata.CheckpointDirectory, "pages-"),
+		)
+	}
+
+	tasks, err := internal.CreateTasks(args, requiredFiles)
+	if err != nil {
+		return err
+	}
+	defer internal.CleanupTasks(tasks)
+
+	if extractGhostFile {
+		if err := internal.ExtractGhostFile(tasks[0].OutputDir, *ghostFileID, *outputFilePath); err != nil {
+			return fmt.Errorf("failed to extract ghost file: %w", err)
+		}
+		fmt.Printf("Wrote ghost file %d from checkpoint: %s to file: %s\n", *ghostFileID, tasks[0].CheckpointFilePath, *outputFilePath)
+		return nil
+	}
+
+	if err := internal.ExtractShmem(tasks[0].OutputDir, *shmemID, *outputFilePath); err != nil {
+		return fmt.Errorf("failed to extract shared memory: %w", err)
+	}
+	fmt.Printf("Wrote shared memory %d from checkpoint: %s to file: %s\n", *shmemID, tasks[0].CheckpointFilePath, *outputFilePath)
+
+	return nil
+}
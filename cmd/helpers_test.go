@@ -0,0 +1,59 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"archive/tar"
+	"encoding/binary"
+	"os"
+	"testing"
+
+	ipc_desc "github.com/checkpoint-restore/go-criu/v8/crit/images/ipc-desc"
+	ipc_shm "github.com/checkpoint-restore/go-criu/v8/crit/images/ipc-shm"
+	"github.com/checkpoint-restore/go-criu/v8/magic"
+	"google.golang.org/protobuf/proto"
+)
+
+// writeIpcShmArchive writes a checkpoint archive with an IPC namespace
+// containing a shared memory segment with the ID 0 and the given contents.
+func writeIpcShmArchive(t *testing.T, path string, contents []byte) {
+	t.Helper()
+	magicMap := magic.LoadMagic()
+	var img []byte
+	img = binary.LittleEndian.AppendUint32(img, uint32(magicMap.ByName["IMG_COMMON"]))
+	img = binary.LittleEndian.AppendUint32(img, uint32(magicMap.ByName["IPCNS_SHM"]))
+	entry, err := proto.Marshal(&ipc_shm.IpcShmEntry{
+		Desc: &ipc_desc.IpcDescEntry{
+			Key: proto.Uint32(0), Uid: proto.Uint32(0), Gid: proto.Uint32(0),
+			Cuid: proto.Uint32(0), Cgid: proto.Uint32(0), Mode: proto.Uint32(0o600),
+			Id: proto.Uint32(0),
+		},
+		Size: proto.Uint64(uint64(len(contents))),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	img = binary.LittleEndian.AppendUint32(img, uint32(len(entry)))
+	img = append(img, entry...)
+	img = append(img, contents...)
+	img = append(img, make([]byte, (4-len(contents)%4)%4)...)
+
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	tw := tar.NewWriter(f)
+	if err := tw.WriteHeader(&tar.Header{Name: "checkpoint/", Typeflag: tar.TypeDir, Mode: 0o755}); err != nil {
+		t.Fatal(err)
+	}
+	if err := tw.WriteHeader(&tar.Header{Name: "checkpoint/ipcns-shm-1.img", Mode: 0o600, Size: int64(len(img))}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tw.Write(img); err != nil {
+		t.Fatal(err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
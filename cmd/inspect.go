@@ -30,6 +30,12 @@ func Inspect() *cobra.Command {
 		false,
 		"Display an overview of mounts used in the container checkpoint",
 	)
+	flags.BoolVar(
+		mountTree,
+		"mount-tree",
+		false,
+		"Display the mount tree recorded by CRIU and highlight mounts not in the OCI spec",
+	)
 	flags.Uint32VarP(
 		pID,
 		"pid",
@@ -55,6 +61,18 @@ func Inspect() *cobra.Command {
 		false,
 		"Display an overview of processes in the container checkpoint with their environment variables",
 	)
+	flags.StringArrayVar(
+		maskEnvVars,
+		"mask-env",
+		nil,
+		"Mask the values of environment variables matching a glob pattern in addition to *PASSWORD*, *TOKEN*, *SECRET* and *KEY* (can be specified multiple times)",
+	)
+	flags.BoolVar(
+		showSecrets,
+		"show-secrets",
+		false,
+		"Display the values of all environment variables without masking",
+	)
 	flags.BoolVar(
 		files,
 		"files",
@@ -67,6 +85,48 @@ func Inspect() *cobra.Command {
 		false,
 		"Display the open sockets for processes in the container checkpoint",
 	)
+	flags.BoolVar(
+		threads,
+		"threads",
+		false,
+		"Display the threads of each process in the container checkpoint",
+	)
+	flags.BoolVar(
+		registers,
+		"registers",
+		false,
+		"Display the saved CPU registers of each thread in the container checkpoint",
+	)
+	flags.BoolVar(
+		namespaces,
+		"namespaces",
+		false,
+		"Display the namespaces and the processes that belong to them",
+	)
+	flags.BoolVar(
+		ipc,
+		"ipc",
+		false,
+		"Display the System V IPC objects in the container checkpoint",
+	)
+	flags.BoolVar(
+		ttys,
+		"ttys",
+		false,
+		"Display the terminals in the container checkpoint and the processes using them",
+	)
+	flags.BoolVar(
+		ghostFiles,
+		"ghost-files",
+		false,
+		"Display files which were deleted while still open and the processes holding them",
+	)
+	flags.BoolVar(
+		shmem,
+		"shmem",
+		false,
+		"Display memfds and shared anonymous memory with the processes sharing them",
+	)
 	flags.BoolVar(
 		showAll,
 		"all",
@@ -90,6 +150,10 @@ func Inspect() *cobra.Command {
 }
 
 func inspect(cmd *cobra.Command, args []string) error {
+	if err := internal.ValidateMaskEnvVars(); err != nil {
+		return err
+	}
+
 	if *showAll {
 		*stats = true
 		*mounts = true
@@ -98,9 +162,21 @@ func inspect(cmd *cobra.Command, args []string) error {
 		*files = true
 		*sockets = true
 		*showMetdata = true
+		*registers = true
+		*threads = true
+		*namespaces = true
+		*mountTree = true
+		*ipc = true
+		*ttys = true
+		*ghostFiles = true
+		*shmem = true
 	}
 
-	requiredFiles := []string{metadata.SpecDumpFile, metadata.ConfigDumpFile, metadata.NetworkStatusFile}
+	requiredFiles := []string{
+		metadata.SpecDumpFile, metadata.ConfigDumpFile, metadata.NetworkStatusFile,
+		// tty-info.img is always unpacked to warn about external terminals
+		filepath.Join(metadata.CheckpointDirectory, "tty-info.img"),
+	}
 
 	if *stats {
 		requiredFiles = append(requiredFiles, "stats-dump")
@@ -140,6 +216,80 @@ func inspect(cmd *cobra.Command, args []string) error {
 		)
 	}
 
+	if *registers || *threads {
+		// Threads and registers are attached to the processes in the tree.
+		// The core-*.img files of all threads are unpacked below.
+		*psTree = true
+	}
+
+	if *namespaces {
+		requiredFiles = append(
+			requiredFiles,
+			// Unpack pstree.img, core-*.img, ids-*.img, utsns-*.img, userns-*.img
+			filepath.Join(metadata.CheckpointDirectory, "pstree.img"),
+			filepath.Join(metadata.CheckpointDirectory, "core-"),
+			filepath.Join(metadata.CheckpointDirectory, "ids-"),
+			filepath.Join(metadata.CheckpointDirectory, "utsns-"),
+			filepath.Join(metadata.CheckpointDirectory, "userns-"),
+		)
+	}
+
+	if *mountTree {
+		requiredFiles = append(
+			requiredFiles,
+			// Unpack mountpoints-*.img
+			filepath.Join(metadata.CheckpointDirectory, "mountpoints-"),
+		)
+	}
+
+	if *ipc {
+		requiredFiles = append(
+			requiredFiles,
+			// Unpack ipcns-shm-*.img, ipcns-sem-*.img, ipcns-msg-*.img
+			filepath.Join(metadata.CheckpointDirectory, "ipcns-"),
+		)
+	}
+
+	if *ttys {
+		requiredFiles = append(
+			requiredFiles,
+			// Unpack files.img, pstree.img, core-*.img, ids-*.img, fdinfo-*.img
+			filepath.Join(metadata.CheckpointDirectory, "files.img"),
+			filepath.Join(metadata.CheckpointDirectory, "pstree.img"),
+			filepath.Join(metadata.CheckpointDirectory, "core-"),
+			filepath.Join(metadata.CheckpointDirectory, "ids-"),
+			filepath.Join(metadata.CheckpointDirectory, "fdinfo-"),
+		)
+	}
+
+	if *ghostFiles {
+		requiredFiles = append(
+			requiredFiles,
+			// Unpack remap-fpath.img, ghost-file-*.img, files.img, pstree.img, core-*.img, ids-*.img, fdinfo-*.img
+			filepath.Join(metadata.CheckpointDirectory, "remap-fpath.img"),
+			filepath.Join(metadata.CheckpointDirectory, "ghost-file-"),
+			filepath.Join(metadata.CheckpointDirectory, "files.img"),
+			filepath.Join(metadata.CheckpointDirectory, "pstree.img"),
+			filepath.Join(metadata.CheckpointDirectory, "core-"),
+			filepath.Join(metadata.CheckpointDirectory, "ids-"),
+			filepath.Join(metadata.CheckpointDirectory, "fdinfo-"),
+		)
+	}
+
+	if *shmem {
+		requiredFiles = append(
+			requiredFiles,
+			// Unpack memfd.img, files.img, pstree.img, core-*.img, ids-*.img, fdinfo-*.img, mm-*.img
+			filepath.Join(metadata.CheckpointDirectory, "memfd.img"),
+			filepath.Join(metadata.CheckpointDirectory, "files.img"),
+			filepath.Join(metadata.CheckpointDirectory, "pstree.img"),
+			filepath.Join(metadata.CheckpointDirectory, "core-"),
+			filepath.Join(metadata.CheckpointDirectory, "ids-"),
+			filepath.Join(metadata.CheckpointDirectory, "fdinfo-"),
+			filepath.Join(metadata.CheckpointDirectory, "mm-"),
+		)
+	}
+
 	if *psTreeCmd || *psTreeEnv {
 		// Enable displaying process tree when using --ps-tree-cmd or --ps-tree-env.
 		*psTree = true
@@ -25,6 +25,13 @@ func List() *cobra.Command {
 		DisableFlagsInUseLine: true,
 	}
 
+	cmd.Flags().StringVar(
+		storeDir,
+		"store",
+		"",
+		"Also list the checkpoints in the store in this directory",
+	)
+
 	return cmd
 }
 
@@ -82,6 +89,18 @@ func list(cmd *cobra.Command, args []string) error {
 		}
 	}
 
+	if cmd.Flags().Changed("store") {
+		storeRows, err := listStore(*storeDir)
+		if err != nil {
+			log.Printf("Error listing checkpoints in store %s: %v\n", *storeDir, err)
+		}
+		if len(storeRows) > 0 {
+			showTable = true
+			fmt.Printf("Listing checkpoints in store: %s\n", *storeDir)
+			rows = append(rows, storeRows...)
+		}
+	}
+
 	if !showTable {
 		fmt.Printf("No checkpoints found in %v\n", allPaths)
 		return nil
@@ -93,3 +112,26 @@ func list(cmd *cobra.Command, args []string) error {
 	w.Flush()
 	return nil
 }
+
+// listStore returns the table rows of the checkpoints in a store. A store
+// which does not exist contains no checkpoints.
+func listStore(dir string) ([][]string, error) {
+	if dir == "" {
+		return nil, nil
+	}
+	checkpoints, err := internal.NewCheckpointStore(dir).List()
+	if err != nil {
+		return nil, err
+	}
+
+	var rows [][]string
+	for _, checkpoint := range checkpoints {
+		row := []string{"-", "-", "-", "-", "-", fmt.Sprintf("%s (%s)", checkpoint.Name, checkpoint.ShortID())}
+		if c := checkpoint.Config; c != nil {
+			row[0], row[1], row[2], row[3] = c.Namespace, c.Pod, c.Container, c.ContainerManager
+			row[4] = c.Timestamp.Format(time.RFC822)
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
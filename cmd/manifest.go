@@ -0,0 +1,80 @@
+// SPDX-License-Identifier: Apache-2.0
+
+// This file is used to list the files of container checkpoints
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/checkpoint-restore/checkpointctl/internal"
+	"github.com/spf13/cobra"
+)
+
+func Manifest() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "manifest <checkpoint-path>",
+		Short: "List the files of a container checkpoint with their digests",
+		Long: `The 'manifest' command lists the path, type, size, mode and SHA-256 digest of
+every member of a container checkpoint archive in JSON format. The files are grouped by
+component: metadata, criu, pages, rootfs and volumes. With --compare, the
+files which were added, removed or modified in another checkpoint are listed:
+  checkpointctl manifest checkpoint.tar
+  checkpointctl manifest checkpoint.tar --compare other.tar`,
+		RunE: manifest,
+		Args: cobra.ExactArgs(1),
+	}
+
+	flags := cmd.Flags()
+
+	flags.StringVar(
+		manifestCompare,
+		"compare",
+		"",
+		"Compare the files with the files of another checkpoint",
+	)
+
+	return cmd
+}
+
+// manifestComparison is the output of the manifest command with --compare
+type manifestComparison struct {
+	Checkpoint string `json:"checkpoint"`
+	Compare    string `json:"compare"`
+	Identical  bool   `json:"identical"`
+	*internal.ManifestDifference
+}
+
+func manifest(cmd *cobra.Command, args []string) error {
+	var result any
+
+	m, err := internal.NewCheckpointManifest(args[0])
+	if err != nil {
+		return fmt.Errorf("failed to create manifest of %s: %w", args[0], err)
+	}
+	result = m
+
+	if *manifestCompare != "" {
+		other, err := internal.NewCheckpointManifest(*manifestCompare)
+		if err != nil {
+			return fmt.Errorf("failed to create manifest of %s: %w", *manifestCompare, err)
+		}
+
+		diff := internal.CompareManifests(m.Entries(), other.Entries())
+		result = manifestComparison{
+			Checkpoint:         args[0],
+			Compare:            *manifestCompare,
+			Identical:          diff.IsEmpty(),
+			ManifestDifference: diff,
+		}
+	}
+
+	jsonData, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(jsonData))
+
+	return nil
+}
@@ -6,14 +6,19 @@ package cmd
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
 
 	"github.com/checkpoint-restore/checkpointctl/internal"
 	metadata "github.com/checkpoint-restore/checkpointctl/lib"
 	"github.com/checkpoint-restore/go-criu/v8/crit"
+	"github.com/checkpoint-restore/go-criu/v8/crit/images/pagemap"
 	"github.com/spf13/cobra"
 )
 
@@ -64,6 +69,20 @@ func MemParse() *cobra.Command {
 		"Search for a regex pattern in memory pages",
 	)
 
+	flags.StringVar(
+		searchHexPattern,
+		"search-hex",
+		"",
+		"Search for a pattern of hexadecimal bytes in memory pages (e.g. \"de ad be ef\")",
+	)
+
+	flags.StringVar(
+		searchPatternFile,
+		"search-file",
+		"",
+		"Search for all patterns of a file at once in memory pages (one pattern per line, \"hex:\" prefix for hexadecimal bytes)",
+	)
+
 	flags.IntVarP(
 		searchContext,
 		"context",
@@ -72,6 +91,76 @@ func MemParse() *cobra.Command {
 		"Print the specified number of bytes surrounding each match",
 	)
 
+	flags.Uint32Var(
+		ipcShmID,
+		"ipc-shm",
+		0,
+		"Specify the ID of a System V shared memory segment to display",
+	)
+
+	flags.Uint32Var(
+		ipcNsID,
+		"ipc-ns",
+		0,
+		"Specify the ID of the IPC namespace of the shared memory segment selected with --ipc-shm",
+	)
+
+	flags.Uint64Var(
+		shmemID,
+		"shmem",
+		0,
+		"Specify the ID of a memfd or shared anonymous memory to display",
+	)
+
+	flags.StringVar(
+		searchFormat,
+		"format",
+		"table",
+		"Specify the output format of search results: table or json",
+	)
+
+	flags.StringVar(
+		dumpDir,
+		"dump-dir",
+		"",
+		"Write the memory of the process specified with --pid to the given directory",
+	)
+
+	flags.StringVar(
+		dumpFormat,
+		"dump-format",
+		"raw",
+		"Specify the format used with --dump-dir: raw (one file per memory region) or elf (core file)",
+	)
+
+	flags.StringVar(
+		memoryRange,
+		"range",
+		"",
+		"Only display the memory pages between the addresses START-END (hexadecimal)",
+	)
+
+	flags.StringVar(
+		vmaName,
+		"vma",
+		"",
+		"Only display the memory pages of the memory regions with the given name (e.g. [heap], [stack] or a file path)",
+	)
+
+	flags.Uint64Var(
+		memoryOffset,
+		"offset",
+		0,
+		"Skip the given number of bytes at the start of the displayed memory pages",
+	)
+
+	flags.Uint64Var(
+		memoryLength,
+		"length",
+		0,
+		"Display at most the given number of bytes of memory pages",
+	)
+
 	return cmd
 }
 
@@ -82,7 +171,32 @@ func memparse(cmd *cobra.Command, args []string) error {
 		filepath.Join(metadata.CheckpointDirectory, "core-"),
 	}
 
-	if *pID == 0 {
+	// Shared memory IDs start at 0, so only the presence of the flags counts
+	showIpcShm := cmd.Flags().Changed("ipc-shm")
+	showShmem := cmd.Flags().Changed("shmem")
+	if cmd.Flags().Changed("ipc-ns") && !showIpcShm {
+		return fmt.Errorf("please specify the shared memory segment to display with --ipc-shm when using --ipc-ns")
+	}
+
+	if showIpcShm {
+		requiredFiles = append(
+			requiredFiles,
+			// The segment contents are either in the ipcns-shm-*.img files or
+			// in pagemap-shmem-[shmid].img and the corresponding pages-*.img file
+			filepath.Join(metadata.CheckpointDirectory, "ipcns-shm-"),
+			filepath.Join(metadata.CheckpointDirectory, fmt.Sprintf("pagemap-shmem-%d.img", *ipcShmID)),
+			filepath.Join(metadata.CheckpointDirectory, "pages-"),
+		)
+	} else if showShmem {
+		requiredFiles = append(
+			requiredFiles,
+			// The size is stored in memfd.img or derived from the mappings in mm-*.img
+			filepath.Join(metadata.CheckpointDirectory, "memfd.img"),
+			filepath.Join(metadata.CheckpointDirectory, "mm-"),
+			filepath.Join(metadata.CheckpointDirectory, fmt.Sprintf("pagemap-shmem-%d.img", *shmemID)),
+			filepath.Join(metadata.CheckpointDirectory, "pages-"),
+		)
+	} else if *pID == 0 {
 		requiredFiles = append(
 			requiredFiles,
 			filepath.Join(metadata.CheckpointDirectory, "pagemap-"),
@@ -96,14 +210,83 @@ func memparse(cmd *cobra.Command, args []string) error {
 		)
 	}
 
+	searchMemory := *searchPattern != "" || *searchRegexPattern != "" || *searchHexPattern != "" || *searchPatternFile != ""
+	var patterns []internal.MemoryPattern
+	if searchMemory {
+		if *searchFormat != "table" && *searchFormat != "json" {
+			return fmt.Errorf("invalid output format: %s", *searchFormat)
+		}
+		var err error
+		if patterns, err = getSearchPatterns(); err != nil {
+			return err
+		}
+		requiredFiles = append(
+			requiredFiles,
+			// Matches are annotated with the memory regions of files.img and memfd.img
+			filepath.Join(metadata.CheckpointDirectory, "files.img"),
+			filepath.Join(metadata.CheckpointDirectory, "memfd.img"),
+		)
+	}
+
+	// The search covers the processes of all checkpoints
+	if *pID != 0 && len(args) > 1 && !searchMemory {
+		return fmt.Errorf("please specify a single checkpoint when using --pid")
+	}
+
+	filterMemory := *memoryRange != "" || *vmaName != "" || *memoryOffset != 0 || *memoryLength != 0
+	if filterMemory && *pID == 0 {
+		return fmt.Errorf("please specify the process to display with --pid when using --range, --vma, --offset or --length")
+	}
+	if filterMemory && (searchMemory || *dumpDir != "") {
+		return fmt.Errorf("--range, --vma, --offset and --length cannot be combined with --search, --search-regex, --search-hex, --search-file or --dump-dir")
+	}
+	if *vmaName != "" {
+		requiredFiles = append(
+			requiredFiles,
+			// The names of the memory regions are in files.img and memfd.img
+			filepath.Join(metadata.CheckpointDirectory, "files.img"),
+			filepath.Join(metadata.CheckpointDirectory, "memfd.img"),
+		)
+	}
+
+	if *dumpDir != "" {
+		if *pID == 0 {
+			return fmt.Errorf("please specify the process to dump with --pid")
+		}
+		if searchMemory {
+			return fmt.Errorf("--dump-dir cannot be combined with --search, --search-regex, --search-hex or --search-file")
+		}
+		if *dumpFormat != "raw" && *dumpFormat != "elf" {
+			return fmt.Errorf("invalid dump format %q: use raw or elf", *dumpFormat)
+		}
+		requiredFiles = append(
+			requiredFiles,
+			// The backing resources of the memory regions are in files.img and memfd.img
+			filepath.Join(metadata.CheckpointDirectory, "files.img"),
+			filepath.Join(metadata.CheckpointDirectory, "memfd.img"),
+		)
+	}
+
 	tasks, err := internal.CreateTasks(args, requiredFiles)
 	if err != nil {
 		return err
 	}
 	defer internal.CleanupTasks(tasks)
 
-	if *searchPattern != "" || *searchRegexPattern != "" {
-		return printMemorySearchResultForPID(tasks[0])
+	if showIpcShm {
+		return printIpcShmContents(tasks[0])
+	}
+
+	if showShmem {
+		return printShmemContents(tasks[0])
+	}
+
+	if searchMemory {
+		return printMemorySearchResults(tasks, patterns)
+	}
+
+	if *dumpDir != "" {
+		return dumpProcessMemory(tasks[0])
 	}
 
 	if *pID != 0 {
@@ -195,11 +378,13 @@ func showProcessMemorySizeTables(tasks []internal.Task) error {
 	return nil
 }
 
-func printProcessMemoryPages(task internal.Task) error {
+// newProcessMemoryReader returns a memory reader for the process specified
+// with --pid and unpacks the pages image of the process.
+func newProcessMemoryReader(task internal.Task) (*crit.MemoryReader, error) {
 	c := crit.New(nil, nil, filepath.Join(task.OutputDir, metadata.CheckpointDirectory), false, false)
 	psTree, err := c.ExplorePs()
 	if err != nil {
-		return fmt.Errorf("failed to get process tree: %w", err)
+		return nil, fmt.Errorf("failed to get process tree: %w", err)
 	}
 
 	// If PID=0, show all PIDs; otherwise, parse the specified PID's memory.
@@ -207,13 +392,13 @@ func printProcessMemoryPages(task internal.Task) error {
 		// Check if PID exist within the checkpoint
 		ps := psTree.FindPs(*pID)
 		if ps == nil {
-			return fmt.Errorf("no process with PID %d (use `inspect --ps-tree` to view all PIDs)", *pID)
+			return nil, fmt.Errorf("no process with PID %d (use `inspect --ps-tree` to view all PIDs)", *pID)
 		}
 
 		// Check if the specified process has memory pages
-		taskState := crit.TaskState(psTree.Core.GetTc().GetTaskState())
+		taskState := crit.TaskState(ps.Core.GetTc().GetTaskState())
 		if !taskState.IsAliveOrStopped() {
-			return fmt.Errorf("process %d has no memory pages (task state is zombie or dead)", ps.PID)
+			return nil, fmt.Errorf("process %d has no memory pages (task state is zombie or dead)", ps.PID)
 		}
 	}
 
@@ -222,7 +407,7 @@ func printProcessMemoryPages(task internal.Task) error {
 		*pID, pageSize,
 	)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// Unpack pages-[pagesID].img file for the given PID
@@ -230,6 +415,15 @@ func printProcessMemoryPages(task internal.Task) error {
 		task.CheckpointFilePath, task.OutputDir,
 		[]string{filepath.Join(metadata.CheckpointDirectory, fmt.Sprintf("pages-%d.img", memReader.GetPagesID()))},
 	); err != nil {
+		return nil, err
+	}
+
+	return memReader, nil
+}
+
+func printProcessMemoryPages(task internal.Task) error {
+	memReader, err := newProcessMemoryReader(task)
+	if err != nil {
 		return err
 	}
 
@@ -256,17 +450,249 @@ func printProcessMemoryPages(task internal.Task) error {
 	fmt.Fprintln(output, "Address           Hexadecimal                                       ASCII            ")
 	fmt.Fprintln(output, "-------------------------------------------------------------------------------------")
 
-	pagemapEntries := memReader.GetPagemapEntries()
+	ranges, err := selectAddressRanges(task, memReader.GetPagemapEntries())
+	if err != nil {
+		return err
+	}
+	for _, r := range ranges {
+		buf, err := memReader.GetMemPages(r.start, r.end)
+		if err != nil {
+			return err
+		}
+
+		hexdump(output, buf, r.start, compact)
+	}
+	return nil
+}
+
+// addressRange is the range of virtual memory addresses [start, end).
+type addressRange struct {
+	start, end uint64
+}
+
+// selectAddressRanges returns the address ranges of the memory pages in the
+// checkpoint which are selected with --range, --vma, --offset and --length.
+func selectAddressRanges(task internal.Task, pagemapEntries []*pagemap.PagemapEntry) ([]addressRange, error) {
+	var ranges []addressRange
 	for _, entry := range pagemapEntries {
 		start := entry.GetVaddr()
-		end := start + (uint64(pageSize) * entry.GetNrPages())
-		buf, err := memReader.GetMemPages(start, end)
+		ranges = append(ranges, addressRange{start, start + uint64(pageSize)*entry.GetNrPages()})
+	}
+
+	if *vmaName != "" {
+		regions, err := internal.GetMemoryRegions(task.OutputDir, *pID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get memory regions: %w", err)
+		}
+		var selected []addressRange
+		for _, region := range regions {
+			if matchesVmaName(region.Name, *vmaName) {
+				selected = append(selected, addressRange{region.Start, region.End})
+			}
+		}
+		if len(selected) == 0 {
+			return nil, fmt.Errorf("no memory region named %q in process %d", *vmaName, *pID)
+		}
+		ranges = intersectAddressRanges(ranges, selected)
+	}
+
+	if *memoryRange != "" {
+		r, err := parseAddressRange(*memoryRange)
+		if err != nil {
+			return nil, err
+		}
+		ranges = intersectAddressRanges(ranges, []addressRange{r})
+	}
+
+	return limitAddressRanges(ranges, *memoryOffset, *memoryLength), nil
+}
+
+// matchesVmaName reports whether the name of a memory region matches the
+// name given with --vma. File mappings also match their base name.
+func matchesVmaName(regionName, name string) bool {
+	if regionName == "" {
+		return false
+	}
+	return regionName == name || (strings.HasPrefix(regionName, "/") && filepath.Base(regionName) == name)
+}
+
+// parseAddressRange parses an address range in the form START-END with
+// hexadecimal addresses and an optional 0x prefix.
+func parseAddressRange(s string) (addressRange, error) {
+	startStr, endStr, found := strings.Cut(s, "-")
+	if !found {
+		return addressRange{}, fmt.Errorf("invalid address range %q: expected START-END", s)
+	}
+	start, err := strconv.ParseUint(strings.TrimPrefix(startStr, "0x"), 16, 64)
+	if err != nil {
+		return addressRange{}, fmt.Errorf("invalid start address in range %q: %w", s, err)
+	}
+	end, err := strconv.ParseUint(strings.TrimPrefix(endStr, "0x"), 16, 64)
+	if err != nil {
+		return addressRange{}, fmt.Errorf("invalid end address in range %q: %w", s, err)
+	}
+	if start >= end {
+		return addressRange{}, fmt.Errorf("invalid address range %q: start address must be below end address", s)
+	}
+	return addressRange{start, end}, nil
+}
+
+// intersectAddressRanges returns the parts of ranges which are within any of
+// the selected ranges.
+func intersectAddressRanges(ranges, selected []addressRange) []addressRange {
+	var result []addressRange
+	for _, r := range ranges {
+		for _, s := range selected {
+			start, end := max(r.start, s.start), min(r.end, s.end)
+			if start < end {
+				result = append(result, addressRange{start, end})
+			}
+		}
+	}
+	return result
+}
+
+// limitAddressRanges skips offset bytes at the start of ranges and limits the
+// total size of the ranges to length bytes. A length of zero means no limit.
+func limitAddressRanges(ranges []addressRange, offset, length uint64) []addressRange {
+	var result []addressRange
+	for _, r := range ranges {
+		size := r.end - r.start
+		if offset >= size {
+			offset -= size
+			continue
+		}
+		r.start += offset
+		offset = 0
+		if length != 0 {
+			if r.end-r.start >= length {
+				r.end = r.start + length
+				return append(result, r)
+			}
+			length -= r.end - r.start
+		}
+		result = append(result, r)
+	}
+	return result
+}
+
+// dumpProcessMemory writes the memory regions of the process specified with
+// --pid to the directory specified with --dump-dir, either as one raw file
+// per region or as an ELF core file.
+func dumpProcessMemory(task internal.Task) error {
+	// The memory reader checks the process and unpacks its pages image
+	if _, err := newProcessMemoryReader(task); err != nil {
+		return err
+	}
+	pages, err := internal.OpenProcessPages(task.OutputDir, *pID)
+	if err != nil {
+		return fmt.Errorf("failed to open memory pages: %w", err)
+	}
+	defer pages.Close()
+
+	regions, err := internal.GetMemoryRegions(task.OutputDir, *pID)
+	if err != nil {
+		return fmt.Errorf("failed to get memory regions: %w", err)
+	}
+
+	if err := os.MkdirAll(*dumpDir, 0o755); err != nil {
+		return err
+	}
+
+	if *dumpFormat == "elf" {
+		corePath := filepath.Join(*dumpDir, fmt.Sprintf("core.%d", *pID))
+		f, err := os.Create(corePath)
 		if err != nil {
 			return err
 		}
+		defer f.Close()
 
-		hexdump(output, buf, start, compact)
+		// The file is written directly to create holes for missing pages
+		if err := internal.WriteElfCore(f, task.OutputDir, *pID, regions, pages); err != nil {
+			return fmt.Errorf("failed to write core file: %w", err)
+		}
+
+		fmt.Printf("Wrote %d memory regions of process ID %d from checkpoint: %s to file: %s\n",
+			len(regions), *pID, task.CheckpointFilePath, corePath,
+		)
+		return nil
+	}
+
+	// Only the pages of the checkpoint are written, the other pages of a
+	// region are holes in the file
+	for _, region := range regions {
+		if err := writeMemoryRegion(pages, region); err != nil {
+			return fmt.Errorf("failed to write memory region 0x%x-0x%x: %w", region.Start, region.End, err)
+		}
 	}
+
+	fmt.Printf("Wrote %d memory regions of process ID %d from checkpoint: %s to directory: %s\n",
+		len(regions), *pID, task.CheckpointFilePath, *dumpDir,
+	)
+	return nil
+}
+
+// writeMemoryRegion writes a memory region to a raw file in the directory
+// specified with --dump-dir.
+func writeMemoryRegion(pages *internal.ProcessPages, region internal.MemoryRegion) error {
+	f, err := os.OpenFile(filepath.Join(*dumpDir, region.FileName()), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	if err := pages.WriteMemory(f, region.Start, region.End); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// printIpcShmContents prints the contents of a System V shared memory segment.
+func printIpcShmContents(task internal.Task) error {
+	buf, err := internal.ReadIpcShmContents(task.OutputDir, *ipcNsID, *ipcShmID)
+	if err != nil {
+		return fmt.Errorf("failed to read shared memory segment: %w", err)
+	}
+
+	return printSharedMemory(task, fmt.Sprintf("shared memory segment %d", *ipcShmID), buf)
+}
+
+// printShmemContents prints the contents of a memfd or shared anonymous memory.
+func printShmemContents(task internal.Task) error {
+	buf, err := internal.ReadShmemContents(task.OutputDir, *shmemID)
+	if err != nil {
+		return fmt.Errorf("failed to read shared memory: %w", err)
+	}
+
+	return printSharedMemory(task, fmt.Sprintf("shared memory %d", *shmemID), buf)
+}
+
+// printSharedMemory prints a hexdump of shared memory with offsets
+// relative to its start.
+func printSharedMemory(task internal.Task, name string, buf *bytes.Buffer) error {
+	// Write the output to stdout by default
+	var output io.Writer = os.Stdout
+	var compact bool
+
+	if *outputFilePath != "" {
+		f, err := os.Create(*outputFilePath)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		output = f
+		fmt.Printf("\nWriting %s from checkpoint: %s to file: %s...\n",
+			name, task.CheckpointFilePath, *outputFilePath,
+		)
+	} else {
+		compact = true
+		fmt.Printf("\nDisplaying %s from checkpoint: %s\n\n", name, task.CheckpointFilePath)
+	}
+
+	fmt.Fprintln(output, "Offset            Hexadecimal                                       ASCII            ")
+	fmt.Fprintln(output, "-------------------------------------------------------------------------------------")
+
+	hexdump(output, buf, 0, compact)
+
 	return nil
 }
 
@@ -315,71 +741,128 @@ func generateHexAndAscii(data []byte) (string, string) {
 	return hex, ascii
 }
 
-// Searches for a pattern in the memory of a given PID and prints the results.
-func printMemorySearchResultForPID(task internal.Task) error {
-	c := crit.New(nil, nil, filepath.Join(task.OutputDir, metadata.CheckpointDirectory), false, false)
-	psTree, err := c.ExplorePs()
-	if err != nil {
-		return fmt.Errorf("failed to get process tree: %w", err)
+// getSearchPatterns returns the patterns given with --search-hex and
+// --search-file together with the pattern given with --search. These
+// patterns are searched at once. It returns nil if neither --search-hex
+// nor --search-file is used.
+func getSearchPatterns() ([]internal.MemoryPattern, error) {
+	if *searchHexPattern == "" && *searchPatternFile == "" {
+		return nil, nil
 	}
-
-	// Check if PID exist within the checkpoint
-	ps := psTree.FindPs(*pID)
-	if ps == nil {
-		return fmt.Errorf("no process with PID %d (use `inspect --ps-tree` to view all PIDs)", *pID)
+	if *searchRegexPattern != "" {
+		return nil, fmt.Errorf("--search-regex cannot be combined with --search-hex or --search-file")
 	}
 
-	// Check if the process has memory pages
-	taskState := crit.TaskState(ps.Core.GetTc().GetTaskState())
-	if !taskState.IsAliveOrStopped() {
-		return fmt.Errorf("process %d has no memory pages (task state is zombie or dead)", ps.PID)
+	var patterns []internal.MemoryPattern
+	if *searchPattern != "" {
+		patterns = append(patterns, internal.MemoryPattern{Name: *searchPattern, Data: []byte(*searchPattern)})
 	}
-
-	memReader, err := crit.NewMemoryReader(
-		filepath.Join(task.OutputDir, metadata.CheckpointDirectory),
-		*pID, pageSize,
-	)
-	if err != nil {
-		return fmt.Errorf("failed to create memory reader: %w", err)
+	if *searchHexPattern != "" {
+		pattern, err := internal.NewHexPattern(*searchHexPattern)
+		if err != nil {
+			return nil, err
+		}
+		patterns = append(patterns, pattern)
 	}
-
-	if err := internal.UntarFiles(
-		task.CheckpointFilePath, task.OutputDir,
-		[]string{filepath.Join(metadata.CheckpointDirectory, fmt.Sprintf("pages-%d.img", memReader.GetPagesID()))},
-	); err != nil {
-		return fmt.Errorf("failed to extract pages file: %w", err)
+	if *searchPatternFile != "" {
+		filePatterns, err := internal.ReadPatternFile(*searchPatternFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read patterns: %w", err)
+		}
+		patterns = append(patterns, filePatterns...)
 	}
 
+	return patterns, nil
+}
+
+// printMemorySearchResults searches a pattern, or the given patterns at
+// once, in the memory of the process specified with --pid, or of all
+// processes of the given checkpoints, and prints the results.
+func printMemorySearchResults(tasks []internal.Task, patterns []internal.MemoryPattern) error {
 	pattern := *searchPattern
 	escapeRegExpCharacters := true
 	if pattern == "" {
 		pattern = *searchRegexPattern
 		escapeRegExpCharacters = false
 	}
+	description := fmt.Sprintf("pattern \"%s\"", pattern)
+	if len(patterns) == 1 {
+		description = fmt.Sprintf("pattern \"%s\"", patterns[0].Name)
+	} else if patterns != nil {
+		description = fmt.Sprintf("%d patterns", len(patterns))
+	}
 
-	results, err := memReader.SearchPattern(pattern, escapeRegExpCharacters, *searchContext, 0)
-	if err != nil {
-		return fmt.Errorf("failed to search pattern in memory: %w", err)
+	var matches []internal.MemorySearchMatch
+	for _, task := range tasks {
+		var result []internal.MemorySearchMatch
+		var err error
+		if patterns != nil {
+			result, err = internal.SearchCheckpointMemoryPatterns(task, *pID, patterns, *searchContext)
+		} else {
+			result, err = internal.SearchCheckpointMemory(task, *pID, pattern, escapeRegExpCharacters, *searchContext)
+		}
+		if err != nil {
+			if len(tasks) > 1 {
+				return fmt.Errorf("%s: %w", task.CheckpointFilePath, err)
+			}
+			return err
+		}
+		matches = append(matches, result...)
+	}
+
+	if *searchFormat == "json" {
+		if matches == nil {
+			matches = []internal.MemorySearchMatch{}
+		}
+		jsonData, err := json.MarshalIndent(matches, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal search results: %w", err)
+		}
+		fmt.Println(string(jsonData))
+		return nil
 	}
 
-	if len(results) == 0 {
-		fmt.Printf("No matches for pattern \"%s\" in the memory of PID %d\n", pattern, *pID)
+	if len(matches) == 0 {
+		if *pID != 0 {
+			fmt.Printf("No matches for %s in the memory of PID %d\n", description, *pID)
+		} else {
+			fmt.Printf("No matches for %s in the memory of any process\n", description)
+		}
 		return nil
 	}
 
 	w := internal.GetNewTabWriter(os.Stdout)
-	header := []string{"Address", "Match", "Instance"}
+	header := []string{"PID", "Command", "Address", "Region", "Match", "Instance"}
+	if patterns != nil {
+		header = slices.Insert(header, 4, "Pattern")
+	}
+	if len(tasks) > 1 {
+		header = append([]string{"Checkpoint"}, header...)
+	}
 
 	internal.WriteTableHeader(w, header)
 
 	// Build rows
 	var rows [][]string
-	for i, result := range results {
+	for i, match := range matches {
+		region := match.Resource
+		if region == "" {
+			region = match.VMA
+		}
 		row := []string{
-			fmt.Sprintf("%016x", result.Vaddr),
-			result.Match,
+			fmt.Sprintf("%d", match.PID),
+			match.Comm,
+			strings.TrimPrefix(match.Address, "0x"),
+			region,
+			match.Match,
 			fmt.Sprintf("%d", i+1),
 		}
+		if patterns != nil {
+			row = slices.Insert(row, 4, match.Pattern)
+		}
+		if len(tasks) > 1 {
+			row = append([]string{match.Checkpoint}, row...)
+		}
 		rows = append(rows, row)
 	}
 
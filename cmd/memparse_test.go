@@ -0,0 +1,166 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseAddressRange(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected addressRange
+		err      string
+	}{
+		{"0x1000-0x2000", addressRange{0x1000, 0x2000}, ""},
+		{"7ffc0000-7ffd0000", addressRange{0x7ffc0000, 0x7ffd0000}, ""},
+		{"0x1000", addressRange{}, "expected START-END"},
+		{"0x2000-0x1000", addressRange{}, "start address must be below end address"},
+		{"xyz-0x1000", addressRange{}, "invalid start address"},
+		{"0x1000-xyz", addressRange{}, "invalid end address"},
+	}
+	for _, test := range tests {
+		result, err := parseAddressRange(test.input)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("Expected error %q for %q, got %v", test.err, test.input, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Unexpected error for %q: %v", test.input, err)
+		}
+		if result != test.expected {
+			t.Errorf("Expected %+v for %q, got %+v", test.expected, test.input, result)
+		}
+	}
+}
+
+func TestIntersectAddressRanges(t *testing.T) {
+	ranges := []addressRange{{0x1000, 0x3000}, {0x5000, 0x6000}, {0x8000, 0x9000}}
+	selected := []addressRange{{0x2000, 0x5800}, {0x8000, 0xa000}}
+
+	result := intersectAddressRanges(ranges, selected)
+
+	expected := []addressRange{{0x2000, 0x3000}, {0x5000, 0x5800}, {0x8000, 0x9000}}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, result)
+	}
+}
+
+func TestLimitAddressRanges(t *testing.T) {
+	ranges := []addressRange{{0x1000, 0x2000}, {0x5000, 0x6000}}
+	tests := []struct {
+		offset, length uint64
+		expected       []addressRange
+	}{
+		{0, 0, ranges},
+		{0x10, 0x20, []addressRange{{0x1010, 0x1030}}},
+		{0xff0, 0x20, []addressRange{{0x1ff0, 0x2000}, {0x5000, 0x5010}}},
+		{0x1800, 0, []addressRange{{0x5800, 0x6000}}},
+		{0x2000, 0, nil},
+	}
+	for _, test := range tests {
+		result := limitAddressRanges(ranges, test.offset, test.length)
+		if !reflect.DeepEqual(result, test.expected) {
+			t.Errorf("Expected %+v with offset 0x%x and length 0x%x, got %+v", test.expected, test.offset, test.length, result)
+		}
+	}
+}
+
+func TestMatchesVmaName(t *testing.T) {
+	tests := []struct {
+		regionName, name string
+		expected         bool
+	}{
+		{"[heap]", "[heap]", true},
+		{"[heap]", "[stack]", false},
+		{"/usr/lib64/libc.so.6", "/usr/lib64/libc.so.6", true},
+		{"/usr/lib64/libc.so.6", "libc.so.6", true},
+		{"[sysv:1]", "1]", false},
+		{"", "", false},
+	}
+	for _, test := range tests {
+		if result := matchesVmaName(test.regionName, test.name); result != test.expected {
+			t.Errorf("Expected %v for region %q and name %q, got %v", test.expected, test.regionName, test.name, result)
+		}
+	}
+}
+
+func TestMemparseIpcShmIDZero(t *testing.T) {
+	dir := t.TempDir()
+	archive := filepath.Join(dir, "checkpoint.tar")
+	writeIpcShmArchive(t, archive, []byte("segment zero"))
+
+	output := filepath.Join(dir, "output.txt")
+	cmd := MemParse()
+	cmd.SetArgs([]string{"--ipc-shm", "0", "--output", output, archive})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	content, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(content), "|segment zero|") {
+		t.Errorf("Expected the contents of segment 0, got %s", content)
+	}
+}
+
+func TestMemparseConflictingFlags(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		expected string
+	}{
+		{
+			name:     "pid with several checkpoints",
+			args:     []string{"--pid", "1", "a.tar", "b.tar"},
+			expected: "please specify a single checkpoint when using --pid",
+		},
+		{
+			name:     "dump-dir with several checkpoints",
+			args:     []string{"--pid", "1", "--dump-dir", "out", "a.tar", "b.tar"},
+			expected: "please specify a single checkpoint when using --pid",
+		},
+		{
+			name:     "dump-dir with search",
+			args:     []string{"--pid", "1", "--dump-dir", "out", "--search", "secret", "a.tar"},
+			expected: "--dump-dir cannot be combined with --search, --search-regex, --search-hex or --search-file",
+		},
+		{
+			name:     "dump-dir with search-hex",
+			args:     []string{"--pid", "1", "--dump-dir", "out", "--search-hex", "de ad", "a.tar"},
+			expected: "--dump-dir cannot be combined with --search, --search-regex, --search-hex or --search-file",
+		},
+		{
+			name:     "range with search",
+			args:     []string{"--pid", "1", "--range", "0x1000-0x2000", "--search", "secret", "a.tar"},
+			expected: "cannot be combined with --search, --search-regex, --search-hex, --search-file or --dump-dir",
+		},
+		{
+			name:     "vma with dump-dir",
+			args:     []string{"--pid", "1", "--vma", "[heap]", "--dump-dir", "out", "a.tar"},
+			expected: "cannot be combined with --search, --search-regex, --search-hex, --search-file or --dump-dir",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := MemParse()
+			cmd.SetArgs(tt.args)
+			cmd.SetOut(io.Discard)
+			cmd.SetErr(io.Discard)
+			err := cmd.Execute()
+			if err == nil || !strings.Contains(err.Error(), tt.expected) {
+				t.Errorf("Expected error %q, got %v", tt.expected, err)
+			}
+		})
+	}
+}
@@ -3,20 +3,59 @@ package cmd
 import "github.com/checkpoint-restore/checkpointctl/internal"
 
 var (
-	format             *string = &internal.Format
-	stats              *bool   = &internal.Stats
-	mounts             *bool   = &internal.Mounts
-	outputFilePath     *string = &internal.OutputFilePath
-	pID                *uint32 = &internal.PID
-	psTree             *bool   = &internal.PsTree
-	psTreeCmd          *bool   = &internal.PsTreeCmd
-	psTreeEnv          *bool   = &internal.PsTreeEnv
-	files              *bool   = &internal.Files
-	sockets            *bool   = &internal.Sockets
-	showUnchanged      *bool   = &internal.ShowUnchanged
-	showAll            *bool   = &internal.ShowAll
-	searchPattern      *string = &internal.SearchPattern
-	searchRegexPattern *string = &internal.SearchRegexPattern
-	searchContext      *int    = &internal.SearchContext
-	showMetdata        *bool   = &internal.Metadata
+	format             *string   = &internal.Format
+	stats              *bool     = &internal.Stats
+	mounts             *bool     = &internal.Mounts
+	outputFilePath     *string   = &internal.OutputFilePath
+	pID                *uint32   = &internal.PID
+	psTree             *bool     = &internal.PsTree
+	psTreeCmd          *bool     = &internal.PsTreeCmd
+	psTreeEnv          *bool     = &internal.PsTreeEnv
+	files              *bool     = &internal.Files
+	sockets            *bool     = &internal.Sockets
+	memory             *bool     = &internal.Memory
+	rootFs             *bool     = &internal.RootFs
+	showUnchanged      *bool     = &internal.ShowUnchanged
+	showAll            *bool     = &internal.ShowAll
+	searchPattern      *string   = &internal.SearchPattern
+	searchRegexPattern *string   = &internal.SearchRegexPattern
+	searchContext      *int      = &internal.SearchContext
+	showMetdata        *bool     = &internal.Metadata
+	registers          *bool     = &internal.Registers
+	threads            *bool     = &internal.Threads
+	namespaces         *bool     = &internal.Namespaces
+	mountTree          *bool     = &internal.MountTree
+	ipc                *bool     = &internal.IPC
+	ipcShmID           *uint32   = &internal.IpcShmID
+	ipcNsID            *uint32   = &internal.IpcNsID
+	ttys               *bool     = &internal.Ttys
+	ghostFiles         *bool     = &internal.GhostFiles
+	ghostFileID        *uint32   = &internal.GhostFileID
+	shmem              *bool     = &internal.Shmem
+	shmemID            *uint64   = &internal.ShmemID
+	dumpDir            *string   = &internal.DumpDir
+	dumpFormat         *string   = &internal.DumpFormat
+	memoryRange        *string   = &internal.MemoryRange
+	vmaName            *string   = &internal.VmaName
+	memoryOffset       *uint64   = &internal.MemoryOffset
+	memoryLength       *uint64   = &internal.MemoryLength
+	searchFormat       *string   = &internal.SearchFormat
+	searchHexPattern   *string   = &internal.SearchHexPattern
+	searchPatternFile  *string   = &internal.SearchPatternFile
+	secretRules        *[]string = &internal.SecretRules
+	secretRulesFile    *string   = &internal.SecretRulesFile
+	secretThreshold    *int      = &internal.SecretThreshold
+	secretEntropy      *float64  = &internal.SecretEntropy
+	redactEnvVars      *[]string = &internal.RedactEnvVars
+	redactPatterns     *[]string = &internal.RedactPatterns
+	redactFiles        *[]string = &internal.RedactFiles
+	redactSecrets      *bool     = &internal.RedactSecrets
+	maskEnvVars        *[]string = &internal.MaskEnvVars
+	showSecrets        *bool     = &internal.ShowSecrets
+	signingKey         *string   = &internal.SigningKey
+	signatureFile      *string   = &internal.SignatureFile
+	manifestCompare    *string   = &internal.ManifestCompare
+	repackCompression  *string   = &internal.RepackCompression
+	repackLevel        *int      = &internal.RepackLevel
+	storeDir           *string   = &internal.StoreDir
 )
@@ -0,0 +1,141 @@
+// SPDX-License-Identifier: Apache-2.0
+
+// This file is used to redact secrets in container checkpoints
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"github.com/checkpoint-restore/checkpointctl/internal"
+	metadata "github.com/checkpoint-restore/checkpointctl/lib"
+	"github.com/spf13/cobra"
+)
+
+func Redact() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "redact <checkpoint-path> <output-path>",
+		Short: "Create a copy of a container checkpoint with secrets removed",
+		Long: `The 'redact' command creates a copy of a container checkpoint in which selected
+environment variables, memory matching regular expressions and files of the
+root file system changes are overwritten. The overwritten data keeps its
+length, so that the checkpoint can still be restored. All other files of the
+checkpoint are copied unchanged:
+  checkpointctl redact checkpoint.tar redacted.tar --env 'AWS_*' --secrets`,
+		RunE: redact,
+		Args: cobra.ExactArgs(2),
+	}
+
+	flags := cmd.Flags()
+
+	flags.StringArrayVar(
+		redactEnvVars,
+		"env",
+		nil,
+		"Redact the environment variables matching a glob pattern and copies of their values in memory (can be specified multiple times)",
+	)
+	flags.StringArrayVar(
+		redactPatterns,
+		"pattern",
+		nil,
+		"Redact the memory matching a regex pattern (can be specified multiple times)",
+	)
+	flags.StringArrayVar(
+		redactFiles,
+		"file",
+		nil,
+		"Redact the files in the root file system changes matching a glob pattern (can be specified multiple times)",
+	)
+	flags.BoolVar(
+		redactSecrets,
+		"secrets",
+		false,
+		"Redact the memory matching the built-in rules of scan-secrets",
+	)
+
+	return cmd
+}
+
+func redact(cmd *cobra.Command, args []string) error {
+	if len(*redactEnvVars) == 0 && len(*redactPatterns) == 0 && len(*redactFiles) == 0 && !*redactSecrets {
+		return fmt.Errorf("please specify what to redact with --env, --pattern, --file or --secrets")
+	}
+
+	input, output := args[0], args[1]
+	if outputInfo, err := os.Stat(output); err == nil {
+		if inputInfo, err := os.Stat(input); err == nil && os.SameFile(inputInfo, outputInfo) {
+			return fmt.Errorf("the output path must be different from the checkpoint path")
+		}
+	}
+
+	opts := internal.RedactOptions{
+		EnvVars: *redactEnvVars,
+		Files:   *redactFiles,
+	}
+	for _, pattern := range *redactPatterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return fmt.Errorf("invalid regex pattern %q: %w", pattern, err)
+		}
+		opts.Rules = append(opts.Rules, internal.SecretRule{Name: pattern, Pattern: re})
+	}
+	if *redactSecrets {
+		opts.Rules = append(opts.Rules, internal.DefaultSecretRules()...)
+	}
+
+	requiredFiles := []string{
+		metadata.SpecDumpFile, metadata.ConfigDumpFile,
+		filepath.Join(metadata.CheckpointDirectory, "pstree.img"),
+		filepath.Join(metadata.CheckpointDirectory, "core-"),
+		filepath.Join(metadata.CheckpointDirectory, "pagemap-"),
+		filepath.Join(metadata.CheckpointDirectory, "pages-"),
+		filepath.Join(metadata.CheckpointDirectory, "mm-"),
+		// The backing resources of the memory regions are in files.img and memfd.img
+		filepath.Join(metadata.CheckpointDirectory, "files.img"),
+		filepath.Join(metadata.CheckpointDirectory, "memfd.img"),
+	}
+
+	tasks, err := internal.CreateTasks(args[:1], requiredFiles)
+	if err != nil {
+		return err
+	}
+	defer internal.CleanupTasks(tasks)
+
+	items, err := internal.RedactCheckpoint(tasks[0], output, opts)
+	if err != nil {
+		return err
+	}
+
+	if len(items) == 0 {
+		fmt.Printf("Nothing was redacted, copied checkpoint: %s to: %s\n", input, output)
+		return nil
+	}
+
+	w := internal.GetNewTabWriter(os.Stdout)
+	internal.WriteTableHeader(w, []string{"Source", "PID", "Command", "Location", "Reason", "Length"})
+
+	var rows [][]string
+	for _, item := range items {
+		pid := "-"
+		if item.PID != 0 {
+			pid = fmt.Sprintf("%d", item.PID)
+		}
+		comm := item.Comm
+		if comm == "" {
+			comm = "-"
+		}
+		rows = append(rows, []string{item.Source, pid, comm, item.Location, item.Reason, fmt.Sprintf("%d", item.Length)})
+	}
+
+	internal.WriteTableRows(w, rows)
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Printf("\nRedacted %d items of checkpoint: %s in: %s\n", len(items), input, output)
+
+	return nil
+}
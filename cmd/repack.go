@@ -0,0 +1,78 @@
+// SPDX-License-Identifier: Apache-2.0
+
+// This file is used to change the compression of container checkpoints
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/checkpoint-restore/checkpointctl/internal"
+	metadata "github.com/checkpoint-restore/checkpointctl/lib"
+	"github.com/spf13/cobra"
+)
+
+func Repack() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "repack <checkpoint-path> <output-path>",
+		Short: "Change the compression of a container checkpoint",
+		Long: `The 'repack' command writes a copy of a container checkpoint archive with a
+different compression. The order of the files is preserved, so that the
+metadata files stay at the front of the archive:
+  checkpointctl repack checkpoint.tar checkpoint.tar.zst --compression zstd --level 19`,
+		RunE: repack,
+		Args: cobra.ExactArgs(2),
+	}
+
+	flags := cmd.Flags()
+
+	flags.StringVar(
+		repackCompression,
+		"compression",
+		internal.CompressionZstd,
+		"Specify the compression of the output: none, gzip, zstd or xz",
+	)
+	flags.IntVar(
+		repackLevel,
+		"level",
+		0,
+		"Specify the compression level (gzip: 1-9, zstd: 1-22, not supported for xz, default level of the compression if 0)",
+	)
+
+	return cmd
+}
+
+func repack(cmd *cobra.Command, args []string) error {
+	if err := internal.ValidateCompressionLevel(*repackCompression, *repackLevel); err != nil {
+		return err
+	}
+
+	input, output := args[0], args[1]
+	if outputInfo, err := os.Stat(output); err == nil {
+		if inputInfo, err := os.Stat(input); err == nil && os.SameFile(inputInfo, outputInfo) {
+			return fmt.Errorf("the output path must be different from the checkpoint path")
+		}
+	}
+
+	result, err := internal.RepackCheckpoint(input, output, *repackCompression, *repackLevel)
+	if err != nil {
+		return err
+	}
+
+	ratio := 0.0
+	if result.InputSize > 0 {
+		ratio = 100 * float64(result.OutputSize) / float64(result.InputSize)
+	}
+
+	fmt.Printf(
+		"Repacked %d files of checkpoint: %s (%s, %s) to: %s (%s, %s, %.1f%%) in %s\n",
+		result.Members,
+		input, result.InputCompression, metadata.ByteToString(result.InputSize),
+		output, result.OutputCompression, metadata.ByteToString(result.OutputSize), ratio,
+		result.Duration.Round(time.Millisecond),
+	)
+
+	return nil
+}
@@ -0,0 +1,181 @@
+// SPDX-License-Identifier: Apache-2.0
+
+// This file is used to scan container checkpoints for secrets
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/checkpoint-restore/checkpointctl/internal"
+	metadata "github.com/checkpoint-restore/checkpointctl/lib"
+	"github.com/spf13/cobra"
+)
+
+func ScanSecrets() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "scan-secrets <checkpoint-path> [<checkpoint-path> ...]",
+		Short: "Scan container checkpoints for secrets",
+		Long: `The 'scan-secrets' command searches the environment variables, command lines
+and memory of all processes and the files of the root file system changes of
+container checkpoints for secrets like AWS keys, private keys, JSON Web Tokens
+and other random looking strings. Printable strings in memory and files are
+reported if their entropy reaches --entropy-threshold. Additional rules are specified as regular
+expressions with --rule or --rules-file. The command fails if more secrets than
+the threshold are found:
+  checkpointctl scan-secrets checkpoint.tar --rule 'db-password=password=\S+'`,
+		RunE: scanSecrets,
+		Args: cobra.MinimumNArgs(1),
+	}
+
+	flags := cmd.Flags()
+
+	flags.StringArrayVar(
+		secretRules,
+		"rule",
+		nil,
+		"Add a rule in the form NAME=REGEX (can be specified multiple times)",
+	)
+	flags.StringVar(
+		secretRulesFile,
+		"rules-file",
+		"",
+		"Add the rules of a file with one NAME=REGEX rule per line",
+	)
+	flags.IntVar(
+		secretThreshold,
+		"threshold",
+		0,
+		"Specify the number of secrets which may be found without failing",
+	)
+	flags.Float64Var(
+		secretEntropy,
+		"entropy-threshold",
+		internal.DefaultEntropyThreshold,
+		"Specify the entropy in bits per byte of strings in memory and files reported as secrets (0 disables the check)",
+	)
+	flags.StringVar(
+		searchFormat,
+		"format",
+		"table",
+		"Specify the output format: table or json",
+	)
+
+	return cmd
+}
+
+func scanSecrets(cmd *cobra.Command, args []string) error {
+	if *searchFormat != "table" && *searchFormat != "json" {
+		return fmt.Errorf("invalid output format: %s", *searchFormat)
+	}
+	if *secretEntropy < 0 || *secretEntropy > 8 {
+		return fmt.Errorf("invalid entropy threshold %g: expected a value between 0 and 8", *secretEntropy)
+	}
+
+	rules := internal.DefaultSecretRules()
+	for _, r := range *secretRules {
+		rule, err := internal.ParseSecretRule(r)
+		if err != nil {
+			return err
+		}
+		rules = append(rules, rule)
+	}
+	if *secretRulesFile != "" {
+		fileRules, err := internal.ReadSecretRules(*secretRulesFile)
+		if err != nil {
+			return err
+		}
+		rules = append(rules, fileRules...)
+	}
+
+	requiredFiles := []string{
+		metadata.SpecDumpFile, metadata.ConfigDumpFile,
+		filepath.Join(metadata.CheckpointDirectory, "pstree.img"),
+		filepath.Join(metadata.CheckpointDirectory, "core-"),
+		filepath.Join(metadata.CheckpointDirectory, "pagemap-"),
+		filepath.Join(metadata.CheckpointDirectory, "pages-"),
+		filepath.Join(metadata.CheckpointDirectory, "mm-"),
+		// The backing resources of the memory regions are in files.img and memfd.img
+		filepath.Join(metadata.CheckpointDirectory, "files.img"),
+		filepath.Join(metadata.CheckpointDirectory, "memfd.img"),
+	}
+
+	tasks, err := internal.CreateTasks(args, requiredFiles)
+	if err != nil {
+		return err
+	}
+	defer internal.CleanupTasks(tasks)
+
+	var findings []internal.SecretFinding
+	for _, task := range tasks {
+		result, err := internal.ScanSecrets(task, rules)
+		if err != nil {
+			if len(tasks) > 1 {
+				return fmt.Errorf("%s: %w", task.CheckpointFilePath, err)
+			}
+			return err
+		}
+		findings = append(findings, result...)
+	}
+
+	if err := printSecretFindings(findings, len(tasks) > 1); err != nil {
+		return err
+	}
+
+	if len(findings) > *secretThreshold {
+		return fmt.Errorf("found %d secrets, which exceeds the threshold of %d", len(findings), *secretThreshold)
+	}
+
+	return nil
+}
+
+func printSecretFindings(findings []internal.SecretFinding, showCheckpoint bool) error {
+	if *searchFormat == "json" {
+		if findings == nil {
+			findings = []internal.SecretFinding{}
+		}
+		jsonData, err := json.MarshalIndent(findings, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal secret findings: %w", err)
+		}
+		fmt.Println(string(jsonData))
+		return nil
+	}
+
+	if len(findings) == 0 {
+		fmt.Println("No secrets found")
+		return nil
+	}
+
+	w := internal.GetNewTabWriter(os.Stdout)
+	header := []string{"Rule", "Source", "PID", "Command", "Location", "Preview"}
+	if showCheckpoint {
+		header = append([]string{"Checkpoint"}, header...)
+	}
+
+	internal.WriteTableHeader(w, header)
+
+	var rows [][]string
+	for _, finding := range findings {
+		pid := "-"
+		if finding.PID != 0 {
+			pid = fmt.Sprintf("%d", finding.PID)
+		}
+		comm := finding.Comm
+		if comm == "" {
+			comm = "-"
+		}
+		row := []string{finding.Rule, finding.Source, pid, comm, finding.Location, finding.Preview}
+		if showCheckpoint {
+			row = append([]string{finding.Checkpoint}, row...)
+		}
+		rows = append(rows, row)
+	}
+
+	internal.WriteTableRows(w, rows)
+
+	return w.Flush()
+}
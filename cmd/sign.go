@@ -0,0 +1,144 @@
+// SPDX-License-Identifier: Apache-2.0
+
+// This file is used to sign container checkpoints and to verify their signatures
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/checkpoint-restore/checkpointctl/internal"
+	"github.com/spf13/cobra"
+)
+
+func Sign() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "sign <checkpoint-path>",
+		Short: "Create a detached signature of a container checkpoint",
+		Long: `The 'sign' command creates a detached signature of a container checkpoint
+archive. The signature covers the SHA-256 digests of all files in the archive,
+so that it does not depend on the compression of the archive. Ed25519 and
+ECDSA private keys in PEM format are supported:
+  checkpointctl sign checkpoint.tar --key key.pem`,
+		RunE: sign,
+		Args: cobra.ExactArgs(1),
+	}
+
+	flags := cmd.Flags()
+
+	flags.StringVar(
+		signingKey,
+		"key",
+		"",
+		"Specify the private key used to create the signature",
+	)
+	flags.StringVarP(
+		outputFilePath,
+		"output",
+		"o",
+		"",
+		"Specify the output file to be written to (default \"<checkpoint-path>.sig\")",
+	)
+
+	return cmd
+}
+
+func sign(cmd *cobra.Command, args []string) error {
+	if *signingKey == "" {
+		return fmt.Errorf("please specify the private key with --key")
+	}
+	if *outputFilePath == "" {
+		*outputFilePath = args[0] + ".sig"
+	}
+
+	key, err := internal.LoadSigningKey(*signingKey)
+	if err != nil {
+		return err
+	}
+
+	signature, err := internal.SignCheckpoint(args[0], key)
+	if err != nil {
+		return err
+	}
+
+	if err := internal.WriteCheckpointSignature(*outputFilePath, signature); err != nil {
+		return err
+	}
+
+	fmt.Printf("Signed checkpoint: %s with key: %s in: %s\n", args[0], signature.KeyID, *outputFilePath)
+
+	return nil
+}
+
+func VerifySignature() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "verify-signature <checkpoint-path>",
+		Short: "Verify the detached signature of a container checkpoint",
+		Long: `The 'verify-signature' command verifies a signature created by the 'sign'
+command. If files of the checkpoint were added, removed or modified after
+signing, they are listed:
+  checkpointctl verify-signature checkpoint.tar --key public.pem`,
+		RunE: verifySignature,
+		Args: cobra.ExactArgs(1),
+	}
+
+	flags := cmd.Flags()
+
+	flags.StringVar(
+		signingKey,
+		"key",
+		"",
+		"Specify the public key used to verify the signature",
+	)
+	flags.StringVar(
+		signatureFile,
+		"signature",
+		"",
+		"Specify the signature file (default \"<checkpoint-path>.sig\")",
+	)
+
+	return cmd
+}
+
+func verifySignature(cmd *cobra.Command, args []string) error {
+	if *signingKey == "" {
+		return fmt.Errorf("please specify the public key with --key")
+	}
+	if *signatureFile == "" {
+		*signatureFile = args[0] + ".sig"
+	}
+
+	key, err := internal.LoadVerificationKey(*signingKey)
+	if err != nil {
+		return err
+	}
+
+	signature, err := internal.ReadCheckpointSignature(*signatureFile)
+	if err != nil {
+		return err
+	}
+
+	diff, err := internal.VerifyCheckpointSignature(args[0], signature, key)
+	if errors.Is(err, internal.ErrManifestMismatch) && diff != nil {
+		var changes []string
+		for _, path := range diff.Added {
+			changes = append(changes, "added: "+path)
+		}
+		for _, path := range diff.Removed {
+			changes = append(changes, "removed: "+path)
+		}
+		for _, path := range diff.Modified {
+			changes = append(changes, "modified: "+path)
+		}
+		return fmt.Errorf("%w:\n  %s", err, strings.Join(changes, "\n  "))
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Verified signature of checkpoint: %s with key: %s\n", args[0], signature.KeyID)
+
+	return nil
+}
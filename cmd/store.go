@@ -0,0 +1,205 @@
+// SPDX-License-Identifier: Apache-2.0
+
+// This file is used to manage the local store of container checkpoints
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/checkpoint-restore/checkpointctl/internal"
+	metadata "github.com/checkpoint-restore/checkpointctl/lib"
+	"github.com/spf13/cobra"
+)
+
+var defaultStorePath = "/var/lib/checkpointctl/store"
+
+func StoreCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "store",
+		Short: "Manage the local store of container checkpoints",
+		Long: `The 'store' command manages a local store of container checkpoints. The files
+and memory pages of all checkpoints in the store are deduplicated on disk, so
+that many checkpoints of similar containers need little space. Every
+checkpoint archive can be reconstructed from the store:
+  checkpointctl store add checkpoint.tar
+  checkpointctl store ls
+  checkpointctl store get <id> -o checkpoint.tar`,
+	}
+
+	cmd.PersistentFlags().StringVar(
+		storeDir,
+		"store",
+		defaultStorePath,
+		"Specify the directory of the store",
+	)
+
+	cmd.AddCommand(storeAdd())
+	cmd.AddCommand(storeList())
+	cmd.AddCommand(storeGet())
+	cmd.AddCommand(storeRemove())
+	cmd.AddCommand(storeGC())
+
+	return cmd
+}
+
+func storeAdd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "add <checkpoint-path> [<checkpoint-path> ...]",
+		Short: "Add container checkpoints to the store",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			store := internal.NewCheckpointStore(*storeDir)
+			for _, path := range args {
+				result, err := store.Add(path)
+				if err != nil {
+					return err
+				}
+				if result.Exists {
+					fmt.Printf("Checkpoint: %s is already stored as: %s\n", path, result.Checkpoint.ShortID())
+					continue
+				}
+				fmt.Printf(
+					"Added checkpoint: %s as: %s (%s, %s of new data)\n",
+					path, result.Checkpoint.ShortID(),
+					metadata.ByteToString(result.Checkpoint.Size), metadata.ByteToString(result.NewSize),
+				)
+			}
+			return printStoreStats(store)
+		},
+	}
+}
+
+func storeList() *cobra.Command {
+	return &cobra.Command{
+		Use:     "ls",
+		Aliases: []string{"list"},
+		Short:   "List the container checkpoints in the store",
+		Args:    cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			store := internal.NewCheckpointStore(*storeDir)
+			checkpoints, err := store.List()
+			if err != nil {
+				return err
+			}
+			if len(checkpoints) == 0 {
+				fmt.Printf("No checkpoints found in store %s\n", *storeDir)
+				return nil
+			}
+
+			w := internal.GetNewTabWriter(os.Stdout)
+			internal.WriteTableHeader(w, []string{"ID", "Name", "Container", "Size", "Compression", "Added"})
+
+			var rows [][]string
+			for _, checkpoint := range checkpoints {
+				container := "-"
+				if checkpoint.Config != nil && checkpoint.Config.Container != "" {
+					container = checkpoint.Config.Container
+				}
+				rows = append(rows, []string{
+					checkpoint.ShortID(),
+					checkpoint.Name,
+					container,
+					metadata.ByteToString(checkpoint.Size),
+					checkpoint.Compression,
+					checkpoint.Added.Local().Format(time.RFC822),
+				})
+			}
+
+			internal.WriteTableRows(w, rows)
+			if err := w.Flush(); err != nil {
+				return err
+			}
+			fmt.Println()
+
+			return printStoreStats(store)
+		},
+	}
+}
+
+func storeGet() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "get <id>",
+		Short: "Reconstruct a container checkpoint from the store",
+		Long: `Reconstruct a container checkpoint archive from the store. The checkpoint is
+selected by its ID, a unique prefix of the ID or its name. The uncompressed
+archive is verified to be identical to the archive which was added.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if *outputFilePath == "" {
+				return fmt.Errorf("please specify the output file with --output")
+			}
+			checkpoint, err := internal.NewCheckpointStore(*storeDir).Get(args[0], *outputFilePath)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Wrote checkpoint: %s from store to: %s\n", checkpoint.ShortID(), *outputFilePath)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(
+		outputFilePath,
+		"output",
+		"o",
+		"",
+		"Specify the output file to be written to",
+	)
+
+	return cmd
+}
+
+func storeRemove() *cobra.Command {
+	return &cobra.Command{
+		Use:   "rm <id> [<id> ...]",
+		Short: "Remove container checkpoints from the store",
+		Long: `Remove container checkpoints from the store. The data which is not used by
+other checkpoints is removed by 'checkpointctl store gc'.`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			store := internal.NewCheckpointStore(*storeDir)
+			for _, ref := range args {
+				checkpoint, err := store.Remove(ref)
+				if err != nil {
+					return err
+				}
+				fmt.Printf("Removed checkpoint: %s (%s) from store\n", checkpoint.ShortID(), checkpoint.Name)
+			}
+			return nil
+		},
+	}
+}
+
+func storeGC() *cobra.Command {
+	return &cobra.Command{
+		Use:   "gc",
+		Short: "Remove data which is not used by any checkpoint from the store",
+		Long: `Remove the files and memory pages which are not used by any checkpoint in the
+store. No checkpoints may be added to the store while 'gc' is running.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			store := internal.NewCheckpointStore(*storeDir)
+			removed, freed, err := store.GC()
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Removed %d unused blobs (%s) from store\n", removed, metadata.ByteToString(freed))
+			return printStoreStats(store)
+		},
+	}
+}
+
+func printStoreStats(store *internal.CheckpointStore) error {
+	stats, err := store.Stats()
+	if err != nil {
+		return err
+	}
+	fmt.Printf(
+		"Store %s: %d checkpoints, %s of checkpoints in %s on disk (dedup ratio %.2f)\n",
+		*storeDir, stats.Checkpoints, metadata.ByteToString(stats.Size),
+		metadata.ByteToString(stats.BlobSize), stats.DedupRatio(),
+	)
+	return nil
+}
@@ -0,0 +1,88 @@
+// SPDX-License-Identifier: Apache-2.0
+
+// This file implements the Aho-Corasick algorithm to search many patterns at once
+
+package internal
+
+// patternMatcher finds all occurrences of a set of byte patterns in a
+// single pass over the data.
+type patternMatcher struct {
+	// next is the transition table of the automaton with the failure
+	// transitions already resolved, 256 entries per state
+	next []int32
+	// output lists the indexes of the patterns ending in each state
+	output [][]int
+	// lengths are the lengths of the patterns
+	lengths []int
+}
+
+// newPatternMatcher builds the automaton for the given non-empty patterns.
+func newPatternMatcher(patterns [][]byte) *patternMatcher {
+	m := &patternMatcher{
+		next:    make([]int32, 256),
+		output:  make([][]int, 1),
+		lengths: make([]int, len(patterns)),
+	}
+
+	// Build the trie of the patterns. Missing transitions are -1.
+	for i := range m.next {
+		m.next[i] = -1
+	}
+	for i, pattern := range patterns {
+		m.lengths[i] = len(pattern)
+		state := int32(0)
+		for _, b := range pattern {
+			idx := int(state)*256 + int(b)
+			if m.next[idx] == -1 {
+				m.next[idx] = int32(len(m.output))
+				m.output = append(m.output, nil)
+				for j := 0; j < 256; j++ {
+					m.next = append(m.next, -1)
+				}
+			}
+			state = m.next[idx]
+		}
+		m.output[state] = append(m.output[state], i)
+	}
+
+	// Resolve the failure transitions in breadth-first order, so that the
+	// failure state of each state is complete when it is visited
+	fail := make([]int32, len(m.output))
+	var queue []int32
+	for b := 0; b < 256; b++ {
+		if child := m.next[b]; child == -1 {
+			m.next[b] = 0
+		} else {
+			queue = append(queue, child)
+		}
+	}
+	for len(queue) > 0 {
+		state := queue[0]
+		queue = queue[1:]
+		m.output[state] = append(m.output[state], m.output[fail[state]]...)
+		for b := 0; b < 256; b++ {
+			idx := int(state)*256 + b
+			failNext := m.next[int(fail[state])*256+b]
+			if child := m.next[idx]; child == -1 {
+				m.next[idx] = failNext
+			} else {
+				fail[child] = failNext
+				queue = append(queue, child)
+			}
+		}
+	}
+
+	return m
+}
+
+// findAll calls found with the start offset and the pattern index of every
+// occurrence of a pattern in data, ordered by the end of the occurrence.
+func (m *patternMatcher) findAll(data []byte, found func(offset, pattern int)) {
+	state := int32(0)
+	for i, b := range data {
+		state = m.next[int(state)*256+int(b)]
+		for _, pattern := range m.output[state] {
+			found(i+1-m.lengths[pattern], pattern)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package internal
+
+import (
+	"bytes"
+	"math/rand"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+type patternOccurrence struct {
+	offset, pattern int
+}
+
+func TestPatternMatcher(t *testing.T) {
+	patterns := [][]byte{[]byte("he"), []byte("she"), []byte("his"), []byte("hers")}
+	matcher := newPatternMatcher(patterns)
+
+	var result []patternOccurrence
+	matcher.findAll([]byte("ushers"), func(offset, pattern int) {
+		result = append(result, patternOccurrence{offset, pattern})
+	})
+
+	expected := []patternOccurrence{{1, 1}, {2, 0}, {2, 3}}
+	sortOccurrences(result)
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("Expected %v, got %v", expected, result)
+	}
+}
+
+func TestPatternMatcherBinary(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	data := make([]byte, 4096)
+	for i := range data {
+		// A small alphabet produces many overlapping occurrences
+		data[i] = byte(rng.Intn(4)) * 0x55
+	}
+	patterns := [][]byte{{0x00, 0x55}, {0x55, 0x00, 0x55}, {0xff}, {0xaa, 0xaa, 0xaa, 0xaa}, {0x00}}
+
+	var result []patternOccurrence
+	newPatternMatcher(patterns).findAll(data, func(offset, pattern int) {
+		result = append(result, patternOccurrence{offset, pattern})
+	})
+
+	var expected []patternOccurrence
+	for i := range data {
+		for p, pattern := range patterns {
+			if bytes.HasPrefix(data[i:], pattern) {
+				expected = append(expected, patternOccurrence{i, p})
+			}
+		}
+	}
+	sortOccurrences(result)
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("Expected %d occurrences, got %d", len(expected), len(result))
+	}
+}
+
+func sortOccurrences(occurrences []patternOccurrence) {
+	sort.Slice(occurrences, func(a, b int) bool {
+		if occurrences[a].offset != occurrences[b].offset {
+			return occurrences[a].offset < occurrences[b].offset
+		}
+		return occurrences[a].pattern < occurrences[b].pattern
+	})
+}
@@ -9,11 +9,11 @@ import (
 )
 
 type ChkptConfig struct {
-	Namespace        string
-	Pod              string
-	Container        string
-	ContainerManager string
-	Timestamp        time.Time
+	Namespace        string    `json:"namespace"`
+	Pod              string    `json:"pod"`
+	Container        string    `json:"container"`
+	ContainerManager string    `json:"container_manager"`
+	Timestamp        time.Time `json:"timestamp"`
 }
 
 func ExtractConfigDump(checkpointPath string) (*ChkptConfig, error) {
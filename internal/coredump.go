@@ -0,0 +1,275 @@
+// SPDX-License-Identifier: Apache-2.0
+
+// This file is used to create core dumps of checkpointed processes which can be loaded into gdb
+
+package internal
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/checkpoint-restore/go-criu/v8/crit"
+	core_x86 "github.com/checkpoint-restore/go-criu/v8/crit/images/core-x86"
+	criu_core "github.com/checkpoint-restore/go-criu/v8/crit/images/criu-core"
+)
+
+// Note types which are not defined in debug/elf
+const (
+	ntAuxv elf.NType = 6
+	ntFile elf.NType = 0x46494c45
+)
+
+// prpsinfoArgsLen is the size of pr_psargs in struct elf_prpsinfo.
+const prpsinfoArgsLen = 80
+
+// elfPrstatus is struct elf_prstatus of 64-bit architectures without
+// pr_reg and pr_fpvalid, which follow it.
+type elfPrstatus struct {
+	Signo   int32
+	Code    int32
+	Errno   int32
+	Cursig  int16
+	_       [2]byte
+	Sigpend uint64
+	Sighold uint64
+	Pid     int32
+	Ppid    int32
+	Pgrp    int32
+	Sid     int32
+	// pr_utime, pr_stime, pr_cutime and pr_cstime
+	Times [8]int64
+}
+
+// elfPrpsinfo is struct elf_prpsinfo of 64-bit architectures.
+type elfPrpsinfo struct {
+	State  byte
+	Sname  byte
+	Zomb   byte
+	Nice   int8
+	_      [4]byte
+	Flag   uint64
+	UID    uint32
+	GID    uint32
+	Pid    int32
+	Ppid   int32
+	Pgrp   int32
+	Sid    int32
+	Fname  [16]byte
+	Psargs [prpsinfoArgsLen]byte
+}
+
+// x86FpregsStruct is struct user_fpregs_struct of x86_64.
+type x86FpregsStruct struct {
+	Cwd       uint16
+	Swd       uint16
+	Twd       uint16
+	Fop       uint16
+	Rip       uint64
+	Rdp       uint64
+	Mxcsr     uint32
+	MxcsrMask uint32
+	StSpace   [32]uint32
+	XmmSpace  [64]uint32
+	Padding   [24]uint32
+}
+
+// aarch64FpsimdState is struct user_fpsimd_state of aarch64.
+type aarch64FpsimdState struct {
+	Vregs [64]uint64
+	Fpsr  uint32
+	Fpcr  uint32
+	_     [2]uint32
+}
+
+// WriteCoreDump writes an ELF core file of the given process. In addition
+// to the memory regions, the core file contains the registers of all threads,
+// the process information with the command line, the auxiliary vector and
+// the files mapped into memory. cmdline contains the arguments of the process
+// separated by null bytes.
+func WriteCoreDump(out io.Writer, checkpointOutputDir string, ps *crit.PsTree, regions []MemoryRegion, cmdline []byte, pages *ProcessPages) error {
+	machine, order, err := elfMachine(ps.Core.GetMtype())
+	if err != nil {
+		return err
+	}
+
+	mmEntry, err := readMmEntry(checkpointOutputDir, ps.PID)
+	if err != nil {
+		return fmt.Errorf("failed to read memory mappings of process %d: %w", ps.PID, err)
+	}
+
+	var notes []elfNote
+	for i, tid := range getThreadIDs(ps) {
+		core := ps.Core
+		if tid != ps.PID {
+			core, err = readCoreEntry(checkpointOutputDir, tid)
+			if err != nil {
+				return fmt.Errorf("failed to read registers of thread %d: %w", tid, err)
+			}
+		}
+		regs, fpregs, err := threadRegisterNotes(core, order)
+		if err != nil {
+			return fmt.Errorf("failed to read registers of thread %d: %w", tid, err)
+		}
+
+		notes = append(notes, elfNote{"CORE", elf.NT_PRSTATUS, buildPrstatus(ps, tid, core, regs, fpregs != nil, order)})
+		// The notes describing the whole process follow the registers
+		// of the first thread, in the same way as in Linux core dumps
+		if i == 0 {
+			auxv := encodeStruct(order, mmEntry.GetMmSavedAuxv())
+			notes = append(notes,
+				elfNote{"CORE", elf.NT_PRPSINFO, buildPrpsinfo(ps, cmdline, order)},
+				elfNote{"CORE", ntAuxv, auxv},
+				elfNote{"CORE", ntFile, buildFileNote(regions, order)},
+			)
+		}
+		if fpregs != nil {
+			notes = append(notes, elfNote{"CORE", elf.NT_FPREGSET, fpregs})
+		}
+	}
+
+	return writeElfCore(out, machine, order, notes, regions, pages)
+}
+
+// threadRegisterNotes returns the general purpose registers in the layout of
+// elf_gregset_t and the floating point registers in the layout of
+// elf_fpregset_t of a thread. The floating point registers are nil if they
+// are not part of the checkpoint.
+func threadRegisterNotes(core *criu_core.CoreEntry, order binary.ByteOrder) ([]byte, []byte, error) {
+	switch core.GetMtype() {
+	case criu_core.CoreEntry_X86_64:
+		gp := core.GetThreadInfo().GetGpregs()
+		if gp == nil {
+			return nil, nil, fmt.Errorf("no registers found")
+		}
+		if gp.GetMode() == core_x86.UserX86RegsMode_COMPAT {
+			return nil, nil, fmt.Errorf("32-bit compat processes are not supported")
+		}
+		// The order of struct user_regs_struct
+		regs := encodeStruct(order, []uint64{
+			gp.GetR15(), gp.GetR14(), gp.GetR13(), gp.GetR12(), gp.GetBp(), gp.GetBx(),
+			gp.GetR11(), gp.GetR10(), gp.GetR9(), gp.GetR8(), gp.GetAx(), gp.GetCx(),
+			gp.GetDx(), gp.GetSi(), gp.GetDi(), gp.GetOrigAx(), gp.GetIp(), gp.GetCs(),
+			gp.GetFlags(), gp.GetSp(), gp.GetSs(), gp.GetFsBase(), gp.GetGsBase(),
+			gp.GetDs(), gp.GetEs(), gp.GetFs(), gp.GetGs(),
+		})
+
+		fp := core.GetThreadInfo().GetFpregs()
+		if fp == nil {
+			return regs, nil, nil
+		}
+		fpregs := x86FpregsStruct{
+			Cwd:       uint16(fp.GetCwd()),
+			Swd:       uint16(fp.GetSwd()),
+			Twd:       uint16(fp.GetTwd()),
+			Fop:       uint16(fp.GetFop()),
+			Rip:       fp.GetRip(),
+			Rdp:       fp.GetRdp(),
+			Mxcsr:     fp.GetMxcsr(),
+			MxcsrMask: fp.GetMxcsrMask(),
+		}
+		copy(fpregs.StSpace[:], fp.GetStSpace())
+		copy(fpregs.XmmSpace[:], fp.GetXmmSpace())
+		copy(fpregs.Padding[:], fp.GetPadding())
+		return regs, encodeStruct(order, fpregs), nil
+	case criu_core.CoreEntry_AARCH64:
+		gp := core.GetTiAarch64().GetGpregs()
+		if gp == nil {
+			return nil, nil, fmt.Errorf("no registers found")
+		}
+		// x0-x30 followed by sp, pc and pstate
+		var values [34]uint64
+		copy(values[:31], gp.GetRegs())
+		values[31], values[32], values[33] = gp.GetSp(), gp.GetPc(), gp.GetPstate()
+		regs := encodeStruct(order, values[:])
+
+		fp := core.GetTiAarch64().GetFpsimd()
+		if fp == nil {
+			return regs, nil, nil
+		}
+		fpregs := aarch64FpsimdState{Fpsr: fp.GetFpsr(), Fpcr: fp.GetFpcr()}
+		copy(fpregs.Vregs[:], fp.GetVregs())
+		return regs, encodeStruct(order, fpregs), nil
+	default:
+		return nil, nil, fmt.Errorf("core dumps are not supported for architecture %s", core.GetMtype())
+	}
+}
+
+// buildPrstatus builds the NT_PRSTATUS note of a thread.
+func buildPrstatus(ps *crit.PsTree, tid uint32, core *criu_core.CoreEntry, regs []byte, fpvalid bool, order binary.ByteOrder) []byte {
+	sighold := core.GetTc().GetBlkSigset()
+	if tc := core.GetThreadCore(); tc != nil && tc.BlkSigset != nil {
+		sighold = tc.GetBlkSigset()
+	}
+
+	var buf bytes.Buffer
+	buf.Write(encodeStruct(order, elfPrstatus{
+		Sighold: sighold,
+		Pid:     int32(tid),
+		Ppid:    int32(ps.Process.GetPpid()),
+		Pgrp:    int32(ps.PgID),
+		Sid:     int32(ps.SID),
+	}))
+	buf.Write(regs)
+	var valid int32
+	if fpvalid {
+		valid = 1
+	}
+	// pr_fpvalid is padded to 8 bytes
+	buf.Write(encodeStruct(order, [2]int32{valid, 0}))
+	return buf.Bytes()
+}
+
+// buildPrpsinfo builds the NT_PRPSINFO note of a process.
+func buildPrpsinfo(ps *crit.PsTree, cmdline []byte, order binary.ByteOrder) []byte {
+	// The state is the index of the state name in "RSDTZW"
+	info := elfPrpsinfo{State: 0, Sname: 'R'}
+	if crit.TaskState(ps.Core.GetTc().GetTaskState()) == crit.TaskStopped {
+		info.State, info.Sname = 3, 'T'
+	}
+	creds := ps.Core.GetThreadCore().GetCreds()
+	info.UID = creds.GetUid()
+	info.GID = creds.GetGid()
+	info.Pid = int32(ps.PID)
+	info.Ppid = int32(ps.Process.GetPpid())
+	info.Pgrp = int32(ps.PgID)
+	info.Sid = int32(ps.SID)
+	copy(info.Fname[:len(info.Fname)-1], ps.Comm)
+
+	args := strings.TrimRight(strings.ReplaceAll(string(cmdline), "\x00", " "), " ")
+	copy(info.Psargs[:prpsinfoArgsLen-1], args)
+
+	return encodeStruct(order, info)
+}
+
+// buildFileNote builds the NT_FILE note listing the files mapped into
+// memory. gdb uses it to find the executable and the shared libraries.
+func buildFileNote(regions []MemoryRegion, order binary.ByteOrder) []byte {
+	pageSize := uint64(os.Getpagesize())
+
+	var mappings []uint64
+	var names bytes.Buffer
+	for _, r := range regions {
+		if r.Status&(vmaFilePrivate|vmaFileShared) == 0 || r.Name == "" {
+			continue
+		}
+		mappings = append(mappings, r.Start, r.End, r.Pgoff/pageSize)
+		names.WriteString(r.Name)
+		names.WriteByte(0)
+	}
+
+	header := []uint64{uint64(len(mappings) / 3), pageSize}
+	return append(encodeStruct(order, append(header, mappings...)), names.Bytes()...)
+}
+
+// encodeStruct encodes fixed-size data with the given byte order.
+func encodeStruct(order binary.ByteOrder, data any) []byte {
+	var buf bytes.Buffer
+	// Writing fixed-size data to a bytes.Buffer does not fail
+	_ = binary.Write(&buf, order, data)
+	return buf.Bytes()
+}
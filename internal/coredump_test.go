@@ -0,0 +1,163 @@
+package internal
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/checkpoint-restore/go-criu/v8/crit"
+	core_x86 "github.com/checkpoint-restore/go-criu/v8/crit/images/core-x86"
+	criu_core "github.com/checkpoint-restore/go-criu/v8/crit/images/criu-core"
+	"github.com/checkpoint-restore/go-criu/v8/crit/images/pstree"
+	"google.golang.org/protobuf/proto"
+)
+
+// readElfNotes decodes the notes of the PT_NOTE segment of a core file.
+func readElfNotes(t *testing.T, f *elf.File) []elfNote {
+	t.Helper()
+	var notes []elfNote
+	for _, prog := range f.Progs {
+		if prog.Type != elf.PT_NOTE {
+			continue
+		}
+		data, err := io.ReadAll(prog.Open())
+		if err != nil {
+			t.Fatal(err)
+		}
+		for len(data) > 0 {
+			namesz := binary.LittleEndian.Uint32(data[0:])
+			descsz := binary.LittleEndian.Uint32(data[4:])
+			typ := binary.LittleEndian.Uint32(data[8:])
+			data = data[12:]
+			name := string(data[:namesz-1])
+			data = data[alignUp(uint64(namesz), 4):]
+			notes = append(notes, elfNote{name: name, typ: elf.NType(typ), desc: data[:descsz]})
+			data = data[alignUp(uint64(descsz), 4):]
+		}
+	}
+	return notes
+}
+
+func TestWriteCoreDump(t *testing.T) {
+	dir := t.TempDir()
+	writeMmImage(t, dir, 1, testVma(0x1000, 0x2000, 0, 0, vmaAreaHeap))
+
+	mtype := criu_core.CoreEntry_X86_64
+	mode := core_x86.UserX86RegsMode_NATIVE
+	ps := &crit.PsTree{
+		PID:     1,
+		PgID:    1,
+		SID:     1,
+		Comm:    "app",
+		Process: &pstree.PstreeEntry{Pid: proto.Uint32(1), Ppid: proto.Uint32(0)},
+		Core: &criu_core.CoreEntry{
+			Mtype: &mtype,
+			Tc:    &criu_core.TaskCoreEntry{TaskState: proto.Uint32(uint32(crit.TaskAlive))},
+			ThreadInfo: &core_x86.ThreadInfoX86{
+				Gpregs: &core_x86.UserX86RegsEntry{
+					Ip:   proto.Uint64(0x401000),
+					Sp:   proto.Uint64(0x7ffc0000),
+					Mode: &mode,
+				},
+			},
+		},
+	}
+	regions := []MemoryRegion{{Start: 0x1000, End: 0x2000, Prot: protRead | protWrite, Name: "[heap]"}}
+	pages := newTestProcessPages(t, [2]uint64{0x1000, 0x2000})
+
+	var out bytes.Buffer
+	if err := WriteCoreDump(&out, dir, ps, regions, []byte("app\x00--verbose\x00"), pages); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	f, err := elf.NewFile(bytes.NewReader(out.Bytes()))
+	if err != nil {
+		t.Fatalf("Failed to parse core file: %v", err)
+	}
+	if len(f.Progs) != 2 || f.Progs[0].Type != elf.PT_NOTE || f.Progs[1].Type != elf.PT_LOAD {
+		t.Fatalf("Unexpected program headers: %+v", f.Progs)
+	}
+
+	notes := readElfNotes(t, f)
+	expectedTypes := []elf.NType{elf.NT_PRSTATUS, elf.NT_PRPSINFO, ntAuxv, ntFile}
+	if len(notes) != len(expectedTypes) {
+		t.Fatalf("Expected %d notes, got %d", len(expectedTypes), len(notes))
+	}
+	for i, note := range notes {
+		if note.name != "CORE" || note.typ != expectedTypes[i] {
+			t.Errorf("Unexpected note %d: %s %v", i, note.name, note.typ)
+		}
+	}
+
+	// struct elf_prstatus of x86_64 is 336 bytes with pr_reg at offset 112
+	prstatus := notes[0].desc
+	if len(prstatus) != 336 {
+		t.Fatalf("Expected NT_PRSTATUS of 336 bytes, got %d", len(prstatus))
+	}
+	if pid := binary.LittleEndian.Uint32(prstatus[32:]); pid != 1 {
+		t.Errorf("Expected pr_pid 1, got %d", pid)
+	}
+	if rip := binary.LittleEndian.Uint64(prstatus[112+16*8:]); rip != 0x401000 {
+		t.Errorf("Expected rip 0x401000, got 0x%x", rip)
+	}
+	if rsp := binary.LittleEndian.Uint64(prstatus[112+19*8:]); rsp != 0x7ffc0000 {
+		t.Errorf("Expected rsp 0x7ffc0000, got 0x%x", rsp)
+	}
+
+	// struct elf_prpsinfo of x86_64 is 136 bytes
+	prpsinfo := notes[1].desc
+	if len(prpsinfo) != 136 {
+		t.Fatalf("Expected NT_PRPSINFO of 136 bytes, got %d", len(prpsinfo))
+	}
+	if fname := string(bytes.TrimRight(prpsinfo[40:56], "\x00")); fname != "app" {
+		t.Errorf("Expected pr_fname app, got %q", fname)
+	}
+	if psargs := string(bytes.TrimRight(prpsinfo[56:], "\x00")); psargs != "app --verbose" {
+		t.Errorf("Expected pr_psargs \"app --verbose\", got %q", psargs)
+	}
+}
+
+func TestWriteCoreDumpUnsupportedArch(t *testing.T) {
+	dir := t.TempDir()
+	writeMmImage(t, dir, 1)
+
+	mtype := criu_core.CoreEntry_PPC64
+	ps := &crit.PsTree{
+		PID:  1,
+		Core: &criu_core.CoreEntry{Mtype: &mtype},
+	}
+
+	err := WriteCoreDump(io.Discard, dir, ps, nil, nil, nil)
+	if err == nil || !strings.Contains(err.Error(), "not supported for architecture PPC64") {
+		t.Errorf("Expected an error for an unsupported architecture, got %v", err)
+	}
+}
+
+func TestBuildFileNote(t *testing.T) {
+	pageSize := uint64(os.Getpagesize())
+	regions := []MemoryRegion{
+		{Start: 0x400000, End: 0x401000, Pgoff: pageSize, Status: vmaFilePrivate, Name: "/usr/bin/app"},
+		{Start: 0x600000, End: 0x601000, Name: "[heap]"},
+		{Start: 0x700000, End: 0x702000, Status: vmaFileShared, Name: "/data/db"},
+	}
+
+	note := buildFileNote(regions, binary.LittleEndian)
+
+	values := make([]uint64, 8)
+	if err := binary.Read(bytes.NewReader(note), binary.LittleEndian, values); err != nil {
+		t.Fatal(err)
+	}
+	expected := []uint64{2, pageSize, 0x400000, 0x401000, 1, 0x700000, 0x702000, 0}
+	for i := range expected {
+		if values[i] != expected[i] {
+			t.Errorf("Expected value %d to be 0x%x, got 0x%x", i, expected[i], values[i])
+		}
+	}
+	if names := string(note[len(expected)*8:]); names != "/usr/bin/app\x00/data/db\x00" {
+		t.Errorf("Unexpected file names %q", names)
+	}
+}
@@ -0,0 +1,56 @@
+// SPDX-License-Identifier: Apache-2.0
+
+// This file is used to decode individual CRIU image files
+
+package internal
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	metadata "github.com/checkpoint-restore/checkpointctl/lib"
+	"github.com/checkpoint-restore/go-criu/v8/crit"
+	criu_core "github.com/checkpoint-restore/go-criu/v8/crit/images/criu-core"
+	"google.golang.org/protobuf/proto"
+)
+
+// readCriuImage decodes the CRIU image file with the given name from the
+// checkpoint directory of an unpacked checkpoint archive.
+func readCriuImage(checkpointOutputDir, name string, entryType proto.Message) (*crit.CriuImage, error) {
+	f, err := os.Open(filepath.Join(checkpointOutputDir, metadata.CheckpointDirectory, name))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	img, err := crit.New(f, nil, "", false, false).Decode(entryType)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %w", name, err)
+	}
+
+	return img, nil
+}
+
+// readCoreEntry returns the core entry of the thread with the given TID.
+func readCoreEntry(checkpointOutputDir string, tid uint32) (*criu_core.CoreEntry, error) {
+	img, err := readCriuImage(checkpointOutputDir, fmt.Sprintf("core-%d.img", tid), &criu_core.CoreEntry{})
+	if err != nil {
+		return nil, err
+	}
+	if len(img.Entries) == 0 {
+		return nil, fmt.Errorf("core-%d.img contains no entries", tid)
+	}
+
+	return img.Entries[0].Message.(*criu_core.CoreEntry), nil
+}
+
+// getThreadIDs returns the IDs of all threads of the given process.
+// The first element is always the thread group leader.
+func getThreadIDs(ps *crit.PsTree) []uint32 {
+	threads := ps.Process.GetThreads()
+	if len(threads) == 0 {
+		return []uint32{ps.PID}
+	}
+	return threads
+}
@@ -0,0 +1,657 @@
+// SPDX-License-Identifier: Apache-2.0
+
+// This file is used to create and apply deltas between checkpoint archives
+
+package internal
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/containers/storage/pkg/archive"
+)
+
+const (
+	// deltaVersion is the version of the delta format
+	deltaVersion = 1
+	// deltaIndexFile is the member of a delta which describes the segments
+	deltaIndexFile = "delta.json"
+	// deltaDataFile is the member of a delta with the data which is not
+	// copied from the base checkpoint
+	deltaDataFile = "data"
+)
+
+// checkpointDelta describes how a checkpoint archive is reconstructed from
+// a base checkpoint archive. The uncompressed tar stream of the checkpoint
+// is the concatenation of all segments. ArchiveDigest is the digest of the
+// original archive file, which differs from Digest for a compressed archive.
+type checkpointDelta struct {
+	Version       int            `json:"version"`
+	BaseDigest    string         `json:"base_digest"`
+	Digest        string         `json:"digest"`
+	ArchiveDigest string         `json:"archive_digest"`
+	Size          int64          `json:"size"`
+	Compression   string         `json:"compression"`
+	Segments      []deltaSegment `json:"segments"`
+}
+
+// deltaSegment is a part of the tar stream of a checkpoint. A segment
+// without a path is read from the data of the delta. Otherwise it is copied
+// from the member of the base checkpoint with the path.
+type deltaSegment struct {
+	Path   string `json:"path,omitempty"`
+	Offset int64  `json:"offset,omitempty"`
+	Size   int64  `json:"size"`
+}
+
+// DeltaResult describes a delta between two checkpoint archives.
+// ArchiveIdentical is set by ApplyCheckpointDelta if the reconstructed
+// archive file is byte-identical to the original archive file, and not
+// only its uncompressed tar stream.
+type DeltaResult struct {
+	Size             int64
+	StoredSize       int64
+	Pages            int
+	MatchedPages     int
+	DeltaSize        int64
+	ArchiveIdentical bool
+}
+
+// pageRef is the location of a page in a pages image of a checkpoint.
+type pageRef struct {
+	path   string
+	offset int64
+}
+
+// memberRef is a regular file of a checkpoint archive.
+type memberRef struct {
+	path string
+	size int64
+}
+
+// baseIndex contains the digests of the pages and files of a base
+// checkpoint archive.
+type baseIndex struct {
+	digest  string
+	pages   map[[sha256.Size]byte]pageRef
+	members map[[sha256.Size]byte]memberRef
+}
+
+// isPagesImage reports whether a member of a checkpoint archive contains
+// memory pages.
+func isPagesImage(path string) bool {
+	return manifestComponent(path) == ManifestComponentPages
+}
+
+// iterateTarStream works like iterateTarArchive, but all bytes of the
+// uncompressed tar stream are written to raw as they are read, including
+// the headers, the padding and the end of the archive.
+func iterateTarStream(archivePath string, raw io.Writer, callback func(r *tar.Reader, header *tar.Header) error) error {
+	archiveFile, err := os.Open(archivePath)
+	if err != nil {
+		return err
+	}
+	defer archiveFile.Close()
+
+	stream, err := archive.DecompressStream(archiveFile)
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+
+	tee := io.TeeReader(stream, raw)
+	tarReader := tar.NewReader(tee)
+	for {
+		header, err := tarReader.Next()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return err
+		}
+		if err := callback(tarReader, header); err != nil {
+			return err
+		}
+	}
+
+	// The padding after the end of the archive is part of the stream
+	_, err = io.Copy(io.Discard, tee)
+	return err
+}
+
+// isPlainFile reports whether the data of a member is stored unchanged in
+// the tar stream. This is not the case for sparse files.
+func isPlainFile(header *tar.Header) bool {
+	if header.Typeflag != tar.TypeReg {
+		return false
+	}
+	for key := range header.PAXRecords {
+		if strings.HasPrefix(key, "GNU.sparse.") {
+			return false
+		}
+	}
+	return true
+}
+
+// tarStreamSplitter splits the uncompressed tar stream of a checkpoint
+// archive into the parts which are stored elsewhere and the remaining data,
+// which is written to a file. The bytes of the stream are collected in
+// pending as they are read, until they are either written to the data file
+// or discarded because they are stored elsewhere.
+type tarStreamSplitter struct {
+	data     *os.File
+	dataSize int64
+	pending  bytes.Buffer
+}
+
+// split iterates over the uncompressed tar stream of an archive, which is
+// written to raw as well. Before each member and at the end of the stream,
+// addData is called for the pending bytes, which are the header of the
+// member and the padding of the previous member. The callback is only called
+// for members whose data is stored unchanged in the stream.
+func (s *tarStreamSplitter) split(archivePath string, raw io.Writer, addData func() error, callback func(r io.Reader, path string) error) error {
+	err := iterateTarStream(archivePath, io.MultiWriter(raw, &s.pending), func(r *tar.Reader, header *tar.Header) error {
+		if err := addData(); err != nil {
+			return err
+		}
+		if !isPlainFile(header) {
+			return nil
+		}
+		return callback(r, strings.TrimPrefix(header.Name, "./"))
+	})
+	if err != nil {
+		return err
+	}
+	return addData()
+}
+
+// writeData writes the pending bytes to the data file and returns their
+// offset in the data file and their size.
+func (s *tarStreamSplitter) writeData() (int64, int64, error) {
+	offset, size := s.dataSize, int64(s.pending.Len())
+	if size == 0 {
+		return offset, 0, nil
+	}
+	if _, err := s.pending.WriteTo(s.data); err != nil {
+		return 0, 0, err
+	}
+	s.dataSize += size
+	return offset, size, nil
+}
+
+// discard drops the pending bytes, which are stored elsewhere.
+func (s *tarStreamSplitter) discard() int64 {
+	size := int64(s.pending.Len())
+	s.pending.Reset()
+	return size
+}
+
+// truncate removes the data written after the given size.
+func (s *tarStreamSplitter) truncate(size int64) error {
+	if err := s.data.Truncate(size); err != nil {
+		return err
+	}
+	if _, err := s.data.Seek(size, io.SeekStart); err != nil {
+		return err
+	}
+	s.dataSize = size
+	return nil
+}
+
+func streamDigest(h hash.Hash) string {
+	return "sha256:" + hex.EncodeToString(h.Sum(nil))
+}
+
+// fileDigest calculates the digest of all bytes of a file.
+func fileDigest(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return streamDigest(h), nil
+}
+
+// indexBaseCheckpoint calculates the digests of all pages and files of a
+// base checkpoint archive.
+func indexBaseCheckpoint(basePath string) (*baseIndex, error) {
+	index := &baseIndex{
+		pages:   make(map[[sha256.Size]byte]pageRef),
+		members: make(map[[sha256.Size]byte]memberRef),
+	}
+	streamHash := sha256.New()
+	page := make([]byte, pageSize)
+
+	err := iterateTarStream(basePath, streamHash, func(r *tar.Reader, header *tar.Header) error {
+		if !isPlainFile(header) {
+			return nil
+		}
+		path := strings.TrimPrefix(header.Name, "./")
+		pages := isPagesImage(path)
+		memberHash := sha256.New()
+		var offset int64
+		for {
+			n, err := io.ReadFull(r, page)
+			if n > 0 {
+				memberHash.Write(page[:n])
+				if pages && n == pageSize {
+					digest := sha256.Sum256(page)
+					if _, exists := index.pages[digest]; !exists {
+						index.pages[digest] = pageRef{path: path, offset: offset}
+					}
+				}
+				offset += int64(n)
+			}
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+				break
+			}
+			if err != nil {
+				return err
+			}
+		}
+		var digest [sha256.Size]byte
+		copy(digest[:], memberHash.Sum(nil))
+		if _, exists := index.members[digest]; !exists {
+			index.members[digest] = memberRef{path: path, size: offset}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	index.digest = streamDigest(streamHash)
+	return index, nil
+}
+
+// deltaWriter collects the segments of a delta. The data which is not
+// copied from the base checkpoint is written to a file.
+type deltaWriter struct {
+	tarStreamSplitter
+	segments []deltaSegment
+}
+
+// addData adds the pending bytes to the data of the delta.
+func (w *deltaWriter) addData() error {
+	_, size, err := w.writeData()
+	if err != nil || size == 0 {
+		return err
+	}
+
+	if n := len(w.segments); n > 0 && w.segments[n-1].Path == "" {
+		w.segments[n-1].Size += size
+	} else {
+		w.segments = append(w.segments, deltaSegment{Size: size})
+	}
+	return nil
+}
+
+// addCopy discards the pending bytes and adds a segment which copies them
+// from a member of the base checkpoint instead.
+func (w *deltaWriter) addCopy(path string, offset, size int64) {
+	w.discard()
+
+	if n := len(w.segments); n > 0 {
+		last := &w.segments[n-1]
+		if last.Path == path && last.Offset+last.Size == offset {
+			last.Size += size
+			return
+		}
+	}
+	w.segments = append(w.segments, deltaSegment{Path: path, Offset: offset, Size: size})
+}
+
+// rewind removes the segments and the data added after a position.
+func (w *deltaWriter) rewind(segments int, lastSize, dataSize int64) error {
+	w.segments = w.segments[:segments]
+	if segments > 0 {
+		w.segments[segments-1].Size = lastSize
+	}
+	return w.truncate(dataSize)
+}
+
+// CreateCheckpointDelta writes a delta to output from which the checkpoint
+// archive newPath is reconstructed with the base checkpoint archive
+// basePath. Memory pages and files which are identical in the base
+// checkpoint are not stored in the delta.
+func CreateCheckpointDelta(basePath, newPath, output string) (*DeltaResult, error) {
+	compression, err := detectArchiveCompression(newPath)
+	if err != nil {
+		return nil, err
+	}
+	if err := ValidateCompressionLevel(compression, 0); err != nil {
+		return nil, fmt.Errorf("%s cannot be reconstructed: %w", newPath, err)
+	}
+
+	index, err := indexBaseCheckpoint(basePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read base checkpoint %s: %w", basePath, err)
+	}
+
+	data, err := os.CreateTemp(filepath.Dir(output), ".delta-data-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(data.Name())
+	defer data.Close()
+
+	w := &deltaWriter{tarStreamSplitter: tarStreamSplitter{data: data}}
+	result := &DeltaResult{}
+	streamHash := sha256.New()
+	page := make([]byte, pageSize)
+
+	err = w.split(newPath, streamHash, w.addData, func(r io.Reader, path string) error {
+		pages := isPagesImage(path)
+		segments, dataSize := len(w.segments), w.dataSize
+		var lastSize int64
+		if segments > 0 {
+			lastSize = w.segments[segments-1].Size
+		}
+
+		memberHash := sha256.New()
+		var offset int64
+		for {
+			n, err := io.ReadFull(r, page)
+			if n > 0 {
+				memberHash.Write(page[:n])
+				if pages && n == pageSize {
+					result.Pages++
+					if ref, ok := index.pages[sha256.Sum256(page)]; ok {
+						result.MatchedPages++
+						w.addCopy(ref.path, ref.offset, int64(n))
+					}
+				}
+				if err := w.addData(); err != nil {
+					return err
+				}
+				offset += int64(n)
+			}
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+				break
+			}
+			if err != nil {
+				return err
+			}
+		}
+
+		// Files which are identical in the base checkpoint are copied
+		var digest [sha256.Size]byte
+		copy(digest[:], memberHash.Sum(nil))
+		if ref, ok := index.members[digest]; ok && ref.size == offset && offset > 0 {
+			if err := w.rewind(segments, lastSize, dataSize); err != nil {
+				return err
+			}
+			w.addCopy(ref.path, 0, offset)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read checkpoint %s: %w", newPath, err)
+	}
+	archiveDigest, err := fileDigest(newPath)
+	if err != nil {
+		return nil, err
+	}
+
+	delta := &checkpointDelta{
+		Version:       deltaVersion,
+		BaseDigest:    index.digest,
+		Digest:        streamDigest(streamHash),
+		ArchiveDigest: archiveDigest,
+		Compression:   compression,
+		Segments:      w.segments,
+	}
+	for _, s := range w.segments {
+		delta.Size += s.Size
+	}
+
+	if err := writeDelta(output, delta, data, w.dataSize); err != nil {
+		os.Remove(output)
+		return nil, err
+	}
+
+	info, err := os.Stat(output)
+	if err != nil {
+		return nil, err
+	}
+	result.Size = delta.Size
+	result.StoredSize = w.dataSize
+	result.DeltaSize = info.Size()
+
+	return result, nil
+}
+
+// writeDelta writes the index and the data of a delta to a zstd compressed
+// tar archive.
+func writeDelta(output string, delta *checkpointDelta, data *os.File, dataSize int64) error {
+	indexData, err := json.Marshal(delta)
+	if err != nil {
+		return err
+	}
+
+	out, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	stream, err := newCompressWriter(out, CompressionZstd, 0)
+	if err != nil {
+		return err
+	}
+	tw := tar.NewWriter(stream)
+
+	if err := tw.WriteHeader(&tar.Header{Name: deltaIndexFile, Mode: 0o644, Size: int64(len(indexData))}); err != nil {
+		return err
+	}
+	if _, err := tw.Write(indexData); err != nil {
+		return err
+	}
+
+	if _, err := data.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if err := tw.WriteHeader(&tar.Header{Name: deltaDataFile, Mode: 0o644, Size: dataSize}); err != nil {
+		return err
+	}
+	if _, err := io.CopyN(tw, data, dataSize); err != nil {
+		return err
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := stream.Close(); err != nil {
+		return err
+	}
+	return out.Close()
+}
+
+// extractBaseMembers extracts the members of a base checkpoint archive
+// which are used by a delta to files in dir and verifies the digest of the
+// base checkpoint.
+func extractBaseMembers(basePath, dir string, delta *checkpointDelta) (map[string]string, error) {
+	needed := make(map[string]bool)
+	for _, s := range delta.Segments {
+		if s.Path != "" {
+			needed[s.Path] = true
+		}
+	}
+
+	files := make(map[string]string)
+	streamHash := sha256.New()
+	err := iterateTarStream(basePath, streamHash, func(r *tar.Reader, header *tar.Header) error {
+		path := strings.TrimPrefix(header.Name, "./")
+		if !needed[path] || !isPlainFile(header) {
+			return nil
+		}
+		if _, exists := files[path]; exists {
+			return nil
+		}
+		// The files are numbered to avoid paths from the archive
+		file := filepath.Join(dir, fmt.Sprintf("member-%d", len(files)))
+		f, err := os.Create(file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		if _, err := io.Copy(f, r); err != nil {
+			return err
+		}
+		files[path] = file
+		return f.Close()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if streamDigest(streamHash) != delta.BaseDigest {
+		return nil, fmt.Errorf("the delta was not created for the base checkpoint %s", basePath)
+	}
+	for path := range needed {
+		if _, ok := files[path]; !ok {
+			return nil, fmt.Errorf("%s is missing in %s", path, basePath)
+		}
+	}
+
+	return files, nil
+}
+
+// ApplyCheckpointDelta reconstructs a checkpoint archive from a base
+// checkpoint archive and a delta created by CreateCheckpointDelta. Only the
+// uncompressed tar stream of the reconstructed archive is guaranteed to be
+// identical to the original and it is verified. A compressed archive is
+// compressed again, which does not necessarily produce the same compressed
+// bytes; whether the archive file is identical as well is reported in
+// ArchiveIdentical.
+func ApplyCheckpointDelta(basePath, deltaPath, output string) (*DeltaResult, error) {
+	deltaFile, err := os.Open(deltaPath)
+	if err != nil {
+		return nil, err
+	}
+	defer deltaFile.Close()
+	stream, err := archive.DecompressStream(deltaFile)
+	if err != nil {
+		return nil, err
+	}
+	defer stream.Close()
+	tr := tar.NewReader(stream)
+
+	// The index is followed by the data
+	header, err := tr.Next()
+	if err != nil || header.Name != deltaIndexFile {
+		return nil, fmt.Errorf("%s is not a checkpoint delta", deltaPath)
+	}
+	var delta checkpointDelta
+	if err := json.NewDecoder(tr).Decode(&delta); err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %w", deltaIndexFile, err)
+	}
+	if delta.Version != deltaVersion {
+		return nil, fmt.Errorf("unsupported delta version %d", delta.Version)
+	}
+	header, err = tr.Next()
+	if err != nil || header.Name != deltaDataFile {
+		return nil, fmt.Errorf("%s is missing in %s", deltaDataFile, deltaPath)
+	}
+
+	tempDir, err := os.MkdirTemp("", "checkpointctl-delta-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tempDir)
+
+	files, err := extractBaseMembers(basePath, tempDir, &delta)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := writeDeltaSegments(output, &delta, tr, files)
+	if err != nil {
+		os.Remove(output)
+		return nil, err
+	}
+
+	info, err := deltaFile.Stat()
+	if err != nil {
+		return nil, err
+	}
+	result.DeltaSize = info.Size()
+
+	return result, nil
+}
+
+// writeDeltaSegments writes the segments of a delta to output.
+func writeDeltaSegments(output string, delta *checkpointDelta, data io.Reader, files map[string]string) (*DeltaResult, error) {
+	out, err := os.Create(output)
+	if err != nil {
+		return nil, err
+	}
+	defer out.Close()
+
+	// The digest of the archive file is calculated from the compressed
+	// bytes as they are written
+	archiveHash := sha256.New()
+	stream, err := newCompressWriter(io.MultiWriter(out, archiveHash), delta.Compression, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	streamHash := sha256.New()
+	w := io.MultiWriter(stream, streamHash)
+	result := &DeltaResult{}
+
+	opened := make(map[string]*os.File)
+	defer func() {
+		for _, f := range opened {
+			f.Close()
+		}
+	}()
+
+	for _, s := range delta.Segments {
+		if s.Path == "" {
+			if _, err := io.CopyN(w, data, s.Size); err != nil {
+				return nil, fmt.Errorf("failed to read data of delta: %w", err)
+			}
+			result.StoredSize += s.Size
+			continue
+		}
+
+		f, ok := opened[s.Path]
+		if !ok {
+			f, err = os.Open(files[s.Path])
+			if err != nil {
+				return nil, err
+			}
+			opened[s.Path] = f
+		}
+		if _, err := io.Copy(w, io.NewSectionReader(f, s.Offset, s.Size)); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := stream.Close(); err != nil {
+		return nil, err
+	}
+	if streamDigest(streamHash) != delta.Digest {
+		return nil, fmt.Errorf("the reconstructed checkpoint does not match the original checkpoint")
+	}
+	result.Size = delta.Size
+	result.ArchiveIdentical = streamDigest(archiveHash) == delta.ArchiveDigest
+
+	return result, out.Close()
+}
@@ -0,0 +1,188 @@
+package internal
+
+import (
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckpointDelta(t *testing.T) {
+	dir := t.TempDir()
+	pages := randomPages(t, 20)
+	core := bytes.Repeat([]byte("core"), 1000)
+
+	base := filepath.Join(dir, "base.tar")
+	writeArchive(t, base, map[string][]byte{
+		"config.dump":            []byte(`{"id":1}`),
+		"checkpoint/core-1.img":  core,
+		"checkpoint/pages-1.img": bytes.Join(pages, nil),
+	})
+
+	// The pages are shifted by a new page, two pages are modified and the
+	// new process shares pages with the first process
+	changed := randomPages(t, 3)
+	newPages := append([][]byte{changed[0]}, pages[:5]...)
+	newPages = append(newPages, changed[1:]...)
+	newPages = append(newPages, pages[7:]...)
+	newCheckpoint := filepath.Join(dir, "new.tar")
+	writeArchive(t, newCheckpoint, map[string][]byte{
+		"config.dump":            []byte(`{"id":2}`),
+		"checkpoint/core-1.img":  core,
+		"checkpoint/pages-1.img": bytes.Join(newPages, nil),
+		"checkpoint/pages-2.img": bytes.Join(pages[:4], nil),
+	})
+
+	deltaPath := filepath.Join(dir, "new.delta")
+	result, err := CreateCheckpointDelta(base, newCheckpoint, deltaPath)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	totalPages, matchedPages := len(newPages)+4, len(newPages)+4-len(changed)
+	if result.Pages != totalPages || result.MatchedPages != matchedPages {
+		t.Errorf("Expected %d of %d matched pages, got %d of %d", matchedPages, totalPages, result.MatchedPages, result.Pages)
+	}
+	// Only the changed pages, the config and the tar headers are stored
+	if result.StoredSize < int64(3*pageSize) || result.StoredSize > int64(3*pageSize+16*1024) {
+		t.Errorf("Unexpected size of stored data %d", result.StoredSize)
+	}
+
+	output := filepath.Join(dir, "reconstructed.tar")
+	applied, err := ApplyCheckpointDelta(base, deltaPath, output)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected, err := os.ReadFile(newCheckpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reconstructed, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(expected, reconstructed) {
+		t.Error("The reconstructed checkpoint differs from the original checkpoint")
+	}
+	if !applied.ArchiveIdentical {
+		t.Error("Expected an identical archive for an uncompressed checkpoint")
+	}
+
+	// The delta cannot be applied to a different base checkpoint
+	if _, err := ApplyCheckpointDelta(newCheckpoint, deltaPath, filepath.Join(dir, "invalid.tar")); err == nil {
+		t.Error("Expected an error for a different base checkpoint")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "invalid.tar")); !os.IsNotExist(err) {
+		t.Errorf("Expected no output for a different base checkpoint, got %v", err)
+	}
+}
+
+func TestDeltaWriterSegments(t *testing.T) {
+	data, err := os.CreateTemp(t.TempDir(), "data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer data.Close()
+	w := &deltaWriter{tarStreamSplitter: tarStreamSplitter{data: data}}
+
+	w.pending.WriteString("header")
+	if err := w.addData(); err != nil {
+		t.Fatal(err)
+	}
+	w.addCopy("pages-1.img", 0, 4096)
+	w.addCopy("pages-1.img", 4096, 4096)
+	w.addCopy("pages-1.img", 16384, 4096)
+	w.pending.WriteString("page")
+	if err := w.addData(); err != nil {
+		t.Fatal(err)
+	}
+	w.pending.WriteString("trailer")
+	if err := w.addData(); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []deltaSegment{
+		{Size: 6},
+		{Path: "pages-1.img", Size: 8192},
+		{Path: "pages-1.img", Offset: 16384, Size: 4096},
+		{Size: 11},
+	}
+	if len(w.segments) != len(expected) {
+		t.Fatalf("Expected segments %+v, got %+v", expected, w.segments)
+	}
+	for i := range expected {
+		if w.segments[i] != expected[i] {
+			t.Errorf("Expected segment %+v, got %+v", expected[i], w.segments[i])
+		}
+	}
+
+	// Rewinding removes the segments and the data after a position
+	if err := w.rewind(1, 6, 6); err != nil {
+		t.Fatal(err)
+	}
+	if len(w.segments) != 1 || w.dataSize != 6 {
+		t.Errorf("Unexpected segments %+v with %d bytes of data after rewinding", w.segments, w.dataSize)
+	}
+	info, err := data.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() != 6 {
+		t.Errorf("Expected 6 bytes of data after rewinding, got %d", info.Size())
+	}
+}
+
+func TestCheckpointDeltaRecompressed(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string][]byte{
+		"config.dump":            []byte(`{"id":1}`),
+		"checkpoint/pages-1.img": bytes.Join(randomPages(t, 4), nil),
+	}
+	base := filepath.Join(dir, "base.tar")
+	writeArchive(t, base, files)
+
+	// The gzip header contains a name, which is not written again
+	newCheckpoint := filepath.Join(dir, "new.tar.gz")
+	f, err := os.Create(newCheckpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gz, err := gzip.NewWriterLevel(f, gzip.BestSpeed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gz.Name = "new.tar"
+	writeTar(t, gz, files)
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	deltaPath := filepath.Join(dir, "new.delta")
+	if _, err := CreateCheckpointDelta(base, newCheckpoint, deltaPath); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	output := filepath.Join(dir, "reconstructed.tar.gz")
+	result, err := ApplyCheckpointDelta(base, deltaPath, output)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.ArchiveIdentical {
+		t.Error("Expected a differing archive for a recompressed checkpoint")
+	}
+
+	// The uncompressed tar stream is identical
+	expected, err := BuildManifest(newCheckpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reconstructed, err := BuildManifest(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changes := CompareManifests(expected, reconstructed); !changes.IsEmpty() {
+		t.Errorf("Unexpected changes in the reconstructed checkpoint: %+v", changes)
+	}
+}
@@ -0,0 +1,190 @@
+// SPDX-License-Identifier: Apache-2.0
+
+// This file is used to export the memory of checkpointed processes as ELF core files
+
+package internal
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+
+	criu_core "github.com/checkpoint-restore/go-criu/v8/crit/images/criu-core"
+)
+
+// elfNote is a note in the PT_NOTE segment of a core file.
+type elfNote struct {
+	name string
+	typ  elf.NType
+	desc []byte
+}
+
+// encodeElfNotes encodes notes in the layout of the PT_NOTE segment.
+// The name and the description are padded to 4 bytes.
+func encodeElfNotes(order binary.ByteOrder, notes []elfNote) []byte {
+	var buf bytes.Buffer
+	for _, n := range notes {
+		name := append([]byte(n.name), 0)
+		// Writing to a bytes.Buffer does not fail
+		_ = binary.Write(&buf, order, [3]uint32{uint32(len(name)), uint32(len(n.desc)), uint32(n.typ)})
+		buf.Write(name)
+		buf.Write(make([]byte, alignUp(uint64(len(name)), 4)-uint64(len(name))))
+		buf.Write(n.desc)
+		buf.Write(make([]byte, alignUp(uint64(len(n.desc)), 4)-uint64(len(n.desc))))
+	}
+	return buf.Bytes()
+}
+
+// elfMachine returns the ELF machine type and byte order of the given
+// CRIU architecture. Only 64-bit architectures are supported.
+func elfMachine(mtype criu_core.CoreEntryMarch) (elf.Machine, binary.ByteOrder, error) {
+	switch mtype {
+	case criu_core.CoreEntry_X86_64:
+		return elf.EM_X86_64, binary.LittleEndian, nil
+	case criu_core.CoreEntry_AARCH64:
+		return elf.EM_AARCH64, binary.LittleEndian, nil
+	case criu_core.CoreEntry_PPC64:
+		// CRIU only supports little-endian ppc64
+		return elf.EM_PPC64, binary.LittleEndian, nil
+	case criu_core.CoreEntry_S390:
+		return elf.EM_S390, binary.BigEndian, nil
+	case criu_core.CoreEntry_MIPS:
+		return elf.EM_MIPS, binary.LittleEndian, nil
+	case criu_core.CoreEntry_LOONGARCH64:
+		return elf.EM_LOONGARCH, binary.LittleEndian, nil
+	case criu_core.CoreEntry_RISCV64:
+		return elf.EM_RISCV, binary.LittleEndian, nil
+	default:
+		return elf.EM_NONE, nil, fmt.Errorf("ELF core files are not supported for architecture %s", mtype)
+	}
+}
+
+// WriteElfCore writes the memory regions of the process with the given PID
+// as an ELF core file. Each region becomes a PT_LOAD segment. Regions
+// without access and regions without any page in the checkpoint, such as
+// unmodified file mappings, are not stored in the file. Other pages which
+// are not part of the checkpoint are zero. If out is an io.Seeker, they are
+// holes in the file.
+func WriteElfCore(out io.Writer, checkpointOutputDir string, pid uint32, regions []MemoryRegion, pages *ProcessPages) error {
+	core, err := readCoreEntry(checkpointOutputDir, pid)
+	if err != nil {
+		return err
+	}
+	machine, order, err := elfMachine(core.GetMtype())
+	if err != nil {
+		return err
+	}
+
+	return writeElfCore(out, machine, order, nil, regions, pages)
+}
+
+// writeElfCore writes an ELF core file. If there are notes, they are
+// stored in a PT_NOTE segment directly after the program headers.
+func writeElfCore(out io.Writer, machine elf.Machine, order binary.ByteOrder, notes []elfNote, regions []MemoryRegion, pages *ProcessPages) error {
+	pageSize := uint64(os.Getpagesize())
+	data := elf.ELFDATA2LSB
+	if order == binary.BigEndian {
+		data = elf.ELFDATA2MSB
+	}
+
+	header := elf.Header64{
+		Ident: [elf.EI_NIDENT]byte{
+			0x7f, 'E', 'L', 'F',
+			byte(elf.ELFCLASS64), byte(data), byte(elf.EV_CURRENT), byte(elf.ELFOSABI_NONE),
+		},
+		Type:      uint16(elf.ET_CORE),
+		Machine:   uint16(machine),
+		Version:   uint32(elf.EV_CURRENT),
+		Phoff:     uint64(binary.Size(elf.Header64{})),
+		Ehsize:    uint16(binary.Size(elf.Header64{})),
+		Phentsize: uint16(binary.Size(elf.Prog64{})),
+		Phnum:     uint16(len(regions)),
+	}
+
+	var noteData []byte
+	if len(notes) > 0 {
+		noteData = encodeElfNotes(order, notes)
+		header.Phnum++
+	}
+
+	// The notes follow the headers and the contents of the memory
+	// regions start page aligned after them
+	headersEnd := header.Phoff + uint64(header.Phnum)*uint64(header.Phentsize)
+	notesEnd := headersEnd + uint64(len(noteData))
+	dataStart := alignUp(notesEnd, pageSize)
+	offset := dataStart
+	progs := make([]elf.Prog64, 0, header.Phnum)
+	if len(notes) > 0 {
+		progs = append(progs, elf.Prog64{
+			Type:   uint32(elf.PT_NOTE),
+			Off:    headersEnd,
+			Filesz: uint64(len(noteData)),
+			Align:  4,
+		})
+	}
+	// Like the kernel and gcore, the contents of regions which cannot be
+	// accessed or which have no pages in the checkpoint are omitted
+	stored := make([]bool, len(regions))
+	for i, r := range regions {
+		stored[i] = r.Prot != 0 && pages.HasPages(r.Start, r.End)
+		var flags elf.ProgFlag
+		if r.Prot&protRead != 0 {
+			flags |= elf.PF_R
+		}
+		if r.Prot&protWrite != 0 {
+			flags |= elf.PF_W
+		}
+		if r.Prot&protExec != 0 {
+			flags |= elf.PF_X
+		}
+		var filesz uint64
+		if stored[i] {
+			filesz = r.Size()
+		}
+		progs = append(progs, elf.Prog64{
+			Type:   uint32(elf.PT_LOAD),
+			Flags:  uint32(flags),
+			Off:    offset,
+			Vaddr:  r.Start,
+			Filesz: filesz,
+			Memsz:  r.Size(),
+			Align:  pageSize,
+		})
+		offset += filesz
+	}
+
+	if err := binary.Write(out, order, header); err != nil {
+		return err
+	}
+	if err := binary.Write(out, order, progs); err != nil {
+		return err
+	}
+	if _, err := out.Write(noteData); err != nil {
+		return err
+	}
+	if len(regions) == 0 {
+		return nil
+	}
+	if _, err := out.Write(make([]byte, dataStart-notesEnd)); err != nil {
+		return err
+	}
+
+	for i, r := range regions {
+		if !stored[i] {
+			continue
+		}
+		if err := pages.WriteMemory(out, r.Start, r.End); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// alignUp rounds v up to the next multiple of align, which has to be a power of 2.
+func alignUp(v, align uint64) uint64 {
+	return (v + align - 1) &^ (align - 1)
+}
@@ -0,0 +1,84 @@
+package internal
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteElfCore(t *testing.T) {
+	regions := []MemoryRegion{
+		{Start: 0x1000, End: 0x3000, Prot: protRead | protWrite},
+		{Start: 0x405000, End: 0x406000, Prot: protRead | protExec},
+		// A reservation without access and a mapping without pages
+		{Start: 0x500000, End: 0x40500000},
+		{Start: 0x7f0000000000, End: 0x7f0000100000, Prot: protRead},
+	}
+	// The second page of the first region is not in the checkpoint
+	pages := newTestProcessPages(t, [2]uint64{0x1000, 0x2000}, [2]uint64{0x405000, 0x406000})
+
+	var out bytes.Buffer
+	if err := writeElfCore(&out, elf.EM_X86_64, binary.LittleEndian, nil, regions, pages); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	f, err := elf.NewFile(bytes.NewReader(out.Bytes()))
+	if err != nil {
+		t.Fatalf("Failed to parse core file: %v", err)
+	}
+	if f.Type != elf.ET_CORE || f.Machine != elf.EM_X86_64 {
+		t.Errorf("Unexpected ELF header: %+v", f.FileHeader)
+	}
+	if len(f.Progs) != 4 {
+		t.Fatalf("Expected 4 program headers, got %d", len(f.Progs))
+	}
+
+	expectedFlags := []elf.ProgFlag{elf.PF_R | elf.PF_W, elf.PF_R | elf.PF_X, 0, elf.PF_R}
+	expectedFilesz := []uint64{0x2000, 0x1000, 0, 0}
+	for i, prog := range f.Progs {
+		if prog.Type != elf.PT_LOAD || prog.Vaddr != regions[i].Start || prog.Memsz != regions[i].Size() ||
+			prog.Filesz != expectedFilesz[i] || prog.Flags != expectedFlags[i] {
+			t.Errorf("Unexpected program header %d: %+v", i, prog.ProgHeader)
+		}
+	}
+
+	data, err := io.ReadAll(f.Progs[0].Open())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, append(bytes.Repeat([]byte{0x1}, 0x1000), make([]byte, 0x1000)...)) {
+		t.Error("Unexpected contents of segment 0")
+	}
+	data, err = io.ReadAll(f.Progs[1].Open())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, bytes.Repeat([]byte{0x5}, 0x1000)) {
+		t.Error("Unexpected contents of segment 1")
+	}
+	if end := f.Progs[1].Off + f.Progs[1].Filesz; uint64(out.Len()) != end {
+		t.Errorf("Expected core file of %d bytes, got %d", end, out.Len())
+	}
+
+	// Written to a file, the missing pages are holes with the same contents
+	path := filepath.Join(t.TempDir(), "core")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writeElfCore(file, elf.EM_X86_64, binary.LittleEndian, nil, regions, pages); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	file.Close()
+	written, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(written, out.Bytes()) {
+		t.Error("Expected the same core file when writing to a file")
+	}
+}
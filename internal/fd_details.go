@@ -0,0 +1,437 @@
+// SPDX-License-Identifier: Apache-2.0
+
+// This file is used to decode the state of anonymous inode file descriptors
+// (timerfd, eventfd, eventpoll, signalfd, inotify, fanotify) and timers
+
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/checkpoint-restore/go-criu/v8/crit"
+	criu_core "github.com/checkpoint-restore/go-criu/v8/crit/images/criu-core"
+	"github.com/checkpoint-restore/go-criu/v8/crit/images/eventpoll"
+	"github.com/checkpoint-restore/go-criu/v8/crit/images/fdinfo"
+	"github.com/checkpoint-restore/go-criu/v8/crit/images/fsnotify"
+	"github.com/checkpoint-restore/go-criu/v8/crit/images/timer"
+	"github.com/checkpoint-restore/go-criu/v8/crit/images/timerfd"
+)
+
+type TimerfdNode struct {
+	Clock    string `json:"clock"`
+	Value    string `json:"value"`
+	Interval string `json:"interval"`
+	Ticks    uint64 `json:"ticks"`
+	Absolute bool   `json:"absolute,omitempty"`
+}
+
+type EventfdNode struct {
+	Counter uint64 `json:"counter"`
+}
+
+type EventpollNode struct {
+	Targets []EventpollTargetNode `json:"targets,omitempty"`
+}
+
+type EventpollTargetNode struct {
+	FD     uint32   `json:"fd"`
+	Events []string `json:"events"`
+	Data   string   `json:"data"`
+}
+
+type SignalfdNode struct {
+	Sigmask string   `json:"sigmask"`
+	Signals []string `json:"signals,omitempty"`
+}
+
+type InotifyNode struct {
+	Watches []InotifyWatchNode `json:"watches,omitempty"`
+}
+
+type InotifyWatchNode struct {
+	WD     uint32   `json:"wd"`
+	Inode  uint64   `json:"inode"`
+	Device string   `json:"device"`
+	Events []string `json:"events"`
+}
+
+type FanotifyNode struct {
+	Marks []FanotifyMarkNode `json:"marks,omitempty"`
+}
+
+type FanotifyMarkNode struct {
+	Type   string   `json:"type"`
+	Target string   `json:"target"`
+	Events []string `json:"events"`
+}
+
+type TimerNode struct {
+	Type     string `json:"type"`
+	ID       uint32 `json:"id,omitempty"`
+	Clock    string `json:"clock,omitempty"`
+	Signal   string `json:"signal,omitempty"`
+	Notify   string `json:"notify,omitempty"`
+	Value    string `json:"value"`
+	Interval string `json:"interval"`
+	Overrun  uint32 `json:"overrun,omitempty"`
+}
+
+type flagName struct {
+	flag uint32
+	name string
+}
+
+// formatFlags returns the names of all flags set in the given mask.
+// Unknown bits are shown as hexadecimal value.
+func formatFlags(mask uint32, names []flagName) []string {
+	var result []string
+	for _, f := range names {
+		if mask&f.flag != 0 {
+			result = append(result, f.name)
+			mask &^= f.flag
+		}
+	}
+	if mask != 0 {
+		result = append(result, fmt.Sprintf("0x%x", mask))
+	}
+	return result
+}
+
+var clockNames = map[uint32]string{
+	0:  "CLOCK_REALTIME",
+	1:  "CLOCK_MONOTONIC",
+	2:  "CLOCK_PROCESS_CPUTIME_ID",
+	3:  "CLOCK_THREAD_CPUTIME_ID",
+	4:  "CLOCK_MONOTONIC_RAW",
+	5:  "CLOCK_REALTIME_COARSE",
+	6:  "CLOCK_MONOTONIC_COARSE",
+	7:  "CLOCK_BOOTTIME",
+	8:  "CLOCK_REALTIME_ALARM",
+	9:  "CLOCK_BOOTTIME_ALARM",
+	11: "CLOCK_TAI",
+}
+
+func clockName(clockID uint32) string {
+	if name, ok := clockNames[clockID]; ok {
+		return name
+	}
+	return fmt.Sprintf("clock %d", clockID)
+}
+
+var epollEvents = []flagName{
+	{0x1, "EPOLLIN"},
+	{0x2, "EPOLLPRI"},
+	{0x4, "EPOLLOUT"},
+	{0x8, "EPOLLERR"},
+	{0x10, "EPOLLHUP"},
+	{0x40, "EPOLLRDNORM"},
+	{0x80, "EPOLLRDBAND"},
+	{0x100, "EPOLLWRNORM"},
+	{0x200, "EPOLLWRBAND"},
+	{0x400, "EPOLLMSG"},
+	{0x2000, "EPOLLRDHUP"},
+	{1 << 28, "EPOLLEXCLUSIVE"},
+	{1 << 29, "EPOLLWAKEUP"},
+	{1 << 30, "EPOLLONESHOT"},
+	{1 << 31, "EPOLLET"},
+}
+
+var inotifyEvents = []flagName{
+	{0x1, "IN_ACCESS"},
+	{0x2, "IN_MODIFY"},
+	{0x4, "IN_ATTRIB"},
+	{0x8, "IN_CLOSE_WRITE"},
+	{0x10, "IN_CLOSE_NOWRITE"},
+	{0x20, "IN_OPEN"},
+	{0x40, "IN_MOVED_FROM"},
+	{0x80, "IN_MOVED_TO"},
+	{0x100, "IN_CREATE"},
+	{0x200, "IN_DELETE"},
+	{0x400, "IN_DELETE_SELF"},
+	{0x800, "IN_MOVE_SELF"},
+	{0x2000, "IN_UNMOUNT"},
+	{0x4000, "IN_Q_OVERFLOW"},
+	{0x8000, "IN_IGNORED"},
+	{0x1000000, "IN_ONLYDIR"},
+	{0x2000000, "IN_DONT_FOLLOW"},
+	{0x4000000, "IN_EXCL_UNLINK"},
+	{0x10000000, "IN_MASK_CREATE"},
+	{0x20000000, "IN_MASK_ADD"},
+	{0x40000000, "IN_ISDIR"},
+	{0x80000000, "IN_ONESHOT"},
+}
+
+var fanotifyEvents = []flagName{
+	{0x1, "FAN_ACCESS"},
+	{0x2, "FAN_MODIFY"},
+	{0x4, "FAN_ATTRIB"},
+	{0x8, "FAN_CLOSE_WRITE"},
+	{0x10, "FAN_CLOSE_NOWRITE"},
+	{0x20, "FAN_OPEN"},
+	{0x40, "FAN_MOVED_FROM"},
+	{0x80, "FAN_MOVED_TO"},
+	{0x100, "FAN_CREATE"},
+	{0x200, "FAN_DELETE"},
+	{0x400, "FAN_DELETE_SELF"},
+	{0x800, "FAN_MOVE_SELF"},
+	{0x1000, "FAN_OPEN_EXEC"},
+	{0x4000, "FAN_Q_OVERFLOW"},
+	{0x10000, "FAN_OPEN_PERM"},
+	{0x20000, "FAN_ACCESS_PERM"},
+	{0x40000, "FAN_OPEN_EXEC_PERM"},
+	{0x08000000, "FAN_EVENT_ON_CHILD"},
+	{0x40000000, "FAN_ONDIR"},
+}
+
+var sigevNotifyNames = map[uint32]string{
+	0: "SIGEV_SIGNAL",
+	1: "SIGEV_NONE",
+	2: "SIGEV_THREAD",
+	4: "SIGEV_THREAD_ID",
+}
+
+// formatTimespec formats the remaining time or interval of a timer.
+// A zero value means that the timer is disarmed or not periodic.
+func formatTimespec(sec, nsec uint64) string {
+	if sec == 0 && nsec == 0 {
+		return "0s"
+	}
+	return (time.Duration(sec)*time.Second + time.Duration(nsec)).String()
+}
+
+// formatDevice formats a kernel device number as major:minor.
+func formatDevice(dev uint32) string {
+	return fmt.Sprintf("%d:%d", dev>>20, dev&0xfffff)
+}
+
+// readFileEntries returns all entries of files.img indexed by their ID.
+// Older CRIU versions store each file type in a separate image, which is not
+// supported, so a missing files.img results in an empty map.
+func readFileEntries(checkpointOutputDir string) (map[uint32]*fdinfo.FileEntry, error) {
+	result := make(map[uint32]*fdinfo.FileEntry)
+
+	img, err := readCriuImage(checkpointOutputDir, "files.img", &fdinfo.FileEntry{})
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return result, nil
+		}
+		return nil, err
+	}
+
+	for _, entry := range img.Entries {
+		file := entry.Message.(*fdinfo.FileEntry)
+		result[file.GetId()] = file
+	}
+
+	return result, nil
+}
+
+// readFdinfoEntries returns the file descriptors of a process indexed by
+// the file descriptor number.
+func readFdinfoEntries(checkpointOutputDir string, pid uint32) (map[string]*fdinfo.FdinfoEntry, error) {
+	img, err := readFdinfoImage(checkpointOutputDir, pid)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file descriptors of process %d: %w", pid, err)
+	}
+
+	result := make(map[string]*fdinfo.FdinfoEntry)
+	for _, entry := range img.Entries {
+		fd := entry.Message.(*fdinfo.FdinfoEntry)
+		result[fmt.Sprintf("%d", fd.GetFd())] = fd
+	}
+
+	return result, nil
+}
+
+// readFdinfoImage reads the fdinfo image of a process. Processes sharing
+// their file descriptor table have the same fdinfo image, which is named
+// after the files ID of the ids image.
+func readFdinfoImage(checkpointOutputDir string, pid uint32) (*crit.CriuImage, error) {
+	img, err := readCriuImage(checkpointOutputDir, fmt.Sprintf("ids-%d.img", pid), &criu_core.TaskKobjIdsEntry{})
+	if err != nil {
+		return nil, err
+	}
+	if len(img.Entries) == 0 {
+		return nil, fmt.Errorf("ids-%d.img contains no entries", pid)
+	}
+	filesID := img.Entries[0].Message.(*criu_core.TaskKobjIdsEntry).GetFilesId()
+
+	return readCriuImage(checkpointOutputDir, fmt.Sprintf("fdinfo-%d.img", filesID), &fdinfo.FdinfoEntry{})
+}
+
+// walkProcessFds calls fn with the file descriptors of every process of the
+// tree which is alive or stopped.
+func walkProcessFds(checkpointOutputDir string, psTree *crit.PsTree, fn func(ps *crit.PsTree, fdinfos map[string]*fdinfo.FdinfoEntry) error) error {
+	return walkAliveProcesses(psTree, func(ps *crit.PsTree) error {
+		fdinfos, err := readFdinfoEntries(checkpointOutputDir, ps.PID)
+		if err != nil {
+			return err
+		}
+		return fn(ps, fdinfos)
+	})
+}
+
+// addFdDetails decodes the state of anonymous inode file descriptors and
+// the timers of each process and adds it to the given file descriptors.
+func addFdDetails(fds []FdNode, checkpointOutputDir string) error {
+	files, err := readFileEntries(checkpointOutputDir)
+	if err != nil {
+		return err
+	}
+
+	for i := range fds {
+		fdinfos, err := readFdinfoEntries(checkpointOutputDir, fds[i].PID)
+		if err != nil {
+			return err
+		}
+
+		for j := range fds[i].OpenFiles {
+			file := &fds[i].OpenFiles[j]
+			fd, ok := fdinfos[strings.TrimPrefix(file.FD, file.Type+" ")]
+			if !ok {
+				continue
+			}
+			if entry, ok := files[fd.GetId()]; ok {
+				addFileEntryDetails(file, entry)
+			}
+		}
+
+		core, err := readCoreEntry(checkpointOutputDir, fds[i].PID)
+		if err != nil {
+			return fmt.Errorf("failed to read timers of process %d: %w", fds[i].PID, err)
+		}
+		fds[i].Timers = buildTimers(core.GetTc().GetTimers())
+	}
+
+	return nil
+}
+
+func addFileEntryDetails(file *OpenFileNode, entry *fdinfo.FileEntry) {
+	switch {
+	case entry.GetTfd() != nil:
+		file.Timerfd = buildTimerfd(entry.GetTfd())
+	case entry.GetEfd() != nil:
+		file.Eventfd = &EventfdNode{Counter: entry.GetEfd().GetCounter()}
+	case entry.GetEpfd() != nil:
+		file.Eventpoll = buildEventpoll(entry.GetEpfd())
+	case entry.GetSgfd() != nil:
+		mask := entry.GetSgfd().GetSigmask()
+		file.Signalfd = &SignalfdNode{
+			Sigmask: fmt.Sprintf("0x%016x", mask),
+			Signals: formatSigset(mask),
+		}
+	case entry.GetIfy() != nil:
+		file.Inotify = buildInotify(entry.GetIfy())
+	case entry.GetFfy() != nil:
+		file.Fanotify = buildFanotify(entry.GetFfy())
+	}
+}
+
+func buildTimerfd(tfd *timerfd.TimerfdEntry) *TimerfdNode {
+	return &TimerfdNode{
+		Clock:    clockName(tfd.GetClockid()),
+		Value:    formatTimespec(tfd.GetVsec(), tfd.GetVnsec()),
+		Interval: formatTimespec(tfd.GetIsec(), tfd.GetInsec()),
+		Ticks:    tfd.GetTicks(),
+		// TFD_TIMER_ABSTIME
+		Absolute: tfd.GetSettimeFlags()&0x1 != 0,
+	}
+}
+
+func buildEventpoll(epfd *eventpoll.EventpollFileEntry) *EventpollNode {
+	node := &EventpollNode{}
+	for _, tfd := range epfd.GetTfd() {
+		node.Targets = append(node.Targets, EventpollTargetNode{
+			FD:     tfd.GetTfd(),
+			Events: formatFlags(tfd.GetEvents(), epollEvents),
+			Data:   fmt.Sprintf("0x%x", tfd.GetData()),
+		})
+	}
+	return node
+}
+
+func buildInotify(ify *fsnotify.InotifyFileEntry) *InotifyNode {
+	node := &InotifyNode{}
+	for _, wd := range ify.GetWd() {
+		node.Watches = append(node.Watches, InotifyWatchNode{
+			WD:     wd.GetWd(),
+			Inode:  wd.GetIIno(),
+			Device: formatDevice(wd.GetSDev()),
+			Events: formatFlags(wd.GetMask(), inotifyEvents),
+		})
+	}
+	return node
+}
+
+func buildFanotify(ffy *fsnotify.FanotifyFileEntry) *FanotifyNode {
+	node := &FanotifyNode{}
+	for _, mark := range ffy.GetMark() {
+		markNode := FanotifyMarkNode{
+			Events: formatFlags(mark.GetMask(), fanotifyEvents),
+		}
+		switch mark.GetType() {
+		case fsnotify.MarkType_MOUNT:
+			markNode.Type = "mount"
+			markNode.Target = mark.GetMe().GetPath()
+			if markNode.Target == "" {
+				markNode.Target = fmt.Sprintf("mount %d", mark.GetMe().GetMntId())
+			}
+		default:
+			markNode.Type = "inode"
+			markNode.Target = fmt.Sprintf("inode %d on %s", mark.GetIe().GetIIno(), formatDevice(mark.GetSDev()))
+		}
+		node.Marks = append(node.Marks, markNode)
+	}
+	return node
+}
+
+// buildTimers returns the interval timers (setitimer) and POSIX timers
+// (timer_create) of a process. Interval timers that are not armed are omitted.
+func buildTimers(timers *timer.TaskTimersEntry) []TimerNode {
+	var result []TimerNode
+
+	itimers := []struct {
+		name  string
+		entry *timer.ItimerEntry
+	}{
+		{"ITIMER_REAL", timers.GetReal()},
+		{"ITIMER_VIRTUAL", timers.GetVirt()},
+		{"ITIMER_PROF", timers.GetProf()},
+	}
+	for _, it := range itimers {
+		if it.entry.GetVsec() == 0 && it.entry.GetVusec() == 0 {
+			continue
+		}
+		result = append(result, TimerNode{
+			Type:     it.name,
+			Value:    formatTimespec(it.entry.GetVsec(), it.entry.GetVusec()*1000),
+			Interval: formatTimespec(it.entry.GetIsec(), it.entry.GetIusec()*1000),
+		})
+	}
+
+	for _, posix := range timers.GetPosix() {
+		node := TimerNode{
+			Type:     "POSIX",
+			ID:       posix.GetItId(),
+			Clock:    clockName(posix.GetClockId()),
+			Notify:   sigevNotifyNames[posix.GetItSigevNotify()],
+			Value:    formatTimespec(posix.GetVsec(), posix.GetVnsec()),
+			Interval: formatTimespec(posix.GetIsec(), posix.GetInsec()),
+			Overrun:  posix.GetOverrun(),
+		}
+		if node.Notify == "" {
+			node.Notify = fmt.Sprintf("%d", posix.GetItSigevNotify())
+		}
+		// SIGEV_NONE and SIGEV_THREAD do not deliver a signal to the process
+		if posix.GetItSigevNotify() == 0 || posix.GetItSigevNotify() == 4 {
+			node.Signal = signalName(int(posix.GetSiSigno()))
+		}
+		result = append(result, node)
+	}
+
+	return result
+}
@@ -0,0 +1,137 @@
+package internal
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/checkpoint-restore/go-criu/v8/crit/images/eventfd"
+	"github.com/checkpoint-restore/go-criu/v8/crit/images/eventpoll"
+	"github.com/checkpoint-restore/go-criu/v8/crit/images/fdinfo"
+	"github.com/checkpoint-restore/go-criu/v8/crit/images/signalfd"
+	"github.com/checkpoint-restore/go-criu/v8/crit/images/timer"
+	"github.com/checkpoint-restore/go-criu/v8/crit/images/timerfd"
+	"github.com/xlab/treeprint"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestFormatFlags(t *testing.T) {
+	result := formatFlags(0x1|0x4|(1<<31)|0x800, epollEvents)
+	expected := []string{"EPOLLIN", "EPOLLOUT", "EPOLLET", "0x800"}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("Expected %v, got %v", expected, result)
+	}
+}
+
+func TestAddFileEntryDetails(t *testing.T) {
+	tests := []struct {
+		name  string
+		entry *fdinfo.FileEntry
+		check func(*OpenFileNode) bool
+	}{
+		{
+			name: "timerfd",
+			entry: &fdinfo.FileEntry{Tfd: &timerfd.TimerfdEntry{
+				Clockid:      proto.Uint32(1),
+				Ticks:        proto.Uint64(3),
+				SettimeFlags: proto.Uint32(0),
+				Vsec:         proto.Uint64(1),
+				Vnsec:        proto.Uint64(500000000),
+				Isec:         proto.Uint64(2),
+				Insec:        proto.Uint64(0),
+			}},
+			check: func(f *OpenFileNode) bool {
+				return reflect.DeepEqual(f.Timerfd, &TimerfdNode{
+					Clock: "CLOCK_MONOTONIC", Value: "1.5s", Interval: "2s", Ticks: 3,
+				})
+			},
+		},
+		{
+			name:  "eventfd",
+			entry: &fdinfo.FileEntry{Efd: &eventfd.EventfdFileEntry{Counter: proto.Uint64(42)}},
+			check: func(f *OpenFileNode) bool { return f.Eventfd != nil && f.Eventfd.Counter == 42 },
+		},
+		{
+			name: "eventpoll",
+			entry: &fdinfo.FileEntry{Epfd: &eventpoll.EventpollFileEntry{
+				Tfd: []*eventpoll.EventpollTfdEntry{
+					{Tfd: proto.Uint32(5), Events: proto.Uint32(0x1 | 0x2000), Data: proto.Uint64(5)},
+				},
+			}},
+			check: func(f *OpenFileNode) bool {
+				return reflect.DeepEqual(f.Eventpoll.Targets, []EventpollTargetNode{
+					{FD: 5, Events: []string{"EPOLLIN", "EPOLLRDHUP"}, Data: "0x5"},
+				})
+			},
+		},
+		{
+			name:  "signalfd",
+			entry: &fdinfo.FileEntry{Sgfd: &signalfd.SignalfdEntry{Sigmask: proto.Uint64(1 << 16)}},
+			check: func(f *OpenFileNode) bool {
+				return f.Signalfd != nil && reflect.DeepEqual(f.Signalfd.Signals, []string{"SIGCHLD"})
+			},
+		},
+	}
+
+	for _, test := range tests {
+		file := OpenFileNode{}
+		addFileEntryDetails(&file, test.entry)
+		if !test.check(&file) {
+			t.Errorf("%s: unexpected details %+v", test.name, file)
+		}
+	}
+}
+
+func TestBuildTimers(t *testing.T) {
+	zero := &timer.ItimerEntry{Isec: proto.Uint64(0), Iusec: proto.Uint64(0), Vsec: proto.Uint64(0), Vusec: proto.Uint64(0)}
+	timers := buildTimers(&timer.TaskTimersEntry{
+		Real: &timer.ItimerEntry{Isec: proto.Uint64(0), Iusec: proto.Uint64(0), Vsec: proto.Uint64(3), Vusec: proto.Uint64(0)},
+		Virt: zero,
+		Prof: zero,
+		Posix: []*timer.PosixTimerEntry{
+			{
+				ItId:          proto.Uint32(0),
+				ClockId:       proto.Uint32(0),
+				SiSigno:       proto.Uint32(10),
+				ItSigevNotify: proto.Uint32(0),
+				Isec:          proto.Uint64(1),
+				Insec:         proto.Uint64(0),
+				Vsec:          proto.Uint64(0),
+				Vnsec:         proto.Uint64(250000000),
+			},
+		},
+	})
+
+	expected := []TimerNode{
+		{Type: "ITIMER_REAL", Value: "3s", Interval: "0s"},
+		{Type: "POSIX", Clock: "CLOCK_REALTIME", Signal: "SIGUSR1", Notify: "SIGEV_SIGNAL", Value: "250ms", Interval: "1s"},
+	}
+	if !reflect.DeepEqual(timers, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, timers)
+	}
+}
+
+func TestAddFdDetailsToTree(t *testing.T) {
+	tree := treeprint.New()
+	fileTree := tree.AddMetaBranch("EVENTPOLL 4", "EVENTPOLL.12")
+	addFdDetailsToTree(fileTree, OpenFileNode{
+		Eventpoll: &EventpollNode{Targets: []EventpollTargetNode{{FD: 5, Events: []string{"EPOLLIN", "EPOLLET"}, Data: "0x5"}}},
+	})
+	addTimersToTree(tree, []TimerNode{
+		{Type: "POSIX", ID: 1, Clock: "CLOCK_MONOTONIC", Notify: "SIGEV_SIGNAL", Signal: "SIGALRM", Value: "1s", Interval: "1s"},
+	})
+	result := tree.String()
+
+	expectedStrings := []string{
+		"Watching fd 5: EPOLLIN|EPOLLET (data 0x5)",
+		"Timers",
+		"[POSIX 1]  remaining 1s, interval 1s",
+		"Clock: CLOCK_MONOTONIC",
+		"Notify: SIGEV_SIGNAL SIGALRM",
+	}
+	for _, expected := range expectedStrings {
+		if !strings.Contains(result, expected) {
+			t.Errorf("Expected tree to contain %q, but it didn't.\nTree:\n%s", expected, result)
+		}
+	}
+}
@@ -0,0 +1,279 @@
+// SPDX-License-Identifier: Apache-2.0
+
+// This file is used to collect and extract the ghost files of a checkpoint
+
+package internal
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	metadata "github.com/checkpoint-restore/checkpointctl/lib"
+	"github.com/checkpoint-restore/go-criu/v8/crit"
+	"github.com/checkpoint-restore/go-criu/v8/crit/images/fdinfo"
+	ghost_file "github.com/checkpoint-restore/go-criu/v8/crit/images/ghost-file"
+	remap_file_path "github.com/checkpoint-restore/go-criu/v8/crit/images/remap-file-path"
+	"google.golang.org/protobuf/proto"
+)
+
+type GhostFileNode struct {
+	ID            uint32            `json:"id"`
+	Path          string            `json:"path"`
+	Size          uint64            `json:"size"`
+	Mode          string            `json:"mode"`
+	UID           uint32            `json:"uid"`
+	GID           uint32            `json:"gid"`
+	Modified      string            `json:"modified,omitempty"`
+	SymlinkTarget string            `json:"symlink_target,omitempty"`
+	Holders       []GhostHolderNode `json:"holders,omitempty"`
+}
+
+type GhostHolderNode struct {
+	PID  uint32 `json:"pid"`
+	FD   uint32 `json:"fd"`
+	Comm string `json:"command"`
+}
+
+// Images of older CRIU versions have no remap type and mark
+// ghost files by setting this bit in the remap ID.
+const remapGhostBit = 1 << 31
+
+// File type bits of st_mode
+const (
+	sIFMT   = 0o170000
+	sIFSOCK = 0o140000
+	sIFLNK  = 0o120000
+	sIFREG  = 0o100000
+	sIFBLK  = 0o060000
+	sIFDIR  = 0o040000
+	sIFCHR  = 0o020000
+	sIFIFO  = 0o010000
+)
+
+// readGhostRemaps returns the files which have been deleted while they were
+// still open, indexed by the ID of their ghost file image. Checkpoints
+// without such files have no remap-fpath.img.
+func readGhostRemaps(checkpointOutputDir string) (map[uint32]uint32, error) {
+	img, err := readCriuImage(checkpointOutputDir, "remap-fpath.img", &remap_file_path.RemapFilePathEntry{})
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	result := make(map[uint32]uint32)
+	for _, entry := range img.Entries {
+		remap := entry.Message.(*remap_file_path.RemapFilePathEntry)
+		switch {
+		case remap.RemapType != nil:
+			if remap.GetRemapType() == remap_file_path.RemapType_GHOST {
+				result[remap.GetRemapId()] = remap.GetOrigId()
+			}
+		case remap.GetRemapId()&remapGhostBit != 0:
+			result[remap.GetRemapId()&^remapGhostBit] = remap.GetOrigId()
+		}
+	}
+
+	return result, nil
+}
+
+// buildJSONGhostFiles lists the ghost files of a checkpoint together with
+// the file descriptors that still reference them.
+func buildJSONGhostFiles(psTree *crit.PsTree, checkpointOutputDir string) ([]GhostFileNode, error) {
+	remaps, err := readGhostRemaps(checkpointOutputDir)
+	if err != nil || len(remaps) == 0 {
+		return nil, err
+	}
+
+	files, err := readFileEntries(checkpointOutputDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []GhostFileNode
+	index := make(map[uint32]int)
+	for id, origID := range remaps {
+		f, entry, err := openGhostFile(checkpointOutputDir, id)
+		if err != nil {
+			return nil, err
+		}
+		f.Close()
+
+		node := buildGhostFileNode(id, entry)
+		node.Path = files[origID].GetReg().GetName()
+		index[origID] = len(result)
+		result = append(result, node)
+	}
+
+	err = walkProcessFds(checkpointOutputDir, psTree, func(ps *crit.PsTree, fdinfos map[string]*fdinfo.FdinfoEntry) error {
+		for _, fd := range fdinfos {
+			if i, ok := index[fd.GetId()]; ok {
+				result[i].Holders = append(result[i].Holders, GhostHolderNode{PID: ps.PID, FD: fd.GetFd(), Comm: ps.Comm})
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(result, func(a, b int) bool { return result[a].ID < result[b].ID })
+	for i := range result {
+		sort.Slice(result[i].Holders, func(a, b int) bool {
+			if result[i].Holders[a].PID != result[i].Holders[b].PID {
+				return result[i].Holders[a].PID < result[i].Holders[b].PID
+			}
+			return result[i].Holders[a].FD < result[i].Holders[b].FD
+		})
+	}
+
+	return result, nil
+}
+
+func buildGhostFileNode(id uint32, entry *ghost_file.GhostFileEntry) GhostFileNode {
+	node := GhostFileNode{
+		ID:            id,
+		Size:          entry.GetSize(),
+		Mode:          fileModeString(entry.GetMode()),
+		UID:           entry.GetUid(),
+		GID:           entry.GetGid(),
+		SymlinkTarget: entry.GetSymlnkTarget(),
+	}
+	if mtim := entry.GetMtim(); mtim != nil {
+		node.Modified = time.Unix(int64(mtim.GetTvSec()), int64(mtim.GetTvUsec())*1000).UTC().Format(time.RFC3339)
+	}
+	return node
+}
+
+// fileModeString formats st_mode in the same way as ls(1).
+func fileModeString(mode uint32) string {
+	fileMode := os.FileMode(mode & 0o777)
+	switch mode & sIFMT {
+	case sIFDIR:
+		fileMode |= os.ModeDir
+	case sIFLNK:
+		fileMode |= os.ModeSymlink
+	case sIFIFO:
+		fileMode |= os.ModeNamedPipe
+	case sIFSOCK:
+		fileMode |= os.ModeSocket
+	case sIFCHR:
+		fileMode |= os.ModeDevice | os.ModeCharDevice
+	case sIFBLK:
+		fileMode |= os.ModeDevice
+	}
+	if mode&0o4000 != 0 {
+		fileMode |= os.ModeSetuid
+	}
+	if mode&0o2000 != 0 {
+		fileMode |= os.ModeSetgid
+	}
+	if mode&0o1000 != 0 {
+		fileMode |= os.ModeSticky
+	}
+	return fileMode.String()
+}
+
+// openGhostFile opens the ghost file image with the given ID and decodes
+// its entry. The returned file is positioned at the start of the contents.
+// go-criu miscalculates the size of contents that are not stored in chunks,
+// which is why the image is decoded here.
+func openGhostFile(checkpointOutputDir string, id uint32) (*os.File, *ghost_file.GhostFileEntry, error) {
+	name := fmt.Sprintf("ghost-file-%x.img", id)
+	f, err := os.Open(filepath.Join(checkpointOutputDir, metadata.CheckpointDirectory, name))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	magic, err := crit.ReadMagic(f)
+	if err != nil {
+		f.Close()
+		return nil, nil, fmt.Errorf("failed to read magic of %s: %w", name, err)
+	}
+	if magic != "GHOST_FILE" {
+		f.Close()
+		return nil, nil, fmt.Errorf("unexpected magic %s in %s", magic, name)
+	}
+
+	entry := &ghost_file.GhostFileEntry{}
+	if err := readSizedEntry(f, entry); err != nil {
+		f.Close()
+		return nil, nil, fmt.Errorf("failed to decode %s: %w", name, err)
+	}
+
+	return f, entry, nil
+}
+
+// readSizedEntry reads a single protobuf entry preceded by its size.
+func readSizedEntry(r io.Reader, entry proto.Message) error {
+	sizeBuf := make([]byte, 4)
+	if _, err := io.ReadFull(r, sizeBuf); err != nil {
+		return err
+	}
+	payload := make([]byte, binary.LittleEndian.Uint32(sizeBuf))
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return err
+	}
+	return proto.Unmarshal(payload, entry)
+}
+
+// ExtractGhostFile writes the contents of the ghost file with the given ID
+// to outputPath. The remap-fpath and ghost-file images have to be unpacked.
+func ExtractGhostFile(checkpointOutputDir string, id uint32, outputPath string) error {
+	f, entry, err := openGhostFile(checkpointOutputDir, id)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("no ghost file with ID %d", id)
+		}
+		return err
+	}
+	defer f.Close()
+
+	if entry.GetMode()&sIFMT != sIFREG {
+		return fmt.Errorf("ghost file %d is not a regular file (%s)", id, fileModeString(entry.GetMode()))
+	}
+
+	out, err := os.OpenFile(outputPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, os.FileMode(entry.GetMode()&0o777))
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	if !entry.GetChunks() {
+		// Older images have no size and the contents extend to the end of the image
+		var src io.Reader = f
+		if entry.Size != nil {
+			src = io.LimitReader(f, int64(entry.GetSize()))
+		}
+		if _, err := io.Copy(out, src); err != nil {
+			return err
+		}
+		return nil
+	}
+
+	// Sparse files are stored as chunks of data with their offset
+	for {
+		chunk := &ghost_file.GhostChunkEntry{}
+		if err := readSizedEntry(f, chunk); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return fmt.Errorf("failed to decode chunk of ghost file %d: %w", id, err)
+		}
+		if _, err := out.Seek(int64(chunk.GetOff()), io.SeekStart); err != nil {
+			return err
+		}
+		if _, err := io.CopyN(out, f, int64(chunk.GetLen())); err != nil {
+			return fmt.Errorf("failed to read chunk of ghost file %d: %w", id, err)
+		}
+	}
+
+	return out.Truncate(int64(entry.GetSize()))
+}
@@ -0,0 +1,162 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/checkpoint-restore/go-criu/v8/crit"
+	criu_core "github.com/checkpoint-restore/go-criu/v8/crit/images/criu-core"
+	"github.com/checkpoint-restore/go-criu/v8/crit/images/fdinfo"
+	"github.com/checkpoint-restore/go-criu/v8/crit/images/fown"
+	ghost_file "github.com/checkpoint-restore/go-criu/v8/crit/images/ghost-file"
+	"github.com/checkpoint-restore/go-criu/v8/crit/images/regfile"
+	remap_file_path "github.com/checkpoint-restore/go-criu/v8/crit/images/remap-file-path"
+	"github.com/xlab/treeprint"
+	"google.golang.org/protobuf/proto"
+)
+
+func ghostFileEntry(size uint64, chunks bool) *ghost_file.GhostFileEntry {
+	return &ghost_file.GhostFileEntry{
+		Uid:    proto.Uint32(1000),
+		Gid:    proto.Uint32(1000),
+		Mode:   proto.Uint32(0o100640),
+		Size:   proto.Uint64(size),
+		Chunks: proto.Bool(chunks),
+	}
+}
+
+func TestBuildJSONGhostFiles(t *testing.T) {
+	dir := t.TempDir()
+	ghostType := remap_file_path.RemapType_GHOST
+	linkedType := remap_file_path.RemapType_LINKED
+	newImageWriter(t, "REMAP_FPATH").
+		entry(&remap_file_path.RemapFilePathEntry{OrigId: proto.Uint32(7), RemapId: proto.Uint32(1), RemapType: &ghostType}).
+		entry(&remap_file_path.RemapFilePathEntry{OrigId: proto.Uint32(8), RemapId: proto.Uint32(9), RemapType: &linkedType}).
+		write(dir, "remap-fpath.img")
+	newImageWriter(t, "GHOST_FILE").entry(ghostFileEntry(5, false)).raw([]byte("hello")).write(dir, "ghost-file-1.img")
+
+	regType := fdinfo.FdTypes_REG
+	newImageWriter(t, "FILES").
+		entry(&fdinfo.FileEntry{
+			Type: &regType,
+			Id:   proto.Uint32(7),
+			Reg: &regfile.RegFileEntry{
+				Id:    proto.Uint32(7),
+				Flags: proto.Uint32(0),
+				Pos:   proto.Uint64(0),
+				Fown: &fown.FownEntry{
+					Uid: proto.Uint32(0), Euid: proto.Uint32(0), Signum: proto.Uint32(0),
+					PidType: proto.Uint32(0), Pid: proto.Uint32(0),
+				},
+				Name: proto.String("/var/log/app.log"),
+			},
+		}).
+		write(dir, "files.img")
+	newImageWriter(t, "IDS").entry(&criu_core.TaskKobjIdsEntry{
+		VmId: proto.Uint32(1), FilesId: proto.Uint32(1), FsId: proto.Uint32(1), SighandId: proto.Uint32(1),
+	}).write(dir, "ids-1.img")
+	newImageWriter(t, "FDINFO").
+		entry(&fdinfo.FdinfoEntry{Id: proto.Uint32(7), Flags: proto.Uint32(0), Type: &regType, Fd: proto.Uint32(3)}).
+		write(dir, "fdinfo-1.img")
+
+	psTree := &crit.PsTree{
+		PID:  1,
+		Comm: "app",
+		Core: &criu_core.CoreEntry{Tc: &criu_core.TaskCoreEntry{TaskState: proto.Uint32(uint32(crit.TaskAlive))}},
+	}
+
+	result, err := buildJSONGhostFiles(psTree, dir)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(result) != 1 {
+		t.Fatalf("Expected 1 ghost file, got %+v", result)
+	}
+	ghost := result[0]
+	if ghost.ID != 1 || ghost.Path != "/var/log/app.log" || ghost.Size != 5 || ghost.Mode != "-rw-r-----" {
+		t.Errorf("Unexpected ghost file: %+v", ghost)
+	}
+	if len(ghost.Holders) != 1 || ghost.Holders[0] != (GhostHolderNode{PID: 1, FD: 3, Comm: "app"}) {
+		t.Errorf("Unexpected holders: %+v", ghost.Holders)
+	}
+}
+
+func TestBuildJSONGhostFilesWithoutImage(t *testing.T) {
+	result, err := buildJSONGhostFiles(&crit.PsTree{}, t.TempDir())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result != nil {
+		t.Errorf("Expected no ghost files, got %+v", result)
+	}
+}
+
+func TestExtractGhostFile(t *testing.T) {
+	dir := t.TempDir()
+	newImageWriter(t, "GHOST_FILE").entry(ghostFileEntry(5, false)).raw([]byte("hello")).write(dir, "ghost-file-1.img")
+	// A sparse file with a hole at the start and at the end
+	newImageWriter(t, "GHOST_FILE").
+		entry(ghostFileEntry(12, true)).
+		entry(&ghost_file.GhostChunkEntry{Off: proto.Uint64(4), Len: proto.Uint64(3)}).
+		raw([]byte("abc")).
+		write(dir, "ghost-file-1a.img")
+
+	tests := []struct {
+		id       uint32
+		expected string
+	}{
+		{1, "hello"},
+		{0x1a, "\x00\x00\x00\x00abc\x00\x00\x00\x00\x00"},
+	}
+	for _, test := range tests {
+		output := filepath.Join(t.TempDir(), "out")
+		if err := ExtractGhostFile(dir, test.id, output); err != nil {
+			t.Fatalf("Unexpected error extracting ghost file %d: %v", test.id, err)
+		}
+		contents, err := os.ReadFile(output)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(contents) != test.expected {
+			t.Errorf("Expected contents %q of ghost file %d, got %q", test.expected, test.id, contents)
+		}
+	}
+
+	err := ExtractGhostFile(dir, 2, filepath.Join(t.TempDir(), "out"))
+	if err == nil || !strings.Contains(err.Error(), "no ghost file with ID 2") {
+		t.Errorf("Expected an error for a missing ghost file, got %v", err)
+	}
+}
+
+func TestAddGhostFilesToTree(t *testing.T) {
+	tree := treeprint.New()
+	addGhostFilesToTree(tree, []GhostFileNode{
+		{
+			ID:       1,
+			Path:     "/var/log/app.log",
+			Size:     2048,
+			Mode:     "-rw-r-----",
+			UID:      1000,
+			GID:      1000,
+			Modified: "2024-01-01T00:00:00Z",
+			Holders:  []GhostHolderNode{{PID: 1, FD: 3, Comm: "app"}},
+		},
+	})
+	result := tree.String()
+
+	expectedStrings := []string{
+		"Ghost files",
+		"[1]  /var/log/app.log",
+		"Size: 2.0 KiB",
+		"Mode: -rw-r----- (UID 1000, GID 1000)",
+		"Modified: 2024-01-01T00:00:00Z",
+		"Held by: app (PID 1, fd 3)",
+	}
+	for _, expected := range expectedStrings {
+		if !strings.Contains(result, expected) {
+			t.Errorf("Expected tree to contain %q, but it didn't.\nTree:\n%s", expected, result)
+		}
+	}
+}
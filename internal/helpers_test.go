@@ -0,0 +1,160 @@
+package internal
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	metadata "github.com/checkpoint-restore/checkpointctl/lib"
+	"github.com/checkpoint-restore/go-criu/v8/magic"
+	"google.golang.org/protobuf/proto"
+)
+
+// imageWriter builds a CRIU image consisting of sized protobuf entries
+// and raw data.
+type imageWriter struct {
+	t   *testing.T
+	buf []byte
+}
+
+func newImageWriter(t *testing.T, magicName string) *imageWriter {
+	magicMap := magic.LoadMagic()
+	w := &imageWriter{t: t}
+	w.buf = binary.LittleEndian.AppendUint32(w.buf, uint32(magicMap.ByName["IMG_COMMON"]))
+	w.buf = binary.LittleEndian.AppendUint32(w.buf, uint32(magicMap.ByName[magicName]))
+	return w
+}
+
+func (w *imageWriter) entry(entry proto.Message) *imageWriter {
+	data, err := proto.Marshal(entry)
+	if err != nil {
+		w.t.Fatal(err)
+	}
+	w.buf = binary.LittleEndian.AppendUint32(w.buf, uint32(len(data)))
+	w.buf = append(w.buf, data...)
+	return w
+}
+
+func (w *imageWriter) raw(data []byte) *imageWriter {
+	w.buf = append(w.buf, data...)
+	return w
+}
+
+func (w *imageWriter) write(dir, name string) {
+	checkpointDir := filepath.Join(dir, metadata.CheckpointDirectory)
+	if err := os.MkdirAll(checkpointDir, 0o700); err != nil {
+		w.t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(checkpointDir, name), w.buf, 0o600); err != nil {
+		w.t.Fatal(err)
+	}
+}
+
+// randomPages returns n pages of random data.
+func randomPages(t *testing.T, n int) [][]byte {
+	t.Helper()
+	pages := make([][]byte, n)
+	for i := range pages {
+		pages[i] = make([]byte, pageSize)
+		if _, err := rand.Read(pages[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return pages
+}
+
+// writeTar writes a tar archive with the given regular files.
+func writeTar(t *testing.T, w io.Writer, files map[string][]byte) {
+	t.Helper()
+	tw := tar.NewWriter(w)
+	for name, content := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(content))}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write(content); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// readTarMembers returns the content of the regular files of a tar archive.
+func readTarMembers(t *testing.T, r io.Reader) map[string]string {
+	t.Helper()
+	members := make(map[string]string)
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return members
+			}
+			t.Fatal(err)
+		}
+		content, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		members[header.Name] = string(content)
+	}
+}
+
+// writeArchive writes an uncompressed archive with the given regular files.
+func writeArchive(t *testing.T, path string, files map[string][]byte) {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	writeTar(t, f, files)
+}
+
+// writeHeaders writes an archive with the given members. Regular files
+// contain the name of the member.
+func writeHeaders(t *testing.T, path string, headers []*tar.Header) {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	tw := tar.NewWriter(f)
+	for _, header := range headers {
+		content := []byte{}
+		if header.Typeflag == tar.TypeReg {
+			content = []byte(header.Name)
+			header.Size = int64(len(content))
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write(content); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// writeRootFsCheckpoint writes a checkpoint archive with the given root file
+// system changes and deleted files.
+func writeRootFsCheckpoint(t *testing.T, path string, files map[string][]byte, deleted string) {
+	t.Helper()
+	var rootFsDiff bytes.Buffer
+	writeTar(t, &rootFsDiff, files)
+	writeArchive(t, path, map[string][]byte{
+		"config.dump":     []byte("{}"),
+		"rootfs-diff.tar": rootFsDiff.Bytes(),
+		"deleted.files":   []byte(deleted),
+	})
+}
@@ -0,0 +1,317 @@
+// SPDX-License-Identifier: Apache-2.0
+
+// This file is used to collect the System V IPC objects of a checkpoint
+
+package internal
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	metadata "github.com/checkpoint-restore/checkpointctl/lib"
+	"github.com/checkpoint-restore/go-criu/v8/crit"
+	ipc_desc "github.com/checkpoint-restore/go-criu/v8/crit/images/ipc-desc"
+	ipc_msg "github.com/checkpoint-restore/go-criu/v8/crit/images/ipc-msg"
+	ipc_sem "github.com/checkpoint-restore/go-criu/v8/crit/images/ipc-sem"
+	ipc_shm "github.com/checkpoint-restore/go-criu/v8/crit/images/ipc-shm"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+type IpcNamespaceNode struct {
+	ID            uint32         `json:"id"`
+	SharedMemory  []ShmNode      `json:"shared_memory,omitempty"`
+	Semaphores    []SemNode      `json:"semaphores,omitempty"`
+	MessageQueues []MsgQueueNode `json:"message_queues,omitempty"`
+}
+
+type IpcOwnerNode struct {
+	ID   uint32 `json:"id"`
+	Key  string `json:"key"`
+	Mode string `json:"mode"`
+	UID  uint32 `json:"uid"`
+	GID  uint32 `json:"gid"`
+}
+
+type ShmNode struct {
+	IpcOwnerNode
+	Size uint64 `json:"size"`
+}
+
+type SemNode struct {
+	IpcOwnerNode
+	Values []uint16 `json:"values"`
+}
+
+type MsgQueueNode struct {
+	IpcOwnerNode
+	Messages uint32 `json:"messages"`
+	Bytes    uint64 `json:"bytes"`
+	MaxBytes uint32 `json:"max_bytes"`
+}
+
+// buildJSONIpc reads the System V IPC objects of all IPC namespaces from the
+// ipcns-shm-*.img, ipcns-sem-*.img and ipcns-msg-*.img files. CRIU only
+// writes these images for IPC namespaces that it dumps, so a checkpoint
+// without them has no IPC objects to show.
+func buildJSONIpc(checkpointOutputDir string) ([]IpcNamespaceNode, error) {
+	namespaces := make(map[uint32]*IpcNamespaceNode)
+	getNamespace := func(id uint32) *IpcNamespaceNode {
+		if namespaces[id] == nil {
+			namespaces[id] = &IpcNamespaceNode{ID: id}
+		}
+		return namespaces[id]
+	}
+
+	shmImages, err := globIpcImages(checkpointOutputDir, "shm")
+	if err != nil {
+		return nil, err
+	}
+	for id, name := range shmImages {
+		segments, err := readIpcShmImage(filepath.Join(checkpointOutputDir, metadata.CheckpointDirectory, name))
+		if err != nil {
+			return nil, err
+		}
+		ns := getNamespace(id)
+		for _, segment := range segments {
+			ns.SharedMemory = append(ns.SharedMemory, ShmNode{
+				IpcOwnerNode: buildIpcOwnerNode(segment.entry.GetDesc()),
+				Size:         segment.entry.GetSize(),
+			})
+		}
+	}
+
+	semImages, err := globIpcImages(checkpointOutputDir, "sem")
+	if err != nil {
+		return nil, err
+	}
+	for id, name := range semImages {
+		img, err := readCriuImage(checkpointOutputDir, name, &ipc_sem.IpcSemEntry{})
+		if err != nil {
+			return nil, err
+		}
+		ns := getNamespace(id)
+		for _, entry := range img.Entries {
+			sem := SemNode{
+				IpcOwnerNode: buildIpcOwnerNode(entry.Message.(*ipc_sem.IpcSemEntry).GetDesc()),
+			}
+			// The semaphore values are stored as JSON array after the entry
+			if err := json.Unmarshal([]byte(entry.Extra), &sem.Values); err != nil {
+				return nil, fmt.Errorf("failed to parse values of semaphore set %d: %w", sem.ID, err)
+			}
+			ns.Semaphores = append(ns.Semaphores, sem)
+		}
+	}
+
+	msgImages, err := globIpcImages(checkpointOutputDir, "msg")
+	if err != nil {
+		return nil, err
+	}
+	for id, name := range msgImages {
+		img, err := readCriuImage(checkpointOutputDir, name, &ipc_msg.IpcMsgEntry{})
+		if err != nil {
+			return nil, err
+		}
+		ns := getNamespace(id)
+		for _, entry := range img.Entries {
+			msgEntry := entry.Message.(*ipc_msg.IpcMsgEntry)
+			queue := MsgQueueNode{
+				IpcOwnerNode: buildIpcOwnerNode(msgEntry.GetDesc()),
+				Messages:     msgEntry.GetQnum(),
+				MaxBytes:     msgEntry.GetQbytes(),
+			}
+			queue.Bytes, err = sumIpcMsgSizes(entry.Extra)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse messages of queue %d: %w", queue.ID, err)
+			}
+			ns.MessageQueues = append(ns.MessageQueues, queue)
+		}
+	}
+
+	result := make([]IpcNamespaceNode, 0, len(namespaces))
+	for _, ns := range namespaces {
+		result = append(result, *ns)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+
+	return result, nil
+}
+
+// globIpcImages returns the image names of the given IPC object type
+// indexed by the IPC namespace ID.
+func globIpcImages(checkpointOutputDir, objectType string) (map[uint32]string, error) {
+	prefix := fmt.Sprintf("ipcns-%s-", objectType)
+	images, err := filepath.Glob(filepath.Join(checkpointOutputDir, metadata.CheckpointDirectory, prefix+"*.img"))
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[uint32]string)
+	for _, image := range images {
+		name := filepath.Base(image)
+		id, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimPrefix(name, prefix), ".img"), 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("unexpected image name %s: %w", name, err)
+		}
+		result[uint32(id)] = name
+	}
+
+	return result, nil
+}
+
+func buildIpcOwnerNode(desc *ipc_desc.IpcDescEntry) IpcOwnerNode {
+	return IpcOwnerNode{
+		ID:   desc.GetId(),
+		Key:  fmt.Sprintf("0x%08x", desc.GetKey()),
+		Mode: fmt.Sprintf("%04o", desc.GetMode()&0o777),
+		UID:  desc.GetUid(),
+		GID:  desc.GetGid(),
+	}
+}
+
+// sumIpcMsgSizes returns the total size of all messages in a queue. go-criu
+// stores the messages as JSON array with alternating message headers and
+// base64 encoded message contents.
+func sumIpcMsgSizes(extra string) (uint64, error) {
+	if extra == "" {
+		return 0, nil
+	}
+
+	var messages []string
+	if err := json.Unmarshal([]byte(extra), &messages); err != nil {
+		return 0, err
+	}
+
+	var total uint64
+	for i := 0; i < len(messages); i += 2 {
+		msg := &ipc_msg.IpcMsg{}
+		if err := protojson.Unmarshal([]byte(messages[i]), msg); err != nil {
+			return 0, err
+		}
+		total += uint64(msg.GetMsize())
+	}
+
+	return total, nil
+}
+
+type ipcShmSegment struct {
+	entry *ipc_shm.IpcShmEntry
+	// contents holds the segment data if it is stored in the image itself
+	contents []byte
+}
+
+// readIpcShmImage decodes an ipcns-shm image. The contents of a segment are
+// either stored directly after its entry or, with newer CRIU versions, in a
+// separate pagemap-shmem image. go-criu always expects the former, which is
+// why the image is decoded here.
+func readIpcShmImage(path string) ([]ipcShmSegment, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	magic, err := crit.ReadMagic(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read magic of %s: %w", filepath.Base(path), err)
+	}
+	if magic != "IPCNS_SHM" {
+		return nil, fmt.Errorf("unexpected magic %s in %s", magic, filepath.Base(path))
+	}
+
+	var result []ipcShmSegment
+	sizeBuf := make([]byte, 4)
+	for {
+		if _, err := io.ReadFull(f, sizeBuf); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, err
+		}
+		payload := make([]byte, binary.LittleEndian.Uint32(sizeBuf))
+		if _, err := io.ReadFull(f, payload); err != nil {
+			return nil, err
+		}
+		entry := &ipc_shm.IpcShmEntry{}
+		if err := proto.Unmarshal(payload, entry); err != nil {
+			return nil, fmt.Errorf("failed to decode %s: %w", filepath.Base(path), err)
+		}
+
+		segment := ipcShmSegment{entry: entry}
+		if !entry.GetInPagemaps() {
+			segment.contents = make([]byte, entry.GetSize())
+			if _, err := io.ReadFull(f, segment.contents); err != nil {
+				return nil, err
+			}
+			// The contents are padded to a multiple of 4 bytes
+			if padding := (4 - entry.GetSize()%4) % 4; padding != 0 {
+				if _, err := f.Seek(int64(padding), io.SeekCurrent); err != nil {
+					return nil, err
+				}
+			}
+		}
+		result = append(result, segment)
+	}
+
+	return result, nil
+}
+
+// ReadIpcShmContents returns the contents of the System V shared memory
+// segment with the given ID in the IPC namespace with the given ID. CRIU
+// assigns namespace IDs starting at 1, so a namespace ID of 0 selects the
+// segment in any namespace, which fails if segments with the same ID exist
+// in several namespaces. The ipcns-shm images and, if the contents are
+// stored in pagemaps, the pagemap-shmem and pages images have to be unpacked.
+func ReadIpcShmContents(checkpointOutputDir string, ipcNsID, shmid uint32) (*bytes.Buffer, error) {
+	images, err := globIpcImages(checkpointOutputDir, "shm")
+	if err != nil {
+		return nil, err
+	}
+	if ipcNsID != 0 {
+		if _, ok := images[ipcNsID]; !ok {
+			return nil, fmt.Errorf("no shared memory segments in IPC namespace %d", ipcNsID)
+		}
+	}
+
+	var found []ipcShmSegment
+	var namespaces []uint32
+	for id, name := range images {
+		if ipcNsID != 0 && id != ipcNsID {
+			continue
+		}
+		segments, err := readIpcShmImage(filepath.Join(checkpointOutputDir, metadata.CheckpointDirectory, name))
+		if err != nil {
+			return nil, err
+		}
+		for _, segment := range segments {
+			if segment.entry.GetDesc().GetId() == shmid {
+				found = append(found, segment)
+				namespaces = append(namespaces, id)
+			}
+		}
+	}
+
+	switch len(found) {
+	case 0:
+		return nil, fmt.Errorf("no shared memory segment with ID %d", shmid)
+	case 1:
+	default:
+		sort.Slice(namespaces, func(i, j int) bool { return namespaces[i] < namespaces[j] })
+		return nil, fmt.Errorf("shared memory segment %d exists in the IPC namespaces %v: please select the namespace", shmid, namespaces)
+	}
+
+	segment := found[0]
+	if !segment.entry.GetInPagemaps() {
+		return bytes.NewBuffer(segment.contents), nil
+	}
+	return readShmemPages(checkpointOutputDir, uint64(shmid), segment.entry.GetSize())
+}
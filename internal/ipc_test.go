@@ -0,0 +1,185 @@
+package internal
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	metadata "github.com/checkpoint-restore/checkpointctl/lib"
+	ipc_desc "github.com/checkpoint-restore/go-criu/v8/crit/images/ipc-desc"
+	ipc_shm "github.com/checkpoint-restore/go-criu/v8/crit/images/ipc-shm"
+	"github.com/checkpoint-restore/go-criu/v8/magic"
+	"github.com/xlab/treeprint"
+	"google.golang.org/protobuf/proto"
+)
+
+// writeIpcShmImage writes an ipcns-shm image with segments whose contents
+// are stored directly in the image. The segment IDs start at firstID.
+func writeIpcShmImage(t *testing.T, dir string, nsID, firstID uint32, segments [][]byte) {
+	t.Helper()
+
+	magicMap := magic.LoadMagic()
+	var buf []byte
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(magicMap.ByName["IMG_COMMON"]))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(magicMap.ByName["IPCNS_SHM"]))
+
+	for i, contents := range segments {
+		entry, err := proto.Marshal(&ipc_shm.IpcShmEntry{
+			Desc: &ipc_desc.IpcDescEntry{
+				Key:  proto.Uint32(0x1234),
+				Uid:  proto.Uint32(1000),
+				Gid:  proto.Uint32(1000),
+				Cuid: proto.Uint32(1000),
+				Cgid: proto.Uint32(1000),
+				Mode: proto.Uint32(0o1600),
+				Id:   proto.Uint32(firstID + uint32(i)),
+			},
+			Size: proto.Uint64(uint64(len(contents))),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(len(entry)))
+		buf = append(buf, entry...)
+		buf = append(buf, contents...)
+		// Pad the contents to a multiple of 4 bytes
+		buf = append(buf, make([]byte, (4-len(contents)%4)%4)...)
+	}
+
+	checkpointDir := filepath.Join(dir, metadata.CheckpointDirectory)
+	if err := os.MkdirAll(checkpointDir, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(checkpointDir, fmt.Sprintf("ipcns-shm-%d.img", nsID)), buf, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBuildJSONIpcSharedMemory(t *testing.T) {
+	dir := t.TempDir()
+	writeIpcShmImage(t, dir, 11, 1, [][]byte{[]byte("hello"), []byte("checkpoint")})
+
+	result, err := buildJSONIpc(dir)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(result) != 1 || result[0].ID != 11 {
+		t.Fatalf("Expected IPC namespace 11, got %+v", result)
+	}
+	shm := result[0].SharedMemory
+	if len(shm) != 2 {
+		t.Fatalf("Expected 2 shared memory segments, got %d", len(shm))
+	}
+	if shm[0].Key != "0x00001234" || shm[0].Mode != "0600" || shm[0].UID != 1000 || shm[0].Size != 5 {
+		t.Errorf("Unexpected first segment: %+v", shm[0])
+	}
+	if shm[1].ID != 2 || shm[1].Size != 10 {
+		t.Errorf("Unexpected second segment: %+v", shm[1])
+	}
+}
+
+func TestBuildJSONIpcNoImages(t *testing.T) {
+	result, err := buildJSONIpc(t.TempDir())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(result) != 0 {
+		t.Errorf("Expected no IPC namespaces, got %+v", result)
+	}
+}
+
+func TestReadIpcShmContents(t *testing.T) {
+	dir := t.TempDir()
+	writeIpcShmImage(t, dir, 11, 1, [][]byte{[]byte("hello"), []byte("checkpoint")})
+
+	buf, err := ReadIpcShmContents(dir, 0, 2)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if buf.String() != "checkpoint" {
+		t.Errorf("Expected contents %q, got %q", "checkpoint", buf.String())
+	}
+
+	if _, err := ReadIpcShmContents(dir, 0, 3); err == nil {
+		t.Error("Expected an error for a missing segment")
+	}
+}
+
+func TestReadIpcShmContentsNamespaces(t *testing.T) {
+	dir := t.TempDir()
+	// The first segment of a namespace has the ID 0
+	writeIpcShmImage(t, dir, 11, 0, [][]byte{[]byte("first"), []byte("second")})
+	writeIpcShmImage(t, dir, 12, 1, [][]byte{[]byte("other")})
+
+	buf, err := ReadIpcShmContents(dir, 0, 0)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if buf.String() != "first" {
+		t.Errorf("Expected contents %q, got %q", "first", buf.String())
+	}
+
+	// Segment 1 exists in both namespaces
+	if _, err := ReadIpcShmContents(dir, 0, 1); err == nil || !strings.Contains(err.Error(), "[11 12]") {
+		t.Errorf("Expected an error for an ambiguous segment, got %v", err)
+	}
+	for nsID, expected := range map[uint32]string{11: "second", 12: "other"} {
+		buf, err := ReadIpcShmContents(dir, nsID, 1)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if buf.String() != expected {
+			t.Errorf("Expected contents %q in namespace %d, got %q", expected, nsID, buf.String())
+		}
+	}
+
+	if _, err := ReadIpcShmContents(dir, 13, 1); err == nil {
+		t.Error("Expected an error for a missing namespace")
+	}
+}
+
+func TestSumIpcMsgSizes(t *testing.T) {
+	extra := `["{\"mtype\":\"1\",\"msize\":5}","aGVsbG8=","{\"mtype\":\"2\",\"msize\":3}","Zm9v"]`
+	total, err := sumIpcMsgSizes(extra)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if total != 8 {
+		t.Errorf("Expected 8 bytes, got %d", total)
+	}
+}
+
+func TestAddIpcNodesToTree(t *testing.T) {
+	owner := IpcOwnerNode{ID: 7, Key: "0x00001234", Mode: "0600", UID: 1000, GID: 1000}
+	tree := treeprint.New()
+	addIpcNodesToTree(tree, []IpcNamespaceNode{
+		{
+			ID:            11,
+			SharedMemory:  []ShmNode{{IpcOwnerNode: owner, Size: 4096}},
+			Semaphores:    []SemNode{{IpcOwnerNode: owner, Values: []uint16{0, 1}}},
+			MessageQueues: []MsgQueueNode{{IpcOwnerNode: owner, Messages: 2, Bytes: 8, MaxBytes: 16384}},
+		},
+	})
+	result := tree.String()
+
+	expectedStrings := []string{
+		"IPC objects",
+		"IPC namespace 11",
+		"Shared memory",
+		"[7]  Key: 0x00001234",
+		"Permissions: 0600 (UID 1000, GID 1000)",
+		"Size: 4.0 KiB",
+		"Values: 0, 1",
+		"Messages: 2 (8 B)",
+		"Max size: 16.0 KiB",
+	}
+	for _, expected := range expectedStrings {
+		if !strings.Contains(result, expected) {
+			t.Errorf("Expected tree to contain %q, but it didn't.\nTree:\n%s", expected, result)
+		}
+	}
+}
@@ -28,23 +28,32 @@ type StatsNode struct {
 }
 
 type PsNode struct {
-	PID       uint32            `json:"pid"`
-	Comm      string            `json:"command"`
-	Cmdline   string            `json:"cmdline,omitempty"`
-	TaskState string            `json:"task_state,omitempty"`
-	EnvVars   map[string]string `json:"environment_variables,omitempty"`
-	Children  []PsNode          `json:"children,omitempty"`
+	PID       uint32                `json:"pid"`
+	Comm      string                `json:"command"`
+	Cmdline   string                `json:"cmdline,omitempty"`
+	TaskState string                `json:"task_state,omitempty"`
+	EnvVars   map[string]string     `json:"environment_variables,omitempty"`
+	Threads   []ThreadNode          `json:"threads,omitempty"`
+	Registers []ThreadRegistersNode `json:"registers,omitempty"`
+	Children  []PsNode              `json:"children,omitempty"`
 }
 
 type FdNode struct {
 	PID       uint32         `json:"pid"`
 	OpenFiles []OpenFileNode `json:"open_files,omitempty"`
+	Timers    []TimerNode    `json:"timers,omitempty"`
 }
 
 type OpenFileNode struct {
-	Type string `json:"type"`
-	FD   string `json:"fd"`
-	Path string `json:"path"`
+	Type      string         `json:"type"`
+	FD        string         `json:"fd"`
+	Path      string         `json:"path"`
+	Timerfd   *TimerfdNode   `json:"timerfd,omitempty"`
+	Eventfd   *EventfdNode   `json:"eventfd,omitempty"`
+	Eventpoll *EventpollNode `json:"eventpoll,omitempty"`
+	Signalfd  *SignalfdNode  `json:"signalfd,omitempty"`
+	Inotify   *InotifyNode   `json:"inotify,omitempty"`
+	Fanotify  *FanotifyNode  `json:"fanotify,omitempty"`
 }
 
 type SkNode struct {
@@ -77,23 +86,30 @@ var socketDataFuncs = map[string]func(*crit.Socket) SkData{
 }
 
 type DisplayNode struct {
-	ContainerName      string         `json:"container_name"`
-	Image              string         `json:"image"`
-	ID                 string         `json:"id"`
-	Runtime            string         `json:"runtime"`
-	Created            string         `json:"created"`
-	Checkpointed       string         `json:"checkpointed,omitempty"`
-	Engine             string         `json:"engine"`
-	IP                 string         `json:"ip,omitempty"`
-	MAC                string         `json:"mac,omitempty"`
-	Networks           []NetworkNode  `json:"networks,omitempty"`
-	CheckpointSize     CheckpointSize `json:"checkpoint_size"`
-	CriuDumpStatistics *StatsNode     `json:"statistics,omitempty"`
-	Metadata           *MetadataNode  `json:"metadata,omitempty"`
-	ProcessTree        *PsNode        `json:"process_tree,omitempty"`
-	FileDescriptors    []FdNode       `json:"file_descriptors,omitempty"`
-	Sockets            []SkNode       `json:"sockets,omitempty"`
-	Mounts             []MountNode    `json:"mounts,omitempty"`
+	ContainerName      string                     `json:"container_name"`
+	Image              string                     `json:"image"`
+	ID                 string                     `json:"id"`
+	Runtime            string                     `json:"runtime"`
+	Created            string                     `json:"created"`
+	Checkpointed       string                     `json:"checkpointed,omitempty"`
+	Engine             string                     `json:"engine"`
+	IP                 string                     `json:"ip,omitempty"`
+	MAC                string                     `json:"mac,omitempty"`
+	Networks           []NetworkNode              `json:"networks,omitempty"`
+	CheckpointSize     CheckpointSize             `json:"checkpoint_size"`
+	CriuDumpStatistics *StatsNode                 `json:"statistics,omitempty"`
+	Metadata           *MetadataNode              `json:"metadata,omitempty"`
+	ProcessTree        *PsNode                    `json:"process_tree,omitempty"`
+	FileDescriptors    []FdNode                   `json:"file_descriptors,omitempty"`
+	Sockets            []SkNode                   `json:"sockets,omitempty"`
+	Mounts             []MountNode                `json:"mounts,omitempty"`
+	MountTree          []MountNamespaceMountsNode `json:"mount_tree,omitempty"`
+	Namespaces         []NamespaceNode            `json:"namespaces,omitempty"`
+	IPC                []IpcNamespaceNode         `json:"ipc,omitempty"`
+	Ttys               []TtyNode                  `json:"ttys,omitempty"`
+	GhostFiles         []GhostFileNode            `json:"ghost_files,omitempty"`
+	SharedMemory       *SharedMemoryNode          `json:"shared_memory,omitempty"`
+	Warnings           []string                   `json:"warnings,omitempty"`
 	// Internal fields for tree rendering (not serialized to JSON)
 	checkpointFilePath string
 }
@@ -112,9 +128,10 @@ type NetworkNode struct {
 }
 
 type MountNode struct {
-	Destination string `json:"destination"`
-	Type        string `json:"type"`
-	Source      string `json:"source"`
+	Destination string   `json:"destination"`
+	Type        string   `json:"type"`
+	Source      string   `json:"source"`
+	Options     []string `json:"options,omitempty"`
 }
 
 type MetadataNode struct {
@@ -232,6 +249,9 @@ func CollectCheckpointData(tasks []Task) ([]DisplayNode, error) {
 			}
 
 			node.FileDescriptors = buildJSONFds(fds)
+			if err := addFdDetails(node.FileDescriptors, task.OutputDir); err != nil {
+				return nil, fmt.Errorf("failed to get file descriptor details: %w", err)
+			}
 		}
 
 		if Sockets {
@@ -250,6 +270,77 @@ func CollectCheckpointData(tasks []Task) ([]DisplayNode, error) {
 			node.Mounts = buildJSONMounts(info.specDump)
 		}
 
+		if MountTree {
+			var err error
+			node.MountTree, err = buildJSONMountTree(task.OutputDir, info.specDump)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get mount tree: %w", err)
+			}
+		}
+
+		if Namespaces {
+			psTree, err := crit.New(nil, nil, checkpointDirectory, false, false).ExplorePs()
+			if err != nil {
+				return nil, fmt.Errorf("failed to get process tree: %w", err)
+			}
+
+			node.Namespaces, err = buildJSONNamespaces(psTree, task.OutputDir)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get namespaces: %w", err)
+			}
+		}
+
+		if IPC {
+			var err error
+			node.IPC, err = buildJSONIpc(task.OutputDir)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get IPC objects: %w", err)
+			}
+		}
+
+		if Ttys {
+			psTree, err := crit.New(nil, nil, checkpointDirectory, false, false).ExplorePs()
+			if err != nil {
+				return nil, fmt.Errorf("failed to get process tree: %w", err)
+			}
+
+			node.Ttys, err = buildJSONTtys(psTree, task.OutputDir)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get terminals: %w", err)
+			}
+		}
+
+		if GhostFiles {
+			psTree, err := crit.New(nil, nil, checkpointDirectory, false, false).ExplorePs()
+			if err != nil {
+				return nil, fmt.Errorf("failed to get process tree: %w", err)
+			}
+
+			node.GhostFiles, err = buildJSONGhostFiles(psTree, task.OutputDir)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get ghost files: %w", err)
+			}
+		}
+
+		if Shmem {
+			psTree, err := crit.New(nil, nil, checkpointDirectory, false, false).ExplorePs()
+			if err != nil {
+				return nil, fmt.Errorf("failed to get process tree: %w", err)
+			}
+
+			node.SharedMemory, err = buildJSONSharedMemory(psTree, task.OutputDir)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get shared memory: %w", err)
+			}
+		}
+
+		// Warnings about problems on restore are shown without options
+		warnings, err := buildTtyWarnings(task.OutputDir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get terminals: %w", err)
+		}
+		node.Warnings = append(node.Warnings, warnings...)
+
 		result = append(result, node)
 	}
 
@@ -280,6 +371,7 @@ func buildJSONMounts(specDump *spec.Spec) []MountNode {
 			Destination: data.Destination,
 			Type:        data.Type,
 			Source:      data.Source,
+			Options:     data.Options,
 		}
 		result = append(result, mountNode)
 	}
@@ -341,12 +433,28 @@ func buildJSONPsNode(psTree *crit.PsTree, checkpointOutputDir string) (PsNode, e
 			}
 			key := envVar[:i]
 			value := envVar[i+1:]
-			envVarMap[key] = value
+			envVarMap[key] = MaskEnvValue(key, value)
 		}
 
 		node.EnvVars = envVarMap
 	}
 
+	if Threads {
+		threads, err := buildJSONThreads(psTree, checkpointOutputDir)
+		if err != nil {
+			return PsNode{}, err
+		}
+		node.Threads = threads
+	}
+
+	if Registers {
+		registers, err := buildJSONRegisters(psTree, checkpointOutputDir)
+		if err != nil {
+			return PsNode{}, err
+		}
+		node.Registers = registers
+	}
+
 	var children []PsNode
 	for _, child := range psTree.Children {
 		childNode, err := buildJSONPsNode(child, checkpointOutputDir)
@@ -0,0 +1,270 @@
+// SPDX-License-Identifier: Apache-2.0
+
+// This file is used to create manifests of the members of checkpoint archives
+
+package internal
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	metadata "github.com/checkpoint-restore/checkpointctl/lib"
+)
+
+// manifestVersion is the first line of the canonical encoding of a manifest
+const manifestVersion = "checkpointctl-manifest-v1"
+
+// Components of a checkpoint archive
+const (
+	ManifestComponentMetadata = "metadata"
+	ManifestComponentCriu     = "criu"
+	ManifestComponentPages    = "pages"
+	ManifestComponentRootFs   = "rootfs"
+	ManifestComponentVolumes  = "volumes"
+)
+
+// manifestComponents is the order of the components in a manifest
+var manifestComponents = []string{
+	ManifestComponentMetadata,
+	ManifestComponentCriu,
+	ManifestComponentPages,
+	ManifestComponentRootFs,
+	ManifestComponentVolumes,
+}
+
+// Types of the members of a checkpoint archive
+const (
+	ManifestTypeFile     = "file"
+	ManifestTypeDir      = "dir"
+	ManifestTypeSymlink  = "symlink"
+	ManifestTypeHardlink = "hardlink"
+	ManifestTypeChar     = "char"
+	ManifestTypeBlock    = "block"
+	ManifestTypeFifo     = "fifo"
+)
+
+// ManifestEntry describes a member of a checkpoint archive. The digest is
+// only set for regular files, the link target only for symbolic and hard
+// links and the device number only for device nodes.
+type ManifestEntry struct {
+	Path      string `json:"path"`
+	Type      string `json:"type"`
+	Size      int64  `json:"size"`
+	Mode      string `json:"mode"`
+	Link      string `json:"link,omitempty"`
+	Device    string `json:"device,omitempty"`
+	SHA256    string `json:"sha256,omitempty"`
+	Component string `json:"-"`
+}
+
+// ManifestComponent lists the files of a component of a checkpoint archive.
+type ManifestComponent struct {
+	Name  string          `json:"name"`
+	Size  int64           `json:"size"`
+	Files []ManifestEntry `json:"files"`
+}
+
+// CheckpointManifest lists the files of a checkpoint archive grouped by
+// component. The digest is calculated over the canonical encoding of the
+// manifest and is the same as the manifest digest of a signature.
+type CheckpointManifest struct {
+	Version    string              `json:"version"`
+	Checkpoint string              `json:"checkpoint"`
+	Digest     string              `json:"digest"`
+	Size       int64               `json:"size"`
+	Files      int                 `json:"files"`
+	Components []ManifestComponent `json:"components"`
+}
+
+// manifestType returns the type of a member of a checkpoint archive.
+func manifestType(header *tar.Header) string {
+	switch header.Typeflag {
+	case tar.TypeReg:
+		return ManifestTypeFile
+	case tar.TypeDir:
+		return ManifestTypeDir
+	case tar.TypeSymlink:
+		return ManifestTypeSymlink
+	case tar.TypeLink:
+		return ManifestTypeHardlink
+	case tar.TypeChar:
+		return ManifestTypeChar
+	case tar.TypeBlock:
+		return ManifestTypeBlock
+	case tar.TypeFifo:
+		return ManifestTypeFifo
+	default:
+		return fmt.Sprintf("type-%d", header.Typeflag)
+	}
+}
+
+// manifestComponent returns the component of a checkpoint archive a file
+// belongs to.
+func manifestComponent(path string) string {
+	switch {
+	case strings.HasPrefix(path, metadata.CheckpointDirectory+"/"):
+		name := strings.TrimPrefix(path, metadata.CheckpointDirectory+"/")
+		if strings.HasPrefix(name, metadata.PagesPrefix) || strings.HasPrefix(name, metadata.AmdgpuPagesPrefix) {
+			return ManifestComponentPages
+		}
+		return ManifestComponentCriu
+	case path == metadata.RootFsDiffTar, path == metadata.DeletedFilesFile:
+		return ManifestComponentRootFs
+	case strings.HasPrefix(path, metadata.CheckpointVolumesDirectory+"/"), path == metadata.DevShmCheckpointTar:
+		// The content of /dev/shm is stored like the content of a volume
+		return ManifestComponentVolumes
+	default:
+		return ManifestComponentMetadata
+	}
+}
+
+// BuildManifest returns the path, type, size, mode, link target, device
+// number and SHA-256 digest of all members of a checkpoint archive sorted by
+// path. The digests are calculated over the uncompressed content, so that
+// the manifest does not depend on the compression of the archive.
+func BuildManifest(archivePath string) ([]ManifestEntry, error) {
+	var entries []ManifestEntry
+	err := iterateTarArchive(archivePath, func(r *tar.Reader, header *tar.Header) error {
+		path := strings.TrimPrefix(header.Name, "./")
+		if path == "" {
+			path = "."
+		}
+		entry := ManifestEntry{
+			Path:      path,
+			Type:      manifestType(header),
+			Mode:      fmt.Sprintf("%04o", header.Mode&0o7777),
+			Component: manifestComponent(path),
+		}
+		switch header.Typeflag {
+		case tar.TypeReg:
+			hash := sha256.New()
+			size, err := io.Copy(hash, r)
+			if err != nil {
+				return err
+			}
+			entry.Size, entry.SHA256 = size, hex.EncodeToString(hash.Sum(nil))
+		case tar.TypeSymlink, tar.TypeLink:
+			entry.Link = header.Linkname
+		case tar.TypeChar, tar.TypeBlock:
+			entry.Device = fmt.Sprintf("%d:%d", header.Devmajor, header.Devminor)
+		}
+		entries = append(entries, entry)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Path < entries[j].Path })
+
+	return entries, nil
+}
+
+// NewCheckpointManifest creates the manifest of a checkpoint archive.
+func NewCheckpointManifest(archivePath string) (*CheckpointManifest, error) {
+	entries, err := BuildManifest(archivePath)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := &CheckpointManifest{
+		Version:    manifestVersion,
+		Checkpoint: archivePath,
+		Digest:     sha256Digest(encodeManifest(entries)),
+		Files:      len(entries),
+		Components: []ManifestComponent{},
+	}
+	for _, name := range manifestComponents {
+		component := ManifestComponent{Name: name}
+		for _, e := range entries {
+			if e.Component == name {
+				component.Files = append(component.Files, e)
+				component.Size += e.Size
+			}
+		}
+		if len(component.Files) > 0 {
+			manifest.Components = append(manifest.Components, component)
+			manifest.Size += component.Size
+		}
+	}
+
+	return manifest, nil
+}
+
+// Entries returns the files of all components sorted by path.
+func (m *CheckpointManifest) Entries() []ManifestEntry {
+	var entries []ManifestEntry
+	for _, component := range m.Components {
+		entries = append(entries, component.Files...)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Path < entries[j].Path })
+	return entries
+}
+
+// encodeManifest returns the canonical encoding of a manifest which is
+// signed. Each entry is encoded as a line with the path, type, mode, size,
+// link target, device number and digest of the member in the order of the
+// entries. Every field is prefixed with its length, so that paths and link
+// targets containing spaces or newlines cannot be confused with other fields.
+func encodeManifest(entries []ManifestEntry) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(manifestVersion + "\n")
+	for _, e := range entries {
+		for _, field := range []string{e.Path, e.Type, e.Mode, strconv.FormatInt(e.Size, 10), e.Link, e.Device, e.SHA256} {
+			fmt.Fprintf(&buf, "%d:%s,", len(field), field)
+		}
+		buf.WriteString("\n")
+	}
+	return buf.Bytes()
+}
+
+// ManifestDifference describes how the members of two manifests differ.
+type ManifestDifference struct {
+	Added    []string `json:"added,omitempty"`
+	Removed  []string `json:"removed,omitempty"`
+	Modified []string `json:"modified,omitempty"`
+}
+
+// IsEmpty reports whether the manifests are identical.
+func (d *ManifestDifference) IsEmpty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Modified) == 0
+}
+
+// CompareManifests returns the paths of the members which were added,
+// removed or modified in manifest b compared to manifest a. A member is
+// modified if its type, content, mode, link target or device number differs.
+func CompareManifests(a, b []ManifestEntry) *ManifestDifference {
+	diff := &ManifestDifference{}
+	indexA := make(map[string]ManifestEntry, len(a))
+	for _, e := range a {
+		indexA[e.Path] = e
+	}
+	indexB := make(map[string]bool, len(b))
+	for _, e := range b {
+		indexB[e.Path] = true
+		entryA, exists := indexA[e.Path]
+		switch {
+		case !exists:
+			diff.Added = append(diff.Added, e.Path)
+		case entryA.Type != e.Type || entryA.SHA256 != e.SHA256 || entryA.Size != e.Size ||
+			entryA.Mode != e.Mode || entryA.Link != e.Link || entryA.Device != e.Device:
+			diff.Modified = append(diff.Modified, e.Path)
+		}
+	}
+	for _, e := range a {
+		if !indexB[e.Path] {
+			diff.Removed = append(diff.Removed, e.Path)
+		}
+	}
+	sort.Strings(diff.Added)
+	sort.Strings(diff.Removed)
+	sort.Strings(diff.Modified)
+	return diff
+}
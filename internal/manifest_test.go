@@ -0,0 +1,84 @@
+package internal
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestManifestComponent(t *testing.T) {
+	tests := []struct {
+		path      string
+		component string
+	}{
+		{"config.dump", ManifestComponentMetadata},
+		{"dump.log", ManifestComponentMetadata},
+		{"checkpoint/pstree.img", ManifestComponentCriu},
+		{"checkpoint/pages-1.img", ManifestComponentPages},
+		{"checkpoint/amdgpu-pages-1-0.img", ManifestComponentPages},
+		{"rootfs-diff.tar", ManifestComponentRootFs},
+		{"deleted.files", ManifestComponentRootFs},
+		{"volumes/data.tar", ManifestComponentVolumes},
+		{"devshm-checkpoint.tar", ManifestComponentVolumes},
+	}
+
+	for _, tt := range tests {
+		if component := manifestComponent(tt.path); component != tt.component {
+			t.Errorf("Expected %s to belong to %s, got %s", tt.path, tt.component, component)
+		}
+	}
+}
+
+func TestNewCheckpointManifest(t *testing.T) {
+	archive := filepath.Join(t.TempDir(), "checkpoint.tar")
+	writeArchive(t, archive, map[string][]byte{
+		"spec.dump":              []byte("{}"),
+		"config.dump":            []byte("{}"),
+		"checkpoint/pages-1.img": []byte("pages"),
+		"checkpoint/core-1.img":  []byte("core"),
+		"rootfs-diff.tar":        []byte("rootfs"),
+	})
+
+	manifest, err := NewCheckpointManifest(archive)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if manifest.Files != 5 || manifest.Size != 19 {
+		t.Errorf("Expected 5 files with 19 bytes, got %d files with %d bytes", manifest.Files, manifest.Size)
+	}
+	expected := []struct {
+		name  string
+		size  int64
+		files int
+	}{
+		{ManifestComponentMetadata, 4, 2},
+		{ManifestComponentCriu, 4, 1},
+		{ManifestComponentPages, 5, 1},
+		{ManifestComponentRootFs, 6, 1},
+	}
+	if len(manifest.Components) != len(expected) {
+		t.Fatalf("Expected %d components, got %+v", len(expected), manifest.Components)
+	}
+	for i, e := range expected {
+		c := manifest.Components[i]
+		if c.Name != e.name || c.Size != e.size || len(c.Files) != e.files {
+			t.Errorf("Expected component %s with %d files and %d bytes, got %s with %d files and %d bytes",
+				e.name, e.files, e.size, c.Name, len(c.Files), c.Size)
+		}
+	}
+	if mode := manifest.Components[0].Files[0].Mode; mode != "0644" {
+		t.Errorf("Expected mode 0644, got %s", mode)
+	}
+
+	// The digest is the same as the manifest digest of a signature
+	entries, err := BuildManifest(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if manifest.Digest != sha256Digest(encodeManifest(entries)) {
+		t.Errorf("Unexpected manifest digest %s", manifest.Digest)
+	}
+	if diff := CompareManifests(entries, manifest.Entries()); !diff.IsEmpty() {
+		t.Errorf("Expected the entries of all components to match the manifest, got %+v", diff)
+	}
+}
@@ -0,0 +1,56 @@
+// SPDX-License-Identifier: Apache-2.0
+
+// This file is used to mask the values of secret environment variables
+
+package internal
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// maskedValue is displayed instead of the values of masked environment
+// variables. It does not reveal the length of the values.
+const maskedValue = "********"
+
+// defaultMaskedEnvVars are glob patterns of the names of environment
+// variables which are masked unless ShowSecrets is set
+var defaultMaskedEnvVars = []string{"*PASSWORD*", "*TOKEN*", "*SECRET*", "*KEY*"}
+
+// ValidateMaskEnvVars checks the glob patterns of MaskEnvVars.
+func ValidateMaskEnvVars() error {
+	for _, pattern := range MaskEnvVars {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid pattern %q for --mask-env: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+// IsMaskedEnvVar reports whether the value of an environment variable is
+// masked. The name is matched case-insensitively against the default
+// patterns and MaskEnvVars.
+func IsMaskedEnvVar(key string) bool {
+	if ShowSecrets {
+		return false
+	}
+	key = strings.ToUpper(key)
+	for _, patterns := range [][]string{defaultMaskedEnvVars, MaskEnvVars} {
+		for _, pattern := range patterns {
+			if matched, _ := path.Match(strings.ToUpper(pattern), key); matched {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// MaskEnvValue returns the value of an environment variable as it is
+// displayed. Empty values are not masked.
+func MaskEnvValue(key, value string) string {
+	if value == "" || !IsMaskedEnvVar(key) {
+		return value
+	}
+	return maskedValue
+}
@@ -0,0 +1,346 @@
+// SPDX-License-Identifier: Apache-2.0
+
+// This file is used to compare the memory of processes in two checkpoints
+
+package internal
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+
+	metadata "github.com/checkpoint-restore/checkpointctl/lib"
+	"github.com/checkpoint-restore/go-criu/v8/crit"
+	"github.com/checkpoint-restore/go-criu/v8/crit/images/pagemap"
+)
+
+// MemoryMappingDiff describes how a memory mapping of a process changed.
+// The status describes the layout of the mapping: a mapping is modified if
+// its size, protection or resource changed. Pages are the dumped pages of
+// the mapping in checkpoint B and changed pages are the pages which are not
+// found with the same content at the same address in checkpoint A. The
+// pages of a pre-dump which are stored in its parent checkpoint are
+// unchanged since the parent and are not counted as changed pages. Unknown
+// pages are pages which are restored lazily, so their content is not stored
+// in the checkpoint. They are counted as changed pages.
+type MemoryMappingDiff struct {
+	Start        string     `json:"start"`
+	End          string     `json:"end"`
+	Protection   string     `json:"protection"`
+	Resource     string     `json:"resource,omitempty"`
+	Status       DiffStatus `json:"status"`
+	SizeBefore   uint64     `json:"size_before"`
+	SizeAfter    uint64     `json:"size_after"`
+	Pages        int        `json:"pages"`
+	ChangedPages int        `json:"changed_pages"`
+	UnknownPages int        `json:"unknown_pages,omitempty"`
+}
+
+// ProcessMemoryDiff describes how the memory of a process changed. The
+// changed bytes are the dumped memory of checkpoint B which differs from
+// checkpoint A, which is the memory a pre-copy migration has to transfer.
+type ProcessMemoryDiff struct {
+	PID          uint32              `json:"pid"`
+	Exe          string              `json:"exe"`
+	Status       DiffStatus          `json:"status"`
+	Pages        int                 `json:"pages"`
+	ChangedPages int                 `json:"changed_pages"`
+	UnknownPages int                 `json:"unknown_pages,omitempty"`
+	ChangedBytes uint64              `json:"changed_bytes"`
+	Mappings     []MemoryMappingDiff `json:"mappings,omitempty"`
+}
+
+// pageHashes maps the address of every dumped page of a process to the
+// digest of its content. Pages whose content is in the parent checkpoint
+// have the digest parentPage and lazy pages have the digest unknownPage.
+type pageHashes map[uint64][sha256.Size]byte
+
+// peParent is the pagemap entry flag of CRIU for pages in the parent
+// checkpoint
+const peParent = 1 << 0
+
+// parentPage and unknownPage are the digests of pages whose content is not
+// in the pages image. They are not the digest of any content.
+var (
+	parentPage  = [sha256.Size]byte{1}
+	unknownPage [sha256.Size]byte
+)
+
+// DiffProcessMemory compares the memory mappings and the content of the
+// memory pages of every process in two unpacked checkpoints. The pstree,
+// core, mm, pagemap and pages images and files.img have to be unpacked.
+func DiffProcessMemory(checkpointOutputDirA, checkpointOutputDirB string) ([]ProcessMemoryDiff, error) {
+	memMapsA, err := crit.New(nil, nil, filepath.Join(checkpointOutputDirA, metadata.CheckpointDirectory), false, false).ExploreMems()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read memory mappings of checkpoint A: %w", err)
+	}
+	memMapsB, err := crit.New(nil, nil, filepath.Join(checkpointOutputDirB, metadata.CheckpointDirectory), false, false).ExploreMems()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read memory mappings of checkpoint B: %w", err)
+	}
+
+	indexA := make(map[uint32]*crit.MemMap)
+	for _, memMap := range memMapsA {
+		indexA[memMap.PId] = memMap
+	}
+	indexB := make(map[uint32]*crit.MemMap)
+	for _, memMap := range memMapsB {
+		indexB[memMap.PId] = memMap
+	}
+
+	var diffs []ProcessMemoryDiff
+	for _, memMapB := range memMapsB {
+		hashesB, err := hashProcessPages(checkpointOutputDirB, memMapB.PId)
+		if err != nil {
+			return nil, err
+		}
+		memMapA, exists := indexA[memMapB.PId]
+		if !exists {
+			diffs = append(diffs, diffMemoryMappings(nil, memMapB, nil, hashesB))
+			continue
+		}
+		hashesA, err := hashProcessPages(checkpointOutputDirA, memMapA.PId)
+		if err != nil {
+			return nil, err
+		}
+		diffs = append(diffs, diffMemoryMappings(memMapA, memMapB, hashesA, hashesB))
+	}
+	for _, memMapA := range memMapsA {
+		if _, exists := indexB[memMapA.PId]; !exists {
+			diffs = append(diffs, diffMemoryMappings(memMapA, nil, nil, nil))
+		}
+	}
+
+	sort.Slice(diffs, func(i, j int) bool { return diffs[i].PID < diffs[j].PID })
+	return diffs, nil
+}
+
+// hashProcessPages returns the digests of the dumped pages of a process.
+// The pages of pagemap entries without content in the pages image are
+// included with the digest parentPage or unknownPage.
+func hashProcessPages(checkpointOutputDir string, pid uint32) (pageHashes, error) {
+	ranges, err := readPagesRanges(checkpointOutputDir, pid)
+	if err != nil {
+		return nil, err
+	}
+	parent, unknown, err := readAbsentPages(checkpointOutputDir, pid)
+	if err != nil {
+		return nil, err
+	}
+	pagesID, err := getPagesID(checkpointOutputDir, pid)
+	if err != nil {
+		return nil, err
+	}
+
+	pages, err := os.Open(filepath.Join(checkpointOutputDir, metadata.CheckpointDirectory, fmt.Sprintf("pages-%d.img", pagesID)))
+	if err != nil {
+		return nil, err
+	}
+	defer pages.Close()
+
+	hashes := make(pageHashes)
+	for _, r := range parent {
+		for addr := r.vaddr; addr < r.vaddr+r.size; addr += uint64(pageSize) {
+			hashes[addr] = parentPage
+		}
+	}
+	for _, r := range unknown {
+		for addr := r.vaddr; addr < r.vaddr+r.size; addr += uint64(pageSize) {
+			hashes[addr] = unknownPage
+		}
+	}
+	page := make([]byte, pageSize)
+	for _, r := range ranges {
+		section := io.NewSectionReader(pages, int64(r.offset), int64(r.size))
+		for addr := r.vaddr; addr < r.vaddr+r.size; addr += uint64(pageSize) {
+			if _, err := io.ReadFull(section, page); err != nil {
+				return nil, fmt.Errorf("failed to read page 0x%x of process %d: %w", addr, pid, err)
+			}
+			hashes[addr] = sha256.Sum256(page)
+		}
+	}
+
+	return hashes, nil
+}
+
+// readAbsentPages returns the address ranges of the pagemap entries of a
+// process which are not present in the pages image. These are the pages of
+// a pre-dump which are found in the parent checkpoint (PE_PARENT) and the
+// pages whose content is unknown, because they are restored lazily
+// (PE_LAZY).
+func readAbsentPages(checkpointOutputDir string, pid uint32) (parent, unknown []pagesRange, err error) {
+	img, err := readCriuImage(checkpointOutputDir, fmt.Sprintf("pagemap-%d.img", pid), &pagemap.PagemapHead{})
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(img.Entries) == 0 {
+		return nil, nil, fmt.Errorf("pagemap-%d.img contains no entries", pid)
+	}
+
+	for _, e := range img.Entries[1:] {
+		entry := e.Message.(*pagemap.PagemapEntry)
+		if entry.Flags == nil || entry.GetFlags()&pePresent != 0 {
+			continue
+		}
+		r := pagesRange{vaddr: entry.GetVaddr(), size: entry.GetNrPages() * uint64(pageSize)}
+		if entry.GetFlags()&peParent != 0 {
+			parent = append(parent, r)
+		} else {
+			unknown = append(unknown, r)
+		}
+	}
+
+	return parent, unknown, nil
+}
+
+// memoryMapping is a memory mapping of crit.ExploreMems with its parsed
+// address range.
+type memoryMapping struct {
+	*crit.Mem
+	start, end uint64
+}
+
+func parseMemoryMappings(memMap *crit.MemMap) []memoryMapping {
+	if memMap == nil {
+		return nil
+	}
+	mappings := make([]memoryMapping, 0, len(memMap.Mems))
+	for _, mem := range memMap.Mems {
+		start, err := strconv.ParseUint(mem.Start, 16, 64)
+		if err != nil {
+			continue
+		}
+		end, err := strconv.ParseUint(mem.End, 16, 64)
+		if err != nil {
+			continue
+		}
+		mappings = append(mappings, memoryMapping{Mem: mem, start: start, end: end})
+	}
+	sort.Slice(mappings, func(i, j int) bool { return mappings[i].start < mappings[j].start })
+	return mappings
+}
+
+// sortedPageAddresses returns the addresses of the pages in ascending order.
+func sortedPageAddresses(hashes pageHashes) []uint64 {
+	addrs := make([]uint64, 0, len(hashes))
+	for addr := range hashes {
+		addrs = append(addrs, addr)
+	}
+	sort.Slice(addrs, func(i, j int) bool { return addrs[i] < addrs[j] })
+	return addrs
+}
+
+// countPages returns the number of dumped pages in a mapping, how many of
+// them are not found with the same content in the pages of the previous
+// checkpoint and how many of them have unknown content. Pages in the parent
+// checkpoint are unchanged. Other pages are changed if their content is
+// unknown or not in the pages image in either checkpoint.
+func countPages(m memoryMapping, addrs []uint64, hashes, previous pageHashes) (pages, changed, unknown int) {
+	first := sort.Search(len(addrs), func(i int) bool { return addrs[i] >= m.start })
+	for _, addr := range addrs[first:] {
+		if addr >= m.end {
+			break
+		}
+		pages++
+		hash := hashes[addr]
+		if hash == parentPage {
+			continue
+		}
+		if hash == unknownPage {
+			unknown++
+			changed++
+			continue
+		}
+		if previousHash, exists := previous[addr]; !exists || previousHash != hash {
+			changed++
+		}
+	}
+	return pages, changed, unknown
+}
+
+// diffMemoryMappings compares the memory mappings and pages of a process.
+// The mappings are matched by their start address. memMapA is nil for an
+// added process and memMapB is nil for a removed process.
+func diffMemoryMappings(memMapA, memMapB *crit.MemMap, hashesA, hashesB pageHashes) ProcessMemoryDiff {
+	mappingsA := parseMemoryMappings(memMapA)
+	mappingsB := parseMemoryMappings(memMapB)
+
+	diff := ProcessMemoryDiff{Status: Unchanged}
+	switch {
+	case memMapA == nil:
+		diff.PID, diff.Exe, diff.Status = memMapB.PId, memMapB.Exe, Added
+	case memMapB == nil:
+		diff.PID, diff.Exe, diff.Status = memMapA.PId, memMapA.Exe, Removed
+	default:
+		diff.PID, diff.Exe = memMapB.PId, memMapB.Exe
+	}
+
+	indexA := make(map[uint64]memoryMapping)
+	for _, m := range mappingsA {
+		indexA[m.start] = m
+	}
+	indexB := make(map[uint64]bool)
+	addrsB := sortedPageAddresses(hashesB)
+
+	for _, m := range mappingsB {
+		indexB[m.start] = true
+		mapping := MemoryMappingDiff{
+			Start:      m.Start,
+			End:        m.End,
+			Protection: m.Protection,
+			Resource:   m.Resource,
+			Status:     Unchanged,
+			SizeAfter:  m.end - m.start,
+		}
+		if previous, exists := indexA[m.start]; !exists {
+			mapping.Status = Added
+		} else {
+			mapping.SizeBefore = previous.end - previous.start
+			if previous.end != m.end || previous.Protection != m.Protection || previous.Resource != m.Resource {
+				mapping.Status = Modified
+			}
+		}
+		mapping.Pages, mapping.ChangedPages, mapping.UnknownPages = countPages(m, addrsB, hashesB, hashesA)
+
+		diff.Pages += mapping.Pages
+		diff.ChangedPages += mapping.ChangedPages
+		diff.UnknownPages += mapping.UnknownPages
+		diff.Mappings = append(diff.Mappings, mapping)
+	}
+
+	for _, m := range mappingsA {
+		if indexB[m.start] {
+			continue
+		}
+		diff.Mappings = append(diff.Mappings, MemoryMappingDiff{
+			Start:      m.Start,
+			End:        m.End,
+			Protection: m.Protection,
+			Resource:   m.Resource,
+			Status:     Removed,
+			SizeBefore: m.end - m.start,
+		})
+	}
+
+	sort.SliceStable(diff.Mappings, func(i, j int) bool {
+		startI, _ := strconv.ParseUint(diff.Mappings[i].Start, 16, 64)
+		startJ, _ := strconv.ParseUint(diff.Mappings[j].Start, 16, 64)
+		return startI < startJ
+	})
+
+	if diff.Status == Unchanged {
+		for _, mapping := range diff.Mappings {
+			if mapping.Status != Unchanged || mapping.ChangedPages > 0 {
+				diff.Status = Modified
+				break
+			}
+		}
+	}
+	diff.ChangedBytes = uint64(diff.ChangedPages) * uint64(pageSize)
+
+	return diff
+}
@@ -0,0 +1,140 @@
+package internal
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+
+	metadata "github.com/checkpoint-restore/checkpointctl/lib"
+	"github.com/checkpoint-restore/go-criu/v8/crit"
+	"github.com/checkpoint-restore/go-criu/v8/crit/images/pagemap"
+	"google.golang.org/protobuf/proto"
+)
+
+// writePages writes the pagemap and pages images of process 1.
+func writePages(t *testing.T, dir string, vaddr uint64, pages [][]byte) {
+	t.Helper()
+	newImageWriter(t, "PAGEMAP").
+		entry(&pagemap.PagemapHead{PagesId: proto.Uint32(1)}).
+		entry(&pagemap.PagemapEntry{Vaddr: proto.Uint64(vaddr), CompatNrPages: proto.Uint32(0), NrPages: proto.Uint64(uint64(len(pages))), Flags: proto.Uint32(pePresent)}).
+		write(dir, "pagemap-1.img")
+	if err := os.WriteFile(filepath.Join(dir, metadata.CheckpointDirectory, "pages-1.img"), bytes.Join(pages, nil), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDiffMemoryMappings(t *testing.T) {
+	dirA, dirB := t.TempDir(), t.TempDir()
+	pages := randomPages(t, 4)
+	writePages(t, dirA, 0x10000, pages)
+	changed := append([][]byte{}, pages...)
+	changed[2] = randomPages(t, 1)[0]
+	writePages(t, dirB, 0x10000, append(changed, randomPages(t, 1)...))
+
+	hashesA, err := hashProcessPages(dirA, 1)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(hashesA) != 4 {
+		t.Fatalf("Expected 4 pages, got %d", len(hashesA))
+	}
+	hashesB, err := hashProcessPages(dirB, 1)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// The first mapping keeps its layout, the second mapping grows by the
+	// new page, the third mapping is removed and the fourth is added
+	end := func(pages int) string { return strconv.FormatUint(0x10000+uint64(pages*pageSize), 16) }
+	memMapA := &crit.MemMap{PId: 1, Exe: "/bin/app", Mems: []*crit.Mem{
+		{Start: "10000", End: end(2), Protection: "r-x"},
+		{Start: end(2), End: end(4), Protection: "rw-"},
+		{Start: "900000", End: "901000", Protection: "rw-", Resource: "[heap]"},
+	}}
+	memMapB := &crit.MemMap{PId: 1, Exe: "/bin/app", Mems: []*crit.Mem{
+		{Start: "10000", End: end(2), Protection: "r-x"},
+		{Start: end(2), End: end(5), Protection: "rw-"},
+		{Start: "a00000", End: "a01000", Protection: "r--"},
+	}}
+
+	diff := diffMemoryMappings(memMapA, memMapB, hashesA, hashesB)
+	if diff.Status != Modified || diff.Pages != 5 || diff.ChangedPages != 2 || diff.ChangedBytes != uint64(2*pageSize) {
+		t.Errorf("Unexpected process memory diff %+v", diff)
+	}
+	var statuses []DiffStatus
+	var changedPages []int
+	for _, mapping := range diff.Mappings {
+		statuses = append(statuses, mapping.Status)
+		changedPages = append(changedPages, mapping.ChangedPages)
+	}
+	if expected := []DiffStatus{Unchanged, Modified, Removed, Added}; !reflect.DeepEqual(statuses, expected) {
+		t.Errorf("Expected mapping statuses %v, got %v", expected, statuses)
+	}
+	if expected := []int{0, 2, 0, 0}; !reflect.DeepEqual(changedPages, expected) {
+		t.Errorf("Expected changed pages %v, got %v", expected, changedPages)
+	}
+
+	if diff := diffMemoryMappings(memMapA, memMapA, hashesA, hashesA); diff.Status != Unchanged || diff.ChangedPages != 0 {
+		t.Errorf("Expected no changes between identical processes, got %+v", diff)
+	}
+
+	added := diffMemoryMappings(nil, memMapB, nil, hashesB)
+	if added.Status != Added || added.ChangedPages != 5 {
+		t.Errorf("Expected all pages of an added process to be changed, got %+v", added)
+	}
+	removed := diffMemoryMappings(memMapA, nil, hashesA, nil)
+	if removed.Status != Removed || removed.ChangedPages != 0 || len(removed.Mappings) != 3 {
+		t.Errorf("Unexpected diff of a removed process %+v", removed)
+	}
+}
+
+func TestDiffMemoryUnknownPages(t *testing.T) {
+	// The first two pages are in the pages image, the next two pages are in
+	// the parent checkpoint of a pre-dump and the last page is lazy
+	const peLazy = 1 << 1
+	pages := randomPages(t, 2)
+	writeImages := func(dir string) {
+		newImageWriter(t, "PAGEMAP").
+			entry(&pagemap.PagemapHead{PagesId: proto.Uint32(1)}).
+			entry(&pagemap.PagemapEntry{Vaddr: proto.Uint64(0x10000), CompatNrPages: proto.Uint32(0), NrPages: proto.Uint64(2), Flags: proto.Uint32(pePresent)}).
+			entry(&pagemap.PagemapEntry{Vaddr: proto.Uint64(0x10000 + uint64(2*pageSize)), CompatNrPages: proto.Uint32(0), NrPages: proto.Uint64(2), Flags: proto.Uint32(peParent)}).
+			entry(&pagemap.PagemapEntry{Vaddr: proto.Uint64(0x10000 + uint64(4*pageSize)), CompatNrPages: proto.Uint32(0), NrPages: proto.Uint64(1), Flags: proto.Uint32(peLazy)}).
+			write(dir, "pagemap-1.img")
+		if err := os.WriteFile(filepath.Join(dir, metadata.CheckpointDirectory, "pages-1.img"), bytes.Join(pages, nil), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	dirA, dirB := t.TempDir(), t.TempDir()
+	writeImages(dirA)
+	writeImages(dirB)
+
+	hashesA, err := hashProcessPages(dirA, 1)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	hashesB, err := hashProcessPages(dirB, 1)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(hashesB) != 5 {
+		t.Fatalf("Expected 5 pages, got %d", len(hashesB))
+	}
+
+	// The pages in the parent checkpoint are unchanged and the lazy page
+	// with unknown content is changed, even if both checkpoints have no
+	// content for it
+	end := strconv.FormatUint(0x10000+uint64(5*pageSize), 16)
+	memMap := &crit.MemMap{PId: 1, Exe: "/bin/app", Mems: []*crit.Mem{
+		{Start: "10000", End: end, Protection: "rw-"},
+	}}
+	diff := diffMemoryMappings(memMap, memMap, hashesA, hashesB)
+	if diff.Status != Modified || diff.Pages != 5 || diff.ChangedPages != 1 || diff.UnknownPages != 1 {
+		t.Errorf("Unexpected process memory diff %+v", diff)
+	}
+	if mapping := diff.Mappings[0]; mapping.Status != Unchanged || mapping.ChangedPages != 1 || mapping.UnknownPages != 1 {
+		t.Errorf("Unexpected mapping diff %+v", mapping)
+	}
+}
@@ -0,0 +1,147 @@
+// SPDX-License-Identifier: Apache-2.0
+
+// This file is used to describe the memory mappings of checkpointed processes
+
+package internal
+
+import (
+	"fmt"
+	"strings"
+)
+
+// VMA status flags of CRIU
+const (
+	vmaAreaStack    = 1 << 1
+	vmaAreaVsyscall = 1 << 2
+	vmaAreaVdso     = 1 << 3
+	vmaAreaHeap     = 1 << 5
+	vmaFilePrivate  = 1 << 6
+	vmaFileShared   = 1 << 7
+	vmaAnonShared   = 1 << 8
+	vmaAreaSysvipc  = 1 << 10
+	vmaAreaSocket   = 1 << 11
+	vmaAreaVvar     = 1 << 12
+	vmaAreaAioring  = 1 << 13
+	vmaAreaMemfd    = 1 << 14
+)
+
+// Memory protection and mapping flags
+const (
+	protRead  = 0x1
+	protWrite = 0x2
+	protExec  = 0x4
+	mapShared = 0x1
+)
+
+// MemoryRegion describes a virtual memory area of a process.
+type MemoryRegion struct {
+	Start  uint64
+	End    uint64
+	Pgoff  uint64
+	Prot   uint32
+	Flags  uint32
+	Status uint32
+	// Name is the backing resource of the region in the format of
+	// /proc/[pid]/maps. It is empty for anonymous memory.
+	Name string
+}
+
+// Size returns the size of the region in bytes.
+func (r MemoryRegion) Size() uint64 {
+	return r.End - r.Start
+}
+
+// Perms returns the permissions of the region in the format of /proc/[pid]/maps.
+func (r MemoryRegion) Perms() string {
+	perms := []byte("---p")
+	if r.Prot&protRead != 0 {
+		perms[0] = 'r'
+	}
+	if r.Prot&protWrite != 0 {
+		perms[1] = 'w'
+	}
+	if r.Prot&protExec != 0 {
+		perms[2] = 'x'
+	}
+	if r.Flags&mapShared != 0 {
+		perms[3] = 's'
+	}
+	return string(perms)
+}
+
+// FileName returns a file name for the contents of the region which
+// consists of the address range and the backing resource.
+func (r MemoryRegion) FileName() string {
+	resource := "anon"
+	if r.Name != "" {
+		resource = strings.NewReplacer("/", "_", " ", "_", ":", "_").Replace(strings.Trim(r.Name, "[]/"))
+	}
+	return fmt.Sprintf("%016x-%016x_%s.bin", r.Start, r.End, resource)
+}
+
+// GetMemoryRegions returns the memory mappings of the process with the
+// given PID. The mm, files and memfd images have to be unpacked.
+func GetMemoryRegions(checkpointOutputDir string, pid uint32) ([]MemoryRegion, error) {
+	mmEntry, err := readMmEntry(checkpointOutputDir, pid)
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := readFileEntries(checkpointOutputDir)
+	if err != nil {
+		return nil, err
+	}
+
+	inodes, err := readMemfdInodes(checkpointOutputDir)
+	if err != nil {
+		return nil, err
+	}
+	memfdNames := make(map[uint64]string)
+	for _, inode := range inodes {
+		memfdNames[inode.GetInodeId()] = inode.GetName()
+	}
+
+	regions := make([]MemoryRegion, 0, len(mmEntry.GetVmas()))
+	for _, vma := range mmEntry.GetVmas() {
+		region := MemoryRegion{
+			Start:  vma.GetStart(),
+			End:    vma.GetEnd(),
+			Pgoff:  vma.GetPgoff(),
+			Prot:   vma.GetProt(),
+			Flags:  vma.GetFlags(),
+			Status: vma.GetStatus(),
+		}
+
+		status := vma.GetStatus()
+		switch {
+		case status&vmaAreaHeap != 0:
+			region.Name = "[heap]"
+		case status&vmaAreaStack != 0:
+			region.Name = "[stack]"
+		case status&vmaAreaVdso != 0:
+			region.Name = "[vdso]"
+		case status&vmaAreaVvar != 0:
+			region.Name = "[vvar]"
+		case status&vmaAreaVsyscall != 0:
+			region.Name = "[vsyscall]"
+		case status&vmaAreaAioring != 0:
+			region.Name = "[aio]"
+		case status&vmaAreaSocket != 0:
+			region.Name = "[socket]"
+		case status&vmaAreaSysvipc != 0:
+			region.Name = fmt.Sprintf("[sysv:%d]", vma.GetShmid())
+		case status&vmaAreaMemfd != 0:
+			// The shmid of file mappings is the ID of the file
+			file := files[uint32(vma.GetShmid())]
+			region.Name = "/memfd:" + memfdNames[uint64(file.GetMemfd().GetInodeId())]
+		case status&(vmaFilePrivate|vmaFileShared) != 0:
+			region.Name = files[uint32(vma.GetShmid())].GetReg().GetName()
+		case status&vmaAnonShared != 0:
+			region.Name = fmt.Sprintf("[shmem:%d]", vma.GetShmid())
+		}
+
+		regions = append(regions, region)
+	}
+
+	return regions, nil
+}
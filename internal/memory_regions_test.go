@@ -0,0 +1,60 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/checkpoint-restore/go-criu/v8/crit/images/fdinfo"
+	"github.com/checkpoint-restore/go-criu/v8/crit/images/fown"
+	"github.com/checkpoint-restore/go-criu/v8/crit/images/regfile"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestGetMemoryRegions(t *testing.T) {
+	dir := t.TempDir()
+	regType := fdinfo.FdTypes_REG
+	newImageWriter(t, "FILES").entry(&fdinfo.FileEntry{
+		Type: &regType,
+		Id:   proto.Uint32(3),
+		Reg: &regfile.RegFileEntry{
+			Id:    proto.Uint32(3),
+			Flags: proto.Uint32(0),
+			Pos:   proto.Uint64(0),
+			Fown: &fown.FownEntry{
+				Uid: proto.Uint32(0), Euid: proto.Uint32(0), Signum: proto.Uint32(0),
+				PidType: proto.Uint32(0), Pid: proto.Uint32(0),
+			},
+			Name: proto.String("/usr/lib/libc.so.6"),
+		},
+	}).write(dir, "files.img")
+
+	libc := testVma(0x7f0000000000, 0x7f0000002000, 0, 3, vmaFilePrivate)
+	libc.Prot = proto.Uint32(protRead | protExec)
+	libc.Flags = proto.Uint32(0x2)
+	writeMmImage(t, dir, 1,
+		testVma(0x1000, 0x3000, 0, 0, vmaAreaHeap),
+		libc,
+		testVma(0x7ffd00000000, 0x7ffd00001000, 0, 0, 0),
+	)
+
+	regions, err := GetMemoryRegions(dir, 1)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(regions) != 3 {
+		t.Fatalf("Expected 3 memory regions, got %+v", regions)
+	}
+
+	expected := []struct {
+		name, perms, fileName string
+	}{
+		{"[heap]", "rw-s", "0000000000001000-0000000000003000_heap.bin"},
+		{"/usr/lib/libc.so.6", "r-xp", "00007f0000000000-00007f0000002000_usr_lib_libc.so.6.bin"},
+		{"", "rw-s", "00007ffd00000000-00007ffd00001000_anon.bin"},
+	}
+	for i, e := range expected {
+		if regions[i].Name != e.name || regions[i].Perms() != e.perms || regions[i].FileName() != e.fileName {
+			t.Errorf("Expected region %q %s %s, got %q %s %s",
+				e.name, e.perms, e.fileName, regions[i].Name, regions[i].Perms(), regions[i].FileName())
+		}
+	}
+}
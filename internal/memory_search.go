@@ -0,0 +1,320 @@
+// SPDX-License-Identifier: Apache-2.0
+
+// This file is used to search the memory of the processes in container checkpoints
+
+package internal
+
+import (
+	"bufio"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	metadata "github.com/checkpoint-restore/checkpointctl/lib"
+	"github.com/checkpoint-restore/go-criu/v8/crit"
+)
+
+type MemorySearchMatch struct {
+	Checkpoint string `json:"checkpoint"`
+	PID        uint32 `json:"pid"`
+	Comm       string `json:"command"`
+	Address    string `json:"address"`
+	VMA        string `json:"vma,omitempty"`
+	Resource   string `json:"resource,omitempty"`
+	Pattern    string `json:"pattern,omitempty"`
+	Match      string `json:"match"`
+}
+
+// MemoryPattern is a pattern searched with --search-hex or --search-file.
+type MemoryPattern struct {
+	Name   string
+	Data   []byte
+	Binary bool
+}
+
+// memoryMatch is a match in the memory of a single process.
+type memoryMatch struct {
+	vaddr   uint64
+	pattern string
+	match   string
+}
+
+// memorySearcher searches the memory of a single process. The pages image
+// of the process is unpacked.
+type memorySearcher func(ps *crit.PsTree, memReader *crit.MemoryReader) ([]memoryMatch, error)
+
+// searchChunkPages is the number of pages searched at once.
+const searchChunkPages = 256
+
+// SearchCheckpointMemory searches a pattern in the memory of all alive and
+// stopped processes of a checkpoint, or only in the memory of the process
+// with the given PID if it is not zero. The matches are annotated with the
+// memory region they are in if the mm images are part of the checkpoint.
+func SearchCheckpointMemory(task Task, pid uint32, pattern string, escapeRegExpCharacters bool, context int) ([]MemorySearchMatch, error) {
+	return searchCheckpointMemory(task, pid, func(ps *crit.PsTree, memReader *crit.MemoryReader) ([]memoryMatch, error) {
+		results, err := memReader.SearchPattern(pattern, escapeRegExpCharacters, context, 0)
+		if err != nil {
+			return nil, fmt.Errorf("failed to search pattern in memory: %w", err)
+		}
+		matches := make([]memoryMatch, 0, len(results))
+		for _, r := range results {
+			matches = append(matches, memoryMatch{vaddr: r.Vaddr, match: r.Match})
+		}
+		return matches, nil
+	})
+}
+
+// SearchCheckpointMemoryPatterns searches many patterns at once in the memory
+// of the processes of a checkpoint in the same way as SearchCheckpointMemory.
+// Each match includes the given number of bytes of context.
+func SearchCheckpointMemoryPatterns(task Task, pid uint32, patterns []MemoryPattern, context int) ([]MemorySearchMatch, error) {
+	if context < 0 {
+		return nil, fmt.Errorf("context size cannot be negative")
+	}
+	data := make([][]byte, len(patterns))
+	for i, p := range patterns {
+		data[i] = p.Data
+	}
+	matcher := newPatternMatcher(data)
+
+	return searchCheckpointMemory(task, pid, func(ps *crit.PsTree, memReader *crit.MemoryReader) ([]memoryMatch, error) {
+		return searchPatternsInProcess(task.OutputDir, ps.PID, memReader.GetPagesID(), matcher, patterns, context)
+	})
+}
+
+func searchCheckpointMemory(task Task, pid uint32, search memorySearcher) ([]MemorySearchMatch, error) {
+	c := crit.New(nil, nil, filepath.Join(task.OutputDir, metadata.CheckpointDirectory), false, false)
+	psTree, err := c.ExplorePs()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get process tree: %w", err)
+	}
+
+	var processes []*crit.PsTree
+	if pid != 0 {
+		// Check if PID exist within the checkpoint
+		ps := psTree.FindPs(pid)
+		if ps == nil {
+			return nil, fmt.Errorf("no process with PID %d (use `inspect --ps-tree` to view all PIDs)", pid)
+		}
+		// Check if the process has memory pages
+		if !crit.TaskState(ps.Core.GetTc().GetTaskState()).IsAliveOrStopped() {
+			return nil, fmt.Errorf("process %d has no memory pages (task state is zombie or dead)", ps.PID)
+		}
+		processes = append(processes, ps)
+	} else {
+		var walk func(*crit.PsTree)
+		walk = func(ps *crit.PsTree) {
+			if crit.TaskState(ps.Core.GetTc().GetTaskState()).IsAliveOrStopped() {
+				processes = append(processes, ps)
+			}
+			for _, child := range ps.Children {
+				walk(child)
+			}
+		}
+		walk(psTree)
+	}
+
+	var result []MemorySearchMatch
+	for _, ps := range processes {
+		matches, err := searchProcessMemory(task, ps, search)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, matches...)
+	}
+
+	return result, nil
+}
+
+func searchProcessMemory(task Task, ps *crit.PsTree, search memorySearcher) ([]MemorySearchMatch, error) {
+	memReader, err := crit.NewMemoryReader(
+		filepath.Join(task.OutputDir, metadata.CheckpointDirectory),
+		ps.PID, os.Getpagesize(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create memory reader for process %d: %w", ps.PID, err)
+	}
+
+	if err := UntarFiles(
+		task.CheckpointFilePath, task.OutputDir,
+		[]string{filepath.Join(metadata.CheckpointDirectory, fmt.Sprintf("pages-%d.img", memReader.GetPagesID()))},
+	); err != nil {
+		return nil, fmt.Errorf("failed to extract pages file: %w", err)
+	}
+
+	results, err := search(ps, memReader)
+	if err != nil {
+		return nil, err
+	}
+
+	regions, err := GetMemoryRegions(task.OutputDir, ps.PID)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to get memory regions of process %d: %w", ps.PID, err)
+	}
+
+	matches := make([]MemorySearchMatch, 0, len(results))
+	for _, r := range results {
+		match := MemorySearchMatch{
+			Checkpoint: task.CheckpointFilePath,
+			PID:        ps.PID,
+			Comm:       ps.Comm,
+			Address:    fmt.Sprintf("0x%016x", r.vaddr),
+			Pattern:    r.pattern,
+			Match:      r.match,
+		}
+		if region := findMemoryRegion(regions, r.vaddr); region != nil {
+			match.VMA = fmt.Sprintf("0x%x-0x%x", region.Start, region.End)
+			match.Resource = region.Name
+		}
+		matches = append(matches, match)
+	}
+
+	return matches, nil
+}
+
+// findMemoryRegion returns the memory region containing the given address.
+// The regions have to be sorted by address, as they are in the mm image.
+func findMemoryRegion(regions []MemoryRegion, addr uint64) *MemoryRegion {
+	i := sort.Search(len(regions), func(i int) bool { return regions[i].End > addr })
+	if i < len(regions) && regions[i].Start <= addr {
+		return &regions[i]
+	}
+	return nil
+}
+
+// searchPatternsInProcess searches the patterns of the matcher in a single
+// pass over the pages image of a process. The pages are read in chunks which
+// overlap by the length of the longest pattern and the context.
+func searchPatternsInProcess(checkpointOutputDir string, pid, pagesID uint32, matcher *patternMatcher, patterns []MemoryPattern, context int) ([]memoryMatch, error) {
+	ranges, err := readPagesRanges(checkpointOutputDir, pid)
+	if err != nil {
+		return nil, err
+	}
+
+	pages, err := os.Open(filepath.Join(checkpointOutputDir, metadata.CheckpointDirectory, fmt.Sprintf("pages-%d.img", pagesID)))
+	if err != nil {
+		return nil, err
+	}
+	defer pages.Close()
+
+	var maxLen int
+	for _, p := range patterns {
+		maxLen = max(maxLen, len(p.Data))
+	}
+	ctx := uint64(context)
+	chunkSize := uint64(searchChunkPages * os.Getpagesize())
+
+	var matches []memoryMatch
+	for _, r := range ranges {
+		for start := uint64(0); start < r.size; start += chunkSize {
+			end := min(start+chunkSize, r.size)
+			bufStart := start - min(start, ctx)
+			bufEnd := min(r.size, end+uint64(maxLen)-1+ctx)
+			buf := make([]byte, bufEnd-bufStart)
+			if _, err := pages.ReadAt(buf, int64(r.offset+bufStart)); err != nil {
+				return nil, fmt.Errorf("failed to read memory pages of process %d: %w", pid, err)
+			}
+
+			var chunkMatches []memoryMatch
+			matcher.findAll(buf, func(offset, pattern int) {
+				// Matches starting in the overlap belong to the adjacent chunk
+				pos := bufStart + uint64(offset)
+				if pos < start || pos >= end {
+					return
+				}
+				p := patterns[pattern]
+				contextStart := max(offset-context, 0)
+				contextEnd := min(offset+len(p.Data)+context, len(buf))
+				chunkMatches = append(chunkMatches, memoryMatch{
+					vaddr:   r.vaddr + pos,
+					pattern: p.Name,
+					match:   formatMemoryMatch(buf[contextStart:contextEnd], p.Binary),
+				})
+			})
+			// The matcher reports matches by their end
+			sort.SliceStable(chunkMatches, func(a, b int) bool { return chunkMatches[a].vaddr < chunkMatches[b].vaddr })
+			matches = append(matches, chunkMatches...)
+		}
+	}
+
+	return matches, nil
+}
+
+// formatMemoryMatch formats the bytes of a match as hexadecimal bytes for
+// binary patterns and as text with non-printable characters replaced otherwise.
+func formatMemoryMatch(data []byte, binary bool) string {
+	if binary {
+		return fmt.Sprintf("% x", data)
+	}
+	text := make([]byte, len(data))
+	for i, b := range data {
+		if b < 32 || b >= 127 {
+			b = '.'
+		}
+		text[i] = b
+	}
+	return string(text)
+}
+
+// ParseHexPattern parses a pattern of hexadecimal bytes, optionally
+// separated by whitespace, such as "de ad be ef" or "deadbeef".
+func ParseHexPattern(s string) ([]byte, error) {
+	data, err := hex.DecodeString(strings.Join(strings.Fields(s), ""))
+	if err != nil {
+		return nil, fmt.Errorf("invalid hex pattern %q: %w", s, err)
+	}
+	if len(data) == 0 {
+		return nil, fmt.Errorf("invalid hex pattern %q: pattern is empty", s)
+	}
+	return data, nil
+}
+
+// NewHexPattern returns the memory pattern of a hexadecimal pattern.
+func NewHexPattern(s string) (MemoryPattern, error) {
+	data, err := ParseHexPattern(s)
+	if err != nil {
+		return MemoryPattern{}, err
+	}
+	return MemoryPattern{Name: "hex:" + fmt.Sprintf("% x", data), Data: data, Binary: true}, nil
+}
+
+// ReadPatternFile reads the patterns of a pattern file. Each line contains
+// a string pattern, or a hexadecimal pattern if it starts with "hex:".
+// Empty lines and lines starting with "#" are ignored.
+func ReadPatternFile(path string) ([]MemoryPattern, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var patterns []MemoryPattern
+	scanner := bufio.NewScanner(f)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if hexPattern, ok := strings.CutPrefix(line, "hex:"); ok {
+			pattern, err := NewHexPattern(hexPattern)
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: %w", path, lineNumber, err)
+			}
+			patterns = append(patterns, pattern)
+			continue
+		}
+		patterns = append(patterns, MemoryPattern{Name: line, Data: []byte(line)})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(patterns) == 0 {
+		return nil, fmt.Errorf("no patterns found in %s", path)
+	}
+
+	return patterns, nil
+}
@@ -0,0 +1,144 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	metadata "github.com/checkpoint-restore/checkpointctl/lib"
+	"github.com/checkpoint-restore/go-criu/v8/crit/images/pagemap"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestFindMemoryRegion(t *testing.T) {
+	regions := []MemoryRegion{
+		{Start: 0x1000, End: 0x3000, Name: "[heap]"},
+		{Start: 0x5000, End: 0x6000, Name: "/usr/lib64/libc.so.6"},
+	}
+	tests := []struct {
+		addr     uint64
+		expected string
+	}{
+		{0x1000, "[heap]"},
+		{0x2fff, "[heap]"},
+		{0x3000, ""},
+		{0x5800, "/usr/lib64/libc.so.6"},
+		{0x6000, ""},
+		{0x0, ""},
+	}
+	for _, test := range tests {
+		region := findMemoryRegion(regions, test.addr)
+		var name string
+		if region != nil {
+			name = region.Name
+		}
+		if name != test.expected {
+			t.Errorf("Expected region %q for address 0x%x, got %q", test.expected, test.addr, name)
+		}
+	}
+
+	if region := findMemoryRegion(nil, 0x1000); region != nil {
+		t.Errorf("Expected no region without memory regions, got %+v", region)
+	}
+}
+
+func TestParseHexPattern(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []byte
+		err      string
+	}{
+		{"de ad be ef", []byte{0xde, 0xad, 0xbe, 0xef}, ""},
+		{"DEADBEEF", []byte{0xde, 0xad, 0xbe, 0xef}, ""},
+		{"7f 45\t4c 46", []byte{0x7f, 0x45, 0x4c, 0x46}, ""},
+		{"de a", nil, "odd length hex string"},
+		{"zz", nil, "invalid byte"},
+		{"  ", nil, "pattern is empty"},
+	}
+	for _, test := range tests {
+		result, err := ParseHexPattern(test.input)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("Expected error %q for %q, got %v", test.err, test.input, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Unexpected error for %q: %v", test.input, err)
+		}
+		if !reflect.DeepEqual(result, test.expected) {
+			t.Errorf("Expected %x for %q, got %x", test.expected, test.input, result)
+		}
+	}
+}
+
+func TestReadPatternFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "patterns")
+	content := "# markers\nBEGIN PRIVATE KEY\n\nhex:7f 45 4c 46\r\n"
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	patterns, err := ReadPatternFile(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := []MemoryPattern{
+		{Name: "BEGIN PRIVATE KEY", Data: []byte("BEGIN PRIVATE KEY")},
+		{Name: "hex:7f 45 4c 46", Data: []byte{0x7f, 0x45, 0x4c, 0x46}, Binary: true},
+	}
+	if !reflect.DeepEqual(patterns, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, patterns)
+	}
+
+	if err := os.WriteFile(path, []byte("hex:xyz\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadPatternFile(path); err == nil || !strings.Contains(err.Error(), path+":1:") {
+		t.Errorf("Expected an error with the line number, got %v", err)
+	}
+}
+
+func TestSearchPatternsInProcess(t *testing.T) {
+	dir := t.TempDir()
+	pageSize := uint64(os.Getpagesize())
+	chunkSize := searchChunkPages * pageSize
+
+	// Two adjacent pagemap entries, a page which is not in the pages
+	// image and a separate entry
+	newImageWriter(t, "PAGEMAP").
+		entry(&pagemap.PagemapHead{PagesId: proto.Uint32(1)}).
+		entry(&pagemap.PagemapEntry{Vaddr: proto.Uint64(0x10000000), CompatNrPages: proto.Uint32(0), NrPages: proto.Uint64(searchChunkPages), Flags: proto.Uint32(pePresent)}).
+		entry(&pagemap.PagemapEntry{Vaddr: proto.Uint64(0x10000000 + chunkSize), CompatNrPages: proto.Uint32(0), NrPages: proto.Uint64(1), Flags: proto.Uint32(pePresent)}).
+		entry(&pagemap.PagemapEntry{Vaddr: proto.Uint64(0x20000000), CompatNrPages: proto.Uint32(0), NrPages: proto.Uint64(1), Flags: proto.Uint32(0)}).
+		entry(&pagemap.PagemapEntry{Vaddr: proto.Uint64(0x30000000), CompatNrPages: proto.Uint32(0), NrPages: proto.Uint64(1), Flags: proto.Uint32(pePresent)}).
+		write(dir, "pagemap-1.img")
+
+	pages := make([]byte, chunkSize+2*pageSize)
+	// A match spanning the two adjacent entries and the chunk boundary
+	copy(pages[chunkSize-2:], "SECRET")
+	copy(pages[chunkSize+pageSize+8:], []byte{0xde, 0xad, 0xbe, 0xef})
+	if err := os.WriteFile(filepath.Join(dir, metadata.CheckpointDirectory, "pages-1.img"), pages, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	patterns := []MemoryPattern{
+		{Name: "SECRET", Data: []byte("SECRET")},
+		{Name: "hex:de ad be ef", Data: []byte{0xde, 0xad, 0xbe, 0xef}, Binary: true},
+	}
+	matcher := newPatternMatcher([][]byte{patterns[0].Data, patterns[1].Data})
+
+	matches, err := searchPatternsInProcess(dir, 1, 1, matcher, patterns, 2)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := []memoryMatch{
+		{vaddr: 0x10000000 + chunkSize - 2, pattern: "SECRET", match: "..SECRET.."},
+		{vaddr: 0x30000000 + 8, pattern: "hex:de ad be ef", match: "00 00 de ad be ef 00 00"},
+	}
+	if !reflect.DeepEqual(matches, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, matches)
+	}
+}
@@ -0,0 +1,204 @@
+// SPDX-License-Identifier: Apache-2.0
+
+// This file is used to build the mount tree recorded by CRIU
+
+package internal
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	metadata "github.com/checkpoint-restore/checkpointctl/lib"
+	"github.com/checkpoint-restore/go-criu/v8/crit/images/mnt"
+	spec "github.com/opencontainers/runtime-spec/specs-go"
+)
+
+type MountNamespaceMountsNode struct {
+	ID     uint32          `json:"id"`
+	Mounts []CriuMountNode `json:"mounts"`
+}
+
+type CriuMountNode struct {
+	ID          uint32          `json:"mount_id"`
+	ParentID    uint32          `json:"parent_mount_id"`
+	Mountpoint  string          `json:"mountpoint"`
+	Root        string          `json:"root"`
+	Fstype      string          `json:"fstype"`
+	Source      string          `json:"source"`
+	Options     string          `json:"options,omitempty"`
+	Propagation string          `json:"propagation"`
+	External    bool            `json:"external,omitempty"`
+	ExternalKey string          `json:"external_key,omitempty"`
+	Deleted     bool            `json:"deleted,omitempty"`
+	InSpec      bool            `json:"in_spec"`
+	Children    []CriuMountNode `json:"children,omitempty"`
+}
+
+// mountFlags lists the per-mount flags from the kernel (MS_*) in the order
+// they are shown in /proc/self/mountinfo.
+var mountFlags = []struct {
+	flag uint32
+	name string
+}{
+	{0x2, "nosuid"},
+	{0x4, "nodev"},
+	{0x8, "noexec"},
+	{0x400, "noatime"},
+	{0x800, "nodiratime"},
+	{0x200000, "relatime"},
+}
+
+// buildJSONMountTree reads all mountpoints-*.img files of the checkpoint and
+// returns the mount tree of every mount namespace. Mounts whose mountpoint is
+// not listed in the OCI spec are marked, as they were created at runtime.
+func buildJSONMountTree(checkpointOutputDir string, specDump *spec.Spec) ([]MountNamespaceMountsNode, error) {
+	images, err := filepath.Glob(filepath.Join(checkpointOutputDir, metadata.CheckpointDirectory, "mountpoints-*.img"))
+	if err != nil {
+		return nil, err
+	}
+
+	specDestinations := map[string]bool{"/": true}
+	if specDump != nil {
+		for _, m := range specDump.Mounts {
+			specDestinations[path.Clean(m.Destination)] = true
+		}
+	}
+
+	var result []MountNamespaceMountsNode
+	for _, image := range images {
+		name := filepath.Base(image)
+		id, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimPrefix(name, "mountpoints-"), ".img"), 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("unexpected image name %s: %w", name, err)
+		}
+
+		img, err := readCriuImage(checkpointOutputDir, name, &mnt.MntEntry{})
+		if err != nil {
+			return nil, err
+		}
+
+		var entries []*mnt.MntEntry
+		for _, entry := range img.Entries {
+			entries = append(entries, entry.Message.(*mnt.MntEntry))
+		}
+
+		result = append(result, MountNamespaceMountsNode{
+			ID:     uint32(id),
+			Mounts: buildMountTree(entries, specDestinations),
+		})
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+
+	return result, nil
+}
+
+// buildMountTree nests the mounts below their parent mount. Mounts with a
+// parent that is not part of the image are returned as roots. The order of
+// the image is kept, which is the order in which CRIU restores the mounts.
+func buildMountTree(entries []*mnt.MntEntry, specDestinations map[string]bool) []CriuMountNode {
+	known := make(map[uint32]bool, len(entries))
+	children := make(map[uint32][]*mnt.MntEntry)
+	for _, entry := range entries {
+		known[entry.GetMntId()] = true
+		children[entry.GetParentMntId()] = append(children[entry.GetParentMntId()], entry)
+	}
+
+	var build func(entry *mnt.MntEntry) CriuMountNode
+	build = func(entry *mnt.MntEntry) CriuMountNode {
+		node := buildCriuMountNode(entry, specDestinations)
+		for _, child := range children[entry.GetMntId()] {
+			// The root mount of a namespace may be its own parent
+			if child.GetMntId() == entry.GetMntId() {
+				continue
+			}
+			node.Children = append(node.Children, build(child))
+		}
+		return node
+	}
+
+	var result []CriuMountNode
+	for _, entry := range entries {
+		if !known[entry.GetParentMntId()] || entry.GetParentMntId() == entry.GetMntId() {
+			result = append(result, build(entry))
+		}
+	}
+
+	return result
+}
+
+func buildCriuMountNode(entry *mnt.MntEntry, specDestinations map[string]bool) CriuMountNode {
+	mountpoint := path.Clean("/" + strings.TrimPrefix(entry.GetMountpoint(), "."))
+
+	return CriuMountNode{
+		ID:          entry.GetMntId(),
+		ParentID:    entry.GetParentMntId(),
+		Mountpoint:  mountpoint,
+		Root:        entry.GetRoot(),
+		Fstype:      mountFstype(entry),
+		Source:      entry.GetSource(),
+		Options:     mountOptions(entry),
+		Propagation: mountPropagation(entry),
+		External:    entry.GetExtMount(),
+		ExternalKey: entry.GetExtKey(),
+		Deleted:     entry.GetDeleted(),
+		InSpec:      specDestinations[mountpoint],
+	}
+}
+
+// mountFstype returns the file system name of a mount. CRIU only has
+// dedicated types for file systems that need special handling, all
+// others are stored with their name.
+func mountFstype(entry *mnt.MntEntry) string {
+	if entry.GetFsname() != "" {
+		return entry.GetFsname()
+	}
+	switch mnt.Fstype(entry.GetFstype()) {
+	case mnt.Fstype_OVERLAYFS:
+		return "overlay"
+	case mnt.Fstype_BINFMT_MISC:
+		return "binfmt_misc"
+	}
+	if name, ok := mnt.Fstype_name[int32(entry.GetFstype())]; ok {
+		return strings.ToLower(name)
+	}
+	return fmt.Sprintf("unknown (%d)", entry.GetFstype())
+}
+
+// mountOptions combines the per-mount flags and the file system options.
+func mountOptions(entry *mnt.MntEntry) string {
+	options := []string{"rw"}
+	// MS_RDONLY
+	if entry.GetFlags()&0x1 != 0 {
+		options[0] = "ro"
+	}
+	for _, f := range mountFlags {
+		if entry.GetFlags()&f.flag != 0 {
+			options = append(options, f.name)
+		}
+	}
+	if entry.GetOptions() != "" {
+		options = append(options, entry.GetOptions())
+	}
+	return strings.Join(options, ",")
+}
+
+// mountPropagation formats the propagation of a mount the same way as
+// the optional fields of /proc/self/mountinfo.
+func mountPropagation(entry *mnt.MntEntry) string {
+	var propagation []string
+	if entry.GetSharedId() != 0 {
+		propagation = append(propagation, fmt.Sprintf("shared:%d", entry.GetSharedId()))
+	}
+	if entry.GetMasterId() != 0 {
+		propagation = append(propagation, fmt.Sprintf("master:%d", entry.GetMasterId()))
+	}
+	if len(propagation) == 0 {
+		return "private"
+	}
+	return strings.Join(propagation, " ")
+}
@@ -0,0 +1,113 @@
+package internal
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/checkpoint-restore/go-criu/v8/crit/images/mnt"
+	"github.com/xlab/treeprint"
+	"google.golang.org/protobuf/proto"
+)
+
+func newMntEntry(id, parent uint32, mountpoint string, fstype mnt.Fstype) *mnt.MntEntry {
+	return &mnt.MntEntry{
+		Fstype:      proto.Uint32(uint32(fstype)),
+		MntId:       proto.Uint32(id),
+		RootDev:     proto.Uint32(0),
+		ParentMntId: proto.Uint32(parent),
+		Flags:       proto.Uint32(0),
+		Root:        proto.String("/"),
+		Mountpoint:  proto.String(mountpoint),
+		Source:      proto.String("none"),
+		Options:     proto.String(""),
+	}
+}
+
+func TestBuildMountTree(t *testing.T) {
+	root := newMntEntry(10, 1, "./", mnt.Fstype_OVERLAYFS)
+	proc := newMntEntry(11, 10, "./proc", mnt.Fstype_PROC)
+	proc.Flags = proto.Uint32(0x2 | 0x4 | 0x8)
+	tmp := newMntEntry(12, 10, "./tmp/runtime", mnt.Fstype_TMPFS)
+	tmp.SharedId = proto.Uint32(3)
+	tmp.MasterId = proto.Uint32(1)
+	sys := newMntEntry(13, 11, "./proc/sys", mnt.Fstype_AUTO)
+	sys.Fsname = proto.String("binfmt_misc")
+	sys.Flags = proto.Uint32(0x1)
+
+	specDestinations := map[string]bool{"/": true, "/proc": true, "/proc/sys": true}
+	result := buildMountTree([]*mnt.MntEntry{root, proc, tmp, sys}, specDestinations)
+
+	if len(result) != 1 {
+		t.Fatalf("Expected one root mount, got %d", len(result))
+	}
+	if result[0].Mountpoint != "/" || result[0].Fstype != "overlay" || len(result[0].Children) != 2 {
+		t.Fatalf("Unexpected root mount: %+v", result[0])
+	}
+
+	procNode := result[0].Children[0]
+	if procNode.Options != "rw,nosuid,nodev,noexec" || procNode.Propagation != "private" || !procNode.InSpec {
+		t.Errorf("Unexpected proc mount: %+v", procNode)
+	}
+	if len(procNode.Children) != 1 || procNode.Children[0].Fstype != "binfmt_misc" || procNode.Children[0].Options != "ro" {
+		t.Errorf("Unexpected children of proc mount: %+v", procNode.Children)
+	}
+
+	tmpNode := result[0].Children[1]
+	if tmpNode.Mountpoint != "/tmp/runtime" || tmpNode.InSpec {
+		t.Errorf("Expected /tmp/runtime to be absent from the spec: %+v", tmpNode)
+	}
+	if tmpNode.Propagation != "shared:3 master:1" {
+		t.Errorf("Expected propagation shared:3 master:1, got %s", tmpNode.Propagation)
+	}
+}
+
+func TestAddMountTreeToTree(t *testing.T) {
+	tree := treeprint.New()
+	addMountTreeToTree(tree, []MountNamespaceMountsNode{
+		{
+			ID: 4026532281,
+			Mounts: []CriuMountNode{
+				{
+					ID:          10,
+					Mountpoint:  "/",
+					Root:        "/",
+					Fstype:      "overlay",
+					Source:      "overlay",
+					Options:     "rw",
+					Propagation: "private",
+					InSpec:      true,
+					Children: []CriuMountNode{
+						{
+							ID:          12,
+							Mountpoint:  "/data",
+							Root:        "/volumes/data",
+							Fstype:      "ext4",
+							Source:      "/dev/sda1",
+							Options:     "rw,relatime",
+							Propagation: "shared:3",
+							External:    true,
+							ExternalKey: "data",
+						},
+					},
+				},
+			},
+		},
+	})
+	result := tree.String()
+
+	expectedStrings := []string{
+		"Mount tree",
+		"Mount namespace 4026532281",
+		"[10]  /",
+		"[12]  /data (not in OCI spec)",
+		"Root: /volumes/data",
+		"Options: rw,relatime",
+		"Propagation: shared:3",
+		"External mount: data",
+	}
+	for _, expected := range expectedStrings {
+		if !strings.Contains(result, expected) {
+			t.Errorf("Expected tree to contain %q, but it didn't.\nTree:\n%s", expected, result)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+// SPDX-License-Identifier: Apache-2.0
+
+// This file is used to collect the namespaces of checkpointed processes
+
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/checkpoint-restore/go-criu/v8/crit"
+	criu_core "github.com/checkpoint-restore/go-criu/v8/crit/images/criu-core"
+	"github.com/checkpoint-restore/go-criu/v8/crit/images/userns"
+	"github.com/checkpoint-restore/go-criu/v8/crit/images/utsns"
+)
+
+type IDMapNode struct {
+	ContainerID uint32 `json:"container_id"`
+	HostID      uint32 `json:"host_id"`
+	Size        uint32 `json:"size"`
+}
+
+type NamespaceNode struct {
+	Type       string      `json:"type"`
+	ID         uint32      `json:"id"`
+	PIDs       []uint32    `json:"pids"`
+	Hostname   string      `json:"hostname,omitempty"`
+	Domainname string      `json:"domainname,omitempty"`
+	UIDMap     []IDMapNode `json:"uid_map,omitempty"`
+	GIDMap     []IDMapNode `json:"gid_map,omitempty"`
+}
+
+// namespaceTypes lists the namespace types in display order together with
+// the function used to get the namespace ID from the task IDs.
+var namespaceTypes = []struct {
+	name  string
+	getID func(*criu_core.TaskKobjIdsEntry) uint32
+}{
+	{"pid", (*criu_core.TaskKobjIdsEntry).GetPidNsId},
+	{"net", (*criu_core.TaskKobjIdsEntry).GetNetNsId},
+	{"ipc", (*criu_core.TaskKobjIdsEntry).GetIpcNsId},
+	{"uts", (*criu_core.TaskKobjIdsEntry).GetUtsNsId},
+	{"mnt", (*criu_core.TaskKobjIdsEntry).GetMntNsId},
+	{"user", (*criu_core.TaskKobjIdsEntry).GetUserNsId},
+	{"cgroup", (*criu_core.TaskKobjIdsEntry).GetCgroupNsId},
+	{"time", (*criu_core.TaskKobjIdsEntry).GetTimeNsId},
+}
+
+// readTaskIDs returns the kernel object IDs of the given process.
+func readTaskIDs(checkpointOutputDir string, ps *crit.PsTree) (*criu_core.TaskKobjIdsEntry, error) {
+	img, err := readCriuImage(checkpointOutputDir, fmt.Sprintf("ids-%d.img", ps.PID), &criu_core.TaskKobjIdsEntry{})
+	if err != nil {
+		// Newer CRIU versions also store the IDs in the core image
+		if errors.Is(err, os.ErrNotExist) && ps.Core.GetIds() != nil {
+			return ps.Core.GetIds(), nil
+		}
+		return nil, err
+	}
+	if len(img.Entries) == 0 {
+		return nil, fmt.Errorf("ids-%d.img contains no entries", ps.PID)
+	}
+
+	return img.Entries[0].Message.(*criu_core.TaskKobjIdsEntry), nil
+}
+
+// buildJSONNamespaces groups all processes with state by the namespaces they belong to.
+func buildJSONNamespaces(psTree *crit.PsTree, checkpointOutputDir string) ([]NamespaceNode, error) {
+	// namespace type -> namespace ID -> PIDs
+	members := make(map[string]map[uint32][]uint32)
+
+	err := walkAliveProcesses(psTree, func(ps *crit.PsTree) error {
+		ids, err := readTaskIDs(checkpointOutputDir, ps)
+		if err != nil {
+			return fmt.Errorf("failed to read namespace IDs of process %d: %w", ps.PID, err)
+		}
+		for _, nsType := range namespaceTypes {
+			id := nsType.getID(ids)
+			if id == 0 {
+				continue
+			}
+			if members[nsType.name] == nil {
+				members[nsType.name] = make(map[uint32][]uint32)
+			}
+			members[nsType.name][id] = append(members[nsType.name][id], ps.PID)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var result []NamespaceNode
+	for _, nsType := range namespaceTypes {
+		nsIDs := make([]uint32, 0, len(members[nsType.name]))
+		for id := range members[nsType.name] {
+			nsIDs = append(nsIDs, id)
+		}
+		sort.Slice(nsIDs, func(i, j int) bool { return nsIDs[i] < nsIDs[j] })
+
+		for _, id := range nsIDs {
+			pids := members[nsType.name][id]
+			sort.Slice(pids, func(i, j int) bool { return pids[i] < pids[j] })
+
+			node := NamespaceNode{
+				Type: nsType.name,
+				ID:   id,
+				PIDs: pids,
+			}
+			if err := addNamespaceDetails(&node, checkpointOutputDir); err != nil {
+				return nil, err
+			}
+			result = append(result, node)
+		}
+	}
+
+	return result, nil
+}
+
+// addNamespaceDetails adds type specific information to a namespace. CRIU
+// only dumps namespaces that differ from the one CRIU runs in, so a missing
+// image is not an error.
+func addNamespaceDetails(node *NamespaceNode, checkpointOutputDir string) error {
+	switch node.Type {
+	case "uts":
+		img, err := readCriuImage(checkpointOutputDir, fmt.Sprintf("utsns-%d.img", node.ID), &utsns.UtsnsEntry{})
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if len(img.Entries) > 0 {
+			entry := img.Entries[0].Message.(*utsns.UtsnsEntry)
+			node.Hostname = entry.GetNodename()
+			node.Domainname = entry.GetDomainname()
+		}
+	case "user":
+		img, err := readCriuImage(checkpointOutputDir, fmt.Sprintf("userns-%d.img", node.ID), &userns.UsernsEntry{})
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if len(img.Entries) > 0 {
+			entry := img.Entries[0].Message.(*userns.UsernsEntry)
+			node.UIDMap = buildIDMap(entry.GetUidMap())
+			node.GIDMap = buildIDMap(entry.GetGidMap())
+		}
+	}
+
+	return nil
+}
+
+func buildIDMap(extents []*userns.UidGidExtent) []IDMapNode {
+	var result []IDMapNode
+	for _, extent := range extents {
+		result = append(result, IDMapNode{
+			ContainerID: extent.GetFirst(),
+			HostID:      extent.GetLowerFirst(),
+			Size:        extent.GetCount(),
+		})
+	}
+	return result
+}
@@ -0,0 +1,105 @@
+package internal
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/checkpoint-restore/go-criu/v8/crit"
+	criu_core "github.com/checkpoint-restore/go-criu/v8/crit/images/criu-core"
+	"github.com/checkpoint-restore/go-criu/v8/crit/images/userns"
+	"github.com/xlab/treeprint"
+	"google.golang.org/protobuf/proto"
+)
+
+func newNsTestProcess(pid, netNsID, utsNsID uint32, children ...*crit.PsTree) *crit.PsTree {
+	return &crit.PsTree{
+		PID: pid,
+		Core: &criu_core.CoreEntry{
+			Tc: &criu_core.TaskCoreEntry{TaskState: proto.Uint32(1)},
+			Ids: &criu_core.TaskKobjIdsEntry{
+				NetNsId: proto.Uint32(netNsID),
+				UtsNsId: proto.Uint32(utsNsID),
+			},
+		},
+		Children: children,
+	}
+}
+
+func TestBuildJSONNamespaces(t *testing.T) {
+	psTree := newNsTestProcess(1, 10, 20,
+		newNsTestProcess(3, 11, 20),
+		newNsTestProcess(2, 10, 20),
+	)
+
+	result, err := buildJSONNamespaces(psTree, t.TempDir())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := []NamespaceNode{
+		{Type: "net", ID: 10, PIDs: []uint32{1, 2}},
+		{Type: "net", ID: 11, PIDs: []uint32{3}},
+		{Type: "uts", ID: 20, PIDs: []uint32{1, 2, 3}},
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, result)
+	}
+}
+
+func TestBuildJSONNamespacesSkipsDeadProcesses(t *testing.T) {
+	zombie := &crit.PsTree{
+		PID: 2,
+		Core: &criu_core.CoreEntry{
+			Tc: &criu_core.TaskCoreEntry{TaskState: proto.Uint32(uint32(crit.TaskZombie))},
+		},
+	}
+	psTree := newNsTestProcess(1, 10, 20, zombie)
+
+	result, err := buildJSONNamespaces(psTree, t.TempDir())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for _, ns := range result {
+		if !reflect.DeepEqual(ns.PIDs, []uint32{1}) {
+			t.Errorf("Expected only PID 1 in namespace %s, got %v", ns.Type, ns.PIDs)
+		}
+	}
+}
+
+func TestBuildIDMap(t *testing.T) {
+	extents := []*userns.UidGidExtent{
+		{First: proto.Uint32(0), LowerFirst: proto.Uint32(100000), Count: proto.Uint32(65536)},
+	}
+
+	expected := []IDMapNode{{ContainerID: 0, HostID: 100000, Size: 65536}}
+	if result := buildIDMap(extents); !reflect.DeepEqual(result, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, result)
+	}
+}
+
+func TestAddNamespaceNodesToTree(t *testing.T) {
+	tree := treeprint.New()
+	addNamespaceNodesToTree(tree, []NamespaceNode{
+		{Type: "uts", ID: 3, PIDs: []uint32{1, 2}, Hostname: "web-0", Domainname: "(none)"},
+		{Type: "user", ID: 4, PIDs: []uint32{1}, UIDMap: []IDMapNode{{ContainerID: 0, HostID: 100000, Size: 65536}}},
+	})
+	result := tree.String()
+
+	expectedStrings := []string{
+		"Namespaces",
+		"[uts]  ID 3",
+		"Hostname: web-0",
+		"PIDs: 1, 2",
+		"[user]  ID 4",
+		"UID map: 0 -> 100000 (65536)",
+	}
+	for _, expected := range expectedStrings {
+		if !strings.Contains(result, expected) {
+			t.Errorf("Expected tree to contain %q, but it didn't.\nTree:\n%s", expected, result)
+		}
+	}
+	if strings.Contains(result, "Domainname") {
+		t.Errorf("Expected unset domainname to be hidden.\nTree:\n%s", result)
+	}
+}
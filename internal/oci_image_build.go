@@ -15,12 +15,14 @@ import (
 type ImageBuilder struct {
 	imageName      string
 	checkpointPath string
+	signaturePath  string
 }
 
-func NewImageBuilder(imageName, checkpointPath string) *ImageBuilder {
+func NewImageBuilder(imageName, checkpointPath, signaturePath string) *ImageBuilder {
 	return &ImageBuilder{
 		imageName:      imageName,
 		checkpointPath: checkpointPath,
+		signaturePath:  signaturePath,
 	}
 }
 
@@ -130,5 +132,19 @@ func (ic *ImageBuilder) getCheckpointAnnotations() (map[string]string, error) {
 	checkpointImageAnnotations[metadata.CheckpointAnnotationRootfsImageID] = info.configDump.RootfsImageRef
 	checkpointImageAnnotations[metadata.CheckpointAnnotationRuntimeName] = info.configDump.OCIRuntime
 
+	if ic.signaturePath != "" {
+		signature, err := ReadCheckpointSignature(ic.signaturePath)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkSignatureMatches(ic.checkpointPath, signature); err != nil {
+			return nil, err
+		}
+		checkpointImageAnnotations[metadata.CheckpointAnnotationSignature], err = signatureAnnotation(signature)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	return checkpointImageAnnotations, nil
 }
@@ -11,10 +11,49 @@ var (
 	PsTreeEnv          bool
 	Files              bool
 	Sockets            bool
+	Memory             bool
+	RootFs             bool
 	ShowUnchanged      bool
 	ShowAll            bool
 	SearchPattern      string
 	SearchRegexPattern string
 	SearchContext      int
 	Metadata           bool
+	Registers          bool
+	Threads            bool
+	Namespaces         bool
+	MountTree          bool
+	IPC                bool
+	IpcShmID           uint32
+	IpcNsID            uint32
+	Ttys               bool
+	GhostFiles         bool
+	GhostFileID        uint32
+	Shmem              bool
+	ShmemID            uint64
+	DumpDir            string
+	DumpFormat         string
+	MemoryRange        string
+	VmaName            string
+	MemoryOffset       uint64
+	MemoryLength       uint64
+	SearchFormat       string
+	SearchHexPattern   string
+	SearchPatternFile  string
+	SecretRules        []string
+	SecretRulesFile    string
+	SecretThreshold    int
+	SecretEntropy      float64
+	RedactEnvVars      []string
+	RedactPatterns     []string
+	RedactFiles        []string
+	RedactSecrets      bool
+	MaskEnvVars        []string
+	ShowSecrets        bool
+	SigningKey         string
+	SignatureFile      string
+	ManifestCompare    string
+	RepackCompression  string
+	RepackLevel        int
+	StoreDir           string
 )
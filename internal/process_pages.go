@@ -0,0 +1,210 @@
+// SPDX-License-Identifier: Apache-2.0
+
+// This file is used to access the memory pages of checkpointed processes
+
+package internal
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	metadata "github.com/checkpoint-restore/checkpointctl/lib"
+	"github.com/checkpoint-restore/go-criu/v8/crit"
+	"github.com/checkpoint-restore/go-criu/v8/crit/images/pagemap"
+)
+
+// pagesRange is a range of contiguous memory pages stored at the given
+// offset of the pages image.
+type pagesRange struct {
+	vaddr, size, offset uint64
+}
+
+// readPagesRanges returns the ranges of the memory pages of a process which
+// are stored in its pages image. Adjacent pagemap entries are merged.
+func readPagesRanges(checkpointOutputDir string, pid uint32) ([]pagesRange, error) {
+	img, err := readCriuImage(checkpointOutputDir, fmt.Sprintf("pagemap-%d.img", pid), &pagemap.PagemapHead{})
+	if err != nil {
+		return nil, err
+	}
+	if len(img.Entries) == 0 {
+		return nil, fmt.Errorf("pagemap-%d.img contains no entries", pid)
+	}
+
+	pageSize := uint64(os.Getpagesize())
+	var ranges []pagesRange
+	var offset uint64
+	for _, e := range img.Entries[1:] {
+		entry := e.Message.(*pagemap.PagemapEntry)
+		// Pages of older images have no flags and are always present
+		if entry.Flags != nil && entry.GetFlags()&pePresent == 0 {
+			continue
+		}
+		size := entry.GetNrPages() * pageSize
+		if n := len(ranges); n > 0 && ranges[n-1].vaddr+ranges[n-1].size == entry.GetVaddr() && ranges[n-1].offset+ranges[n-1].size == offset {
+			ranges[n-1].size += size
+		} else {
+			ranges = append(ranges, pagesRange{vaddr: entry.GetVaddr(), size: size, offset: offset})
+		}
+		offset += size
+	}
+
+	return ranges, nil
+}
+
+// getPagesID returns the ID of the pages image of a process.
+func getPagesID(checkpointOutputDir string, pid uint32) (uint32, error) {
+	mr, err := crit.NewMemoryReader(filepath.Join(checkpointOutputDir, metadata.CheckpointDirectory), pid, pageSize)
+	if err != nil {
+		return 0, err
+	}
+	return mr.GetPagesID(), nil
+}
+
+// ProcessPages provides access to the memory of a process stored in its
+// pages image. Only the pages which are present in the pagemap are read,
+// so the cost does not depend on the size of the address space.
+type ProcessPages struct {
+	id     uint32
+	file   *os.File
+	ranges []pagesRange
+}
+
+// OpenProcessPages opens the pages image of a process for reading. The
+// pagemap and pages images of the process have to be unpacked.
+func OpenProcessPages(checkpointOutputDir string, pid uint32) (*ProcessPages, error) {
+	return openProcessPages(checkpointOutputDir, pid, os.O_RDONLY)
+}
+
+func openProcessPages(checkpointOutputDir string, pid uint32, flag int) (*ProcessPages, error) {
+	ranges, err := readPagesRanges(checkpointOutputDir, pid)
+	if err != nil {
+		return nil, err
+	}
+	pagesID, err := getPagesID(checkpointOutputDir, pid)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(filepath.Join(checkpointOutputDir, metadata.CheckpointDirectory, fmt.Sprintf("pages-%d.img", pagesID)), flag, 0)
+	if err != nil {
+		return nil, err
+	}
+	return &ProcessPages{id: pagesID, file: file, ranges: ranges}, nil
+}
+
+// Close closes the pages image.
+func (p *ProcessPages) Close() error {
+	return p.file.Close()
+}
+
+// forEach calls fn with the offsets in the pages image and in the address
+// range of all pieces of the address range which are stored in the image.
+func (p *ProcessPages) forEach(vaddr, size uint64, fn func(fileOffset, offset, n uint64) error) error {
+	end := vaddr + size
+	for _, r := range p.ranges {
+		start := max(vaddr, r.vaddr)
+		stop := min(end, r.vaddr+r.size)
+		if start >= stop {
+			continue
+		}
+		if err := fn(r.offset+start-r.vaddr, start-vaddr, stop-start); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// read returns the memory of an address range. Pages which are not stored
+// in the image are returned as zeros.
+func (p *ProcessPages) read(vaddr, size uint64) ([]byte, error) {
+	data := make([]byte, size)
+	err := p.forEach(vaddr, size, func(fileOffset, offset, n uint64) error {
+		_, err := p.file.ReadAt(data[offset:offset+n], int64(fileOffset))
+		return err
+	})
+	return data, err
+}
+
+// HasPages reports whether any page of the address range between start and
+// end is stored in the image.
+func (p *ProcessPages) HasPages(start, end uint64) bool {
+	found := false
+	_ = p.forEach(start, end-start, func(_, _, _ uint64) error {
+		found = true
+		return nil
+	})
+	return found
+}
+
+// WriteMemory writes the memory of the address range between start and end
+// to out. The pages are copied directly from the pages image. Pages which
+// are not stored in the image are zero. If out is an io.Seeker, they are
+// skipped to create a sparse file instead of being written.
+func (p *ProcessPages) WriteMemory(out io.Writer, start, end uint64) error {
+	w := &holeWriter{out: out}
+	var written uint64
+	err := p.forEach(start, end-start, func(fileOffset, offset, n uint64) error {
+		w.skip(offset - written)
+		if _, err := io.Copy(w, io.NewSectionReader(p.file, int64(fileOffset), int64(n))); err != nil {
+			return fmt.Errorf("failed to read memory at 0x%x: %w", start+offset, err)
+		}
+		written = offset + n
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	w.skip(end - start - written)
+	return w.finish()
+}
+
+// holeWriter writes zeros which are skipped with skip lazily. If the
+// underlying writer is an io.Seeker, the zeros are not written but skipped
+// by seeking, which creates holes in files.
+type holeWriter struct {
+	out  io.Writer
+	hole uint64
+}
+
+func (w *holeWriter) skip(n uint64) {
+	w.hole += n
+}
+
+func (w *holeWriter) Write(p []byte) (int, error) {
+	if w.hole > 0 {
+		if seeker, ok := w.out.(io.Seeker); ok {
+			if _, err := seeker.Seek(int64(w.hole), io.SeekCurrent); err != nil {
+				return 0, err
+			}
+		} else if err := writeZeros(w.out, w.hole); err != nil {
+			return 0, err
+		}
+		w.hole = 0
+	}
+	return w.out.Write(p)
+}
+
+// finish writes a hole at the end. Seeking alone does not extend a file,
+// so the last zero byte is written.
+func (w *holeWriter) finish() error {
+	if w.hole == 0 {
+		return nil
+	}
+	w.hole--
+	_, err := w.Write([]byte{0})
+	return err
+}
+
+// writeZeros writes n zero bytes.
+func writeZeros(out io.Writer, n uint64) error {
+	zeros := make([]byte, min(n, 1<<20))
+	for n > 0 {
+		written, err := out.Write(zeros[:min(n, uint64(len(zeros)))])
+		if err != nil {
+			return err
+		}
+		n -= uint64(written)
+	}
+	return nil
+}
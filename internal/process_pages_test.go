@@ -0,0 +1,105 @@
+package internal
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	metadata "github.com/checkpoint-restore/checkpointctl/lib"
+	"github.com/checkpoint-restore/go-criu/v8/crit/images/pagemap"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestProcessPagesWriteMemory(t *testing.T) {
+	dir := t.TempDir()
+	page := uint64(pageSize)
+
+	newImageWriter(t, "PAGEMAP").
+		entry(&pagemap.PagemapHead{PagesId: proto.Uint32(1)}).
+		entry(&pagemap.PagemapEntry{Vaddr: proto.Uint64(0x10000), CompatNrPages: proto.Uint32(0), NrPages: proto.Uint64(1), Flags: proto.Uint32(pePresent)}).
+		entry(&pagemap.PagemapEntry{Vaddr: proto.Uint64(0x10000 + 3*page), CompatNrPages: proto.Uint32(0), NrPages: proto.Uint64(2), Flags: proto.Uint32(pePresent)}).
+		write(dir, "pagemap-1.img")
+	pages := randomPages(t, 3)
+	if err := os.WriteFile(filepath.Join(dir, metadata.CheckpointDirectory, "pages-1.img"), bytes.Join(pages, nil), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := OpenProcessPages(dir, 1)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer p.Close()
+
+	zero := make([]byte, page)
+	expected := bytes.Join([][]byte{pages[0], zero, zero, pages[1], pages[2], zero}, nil)
+
+	// Holes are written as zeros to writers which cannot seek
+	var buf bytes.Buffer
+	if err := p.WriteMemory(&buf, 0x10000, 0x10000+6*page); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !bytes.Equal(buf.Bytes(), expected) {
+		t.Error("Unexpected memory written to buffer")
+	}
+
+	// Holes are skipped in files, including the hole at the end
+	path := filepath.Join(t.TempDir(), "memory")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.WriteMemory(f, 0x10000, 0x10000+6*page); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	f.Close()
+	written, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(written, expected) {
+		t.Errorf("Unexpected memory written to file of %d bytes", len(written))
+	}
+
+	if !p.HasPages(0x10000+2*page, 0x10000+4*page) || p.HasPages(0x10000+page, 0x10000+3*page) {
+		t.Error("Unexpected result of HasPages")
+	}
+
+	// A large region without pages is not read or written
+	f, err = os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := p.WriteMemory(f, 1<<40, 1<<40+(1<<34)); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if info, err := f.Stat(); err != nil || info.Size() != 1<<34 {
+		t.Errorf("Expected a sparse file of 16 GiB, got %v %v", info, err)
+	}
+}
+
+// newTestProcessPages returns the pages of a process which are stored in
+// the given ranges. The ranges are stored one after another and each page
+// is filled with the page number of its address.
+func newTestProcessPages(t *testing.T, ranges ...[2]uint64) *ProcessPages {
+	t.Helper()
+	f, err := os.Create(filepath.Join(t.TempDir(), "pages-1.img"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { f.Close() })
+
+	p := &ProcessPages{id: 1, file: f}
+	var offset uint64
+	for _, r := range ranges {
+		for addr := r[0]; addr < r[1]; addr += uint64(pageSize) {
+			if _, err := f.Write(bytes.Repeat([]byte{byte(addr >> 12)}, pageSize)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		p.ranges = append(p.ranges, pagesRange{vaddr: r[0], size: r[1] - r[0], offset: offset})
+		offset += r[1] - r[0]
+	}
+	return p
+}
@@ -0,0 +1,589 @@
+// SPDX-License-Identifier: Apache-2.0
+
+// This file is used to redact secrets in container checkpoints
+
+package internal
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	metadata "github.com/checkpoint-restore/checkpointctl/lib"
+	"github.com/checkpoint-restore/go-criu/v8/crit"
+)
+
+// redactByte replaces every byte of redacted data. The length of the data
+// is kept, so that the CRIU images remain valid.
+const redactByte = '*'
+
+// redactCopyMinLength is the minimum length of the value of an environment
+// variable whose copies are searched in the memory of all processes. Shorter
+// values are too likely to match unrelated memory.
+const redactCopyMinLength = 6
+
+// RedactSourceConfig is the source of environment variables redacted in
+// spec.dump and config.dump
+const RedactSourceConfig = "config"
+
+type RedactOptions struct {
+	// EnvVars are glob patterns of the names of environment variables
+	EnvVars []string
+	// Rules are applied to the memory pages of all processes
+	Rules []SecretRule
+	// Files are glob patterns of the paths of files in rootfs-diff.tar
+	Files []string
+}
+
+type RedactedItem struct {
+	Source   string `json:"source"`
+	PID      uint32 `json:"pid,omitempty"`
+	Comm     string `json:"command,omitempty"`
+	Location string `json:"location"`
+	Reason   string `json:"reason"`
+	Length   int    `json:"length"`
+}
+
+// RedactCheckpoint writes a copy of the checkpoint archive of the task to
+// output in which the selected environment variables, the memory matching
+// the rules and the selected files of rootfs-diff.tar are overwritten. All
+// other members of the archive are copied unchanged. The pstree, core, mm,
+// pagemap and pages images and the spec.dump and config.dump files have to
+// be unpacked. The unpacked pages images are modified in place. The copy
+// is written with the compression of the archive, so archives with a
+// compression which cannot be written are rejected before anything is
+// modified.
+func RedactCheckpoint(task Task, output string, opts RedactOptions) ([]RedactedItem, error) {
+	compression, err := detectArchiveCompression(task.CheckpointFilePath)
+	if err != nil {
+		return nil, err
+	}
+	if err := ValidateCompressionLevel(compression, 0); err != nil {
+		return nil, fmt.Errorf("cannot write a redacted copy of %s: %w", task.CheckpointFilePath, err)
+	}
+
+	c := crit.New(nil, nil, filepath.Join(task.OutputDir, metadata.CheckpointDirectory), false, false)
+	psTree, err := c.ExplorePs()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get process tree: %w", err)
+	}
+
+	secrets, err := collectEnvSecrets(task.OutputDir, psTree, opts.EnvVars)
+	if err != nil {
+		return nil, err
+	}
+
+	var items []RedactedItem
+	// replaced maps the names of the archive members which were modified
+	// to the files with their new content
+	replaced := make(map[string]string)
+
+	err = walkAliveProcesses(psTree, func(ps *crit.PsTree) error {
+		result, pagesFile, err := redactProcess(task.OutputDir, ps, opts, secrets)
+		if err != nil {
+			return fmt.Errorf("failed to redact process %d: %w", ps.PID, err)
+		}
+		if len(result) > 0 {
+			replaced[filepath.Join(metadata.CheckpointDirectory, filepath.Base(pagesFile))] = pagesFile
+		}
+		items = append(items, result...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	configItems, err := redactConfigEnvVars(task.OutputDir, opts.EnvVars, replaced)
+	if err != nil {
+		return nil, err
+	}
+	items = append(items, configItems...)
+
+	if len(opts.Files) > 0 {
+		rootFsDiff := filepath.Join(task.OutputDir, metadata.RootFsDiffTar)
+		fileItems, err := redactRootFsDiff(task.CheckpointFilePath, rootFsDiff, opts.Files)
+		if err != nil {
+			return nil, err
+		}
+		replaced[metadata.RootFsDiffTar] = rootFsDiff
+		items = append(items, fileItems...)
+	}
+
+	if err := copyArchive(task.CheckpointFilePath, output, compression, replaced); err != nil {
+		return nil, fmt.Errorf("failed to write %s: %w", output, err)
+	}
+
+	return items, nil
+}
+
+// redact overwrites the memory of an address range.
+func (p *ProcessPages) redact(vaddr, size uint64) error {
+	return p.forEach(vaddr, size, func(fileOffset, _, n uint64) error {
+		_, err := p.file.WriteAt(bytes.Repeat([]byte{redactByte}, int(n)), int64(fileOffset))
+		return err
+	})
+}
+
+// readProcessEnv returns the start address and the content of the
+// environment of a process.
+func readProcessEnv(checkpointOutputDir string, pid uint32, pages *ProcessPages) (uint64, []byte, error) {
+	mmEntry, err := readMmEntry(checkpointOutputDir, pid)
+	if err != nil {
+		return 0, nil, err
+	}
+	envStart := mmEntry.GetMmEnvStart()
+	env, err := pages.read(envStart, mmEntry.GetMmEnvEnd()-envStart)
+	return envStart, env, err
+}
+
+// envSecret is the value of an environment variable selected for redaction.
+type envSecret struct {
+	key   string
+	value []byte
+}
+
+// collectEnvSecrets returns the distinct values of the environment
+// variables matching the glob patterns in the environment of all processes.
+// Values shorter than redactCopyMinLength are omitted.
+func collectEnvSecrets(checkpointOutputDir string, psTree *crit.PsTree, patterns []string) ([]envSecret, error) {
+	if len(patterns) == 0 {
+		return nil, nil
+	}
+
+	var secrets []envSecret
+	seen := make(map[string]bool)
+	err := walkAliveProcesses(psTree, func(ps *crit.PsTree) error {
+		pages, err := OpenProcessPages(checkpointOutputDir, ps.PID)
+		if err != nil {
+			return fmt.Errorf("failed to read environment of process %d: %w", ps.PID, err)
+		}
+		_, env, err := readProcessEnv(checkpointOutputDir, ps.PID, pages)
+		pages.Close()
+		if err != nil {
+			return fmt.Errorf("failed to read environment of process %d: %w", ps.PID, err)
+		}
+		for _, envVar := range bytes.Split(env, []byte{0}) {
+			key, value, found := bytes.Cut(envVar, []byte("="))
+			if !found || len(value) < redactCopyMinLength || matchGlob(patterns, string(key)) == "" || seen[string(value)] {
+				continue
+			}
+			seen[string(value)] = true
+			secrets = append(secrets, envSecret{key: string(key), value: bytes.Clone(value)})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return secrets, nil
+}
+
+// redactProcess redacts the selected environment variables, all copies of
+// the values of the secrets in the memory and the memory matching the rules
+// in the pages image of a process. It returns the path of the pages image.
+func redactProcess(checkpointOutputDir string, ps *crit.PsTree, opts RedactOptions, secrets []envSecret) ([]RedactedItem, string, error) {
+	pages, err := openProcessPages(checkpointOutputDir, ps.PID, os.O_RDWR)
+	if err != nil {
+		return nil, "", err
+	}
+	defer pages.Close()
+
+	var items []RedactedItem
+	add := func(source, location, reason string, length int) {
+		items = append(items, RedactedItem{
+			Source:   source,
+			PID:      ps.PID,
+			Comm:     ps.Comm,
+			Location: location,
+			Reason:   reason,
+			Length:   length,
+		})
+	}
+
+	var regions []MemoryRegion
+	location := func(vaddr uint64) string {
+		s := fmt.Sprintf("0x%016x", vaddr)
+		if region := findMemoryRegion(regions, vaddr); region != nil && region.Name != "" {
+			s += " " + region.Name
+		}
+		return s
+	}
+	if len(secrets) > 0 || len(opts.Rules) > 0 {
+		if regions, err = GetMemoryRegions(checkpointOutputDir, ps.PID); err != nil {
+			return nil, "", err
+		}
+	}
+
+	if len(opts.EnvVars) > 0 {
+		envStart, env, err := readProcessEnv(checkpointOutputDir, ps.PID, pages)
+		if err != nil {
+			return nil, "", err
+		}
+		var offset uint64
+		for _, envVar := range bytes.Split(env, []byte{0}) {
+			key, value, found := bytes.Cut(envVar, []byte("="))
+			if pattern := matchGlob(opts.EnvVars, string(key)); found && pattern != "" && len(value) > 0 {
+				if err := pages.redact(envStart+offset+uint64(len(key))+1, uint64(len(value))); err != nil {
+					return nil, "", err
+				}
+				add(SecretSourceEnvironment, string(key), pattern, len(value))
+			}
+			offset += uint64(len(envVar)) + 1
+		}
+	}
+
+	// The values of the secrets are also copied to other memory, for example
+	// by getenv() and strdup() or into the buffers of the application. The
+	// environment itself was already redacted and does not match anymore.
+	if len(secrets) > 0 {
+		patterns := make([]MemoryPattern, len(secrets))
+		data := make([][]byte, len(secrets))
+		for i, secret := range secrets {
+			// The name is the index of the secret to find its key
+			patterns[i] = MemoryPattern{Name: strconv.Itoa(i), Data: secret.value}
+			data[i] = secret.value
+		}
+		matches, err := searchPatternsInProcess(checkpointOutputDir, ps.PID, pages.id, newPatternMatcher(data), patterns, 0)
+		if err != nil {
+			return nil, "", err
+		}
+		for _, m := range matches {
+			i, _ := strconv.Atoi(m.pattern)
+			if err := pages.redact(m.vaddr, uint64(len(secrets[i].value))); err != nil {
+				return nil, "", err
+			}
+			add(SecretSourceMemory, location(m.vaddr), "copy of "+secrets[i].key, len(secrets[i].value))
+		}
+	}
+
+	if len(opts.Rules) > 0 {
+		type match struct {
+			vaddr uint64
+			size  int
+			rule  string
+		}
+		var matches []match
+		for _, r := range pages.ranges {
+			err := scanSecretsInStream(io.NewSectionReader(pages.file, int64(r.offset), int64(r.size)), opts.Rules, 0, func(offset uint64, rule string, secret []byte) {
+				matches = append(matches, match{vaddr: r.vaddr + offset, size: len(secret), rule: rule})
+			})
+			if err != nil {
+				return nil, "", err
+			}
+		}
+		for _, m := range matches {
+			if err := pages.redact(m.vaddr, uint64(m.size)); err != nil {
+				return nil, "", err
+			}
+			add(SecretSourceMemory, location(m.vaddr), m.rule, m.size)
+		}
+	}
+
+	return items, pages.file.Name(), nil
+}
+
+// matchGlob returns the first pattern matching name or an empty string.
+func matchGlob(patterns []string, name string) string {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, name); matched {
+			return pattern
+		}
+	}
+	return ""
+}
+
+// configEnvVar is an environment variable of the container selected for
+// redaction in spec.dump or config.dump.
+type configEnvVar struct {
+	key     string
+	pattern string
+	length  int
+}
+
+// collectConfigEnvVars adds the entries of all environment lists of a
+// decoded JSON document matching the glob patterns to envVars. Environment
+// lists are arrays of "KEY=VALUE" strings stored as "env" or "Env".
+func collectConfigEnvVars(doc any, patterns []string, envVars map[string]configEnvVar) {
+	switch v := doc.(type) {
+	case map[string]any:
+		for name, value := range v {
+			if list, ok := value.([]any); ok && strings.EqualFold(name, "env") {
+				for _, entry := range list {
+					envVar, ok := entry.(string)
+					if !ok {
+						continue
+					}
+					key, value, _ := strings.Cut(envVar, "=")
+					if pattern := matchGlob(patterns, key); pattern != "" && value != "" {
+						envVars[envVar] = configEnvVar{key: key, pattern: pattern, length: len(value)}
+					}
+				}
+			}
+			collectConfigEnvVars(value, patterns, envVars)
+		}
+	case []any:
+		for _, value := range v {
+			collectConfigEnvVars(value, patterns, envVars)
+		}
+	}
+}
+
+// redactConfigStrings overwrites the values of the selected environment
+// variables in all strings of an encoded JSON document which are equal to one
+// of the variables. This includes the environment lists and copies such as
+// the command used to create the container. The values are overwritten in
+// the encoded document, so escaped characters are overwritten with as many
+// bytes as their encoding uses. It returns the redacted variables and fails
+// without changing the document if a variable is only part of a longer
+// string, which cannot be redacted safely.
+func redactConfigStrings(content []byte, envVars map[string]configEnvVar) (map[string]configEnvVar, error) {
+	found := make(map[string]configEnvVar)
+	var values [][]byte
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	var offset int64
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, err
+		}
+		// The encoded token follows whitespace and delimiters
+		encoded := content[offset:decoder.InputOffset()]
+		offset = decoder.InputOffset()
+
+		str, ok := token.(string)
+		if !ok {
+			continue
+		}
+		envVar, ok := envVars[str]
+		if !ok {
+			for original, envVar := range envVars {
+				if strings.Contains(str, original) {
+					return nil, fmt.Errorf("cannot redact %s: the value is part of the string %q", envVar.key, str)
+				}
+			}
+			continue
+		}
+		found[envVar.key] = envVar
+		encoded = encoded[bytes.IndexByte(encoded, '"')+1 : len(encoded)-1]
+		values = append(values, encoded[encodedEnvValueStart(encoded):])
+	}
+
+	for _, value := range values {
+		for i := range value {
+			value[i] = redactByte
+		}
+	}
+	return found, nil
+}
+
+// encodedEnvValueStart returns the offset of the value in an encoded JSON
+// string "KEY=VALUE" without quotes. The name of an environment variable
+// cannot contain "=", so the value starts after the first "=", which might
+// be escaped.
+func encodedEnvValueStart(encoded []byte) int {
+	for i := 0; i < len(encoded); i++ {
+		switch {
+		case encoded[i] == '=':
+			return i + 1
+		case encoded[i] == '\\' && i+5 < len(encoded) && encoded[i+1] == 'u':
+			if strings.EqualFold(string(encoded[i+2:i+6]), "003d") {
+				return i + 6
+			}
+			i += 5
+		case encoded[i] == '\\':
+			i++
+		}
+	}
+	return len(encoded)
+}
+
+// redactConfigEnvVars redacts the selected environment variables of the
+// container in spec.dump and config.dump. The values are overwritten in
+// place, so the files keep their formatting and size.
+func redactConfigEnvVars(checkpointOutputDir string, envVars []string, replaced map[string]string) ([]RedactedItem, error) {
+	if len(envVars) == 0 {
+		return nil, nil
+	}
+
+	names := []string{metadata.SpecDumpFile, metadata.ConfigDumpFile}
+	contents := make(map[string][]byte)
+	selected := make(map[string]configEnvVar)
+	for _, name := range names {
+		content, err := os.ReadFile(filepath.Join(checkpointOutputDir, name))
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return nil, err
+		}
+		var doc any
+		if err := json.Unmarshal(content, &doc); err != nil {
+			return nil, fmt.Errorf("failed to decode %s: %w", name, err)
+		}
+		contents[name] = content
+		collectConfigEnvVars(doc, envVars, selected)
+	}
+	if len(selected) == 0 {
+		return nil, nil
+	}
+
+	var items []RedactedItem
+	for _, name := range names {
+		content, ok := contents[name]
+		if !ok {
+			continue
+		}
+		found, err := redactConfigStrings(content, selected)
+		if err != nil {
+			return nil, fmt.Errorf("failed to redact %s: %w", name, err)
+		}
+		if len(found) == 0 {
+			continue
+		}
+
+		file := filepath.Join(checkpointOutputDir, name)
+		if err := os.WriteFile(file, content, 0o600); err != nil {
+			return nil, err
+		}
+		replaced[name] = file
+
+		keys := make([]string, 0, len(found))
+		for key := range found {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			items = append(items, RedactedItem{
+				Source:   RedactSourceConfig,
+				Location: name + " " + key,
+				Reason:   found[key].pattern,
+				Length:   found[key].length,
+			})
+		}
+	}
+
+	return items, nil
+}
+
+// redactRootFsDiff writes a copy of rootfs-diff.tar of the checkpoint
+// archive to output in which the content of the selected files is
+// overwritten.
+func redactRootFsDiff(checkpointPath, output string, files []string) ([]RedactedItem, error) {
+	out, err := os.Create(output)
+	if err != nil {
+		return nil, err
+	}
+	defer out.Close()
+
+	var items []RedactedItem
+	matched := make(map[string]bool)
+	found := false
+	err = iterateTarArchive(checkpointPath, func(r *tar.Reader, header *tar.Header) error {
+		if !hasPrefix(header.Name, metadata.RootFsDiffTar) {
+			return nil
+		}
+		found = true
+		rootFsDiff := tar.NewReader(r)
+		tw := tar.NewWriter(out)
+		for {
+			fileHeader, err := rootFsDiff.Next()
+			if err != nil {
+				if errors.Is(err, io.EOF) {
+					break
+				}
+				return err
+			}
+			if err := tw.WriteHeader(fileHeader); err != nil {
+				return err
+			}
+			name := "/" + strings.TrimPrefix(fileHeader.Name, "./")
+			pattern := matchGlob(files, name)
+			if pattern == "" || !fileHeader.FileInfo().Mode().IsRegular() {
+				if _, err := io.Copy(tw, rootFsDiff); err != nil {
+					return err
+				}
+				continue
+			}
+			matched[pattern] = true
+			if _, err := io.Copy(tw, io.LimitReader(redactReader{}, fileHeader.Size)); err != nil {
+				return err
+			}
+			items = append(items, RedactedItem{
+				Source:   SecretSourceRootFs,
+				Location: name,
+				Reason:   pattern,
+				Length:   int(fileHeader.Size),
+			})
+		}
+		return tw.Close()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if !found {
+		return nil, fmt.Errorf("%s is missing in %s", metadata.RootFsDiffTar, checkpointPath)
+	}
+	for _, pattern := range files {
+		if !matched[pattern] {
+			return nil, fmt.Errorf("no file matching %s in %s", pattern, metadata.RootFsDiffTar)
+		}
+	}
+
+	return items, nil
+}
+
+// redactReader returns an endless stream of redactByte.
+type redactReader struct{}
+
+func (redactReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = redactByte
+	}
+	return len(p), nil
+}
+
+// copyArchive writes a copy of a checkpoint archive to output with the given
+// compression. The content of the members in replaced is read from the
+// given files instead. The output is removed if the copy fails.
+func copyArchive(input, output, compression string, replaced map[string]string) error {
+	_, err := rewriteArchive(input, output, compression, 0, func(tw *tar.Writer, r *tar.Reader, header *tar.Header) error {
+		file, ok := replaced[strings.TrimPrefix(header.Name, "./")]
+		if !ok || !header.FileInfo().Mode().IsRegular() {
+			return copyMember(tw, r, header)
+		}
+
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		info, err := f.Stat()
+		if err != nil {
+			return err
+		}
+		header.Size = info.Size()
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		_, err = io.Copy(tw, f)
+		return err
+	})
+	if err != nil {
+		os.Remove(output)
+	}
+	return err
+}
@@ -0,0 +1,303 @@
+package internal
+
+import (
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+
+	metadata "github.com/checkpoint-restore/checkpointctl/lib"
+	"github.com/checkpoint-restore/go-criu/v8/crit"
+	"github.com/checkpoint-restore/go-criu/v8/crit/images/mm"
+	"github.com/checkpoint-restore/go-criu/v8/crit/images/pagemap"
+	"github.com/checkpoint-restore/go-criu/v8/crit/images/vma"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestRedactProcess(t *testing.T) {
+	dir := t.TempDir()
+	pageSize := uint64(os.Getpagesize())
+
+	newImageWriter(t, "PAGEMAP").
+		entry(&pagemap.PagemapHead{PagesId: proto.Uint32(1)}).
+		entry(&pagemap.PagemapEntry{Vaddr: proto.Uint64(0x10000), CompatNrPages: proto.Uint32(0), NrPages: proto.Uint64(2), Flags: proto.Uint32(pePresent)}).
+		write(dir, "pagemap-1.img")
+
+	// The environment crosses the page boundary
+	env := "HOME=/root\x00AWS_SECRET=abcdefgh\x00EMPTY_SECRET=\x00"
+	envStart := 0x10000 + pageSize - 16
+	pages := make([]byte, 2*pageSize)
+	copy(pages[pageSize-16:], env)
+	copy(pages[100:], "token=TOKEN1234")
+	// A copy of the secret on the heap, for example by strdup()
+	copy(pages[200:], "abcdefgh")
+	if err := os.WriteFile(filepath.Join(dir, metadata.CheckpointDirectory, "pages-1.img"), pages, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	zero := proto.Uint64(0)
+	newImageWriter(t, "MM").entry(&mm.MmEntry{
+		MmStartCode: zero, MmEndCode: zero, MmStartData: zero, MmEndData: zero,
+		MmStartStack: zero, MmStartBrk: zero, MmBrk: zero, MmArgStart: zero,
+		MmArgEnd: zero, MmEnvStart: proto.Uint64(envStart), MmEnvEnd: proto.Uint64(envStart + uint64(len(env))),
+		ExeFileId: proto.Uint32(0),
+		Vmas:      []*vma.VmaEntry{testVma(0x10000, 0x10000+2*pageSize, 0, 0, vmaAreaHeap)},
+	}).write(dir, "mm-1.img")
+
+	opts := RedactOptions{
+		EnvVars: []string{"*_SECRET"},
+		Rules:   []SecretRule{{Name: "TOKEN[0-9]+", Pattern: regexp.MustCompile(`TOKEN[0-9]+`)}},
+	}
+	secrets := []envSecret{{key: "AWS_SECRET", value: []byte("abcdefgh")}}
+	items, pagesFile, err := redactProcess(dir, &crit.PsTree{PID: 1, Comm: "app"}, opts, secrets)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expectedItems := []RedactedItem{
+		{Source: SecretSourceEnvironment, PID: 1, Comm: "app", Location: "AWS_SECRET", Reason: "*_SECRET", Length: 8},
+		{Source: SecretSourceMemory, PID: 1, Comm: "app", Location: "0x00000000000100c8 [heap]", Reason: "copy of AWS_SECRET", Length: 8},
+		{Source: SecretSourceMemory, PID: 1, Comm: "app", Location: "0x000000000001006a [heap]", Reason: "TOKEN[0-9]+", Length: 9},
+	}
+	if !reflect.DeepEqual(items, expectedItems) {
+		t.Errorf("Expected %+v, got %+v", expectedItems, items)
+	}
+
+	redacted, err := os.ReadFile(pagesFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(redacted) != len(pages) {
+		t.Fatalf("Expected pages image of %d bytes, got %d", len(pages), len(redacted))
+	}
+	if got := string(redacted[pageSize-16 : pageSize-16+uint64(len(env))]); got != "HOME=/root\x00AWS_SECRET=********\x00EMPTY_SECRET=\x00" {
+		t.Errorf("Unexpected environment %q", got)
+	}
+	if got := string(redacted[100:115]); got != "token=*********" {
+		t.Errorf("Unexpected memory %q", got)
+	}
+	if got := string(redacted[200:208]); got != "********" {
+		t.Errorf("Expected the copy of the secret to be redacted, got %q", got)
+	}
+}
+
+func TestRedactConfigEnvVars(t *testing.T) {
+	dir := t.TempDir()
+	spec := `{"ociVersion":"1.0.0","process":{"env":["PATH=/usr/bin","DB_PASSWORD=hunter2"],"cwd":"/"}}`
+	if err := os.WriteFile(filepath.Join(dir, metadata.SpecDumpFile), []byte(spec), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	replaced := make(map[string]string)
+	items, err := redactConfigEnvVars(dir, []string{"*PASSWORD*"}, replaced)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := []RedactedItem{{Source: RedactSourceConfig, Location: "spec.dump DB_PASSWORD", Reason: "*PASSWORD*", Length: 7}}
+	if !reflect.DeepEqual(items, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, items)
+	}
+	if replaced[metadata.SpecDumpFile] != filepath.Join(dir, metadata.SpecDumpFile) {
+		t.Errorf("Expected spec.dump to be replaced, got %v", replaced)
+	}
+
+	content, err := os.ReadFile(filepath.Join(dir, metadata.SpecDumpFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := `{"ociVersion":"1.0.0","process":{"env":["PATH=/usr/bin","DB_PASSWORD=*******"],"cwd":"/"}}`; string(content) != expected {
+		t.Errorf("Expected %s, got %s", expected, content)
+	}
+}
+
+func TestRedactConfigEnvVarsEncoding(t *testing.T) {
+	dir := t.TempDir()
+	// The encoder of the container engine escaped "<", ">" and "/"
+	spec := `{"process":{"env":["API_TOKEN=\u003ca\/b\u003e"]}}`
+	config := "{\n  \"createCommand\": [\n    \"podman\",\n    \"-e\",\n    \"API_TOKEN=<a/b>\"\n  ],\n  \"size\": 12345678901234567890,\n" +
+		"  \"spec\": {\n    \"process\": {\n      \"Env\": [\n        \"API_TOKEN=<a/b>\"\n      ]\n    }\n  }\n}\n"
+	for name, content := range map[string]string{metadata.SpecDumpFile: spec, metadata.ConfigDumpFile: config} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	items, err := redactConfigEnvVars(dir, []string{"API_*"}, make(map[string]string))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := []RedactedItem{
+		{Source: RedactSourceConfig, Location: "spec.dump API_TOKEN", Reason: "API_*", Length: 5},
+		{Source: RedactSourceConfig, Location: "config.dump API_TOKEN", Reason: "API_*", Length: 5},
+	}
+	if !reflect.DeepEqual(items, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, items)
+	}
+
+	content, err := os.ReadFile(filepath.Join(dir, metadata.SpecDumpFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Escaped characters are overwritten with as many bytes as their encoding uses
+	if expected := `{"process":{"env":["API_TOKEN=****************"]}}`; string(content) != expected {
+		t.Errorf("Expected %s, got %s", expected, content)
+	}
+	content, err = os.ReadFile(filepath.Join(dir, metadata.ConfigDumpFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := strings.ReplaceAll(config, "<a/b>", "*****"); string(content) != expected {
+		t.Errorf("Expected %s, got %s", expected, content)
+	}
+}
+
+func TestEncodedEnvValueStart(t *testing.T) {
+	tests := []struct {
+		encoded  string
+		expected int
+	}{
+		{`KEY=value`, 4},
+		{`KEY\u003dvalue`, 9},
+		{`K\u0045Y=a=b`, 9},
+		{`K\"Y=value`, 5},
+		{`KEY`, 3},
+	}
+	for _, tt := range tests {
+		if result := encodedEnvValueStart([]byte(tt.encoded)); result != tt.expected {
+			t.Errorf("Expected %d for %s, got %d", tt.expected, tt.encoded, result)
+		}
+	}
+}
+
+func TestRedactConfigEnvVarsPartOfString(t *testing.T) {
+	dir := t.TempDir()
+	spec := `{"process":{"env":["DB_PASSWORD=hunter2"],"args":["app","--env=DB_PASSWORD=hunter2"]}}`
+	if err := os.WriteFile(filepath.Join(dir, metadata.SpecDumpFile), []byte(spec), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := redactConfigEnvVars(dir, []string{"DB_PASSWORD"}, make(map[string]string)); err == nil {
+		t.Error("Expected an error for a variable which cannot be redacted")
+	}
+	content, err := os.ReadFile(filepath.Join(dir, metadata.SpecDumpFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != spec {
+		t.Errorf("Expected spec.dump to be unchanged, got %s", content)
+	}
+}
+
+func TestRedactRootFsDiffAndCopyArchive(t *testing.T) {
+	dir := t.TempDir()
+
+	var rootFsDiff bytes.Buffer
+	writeTar(t, &rootFsDiff, map[string][]byte{
+		"etc/app.conf": []byte("password=hunter2\n"),
+		"etc/hosts":    []byte("127.0.0.1 localhost\n"),
+	})
+
+	// The checkpoint archive is compressed with gzip
+	input := filepath.Join(dir, "checkpoint.tar.gz")
+	f, err := os.Create(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gz := gzip.NewWriter(f)
+	writeTar(t, gz, map[string][]byte{
+		"checkpoint/pages-1.img": []byte("SECRET"),
+		"checkpoint/core-1.img":  []byte("core"),
+		"rootfs-diff.tar":        rootFsDiff.Bytes(),
+	})
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	redactedRootFsDiff := filepath.Join(dir, metadata.RootFsDiffTar)
+	items, err := redactRootFsDiff(input, redactedRootFsDiff, []string{"/etc/*.conf"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := []RedactedItem{{Source: SecretSourceRootFs, Location: "/etc/app.conf", Reason: "/etc/*.conf", Length: 17}}
+	if !reflect.DeepEqual(items, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, items)
+	}
+
+	if _, err := redactRootFsDiff(input, filepath.Join(dir, "unused.tar"), []string{"/missing"}); err == nil {
+		t.Error("Expected an error for a file pattern without matches")
+	}
+
+	redactedPages := filepath.Join(dir, "pages-1.img")
+	if err := os.WriteFile(redactedPages, []byte("******"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	output := filepath.Join(dir, "redacted.tar.gz")
+	replaced := map[string]string{
+		"checkpoint/pages-1.img": redactedPages,
+		metadata.RootFsDiffTar:   redactedRootFsDiff,
+	}
+	if err := copyArchive(input, output, CompressionGzip, replaced); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	out, err := os.Open(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+	gzr, err := gzip.NewReader(out)
+	if err != nil {
+		t.Fatalf("Expected a gzip compressed archive: %v", err)
+	}
+	members := readTarMembers(t, gzr)
+
+	if members["checkpoint/pages-1.img"] != "******" {
+		t.Errorf("Unexpected pages image %q", members["checkpoint/pages-1.img"])
+	}
+	if members["checkpoint/core-1.img"] != "core" {
+		t.Errorf("Unexpected core image %q", members["checkpoint/core-1.img"])
+	}
+	files := readTarMembers(t, strings.NewReader(members[metadata.RootFsDiffTar]))
+	if files["etc/app.conf"] != strings.Repeat("*", 17) || files["etc/hosts"] != "127.0.0.1 localhost\n" {
+		t.Errorf("Unexpected files in %s: %v", metadata.RootFsDiffTar, files)
+	}
+}
+
+func TestRedactCheckpointUnsupportedCompression(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "checkpoint.tar.bz2")
+	if err := os.WriteFile(input, []byte("BZh91AY&SY"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	output := filepath.Join(dir, "redacted.tar.bz2")
+	_, err := RedactCheckpoint(Task{CheckpointFilePath: input}, output, RedactOptions{EnvVars: []string{"*"}})
+	if err == nil || !strings.Contains(err.Error(), "bzip2") {
+		t.Errorf("Expected an error for a bzip2 compressed checkpoint, got %v", err)
+	}
+	if _, err := os.Stat(output); !os.IsNotExist(err) {
+		t.Errorf("Expected no output file, got %v", err)
+	}
+}
+
+func TestCopyArchiveRemovesOutput(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "checkpoint.tar")
+	writeArchive(t, input, map[string][]byte{"checkpoint/pages-1.img": []byte("pages")})
+
+	output := filepath.Join(dir, "redacted.tar")
+	replaced := map[string]string{"checkpoint/pages-1.img": filepath.Join(dir, "missing.img")}
+	if err := copyArchive(input, output, CompressionNone, replaced); err == nil {
+		t.Fatal("Expected an error for a missing replacement")
+	}
+	if _, err := os.Stat(output); !os.IsNotExist(err) {
+		t.Errorf("Expected the partial output to be removed, got %v", err)
+	}
+}
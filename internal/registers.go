@@ -0,0 +1,307 @@
+// SPDX-License-Identifier: Apache-2.0
+
+// This file is used to decode the saved CPU register state of threads
+
+package internal
+
+import (
+	"fmt"
+
+	"github.com/checkpoint-restore/go-criu/v8/crit"
+	core_x86 "github.com/checkpoint-restore/go-criu/v8/crit/images/core-x86"
+	criu_core "github.com/checkpoint-restore/go-criu/v8/crit/images/criu-core"
+)
+
+type RegisterNode struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type ThreadRegistersNode struct {
+	TID                  uint32         `json:"tid"`
+	Arch                 string         `json:"arch"`
+	InstructionPointer   string         `json:"instruction_pointer,omitempty"`
+	StackPointer         string         `json:"stack_pointer,omitempty"`
+	GeneralPurpose       []RegisterNode `json:"general_purpose,omitempty"`
+	FPUState             bool           `json:"fpu_state"`
+	ExtendedStates       []string       `json:"extended_states,omitempty"`
+	UnsupportedArchError string         `json:"error,omitempty"`
+}
+
+func hexValue(v uint64) string {
+	return fmt.Sprintf("0x%016x", v)
+}
+
+func hexValue32(v uint32) string {
+	return fmt.Sprintf("0x%08x", v)
+}
+
+// buildJSONRegisters collects the register state of every thread of the given process.
+func buildJSONRegisters(ps *crit.PsTree, checkpointOutputDir string) ([]ThreadRegistersNode, error) {
+	var result []ThreadRegistersNode
+
+	for _, tid := range getThreadIDs(ps) {
+		core := ps.Core
+		if tid != ps.PID {
+			var err error
+			core, err = readCoreEntry(checkpointOutputDir, tid)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read registers of thread %d: %w", tid, err)
+			}
+		}
+		result = append(result, buildThreadRegisters(tid, core))
+	}
+
+	return result, nil
+}
+
+// buildThreadRegisters decodes the architecture specific thread state of a core entry.
+func buildThreadRegisters(tid uint32, core *criu_core.CoreEntry) ThreadRegistersNode {
+	node := ThreadRegistersNode{
+		TID:  tid,
+		Arch: core.GetMtype().String(),
+	}
+
+	switch core.GetMtype() {
+	case criu_core.CoreEntry_X86_64:
+		addX86Registers(&node, core)
+	case criu_core.CoreEntry_AARCH64:
+		addAarch64Registers(&node, core)
+	case criu_core.CoreEntry_ARM:
+		addArmRegisters(&node, core)
+	case criu_core.CoreEntry_PPC64:
+		addPpc64Registers(&node, core)
+	case criu_core.CoreEntry_S390:
+		addS390Registers(&node, core)
+	case criu_core.CoreEntry_RISCV64:
+		addRiscv64Registers(&node, core)
+	case criu_core.CoreEntry_LOONGARCH64:
+		addLoongarch64Registers(&node, core)
+	default:
+		node.UnsupportedArchError = fmt.Sprintf("decoding registers for architecture %s is not supported", node.Arch)
+	}
+
+	return node
+}
+
+func addX86Registers(node *ThreadRegistersNode, core *criu_core.CoreEntry) {
+	ti := core.GetThreadInfo()
+	if ti == nil {
+		return
+	}
+	gp := ti.GetGpregs()
+
+	names := []string{
+		"rax", "rbx", "rcx", "rdx", "rsi", "rdi", "rbp", "rsp",
+		"r8", "r9", "r10", "r11", "r12", "r13", "r14", "r15",
+		"rip", "eflags", "orig_rax", "cs", "ss", "ds", "es", "fs", "gs",
+		"fs_base", "gs_base",
+	}
+	values := []uint64{
+		gp.GetAx(), gp.GetBx(), gp.GetCx(), gp.GetDx(), gp.GetSi(), gp.GetDi(), gp.GetBp(), gp.GetSp(),
+		gp.GetR8(), gp.GetR9(), gp.GetR10(), gp.GetR11(), gp.GetR12(), gp.GetR13(), gp.GetR14(), gp.GetR15(),
+		gp.GetIp(), gp.GetFlags(), gp.GetOrigAx(), gp.GetCs(), gp.GetSs(), gp.GetDs(), gp.GetEs(), gp.GetFs(), gp.GetGs(),
+		gp.GetFsBase(), gp.GetGsBase(),
+	}
+	if gp.GetMode() == core_x86.UserX86RegsMode_COMPAT {
+		node.Arch = "X86_64 (ia32 compat)"
+	}
+	for i, name := range names {
+		node.GeneralPurpose = append(node.GeneralPurpose, RegisterNode{Name: name, Value: hexValue(values[i])})
+	}
+	node.InstructionPointer = hexValue(gp.GetIp())
+	node.StackPointer = hexValue(gp.GetSp())
+
+	fp := ti.GetFpregs()
+	node.FPUState = fp != nil
+	if xsave := fp.GetXsave(); xsave != nil {
+		if len(xsave.GetYmmhSpace()) > 0 {
+			node.ExtendedStates = append(node.ExtendedStates, "AVX")
+		}
+		if len(xsave.GetBndregState()) > 0 || len(xsave.GetBndcsrState()) > 0 {
+			node.ExtendedStates = append(node.ExtendedStates, "MPX")
+		}
+		if len(xsave.GetOpmaskReg()) > 0 || len(xsave.GetZmmUpper()) > 0 || len(xsave.GetHi16Zmm()) > 0 {
+			node.ExtendedStates = append(node.ExtendedStates, "AVX-512")
+		}
+		if len(xsave.GetPkru()) > 0 {
+			node.ExtendedStates = append(node.ExtendedStates, "PKRU")
+		}
+		if xsave.GetCet() != nil {
+			node.ExtendedStates = append(node.ExtendedStates, "CET")
+		}
+	}
+}
+
+func addAarch64Registers(node *ThreadRegistersNode, core *criu_core.CoreEntry) {
+	ti := core.GetTiAarch64()
+	if ti == nil {
+		return
+	}
+	gp := ti.GetGpregs()
+
+	for i, v := range gp.GetRegs() {
+		node.GeneralPurpose = append(node.GeneralPurpose, RegisterNode{Name: fmt.Sprintf("x%d", i), Value: hexValue(v)})
+	}
+	node.GeneralPurpose = append(node.GeneralPurpose,
+		RegisterNode{Name: "sp", Value: hexValue(gp.GetSp())},
+		RegisterNode{Name: "pc", Value: hexValue(gp.GetPc())},
+		RegisterNode{Name: "pstate", Value: hexValue(gp.GetPstate())},
+		RegisterNode{Name: "tpidr_el0", Value: hexValue(ti.GetTls())},
+	)
+	node.InstructionPointer = hexValue(gp.GetPc())
+	node.StackPointer = hexValue(gp.GetSp())
+
+	node.FPUState = ti.GetFpsimd() != nil
+	if ti.GetPacKeys() != nil {
+		node.ExtendedStates = append(node.ExtendedStates, "PAC")
+	}
+}
+
+func addArmRegisters(node *ThreadRegistersNode, core *criu_core.CoreEntry) {
+	ti := core.GetTiArm()
+	if ti == nil {
+		return
+	}
+	gp := ti.GetGpregs()
+
+	names := []string{
+		"r0", "r1", "r2", "r3", "r4", "r5", "r6", "r7", "r8", "r9", "r10",
+		"fp", "ip", "sp", "lr", "pc", "cpsr", "orig_r0",
+	}
+	values := []uint32{
+		gp.GetR0(), gp.GetR1(), gp.GetR2(), gp.GetR3(), gp.GetR4(), gp.GetR5(), gp.GetR6(), gp.GetR7(), gp.GetR8(), gp.GetR9(), gp.GetR10(),
+		gp.GetFp(), gp.GetIp(), gp.GetSp(), gp.GetLr(), gp.GetPc(), gp.GetCpsr(), gp.GetOrigR0(),
+	}
+	for i, name := range names {
+		node.GeneralPurpose = append(node.GeneralPurpose, RegisterNode{Name: name, Value: hexValue32(values[i])})
+	}
+	node.InstructionPointer = hexValue32(gp.GetPc())
+	node.StackPointer = hexValue32(gp.GetSp())
+
+	node.FPUState = ti.GetFpstate() != nil
+}
+
+func addPpc64Registers(node *ThreadRegistersNode, core *criu_core.CoreEntry) {
+	ti := core.GetTiPpc64()
+	if ti == nil {
+		return
+	}
+	gp := ti.GetGpregs()
+
+	for i, v := range gp.GetGpr() {
+		node.GeneralPurpose = append(node.GeneralPurpose, RegisterNode{Name: fmt.Sprintf("r%d", i), Value: hexValue(v)})
+	}
+	node.GeneralPurpose = append(node.GeneralPurpose,
+		RegisterNode{Name: "nip", Value: hexValue(gp.GetNip())},
+		RegisterNode{Name: "msr", Value: hexValue(gp.GetMsr())},
+		RegisterNode{Name: "orig_gpr3", Value: hexValue(gp.GetOrigGpr3())},
+		RegisterNode{Name: "ctr", Value: hexValue(gp.GetCtr())},
+		RegisterNode{Name: "link", Value: hexValue(gp.GetLink())},
+		RegisterNode{Name: "xer", Value: hexValue(gp.GetXer())},
+		RegisterNode{Name: "ccr", Value: hexValue(gp.GetCcr())},
+		RegisterNode{Name: "trap", Value: hexValue(gp.GetTrap())},
+	)
+	node.InstructionPointer = hexValue(gp.GetNip())
+	// r1 is the stack pointer by ABI convention
+	if len(gp.GetGpr()) > 1 {
+		node.StackPointer = hexValue(gp.GetGpr()[1])
+	}
+
+	node.FPUState = ti.GetFpstate() != nil
+	if ti.GetVrstate() != nil {
+		node.ExtendedStates = append(node.ExtendedStates, "Altivec")
+	}
+	if ti.GetVsxstate() != nil {
+		node.ExtendedStates = append(node.ExtendedStates, "VSX")
+	}
+	if ti.GetTmstate() != nil {
+		node.ExtendedStates = append(node.ExtendedStates, "TM")
+	}
+}
+
+func addS390Registers(node *ThreadRegistersNode, core *criu_core.CoreEntry) {
+	ti := core.GetTiS390()
+	if ti == nil {
+		return
+	}
+	gp := ti.GetGpregs()
+
+	node.GeneralPurpose = append(node.GeneralPurpose,
+		RegisterNode{Name: "psw_mask", Value: hexValue(gp.GetPswMask())},
+		RegisterNode{Name: "psw_addr", Value: hexValue(gp.GetPswAddr())},
+	)
+	for i, v := range gp.GetGprs() {
+		node.GeneralPurpose = append(node.GeneralPurpose, RegisterNode{Name: fmt.Sprintf("r%d", i), Value: hexValue(v)})
+	}
+	for i, v := range gp.GetAcrs() {
+		node.GeneralPurpose = append(node.GeneralPurpose, RegisterNode{Name: fmt.Sprintf("a%d", i), Value: hexValue32(v)})
+	}
+	node.GeneralPurpose = append(node.GeneralPurpose,
+		RegisterNode{Name: "orig_gpr2", Value: hexValue(gp.GetOrigGpr2())},
+	)
+	node.InstructionPointer = hexValue(gp.GetPswAddr())
+	// r15 is the stack pointer by ABI convention
+	if len(gp.GetGprs()) > 15 {
+		node.StackPointer = hexValue(gp.GetGprs()[15])
+	}
+
+	node.FPUState = ti.GetFpregs() != nil
+	if ti.GetVxrsLow() != nil || ti.GetVxrsHigh() != nil {
+		node.ExtendedStates = append(node.ExtendedStates, "VX")
+	}
+	if ti.GetGsCb() != nil || ti.GetGsBc() != nil {
+		node.ExtendedStates = append(node.ExtendedStates, "GS")
+	}
+	if ti.GetRiCb() != nil {
+		node.ExtendedStates = append(node.ExtendedStates, "RI")
+	}
+}
+
+func addRiscv64Registers(node *ThreadRegistersNode, core *criu_core.CoreEntry) {
+	ti := core.GetTiRiscv64()
+	if ti == nil {
+		return
+	}
+	gp := ti.GetGpregs()
+
+	names := []string{
+		"pc", "ra", "sp", "gp", "tp", "t0", "t1", "t2", "s0", "s1",
+		"a0", "a1", "a2", "a3", "a4", "a5", "a6", "a7",
+		"s2", "s3", "s4", "s5", "s6", "s7", "s8", "s9", "s10", "s11",
+		"t3", "t4", "t5", "t6",
+	}
+	values := []uint64{
+		gp.GetPc(), gp.GetRa(), gp.GetSp(), gp.GetGp(), gp.GetTp(), gp.GetT0(), gp.GetT1(), gp.GetT2(), gp.GetS0(), gp.GetS1(),
+		gp.GetA0(), gp.GetA1(), gp.GetA2(), gp.GetA3(), gp.GetA4(), gp.GetA5(), gp.GetA6(), gp.GetA7(),
+		gp.GetS2(), gp.GetS3(), gp.GetS4(), gp.GetS5(), gp.GetS6(), gp.GetS7(), gp.GetS8(), gp.GetS9(), gp.GetS10(), gp.GetS11(),
+		gp.GetT3(), gp.GetT4(), gp.GetT5(), gp.GetT6(),
+	}
+	for i, name := range names {
+		node.GeneralPurpose = append(node.GeneralPurpose, RegisterNode{Name: name, Value: hexValue(values[i])})
+	}
+	node.InstructionPointer = hexValue(gp.GetPc())
+	node.StackPointer = hexValue(gp.GetSp())
+
+	node.FPUState = ti.GetFpsimd() != nil
+}
+
+func addLoongarch64Registers(node *ThreadRegistersNode, core *criu_core.CoreEntry) {
+	ti := core.GetTiLoongarch64()
+	if ti == nil {
+		return
+	}
+	gp := ti.GetGpregs()
+
+	for i, v := range gp.GetRegs() {
+		node.GeneralPurpose = append(node.GeneralPurpose, RegisterNode{Name: fmt.Sprintf("r%d", i), Value: hexValue(v)})
+	}
+	node.GeneralPurpose = append(node.GeneralPurpose, RegisterNode{Name: "pc", Value: hexValue(gp.GetPc())})
+	node.InstructionPointer = hexValue(gp.GetPc())
+	// r3 is the stack pointer by ABI convention
+	if len(gp.GetRegs()) > 3 {
+		node.StackPointer = hexValue(gp.GetRegs()[3])
+	}
+
+	node.FPUState = ti.GetFpregs() != nil
+}
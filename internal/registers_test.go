@@ -0,0 +1,127 @@
+package internal
+
+import (
+	"strings"
+	"testing"
+
+	core_aarch64 "github.com/checkpoint-restore/go-criu/v8/crit/images/core-aarch64"
+	core_x86 "github.com/checkpoint-restore/go-criu/v8/crit/images/core-x86"
+	criu_core "github.com/checkpoint-restore/go-criu/v8/crit/images/criu-core"
+	"github.com/xlab/treeprint"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestBuildThreadRegistersX86(t *testing.T) {
+	mtype := criu_core.CoreEntry_X86_64
+	core := &criu_core.CoreEntry{
+		Mtype: &mtype,
+		ThreadInfo: &core_x86.ThreadInfoX86{
+			Gpregs: &core_x86.UserX86RegsEntry{
+				Ax: proto.Uint64(0x1),
+				Ip: proto.Uint64(0x401000),
+				Sp: proto.Uint64(0x7ffd0000),
+			},
+			Fpregs: &core_x86.UserX86FpregsEntry{
+				Xsave: &core_x86.UserX86XsaveEntry{
+					YmmhSpace: []uint32{1, 2},
+				},
+			},
+		},
+	}
+
+	node := buildThreadRegisters(42, core)
+
+	if node.TID != 42 || node.Arch != "X86_64" {
+		t.Errorf("Unexpected thread header: %+v", node)
+	}
+	if node.InstructionPointer != "0x0000000000401000" {
+		t.Errorf("Expected instruction pointer 0x0000000000401000, got %s", node.InstructionPointer)
+	}
+	if node.StackPointer != "0x000000007ffd0000" {
+		t.Errorf("Expected stack pointer 0x000000007ffd0000, got %s", node.StackPointer)
+	}
+	if node.GeneralPurpose[0].Name != "rax" || node.GeneralPurpose[0].Value != "0x0000000000000001" {
+		t.Errorf("Expected rax=0x1 as first register, got %+v", node.GeneralPurpose[0])
+	}
+	if !node.FPUState {
+		t.Error("Expected FPU state to be present")
+	}
+	if len(node.ExtendedStates) != 1 || node.ExtendedStates[0] != "AVX" {
+		t.Errorf("Expected extended states [AVX], got %v", node.ExtendedStates)
+	}
+}
+
+func TestBuildThreadRegistersAarch64(t *testing.T) {
+	mtype := criu_core.CoreEntry_AARCH64
+	core := &criu_core.CoreEntry{
+		Mtype: &mtype,
+		TiAarch64: &core_aarch64.ThreadInfoAarch64{
+			Tls: proto.Uint64(0),
+			Gpregs: &core_aarch64.UserAarch64RegsEntry{
+				Regs:   make([]uint64, 31),
+				Sp:     proto.Uint64(0x1000),
+				Pc:     proto.Uint64(0x2000),
+				Pstate: proto.Uint64(0),
+			},
+		},
+	}
+
+	node := buildThreadRegisters(1, core)
+
+	if node.InstructionPointer != "0x0000000000002000" {
+		t.Errorf("Expected pc 0x0000000000002000, got %s", node.InstructionPointer)
+	}
+	if node.StackPointer != "0x0000000000001000" {
+		t.Errorf("Expected sp 0x0000000000001000, got %s", node.StackPointer)
+	}
+	// x0-x30, sp, pc, pstate, tpidr_el0
+	if len(node.GeneralPurpose) != 35 {
+		t.Errorf("Expected 35 registers, got %d", len(node.GeneralPurpose))
+	}
+	if node.FPUState {
+		t.Error("Expected FPU state to be absent")
+	}
+}
+
+func TestBuildThreadRegistersUnsupportedArch(t *testing.T) {
+	mtype := criu_core.CoreEntry_MIPS
+	node := buildThreadRegisters(1, &criu_core.CoreEntry{Mtype: &mtype})
+
+	if node.UnsupportedArchError == "" {
+		t.Error("Expected an error for unsupported architecture")
+	}
+	if len(node.GeneralPurpose) != 0 {
+		t.Errorf("Expected no registers, got %d", len(node.GeneralPurpose))
+	}
+}
+
+func TestAddRegistersToTree(t *testing.T) {
+	tree := treeprint.New()
+	addRegistersToTree(tree, []ThreadRegistersNode{
+		{
+			TID:                42,
+			Arch:               "X86_64",
+			InstructionPointer: "0x0000000000401000",
+			StackPointer:       "0x000000007ffd0000",
+			GeneralPurpose:     []RegisterNode{{Name: "rax", Value: "0x0000000000000001"}},
+			FPUState:           true,
+			ExtendedStates:     []string{"AVX", "PKRU"},
+		},
+	})
+	result := tree.String()
+
+	expectedStrings := []string{
+		"Registers",
+		"Thread 42 (X86_64)",
+		"IP: 0x0000000000401000",
+		"SP: 0x000000007ffd0000",
+		"[rax]  0x0000000000000001",
+		"FPU state: present",
+		"Extended state: AVX, PKRU",
+	}
+	for _, expected := range expectedStrings {
+		if !strings.Contains(result, expected) {
+			t.Errorf("Expected tree to contain %q, but it didn't.\nTree:\n%s", expected, result)
+		}
+	}
+}
@@ -0,0 +1,205 @@
+// SPDX-License-Identifier: Apache-2.0
+
+// This file is used to change the compression of checkpoint archives
+
+package internal
+
+import (
+	"archive/tar"
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/containers/storage/pkg/archive"
+	"github.com/klauspost/compress/zstd"
+	gzip "github.com/klauspost/pgzip"
+	"github.com/ulikunitz/xz"
+)
+
+// Compression formats of checkpoint archives
+const (
+	CompressionNone  = "none"
+	CompressionGzip  = "gzip"
+	CompressionZstd  = "zstd"
+	CompressionXz    = "xz"
+	CompressionBzip2 = "bzip2"
+)
+
+// RepackResult describes the conversion of a checkpoint archive.
+type RepackResult struct {
+	InputCompression  string
+	OutputCompression string
+	InputSize         int64
+	OutputSize        int64
+	Members           int
+	Duration          time.Duration
+}
+
+// ValidateCompressionLevel checks whether a compression level is supported
+// by a compression format. The level 0 selects the default level. The xz
+// encoder has no presets like xz(1), so levels are rejected for xz.
+func ValidateCompressionLevel(compression string, level int) error {
+	var minLevel, maxLevel int
+	switch compression {
+	case CompressionNone:
+		if level != 0 {
+			return fmt.Errorf("a compression level cannot be used without compression")
+		}
+		return nil
+	case CompressionGzip:
+		minLevel, maxLevel = gzip.BestSpeed, gzip.BestCompression
+	case CompressionZstd:
+		minLevel, maxLevel = 1, 22
+	case CompressionXz:
+		if level != 0 {
+			return fmt.Errorf("compression levels are not supported for xz")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported compression %q: use none, gzip, zstd or xz", compression)
+	}
+	if level != 0 && (level < minLevel || level > maxLevel) {
+		return fmt.Errorf("invalid compression level %d for %s: use %d to %d", level, compression, minLevel, maxLevel)
+	}
+	return nil
+}
+
+// newCompressWriter returns a writer which compresses the data written to w.
+func newCompressWriter(w io.Writer, compression string, level int) (io.WriteCloser, error) {
+	if err := ValidateCompressionLevel(compression, level); err != nil {
+		return nil, err
+	}
+
+	switch compression {
+	case CompressionGzip:
+		if level == 0 {
+			level = gzip.DefaultCompression
+		}
+		return gzip.NewWriterLevel(w, level)
+	case CompressionZstd:
+		if level == 0 {
+			return zstd.NewWriter(w)
+		}
+		return zstd.NewWriter(w, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(level)))
+	case CompressionXz:
+		return xz.NewWriter(w)
+	default:
+		return nopWriteCloser{w}, nil
+	}
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+// detectArchiveCompression returns the compression of an archive.
+func detectArchiveCompression(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	magic, err := bufio.NewReader(f).Peek(10)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+
+	switch archive.DetectCompression(magic) {
+	case archive.Gzip:
+		return CompressionGzip, nil
+	case archive.Zstd:
+		return CompressionZstd, nil
+	case archive.Xz:
+		return CompressionXz, nil
+	case archive.Bzip2:
+		return CompressionBzip2, nil
+	default:
+		return CompressionNone, nil
+	}
+}
+
+// rewriteArchive writes the members of a checkpoint archive in their original
+// order to output with the given compression. The callback writes the
+// content of each member and may change its header before.
+func rewriteArchive(input, output, compression string, level int, write func(tw *tar.Writer, r *tar.Reader, header *tar.Header) error) (int, error) {
+	out, err := os.Create(output)
+	if err != nil {
+		return 0, err
+	}
+	defer out.Close()
+
+	stream, err := newCompressWriter(out, compression, level)
+	if err != nil {
+		return 0, err
+	}
+	tw := tar.NewWriter(stream)
+
+	members := 0
+	err = iterateTarArchive(input, func(r *tar.Reader, header *tar.Header) error {
+		members++
+		return write(tw, r, header)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if err := tw.Close(); err != nil {
+		return 0, err
+	}
+	if err := stream.Close(); err != nil {
+		return 0, err
+	}
+	return members, out.Close()
+}
+
+// copyMember writes a member of an archive unchanged.
+func copyMember(tw *tar.Writer, r *tar.Reader, header *tar.Header) error {
+	if err := tw.WriteHeader(header); err != nil {
+		return err
+	}
+	_, err := io.Copy(tw, r)
+	return err
+}
+
+// RepackCheckpoint writes a copy of a checkpoint archive with a different
+// compression. The order of the members is preserved.
+func RepackCheckpoint(input, output, compression string, level int) (*RepackResult, error) {
+	start := time.Now()
+
+	inputCompression, err := detectArchiveCompression(input)
+	if err != nil {
+		return nil, err
+	}
+
+	members, err := rewriteArchive(input, output, compression, level, copyMember)
+	if err != nil {
+		os.Remove(output)
+		return nil, err
+	}
+
+	inputInfo, err := os.Stat(input)
+	if err != nil {
+		return nil, err
+	}
+	outputInfo, err := os.Stat(output)
+	if err != nil {
+		return nil, err
+	}
+
+	return &RepackResult{
+		InputCompression:  inputCompression,
+		OutputCompression: compression,
+		InputSize:         inputInfo.Size(),
+		OutputSize:        outputInfo.Size(),
+		Members:           members,
+		Duration:          time.Since(start),
+	}, nil
+}
@@ -0,0 +1,97 @@
+package internal
+
+import (
+	"archive/tar"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRepackCheckpoint(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "checkpoint.tar")
+	f, err := os.Create(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tw := tar.NewWriter(f)
+	names := []string{"spec.dump", "config.dump", "checkpoint/", "checkpoint/pages-1.img", "checkpoint/core-1.img"}
+	for _, name := range names {
+		header := &tar.Header{Name: name, Mode: 0o600, Typeflag: tar.TypeReg}
+		content := strings.Repeat(name, 1000)
+		if strings.HasSuffix(name, "/") {
+			header.Typeflag = tar.TypeDir
+			header.Mode = 0o755
+			content = ""
+		}
+		header.Size = int64(len(content))
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	expected, err := BuildManifest(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, compression := range []string{CompressionGzip, CompressionZstd, CompressionXz, CompressionNone} {
+		output := filepath.Join(dir, "checkpoint."+compression)
+		result, err := RepackCheckpoint(input, output, compression, 1)
+		if compression == CompressionNone || compression == CompressionXz {
+			if err == nil {
+				t.Errorf("Expected an error for a compression level with %s", compression)
+			}
+			result, err = RepackCheckpoint(input, output, compression, 0)
+		}
+		if err != nil {
+			t.Fatalf("Unexpected error for %s: %v", compression, err)
+		}
+
+		if result.InputCompression != CompressionNone || result.OutputCompression != compression || result.Members != len(names) {
+			t.Errorf("Unexpected result %+v", result)
+		}
+		if detected, err := detectArchiveCompression(output); err != nil || detected != compression {
+			t.Errorf("Expected %s compressed archive, got %s (%v)", compression, detected, err)
+		}
+		if compression != CompressionNone && result.OutputSize >= result.InputSize {
+			t.Errorf("Expected %s compressed archive to be smaller than %d bytes, got %d", compression, result.InputSize, result.OutputSize)
+		}
+
+		manifest, err := BuildManifest(output)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := CompareManifests(expected, manifest); !diff.IsEmpty() {
+			t.Errorf("Unexpected differences after repacking with %s: %+v", compression, diff)
+		}
+
+		// The order of the members is preserved
+		var order []string
+		if err := iterateTarArchive(output, func(_ *tar.Reader, header *tar.Header) error {
+			order = append(order, header.Name)
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(order, names) {
+			t.Errorf("Expected members %v after repacking with %s, got %v", names, compression, order)
+		}
+	}
+
+	if _, err := RepackCheckpoint(input, filepath.Join(dir, "invalid"), CompressionGzip, 10); err == nil {
+		t.Error("Expected an error for an invalid compression level")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "invalid")); !os.IsNotExist(err) {
+		t.Errorf("Expected no output for an invalid compression level, got %v", err)
+	}
+}
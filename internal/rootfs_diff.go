@@ -0,0 +1,206 @@
+// SPDX-License-Identifier: Apache-2.0
+
+// This file is used to compare the root file system changes of two checkpoints
+
+package internal
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	metadata "github.com/checkpoint-restore/checkpointctl/lib"
+)
+
+// RootFsChange describes a file in the writable layer of a container which
+// differs between two checkpoints.
+type RootFsChange struct {
+	Path       string     `json:"path"`
+	Type       string     `json:"type"`
+	Status     DiffStatus `json:"status"`
+	SizeBefore int64      `json:"size_before"`
+	SizeAfter  int64      `json:"size_after"`
+}
+
+// DeletedFilesDiff lists the files of the container image which were
+// deleted (added) or are no longer deleted (removed) in checkpoint B.
+type DeletedFilesDiff struct {
+	Added   []string `json:"added,omitempty"`
+	Removed []string `json:"removed,omitempty"`
+}
+
+// RootFsDiff describes how the files in rootfs-diff.tar and deleted.files
+// changed between two checkpoints. A file is modified if its type, mode,
+// content or link target changed.
+type RootFsDiff struct {
+	Added        []RootFsChange    `json:"added,omitempty"`
+	Removed      []RootFsChange    `json:"removed,omitempty"`
+	Modified     []RootFsChange    `json:"modified,omitempty"`
+	Unchanged    []RootFsChange    `json:"unchanged,omitempty"`
+	DeletedFiles *DeletedFilesDiff `json:"deleted_files,omitempty"`
+	SizeChange   int64             `json:"size_change"`
+}
+
+// rootFsEntry is a file of rootfs-diff.tar.
+type rootFsEntry struct {
+	fileType string
+	mode     int64
+	size     int64
+	digest   string
+	link     string
+}
+
+// rootFsState contains the files of rootfs-diff.tar and deleted.files of a
+// checkpoint. Both are missing if the root file system was not changed.
+type rootFsState struct {
+	files   map[string]rootFsEntry
+	deleted []string
+}
+
+func rootFsFileType(header *tar.Header) string {
+	switch header.Typeflag {
+	case tar.TypeReg:
+		return "file"
+	case tar.TypeDir:
+		return "dir"
+	case tar.TypeSymlink:
+		return "symlink"
+	case tar.TypeLink:
+		return "hardlink"
+	case tar.TypeChar, tar.TypeBlock:
+		return "device"
+	case tar.TypeFifo:
+		return "fifo"
+	default:
+		return "other"
+	}
+}
+
+// readRootFsState reads the files of rootfs-diff.tar with the digests of
+// their content and the list of deleted files of a checkpoint archive.
+func readRootFsState(checkpointPath string) (*rootFsState, error) {
+	state := &rootFsState{files: make(map[string]rootFsEntry)}
+	err := iterateTarArchive(checkpointPath, func(r *tar.Reader, header *tar.Header) error {
+		switch {
+		case hasPrefix(header.Name, metadata.DeletedFilesFile):
+			if err := json.NewDecoder(r).Decode(&state.deleted); err != nil {
+				return fmt.Errorf("failed to read %s: %w", metadata.DeletedFilesFile, err)
+			}
+			return nil
+		case !hasPrefix(header.Name, metadata.RootFsDiffTar):
+			return nil
+		}
+
+		rootFsDiff := tar.NewReader(r)
+		for {
+			fileHeader, err := rootFsDiff.Next()
+			if err != nil {
+				if errors.Is(err, io.EOF) {
+					return nil
+				}
+				return fmt.Errorf("failed to read %s: %w", metadata.RootFsDiffTar, err)
+			}
+			name := "/" + strings.Trim(strings.TrimPrefix(fileHeader.Name, "./"), "/")
+			if name == "/" {
+				continue
+			}
+			entry := rootFsEntry{
+				fileType: rootFsFileType(fileHeader),
+				mode:     fileHeader.Mode,
+				link:     fileHeader.Linkname,
+			}
+			if fileHeader.Typeflag == tar.TypeReg {
+				hash := sha256.New()
+				size, err := io.Copy(hash, rootFsDiff)
+				if err != nil {
+					return err
+				}
+				entry.size, entry.digest = size, streamDigest(hash)
+			}
+			state.files[name] = entry
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// DiffRootFs compares the files in rootfs-diff.tar and the deleted files of
+// two checkpoint archives.
+func DiffRootFs(checkpointA, checkpointB string) (*RootFsDiff, error) {
+	stateA, err := readRootFsState(checkpointA)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read root file system changes of %s: %w", checkpointA, err)
+	}
+	stateB, err := readRootFsState(checkpointB)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read root file system changes of %s: %w", checkpointB, err)
+	}
+	return compareRootFsStates(stateA, stateB), nil
+}
+
+func compareRootFsStates(stateA, stateB *rootFsState) *RootFsDiff {
+	diff := &RootFsDiff{}
+
+	for path, b := range stateB.files {
+		change := RootFsChange{Path: path, Type: b.fileType, SizeAfter: b.size}
+		a, exists := stateA.files[path]
+		switch {
+		case !exists:
+			change.Status = Added
+			diff.Added = append(diff.Added, change)
+		case a != b:
+			change.Status = Modified
+			change.SizeBefore = a.size
+			diff.Modified = append(diff.Modified, change)
+		default:
+			change.Status = Unchanged
+			change.SizeBefore = a.size
+			diff.Unchanged = append(diff.Unchanged, change)
+		}
+		diff.SizeChange += b.size - a.size
+	}
+	for path, a := range stateA.files {
+		if _, exists := stateB.files[path]; !exists {
+			diff.Removed = append(diff.Removed, RootFsChange{Path: path, Type: a.fileType, Status: Removed, SizeBefore: a.size})
+			diff.SizeChange -= a.size
+		}
+	}
+
+	for _, changes := range [][]RootFsChange{diff.Added, diff.Removed, diff.Modified, diff.Unchanged} {
+		sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	}
+
+	deletedA := make(map[string]bool)
+	for _, path := range stateA.deleted {
+		deletedA[path] = true
+	}
+	deletedB := make(map[string]bool)
+	for _, path := range stateB.deleted {
+		deletedB[path] = true
+	}
+	deleted := &DeletedFilesDiff{}
+	for _, path := range stateB.deleted {
+		if !deletedA[path] {
+			deleted.Added = append(deleted.Added, path)
+		}
+	}
+	for _, path := range stateA.deleted {
+		if !deletedB[path] {
+			deleted.Removed = append(deleted.Removed, path)
+		}
+	}
+	sort.Strings(deleted.Added)
+	sort.Strings(deleted.Removed)
+	if len(deleted.Added) > 0 || len(deleted.Removed) > 0 {
+		diff.DeletedFiles = deleted
+	}
+
+	return diff
+}
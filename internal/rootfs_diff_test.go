@@ -0,0 +1,64 @@
+package internal
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestDiffRootFs(t *testing.T) {
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a.tar")
+	b := filepath.Join(dir, "b.tar")
+	writeRootFsCheckpoint(t, a, map[string][]byte{
+		"etc/app.conf":   []byte("port=80\n"),
+		"etc/hosts":      []byte("127.0.0.1 localhost\n"),
+		"tmp/cache/data": []byte("cached"),
+	}, `["/usr/share/doc","/etc/motd"]`)
+	writeRootFsCheckpoint(t, b, map[string][]byte{
+		"etc/app.conf":       []byte("port=8080\n"),
+		"./etc/hosts":        []byte("127.0.0.1 localhost\n"),
+		"var/log/app.log":    []byte("started\nlistening\n"),
+		"var/lib/app/new.db": []byte("db"),
+	}, `["/usr/share/doc","/root/.profile"]`)
+
+	diff, err := DiffRootFs(a, b)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := &RootFsDiff{
+		Added: []RootFsChange{
+			{Path: "/var/lib/app/new.db", Type: "file", Status: Added, SizeAfter: 2},
+			{Path: "/var/log/app.log", Type: "file", Status: Added, SizeAfter: 18},
+		},
+		Removed: []RootFsChange{
+			{Path: "/tmp/cache/data", Type: "file", Status: Removed, SizeBefore: 6},
+		},
+		Modified: []RootFsChange{
+			{Path: "/etc/app.conf", Type: "file", Status: Modified, SizeBefore: 8, SizeAfter: 10},
+		},
+		Unchanged: []RootFsChange{
+			{Path: "/etc/hosts", Type: "file", Status: Unchanged, SizeBefore: 20, SizeAfter: 20},
+		},
+		DeletedFiles: &DeletedFilesDiff{
+			Added:   []string{"/root/.profile"},
+			Removed: []string{"/etc/motd"},
+		},
+		SizeChange: 2 + 18 - 6 + 2,
+	}
+	if !reflect.DeepEqual(diff, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, diff)
+	}
+
+	// Checkpoints without root file system changes are identical
+	empty := filepath.Join(dir, "empty.tar")
+	writeArchive(t, empty, map[string][]byte{"config.dump": []byte("{}")})
+	diff, err = DiffRootFs(empty, empty)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(diff, &RootFsDiff{}) {
+		t.Errorf("Expected no changes, got %+v", diff)
+	}
+}
@@ -0,0 +1,445 @@
+// SPDX-License-Identifier: Apache-2.0
+
+// This file is used to scan container checkpoints for secrets and credentials
+
+package internal
+
+import (
+	"archive/tar"
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	metadata "github.com/checkpoint-restore/checkpointctl/lib"
+	"github.com/checkpoint-restore/go-criu/v8/crit"
+)
+
+// Sources of secrets in a checkpoint
+const (
+	SecretSourceEnvironment = "environment"
+	SecretSourceCmdline     = "cmdline"
+	SecretSourceMemory      = "memory"
+	SecretSourceRootFs      = "rootfs"
+)
+
+// Rules which are not based on regular expressions
+const (
+	highEntropyRule       = "high-entropy-string"
+	sensitiveVariableRule = "sensitive-variable"
+)
+
+const (
+	// secretScanChunkSize is the number of bytes scanned at once
+	secretScanChunkSize = 1 << 20
+	// secretScanOverlap is the number of bytes at the end of a chunk which
+	// are scanned again with the next chunk, so that secrets crossing chunk
+	// boundaries are found
+	secretScanOverlap = 4096
+	// secretPreviewLength is the maximum length of the redacted preview
+	secretPreviewLength = 40
+	// minHighEntropyLength and minHighEntropy describe the random looking
+	// strings in environment variables and arguments reported by the
+	// generic high entropy rule
+	minHighEntropyLength = 20
+	minHighEntropy       = 3.5
+)
+
+// DefaultEntropyThreshold is the default Shannon entropy in bits per byte
+// above which printable strings in memory pages and files are reported by
+// the high entropy rule. It is higher than the threshold for environment
+// variables and arguments, because memory contains many identifiers like
+// mangled symbol names which are not secrets.
+const DefaultEntropyThreshold = 4.5
+
+type SecretRule struct {
+	Name    string
+	Pattern *regexp.Regexp
+}
+
+type SecretFinding struct {
+	Checkpoint string `json:"checkpoint"`
+	Rule       string `json:"rule"`
+	Source     string `json:"source"`
+	PID        uint32 `json:"pid,omitempty"`
+	Comm       string `json:"command,omitempty"`
+	Location   string `json:"location"`
+	Preview    string `json:"preview"`
+}
+
+var (
+	highEntropyToken  = regexp.MustCompile(`[A-Za-z0-9+/=_-]{20,}`)
+	sensitiveVariable = regexp.MustCompile(`(?i)(PASSWORD|PASSWD|SECRET|TOKEN|API_?KEY|PRIVATE_?KEY|ACCESS_?KEY|CREDENTIAL)`)
+)
+
+// DefaultSecretRules returns the built-in rules of the secret scanner.
+func DefaultSecretRules() []SecretRule {
+	return []SecretRule{
+		{"aws-access-key-id", regexp.MustCompile(`\b(?:AKIA|ASIA|AGPA|AIDA|AROA|ANPA|ANVA|AIPA)[0-9A-Z]{16}\b`)},
+		{"aws-secret-access-key", regexp.MustCompile(`(?i)aws_?secret_?access_?key["']?\s*[=:]\s*["']?[A-Za-z0-9/+]{40}\b`)},
+		{"private-key", regexp.MustCompile(`-----BEGIN (?:[A-Z0-9]+ )*PRIVATE KEY(?: BLOCK)?-----`)},
+		{"jwt", regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{10,}\.eyJ[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]{10,}`)},
+		{"github-token", regexp.MustCompile(`\bgh[pousr]_[A-Za-z0-9]{36,}\b`)},
+		{"slack-token", regexp.MustCompile(`\bxox[abprs]-[A-Za-z0-9-]{10,}`)},
+	}
+}
+
+// ParseSecretRule parses a custom rule in the form NAME=REGEX.
+func ParseSecretRule(s string) (SecretRule, error) {
+	name, expr, found := strings.Cut(s, "=")
+	if !found || name == "" || expr == "" {
+		return SecretRule{}, fmt.Errorf("invalid rule %q: expected NAME=REGEX", s)
+	}
+	pattern, err := regexp.Compile(expr)
+	if err != nil {
+		return SecretRule{}, fmt.Errorf("invalid regular expression of rule %s: %w", name, err)
+	}
+	return SecretRule{Name: name, Pattern: pattern}, nil
+}
+
+// ReadSecretRules reads custom rules from a file with one NAME=REGEX rule
+// per line. Empty lines and lines starting with "#" are ignored.
+func ReadSecretRules(path string) ([]SecretRule, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var rules []SecretRule
+	scanner := bufio.NewScanner(f)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		rule, err := ParseSecretRule(line)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, lineNumber, err)
+		}
+		rules = append(rules, rule)
+	}
+
+	return rules, scanner.Err()
+}
+
+// ScanSecrets scans the environment variables, command lines and memory of
+// all processes and the files of rootfs-diff.tar of a checkpoint for secrets.
+// Printable strings in memory and files are checked with the high entropy
+// rule if SecretEntropy is not 0. The pstree, core, mm, pagemap and
+// pages images have to be unpacked.
+func ScanSecrets(task Task, rules []SecretRule) ([]SecretFinding, error) {
+	c := crit.New(nil, nil, filepath.Join(task.OutputDir, metadata.CheckpointDirectory), false, false)
+	psTree, err := c.ExplorePs()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get process tree: %w", err)
+	}
+
+	var findings []SecretFinding
+	err = walkAliveProcesses(psTree, func(ps *crit.PsTree) error {
+		result, err := scanProcessSecrets(task, ps, rules)
+		if err != nil {
+			return fmt.Errorf("failed to scan process %d: %w", ps.PID, err)
+		}
+		findings = append(findings, result...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := scanRootFsDiffSecrets(task.CheckpointFilePath, rules, SecretEntropy)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan %s: %w", metadata.RootFsDiffTar, err)
+	}
+	findings = append(findings, result...)
+
+	for i := range findings {
+		findings[i].Checkpoint = task.CheckpointFilePath
+	}
+
+	return findings, nil
+}
+
+func scanProcessSecrets(task Task, ps *crit.PsTree, rules []SecretRule) ([]SecretFinding, error) {
+	var findings []SecretFinding
+	add := func(rule, source, location string, secret []byte) {
+		findings = append(findings, SecretFinding{
+			Rule:     rule,
+			Source:   source,
+			PID:      ps.PID,
+			Comm:     ps.Comm,
+			Location: location,
+			Preview:  redactSecret(secret),
+		})
+	}
+
+	envVars, err := getPsEnvVars(task.OutputDir, ps.PID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get environment variables: %w", err)
+	}
+	for _, envVar := range envVars {
+		key, value, _ := strings.Cut(envVar, "=")
+		if value == "" {
+			continue
+		}
+		if scanString(value, rules, func(rule string, secret []byte) { add(rule, SecretSourceEnvironment, key, secret) }) {
+			continue
+		}
+		if sensitiveVariable.MatchString(key) {
+			add(sensitiveVariableRule, SecretSourceEnvironment, key, []byte(value))
+		}
+	}
+
+	args, err := getPsArgs(task.OutputDir, ps.PID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get command line: %w", err)
+	}
+	for i, arg := range args {
+		scanString(arg, rules, func(rule string, secret []byte) {
+			add(rule, SecretSourceCmdline, fmt.Sprintf("argument %d", i), secret)
+		})
+	}
+
+	memoryFindings, err := scanMemorySecrets(task.OutputDir, ps.PID, rules, SecretEntropy)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range memoryFindings {
+		add(f.rule, SecretSourceMemory, f.location, f.secret)
+	}
+
+	return findings, nil
+}
+
+// scanString scans a single environment variable or argument with the rules
+// and the high entropy rule. It reports whether a secret was found.
+func scanString(s string, rules []SecretRule, found func(rule string, secret []byte)) bool {
+	var matched bool
+	for _, rule := range rules {
+		for _, match := range rule.Pattern.FindAllString(s, -1) {
+			found(rule.Name, []byte(match))
+			matched = true
+		}
+	}
+	if matched {
+		return true
+	}
+	for _, token := range highEntropyToken.FindAllString(s, -1) {
+		if isHighEntropy(token, minHighEntropy) {
+			found(highEntropyRule, []byte(token))
+			matched = true
+		}
+	}
+	return matched
+}
+
+// isHighEntropy reports whether a string looks random. It has to contain
+// letters and digits and have a Shannon entropy of at least threshold.
+func isHighEntropy(s string, threshold float64) bool {
+	if len(s) < minHighEntropyLength || !strings.ContainsAny(s, "0123456789") ||
+		!strings.ContainsFunc(s, func(r rune) bool { return (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') }) {
+		return false
+	}
+	return shannonEntropy(s) >= threshold
+}
+
+// shannonEntropy returns the Shannon entropy of a string in bits per byte.
+func shannonEntropy(s string) float64 {
+	var counts [256]int
+	for i := 0; i < len(s); i++ {
+		counts[s[i]]++
+	}
+	var entropy float64
+	for _, count := range counts {
+		if count > 0 {
+			p := float64(count) / float64(len(s))
+			entropy -= p * math.Log2(p)
+		}
+	}
+	return entropy
+}
+
+// redactSecret returns a preview of a secret which only shows its first
+// four and last two characters.
+func redactSecret(secret []byte) string {
+	preview := []byte(formatMemoryMatch(secret, false))
+	if len(preview) <= 8 {
+		return strings.Repeat("*", len(preview))
+	}
+	hidden := min(len(preview)-6, secretPreviewLength-6)
+	return string(preview[:4]) + strings.Repeat("*", hidden) + string(preview[len(preview)-2:])
+}
+
+func getPsArgs(checkpointOutputDir string, pid uint32) ([]string, error) {
+	mr, err := crit.NewMemoryReader(filepath.Join(checkpointOutputDir, metadata.CheckpointDirectory), pid, pageSize)
+	if err != nil {
+		return nil, err
+	}
+
+	buffer, err := mr.GetPsArgs()
+	if err != nil {
+		return nil, err
+	}
+
+	return strings.Split(strings.TrimRight(buffer.String(), "\x00"), "\x00"), nil
+}
+
+type memorySecret struct {
+	rule     string
+	location string
+	secret   []byte
+}
+
+// scanMemorySecrets scans the memory pages of a process with the rules and
+// the high entropy rule with the given threshold. The arguments and
+// environment variables are skipped because they are scanned separately.
+func scanMemorySecrets(checkpointOutputDir string, pid uint32, rules []SecretRule, entropyThreshold float64) ([]memorySecret, error) {
+	mmEntry, err := readMmEntry(checkpointOutputDir, pid)
+	if err != nil {
+		return nil, err
+	}
+	regions, err := GetMemoryRegions(checkpointOutputDir, pid)
+	if err != nil {
+		return nil, err
+	}
+	ranges, err := readPagesRanges(checkpointOutputDir, pid)
+	if err != nil {
+		return nil, err
+	}
+	pagesID, err := getPagesID(checkpointOutputDir, pid)
+	if err != nil {
+		return nil, err
+	}
+
+	pages, err := os.Open(filepath.Join(checkpointOutputDir, metadata.CheckpointDirectory, fmt.Sprintf("pages-%d.img", pagesID)))
+	if err != nil {
+		return nil, err
+	}
+	defer pages.Close()
+
+	inArgsOrEnv := func(addr uint64) bool {
+		return (addr >= mmEntry.GetMmArgStart() && addr < mmEntry.GetMmArgEnd()) ||
+			(addr >= mmEntry.GetMmEnvStart() && addr < mmEntry.GetMmEnvEnd())
+	}
+
+	var result []memorySecret
+	for _, r := range ranges {
+		err := scanSecretsInStream(io.NewSectionReader(pages, int64(r.offset), int64(r.size)), rules, entropyThreshold, func(offset uint64, rule string, secret []byte) {
+			addr := r.vaddr + offset
+			if inArgsOrEnv(addr) {
+				return
+			}
+			location := fmt.Sprintf("0x%016x", addr)
+			if region := findMemoryRegion(regions, addr); region != nil && region.Name != "" {
+				location += " " + region.Name
+			}
+			result = append(result, memorySecret{rule: rule, location: location, secret: secret})
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+// scanRootFsDiffSecrets scans the files of rootfs-diff.tar in the
+// checkpoint archive with the rules and the high entropy rule with the
+// given threshold.
+func scanRootFsDiffSecrets(checkpointPath string, rules []SecretRule, entropyThreshold float64) ([]SecretFinding, error) {
+	var findings []SecretFinding
+	err := iterateTarArchive(checkpointPath, func(r *tar.Reader, header *tar.Header) error {
+		if !hasPrefix(header.Name, metadata.RootFsDiffTar) {
+			return nil
+		}
+		rootFsDiff := tar.NewReader(r)
+		for {
+			fileHeader, err := rootFsDiff.Next()
+			if err != nil {
+				if errors.Is(err, io.EOF) {
+					return nil
+				}
+				return err
+			}
+			if !fileHeader.FileInfo().Mode().IsRegular() {
+				continue
+			}
+			name := "/" + strings.TrimPrefix(fileHeader.Name, "./")
+			err = scanSecretsInStream(rootFsDiff, rules, entropyThreshold, func(offset uint64, rule string, secret []byte) {
+				findings = append(findings, SecretFinding{
+					Rule:     rule,
+					Source:   SecretSourceRootFs,
+					Location: fmt.Sprintf("%s at offset %d", name, offset),
+					Preview:  redactSecret(secret),
+				})
+			})
+			if err != nil {
+				return err
+			}
+		}
+	})
+	return findings, err
+}
+
+// scanSecretsInStream scans data read from r in chunks with the rules and
+// calls found with the offset of each secret. If entropyThreshold is not 0,
+// printable strings with at least this entropy are reported as well.
+func scanSecretsInStream(r io.Reader, rules []SecretRule, entropyThreshold float64, found func(offset uint64, rule string, secret []byte)) error {
+	buf := make([]byte, secretScanOverlap+secretScanChunkSize)
+	// Secrets are only reported once, even if a rule matches again
+	// within a secret in the overlap of the next chunk. The last element
+	// is used for the high entropy rule.
+	lastEnd := make([]uint64, len(rules)+1)
+	var base uint64
+	var filled int
+	for {
+		n, err := io.ReadFull(r, buf[filled:])
+		filled += n
+		eof := errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+		if err != nil && !eof {
+			return err
+		}
+
+		data := buf[:filled]
+		// Matches starting in the overlap are reported with the next chunk
+		reportEnd := len(data)
+		if !eof {
+			reportEnd -= secretScanOverlap
+		}
+		for i, rule := range rules {
+			for _, loc := range rule.Pattern.FindAllIndex(data, -1) {
+				start := base + uint64(loc[0])
+				if loc[0] >= reportEnd || start < lastEnd[i] {
+					continue
+				}
+				lastEnd[i] = base + uint64(loc[1])
+				found(start, rule.Name, data[loc[0]:loc[1]])
+			}
+		}
+		if entropyThreshold != 0 {
+			for _, loc := range highEntropyToken.FindAllIndex(data, -1) {
+				start := base + uint64(loc[0])
+				if loc[0] >= reportEnd || start < lastEnd[len(rules)] {
+					continue
+				}
+				if !isHighEntropy(string(data[loc[0]:loc[1]]), entropyThreshold) {
+					continue
+				}
+				lastEnd[len(rules)] = base + uint64(loc[1])
+				found(start, highEntropyRule, data[loc[0]:loc[1]])
+			}
+		}
+
+		if eof {
+			return nil
+		}
+		filled = copy(buf, data[reportEnd:])
+		base += uint64(reportEnd)
+	}
+}
@@ -0,0 +1,351 @@
+// SPDX-License-Identifier: Apache-2.0
+
+// This file is used to collect the memfds and shared anonymous memory of a checkpoint
+
+package internal
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	metadata "github.com/checkpoint-restore/checkpointctl/lib"
+	"github.com/checkpoint-restore/go-criu/v8/crit"
+	"github.com/checkpoint-restore/go-criu/v8/crit/images/fdinfo"
+	"github.com/checkpoint-restore/go-criu/v8/crit/images/memfd"
+	"github.com/checkpoint-restore/go-criu/v8/crit/images/mm"
+	"github.com/checkpoint-restore/go-criu/v8/crit/images/pagemap"
+)
+
+type SharedMemoryNode struct {
+	Memfds    []MemfdNode        `json:"memfds,omitempty"`
+	Anonymous []ShmemSegmentNode `json:"anonymous,omitempty"`
+}
+
+type MemfdNode struct {
+	ID      uint64            `json:"id"`
+	ShmID   uint64            `json:"shmid"`
+	Name    string            `json:"name"`
+	Size    uint64            `json:"size"`
+	Mode    string            `json:"mode"`
+	UID     uint32            `json:"uid"`
+	GID     uint32            `json:"gid"`
+	Seals   []string          `json:"seals,omitempty"`
+	Hugetlb bool              `json:"hugetlb,omitempty"`
+	Holders []ShmemHolderNode `json:"holders,omitempty"`
+}
+
+type ShmemSegmentNode struct {
+	ShmID   uint64            `json:"shmid"`
+	Size    uint64            `json:"size"`
+	Holders []ShmemHolderNode `json:"holders,omitempty"`
+}
+
+// ShmemHolderNode is either a file descriptor or a memory mapping
+// of a process which references a shared memory object.
+type ShmemHolderNode struct {
+	PID     uint32  `json:"pid"`
+	Comm    string  `json:"command"`
+	FD      *uint32 `json:"fd,omitempty"`
+	Mapping string  `json:"mapping,omitempty"`
+}
+
+// pePresent is the pagemap entry flag of CRIU for pages in the pages image
+const pePresent = 1 << 2
+
+var memfdSeals = []flagName{
+	{0x1, "F_SEAL_SEAL"},
+	{0x2, "F_SEAL_SHRINK"},
+	{0x4, "F_SEAL_GROW"},
+	{0x8, "F_SEAL_WRITE"},
+	{0x10, "F_SEAL_FUTURE_WRITE"},
+	{0x20, "F_SEAL_EXEC"},
+}
+
+// readMemfdInodes returns the entries of memfd.img. Checkpoints of
+// processes without memfds have no memfd.img.
+func readMemfdInodes(checkpointOutputDir string) ([]*memfd.MemfdInodeEntry, error) {
+	img, err := readCriuImage(checkpointOutputDir, "memfd.img", &memfd.MemfdInodeEntry{})
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	result := make([]*memfd.MemfdInodeEntry, 0, len(img.Entries))
+	for _, entry := range img.Entries {
+		result = append(result, entry.Message.(*memfd.MemfdInodeEntry))
+	}
+	return result, nil
+}
+
+// readMmEntry returns the memory mappings of the process with the given PID.
+func readMmEntry(checkpointOutputDir string, pid uint32) (*mm.MmEntry, error) {
+	img, err := readCriuImage(checkpointOutputDir, fmt.Sprintf("mm-%d.img", pid), &mm.MmEntry{})
+	if err != nil {
+		return nil, err
+	}
+	if len(img.Entries) == 0 {
+		return nil, fmt.Errorf("mm-%d.img contains no entries", pid)
+	}
+	return img.Entries[0].Message.(*mm.MmEntry), nil
+}
+
+// buildJSONSharedMemory lists the memfds and the shared anonymous memory
+// of a checkpoint together with the processes that reference them.
+// System V shared memory is shown with the other IPC objects.
+func buildJSONSharedMemory(psTree *crit.PsTree, checkpointOutputDir string) (*SharedMemoryNode, error) {
+	inodes, err := readMemfdInodes(checkpointOutputDir)
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := readFileEntries(checkpointOutputDir)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &SharedMemoryNode{}
+	memfdIndex := make(map[uint64]int)
+	for _, inode := range inodes {
+		memfdIndex[inode.GetInodeId()] = len(result.Memfds)
+		result.Memfds = append(result.Memfds, buildMemfdNode(inode))
+	}
+	anonIndex := make(map[uint64]int)
+
+	err = walkProcessFds(checkpointOutputDir, psTree, func(ps *crit.PsTree, fdinfos map[string]*fdinfo.FdinfoEntry) error {
+		for _, fd := range fdinfos {
+			if fd.GetType() != fdinfo.FdTypes_MEMFD {
+				continue
+			}
+			if i, ok := memfdIndex[uint64(files[fd.GetId()].GetMemfd().GetInodeId())]; ok {
+				fdNum := fd.GetFd()
+				result.Memfds[i].Holders = append(result.Memfds[i].Holders, ShmemHolderNode{PID: ps.PID, Comm: ps.Comm, FD: &fdNum})
+			}
+		}
+
+		mmEntry, err := readMmEntry(checkpointOutputDir, ps.PID)
+		if err != nil {
+			return fmt.Errorf("failed to read memory mappings of process %d: %w", ps.PID, err)
+		}
+		for _, vma := range mmEntry.GetVmas() {
+			holder := ShmemHolderNode{
+				PID:     ps.PID,
+				Comm:    ps.Comm,
+				Mapping: fmt.Sprintf("0x%x-0x%x", vma.GetStart(), vma.GetEnd()),
+			}
+			switch {
+			case vma.GetStatus()&vmaAreaMemfd != 0:
+				// The shmid of memfd mappings is the ID of the file
+				if i, ok := memfdIndex[uint64(files[uint32(vma.GetShmid())].GetMemfd().GetInodeId())]; ok {
+					result.Memfds[i].Holders = append(result.Memfds[i].Holders, holder)
+				}
+			case vma.GetStatus()&vmaAnonShared != 0 && vma.GetStatus()&vmaAreaSysvipc == 0:
+				i, ok := anonIndex[vma.GetShmid()]
+				if !ok {
+					i = len(result.Anonymous)
+					anonIndex[vma.GetShmid()] = i
+					result.Anonymous = append(result.Anonymous, ShmemSegmentNode{ShmID: vma.GetShmid()})
+				}
+				result.Anonymous[i].Size = max(result.Anonymous[i].Size, vmaSegmentEnd(vma.GetPgoff(), vma.GetStart(), vma.GetEnd()))
+				result.Anonymous[i].Holders = append(result.Anonymous[i].Holders, holder)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(result.Memfds) == 0 && len(result.Anonymous) == 0 {
+		return nil, nil
+	}
+
+	sort.Slice(result.Memfds, func(a, b int) bool { return result.Memfds[a].ShmID < result.Memfds[b].ShmID })
+	sort.Slice(result.Anonymous, func(a, b int) bool { return result.Anonymous[a].ShmID < result.Anonymous[b].ShmID })
+	for i := range result.Memfds {
+		sortShmemHolders(result.Memfds[i].Holders)
+	}
+	for i := range result.Anonymous {
+		sortShmemHolders(result.Anonymous[i].Holders)
+	}
+
+	return result, nil
+}
+
+func buildMemfdNode(inode *memfd.MemfdInodeEntry) MemfdNode {
+	return MemfdNode{
+		ID:      inode.GetInodeId(),
+		ShmID:   uint64(inode.GetShmid()),
+		Name:    inode.GetName(),
+		Size:    inode.GetSize(),
+		Mode:    fmt.Sprintf("%04o", inode.GetMode()&0o7777),
+		UID:     inode.GetUid(),
+		GID:     inode.GetGid(),
+		Seals:   formatFlags(inode.GetSeals(), memfdSeals),
+		Hugetlb: inode.GetHugetlbFlag() != 0,
+	}
+}
+
+// vmaSegmentEnd returns the offset in the shared memory object up to which
+// a mapping reaches.
+func vmaSegmentEnd(pgoff, start, end uint64) uint64 {
+	return pgoff + end - start
+}
+
+// sortShmemHolders sorts the holders by PID with file descriptors first.
+func sortShmemHolders(holders []ShmemHolderNode) {
+	sort.SliceStable(holders, func(a, b int) bool {
+		if holders[a].PID != holders[b].PID {
+			return holders[a].PID < holders[b].PID
+		}
+		if (holders[a].FD == nil) != (holders[b].FD == nil) {
+			return holders[a].FD != nil
+		}
+		if holders[a].FD != nil {
+			return *holders[a].FD < *holders[b].FD
+		}
+		return holders[a].Mapping < holders[b].Mapping
+	})
+}
+
+// ReadShmemContents returns the contents of the memfd or the shared anonymous
+// memory with the given shmid. The memfd.img, mm-*.img, pagemap-shmem and
+// pages images have to be unpacked.
+func ReadShmemContents(checkpointOutputDir string, shmid uint64) (*bytes.Buffer, error) {
+	size, err := shmemSize(checkpointOutputDir, shmid)
+	if err != nil {
+		return nil, err
+	}
+	return readShmemPages(checkpointOutputDir, shmid, size)
+}
+
+// ExtractShmem writes the contents of the memfd or the shared anonymous
+// memory with the given shmid to outputPath. Pages which are not part of the
+// pagemap are left as holes. The same images as for ReadShmemContents have
+// to be unpacked.
+func ExtractShmem(checkpointOutputDir string, shmid uint64, outputPath string) error {
+	size, err := shmemSize(checkpointOutputDir, shmid)
+	if err != nil {
+		return err
+	}
+
+	out, err := os.OpenFile(outputPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	err = iterateShmemPages(checkpointOutputDir, shmid, size, func(offset int64, pages *io.SectionReader) error {
+		if _, err := out.Seek(offset, io.SeekStart); err != nil {
+			return err
+		}
+		_, err := io.CopyN(out, pages, pages.Size())
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	return out.Truncate(int64(size))
+}
+
+// shmemSize returns the size of the memfd or the shared anonymous memory
+// with the given shmid.
+func shmemSize(checkpointOutputDir string, shmid uint64) (uint64, error) {
+	inodes, err := readMemfdInodes(checkpointOutputDir)
+	if err != nil {
+		return 0, err
+	}
+	for _, inode := range inodes {
+		if uint64(inode.GetShmid()) == shmid {
+			return inode.GetSize(), nil
+		}
+	}
+
+	// The size of shared anonymous memory is only known from its mappings
+	mmImages, err := filepath.Glob(filepath.Join(checkpointOutputDir, metadata.CheckpointDirectory, "mm-*.img"))
+	if err != nil {
+		return 0, err
+	}
+	var size uint64
+	for _, path := range mmImages {
+		img, err := readCriuImage(checkpointOutputDir, filepath.Base(path), &mm.MmEntry{})
+		if err != nil {
+			return 0, err
+		}
+		for _, entry := range img.Entries {
+			for _, vma := range entry.Message.(*mm.MmEntry).GetVmas() {
+				if vma.GetStatus()&vmaAnonShared != 0 && vma.GetShmid() == shmid {
+					size = max(size, vmaSegmentEnd(vma.GetPgoff(), vma.GetStart(), vma.GetEnd()))
+				}
+			}
+		}
+	}
+	if size == 0 {
+		return 0, fmt.Errorf("no memfd or shared anonymous memory with ID %d", shmid)
+	}
+
+	return size, nil
+}
+
+// readShmemPages reads a shared memory segment from the pagemap-shmem image
+// with the given ID. Pages which are not part of the pagemap are zero.
+func readShmemPages(checkpointOutputDir string, shmid, size uint64) (*bytes.Buffer, error) {
+	contents := make([]byte, size)
+	err := iterateShmemPages(checkpointOutputDir, shmid, size, func(offset int64, pages *io.SectionReader) error {
+		_, err := io.ReadFull(pages, contents[offset:offset+pages.Size()])
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return bytes.NewBuffer(contents), nil
+}
+
+// iterateShmemPages calls fn with the offset and the contents of each range
+// of present pages of the shared memory segment with the given ID. Pages
+// beyond size are left out.
+func iterateShmemPages(checkpointOutputDir string, shmid, size uint64, fn func(offset int64, pages *io.SectionReader) error) error {
+	img, err := readCriuImage(checkpointOutputDir, fmt.Sprintf("pagemap-shmem-%d.img", shmid), &pagemap.PagemapHead{})
+	if err != nil {
+		return err
+	}
+	if len(img.Entries) == 0 {
+		return fmt.Errorf("pagemap-shmem-%d.img contains no entries", shmid)
+	}
+	pagesID := img.Entries[0].Message.(*pagemap.PagemapHead).GetPagesId()
+
+	pages, err := os.Open(filepath.Join(checkpointOutputDir, metadata.CheckpointDirectory, fmt.Sprintf("pages-%d.img", pagesID)))
+	if err != nil {
+		return err
+	}
+	defer pages.Close()
+
+	pageSize := uint64(os.Getpagesize())
+	var offset int64
+	for _, e := range img.Entries[1:] {
+		entry := e.Message.(*pagemap.PagemapEntry)
+		// Pages of older images have no flags and are always present
+		if entry.Flags != nil && entry.GetFlags()&pePresent == 0 {
+			continue
+		}
+		length := entry.GetNrPages() * pageSize
+		if entry.GetVaddr() < size {
+			end := min(entry.GetVaddr()+length, size)
+			section := io.NewSectionReader(pages, offset, int64(end-entry.GetVaddr()))
+			if err := fn(int64(entry.GetVaddr()), section); err != nil {
+				return err
+			}
+		}
+		offset += int64(length)
+	}
+
+	return nil
+}
@@ -0,0 +1,235 @@
+package internal
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	metadata "github.com/checkpoint-restore/checkpointctl/lib"
+	"github.com/checkpoint-restore/go-criu/v8/crit"
+	criu_core "github.com/checkpoint-restore/go-criu/v8/crit/images/criu-core"
+	"github.com/checkpoint-restore/go-criu/v8/crit/images/fdinfo"
+	"github.com/checkpoint-restore/go-criu/v8/crit/images/fown"
+	"github.com/checkpoint-restore/go-criu/v8/crit/images/memfd"
+	"github.com/checkpoint-restore/go-criu/v8/crit/images/mm"
+	"github.com/checkpoint-restore/go-criu/v8/crit/images/pagemap"
+	"github.com/checkpoint-restore/go-criu/v8/crit/images/vma"
+	"github.com/xlab/treeprint"
+	"google.golang.org/protobuf/proto"
+)
+
+func testVma(start, end, pgoff, shmid uint64, status uint32) *vma.VmaEntry {
+	return &vma.VmaEntry{
+		Start:  proto.Uint64(start),
+		End:    proto.Uint64(end),
+		Pgoff:  proto.Uint64(pgoff),
+		Shmid:  proto.Uint64(shmid),
+		Prot:   proto.Uint32(0x3),
+		Flags:  proto.Uint32(0x1),
+		Status: proto.Uint32(status),
+		Fd:     proto.Int64(-1),
+	}
+}
+
+func writeMmImage(t *testing.T, dir string, pid uint32, vmas ...*vma.VmaEntry) {
+	t.Helper()
+	zero := proto.Uint64(0)
+	newImageWriter(t, "MM").entry(&mm.MmEntry{
+		MmStartCode: zero, MmEndCode: zero, MmStartData: zero, MmEndData: zero,
+		MmStartStack: zero, MmStartBrk: zero, MmBrk: zero, MmArgStart: zero,
+		MmArgEnd: zero, MmEnvStart: zero, MmEnvEnd: zero, ExeFileId: proto.Uint32(0),
+		Vmas: vmas,
+	}).write(dir, fmt.Sprintf("mm-%d.img", pid))
+}
+
+func TestBuildJSONSharedMemory(t *testing.T) {
+	dir := t.TempDir()
+	newImageWriter(t, "MEMFD_INODE").entry(&memfd.MemfdInodeEntry{
+		Name:    proto.String("buffer"),
+		Uid:     proto.Uint32(0),
+		Gid:     proto.Uint32(0),
+		Size:    proto.Uint64(10),
+		Shmid:   proto.Uint32(100),
+		Seals:   proto.Uint32(0x2 | 0x4),
+		InodeId: proto.Uint64(5),
+		Mode:    proto.Uint32(0o100600),
+	}).write(dir, "memfd.img")
+
+	memfdType := fdinfo.FdTypes_MEMFD
+	newImageWriter(t, "FILES").entry(&fdinfo.FileEntry{
+		Type: &memfdType,
+		Id:   proto.Uint32(7),
+		Memfd: &memfd.MemfdFileEntry{
+			Id:    proto.Uint32(7),
+			Flags: proto.Uint32(0),
+			Pos:   proto.Uint64(0),
+			Fown: &fown.FownEntry{
+				Uid: proto.Uint32(0), Euid: proto.Uint32(0), Signum: proto.Uint32(0),
+				PidType: proto.Uint32(0), Pid: proto.Uint32(0),
+			},
+			InodeId: proto.Uint32(5),
+		},
+	}).write(dir, "files.img")
+	newImageWriter(t, "IDS").entry(&criu_core.TaskKobjIdsEntry{
+		VmId: proto.Uint32(1), FilesId: proto.Uint32(1), FsId: proto.Uint32(1), SighandId: proto.Uint32(1),
+	}).write(dir, "ids-1.img")
+	newImageWriter(t, "FDINFO").
+		entry(&fdinfo.FdinfoEntry{Id: proto.Uint32(7), Flags: proto.Uint32(0), Type: &memfdType, Fd: proto.Uint32(4)}).
+		write(dir, "fdinfo-1.img")
+	writeMmImage(t, dir, 1,
+		testVma(0x1000, 0x2000, 0, 7, vmaAreaMemfd),
+		testVma(0x3000, 0x5000, 0, 200, vmaAnonShared),
+		testVma(0x6000, 0x7000, 0, 300, vmaAnonShared|vmaAreaSysvipc),
+	)
+
+	psTree := &crit.PsTree{
+		PID:  1,
+		Comm: "app",
+		Core: &criu_core.CoreEntry{Tc: &criu_core.TaskCoreEntry{TaskState: proto.Uint32(uint32(crit.TaskAlive))}},
+	}
+
+	result, err := buildJSONSharedMemory(psTree, dir)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(result.Memfds) != 1 {
+		t.Fatalf("Expected 1 memfd, got %+v", result.Memfds)
+	}
+	m := result.Memfds[0]
+	if m.ShmID != 100 || m.Name != "buffer" || m.Size != 10 || m.Mode != "0600" || strings.Join(m.Seals, "|") != "F_SEAL_SHRINK|F_SEAL_GROW" {
+		t.Errorf("Unexpected memfd: %+v", m)
+	}
+	if len(m.Holders) != 2 || m.Holders[0].FD == nil || *m.Holders[0].FD != 4 || m.Holders[1].Mapping != "0x1000-0x2000" {
+		t.Errorf("Unexpected memfd holders: %+v", m.Holders)
+	}
+
+	if len(result.Anonymous) != 1 {
+		t.Fatalf("Expected 1 shared anonymous memory segment, got %+v", result.Anonymous)
+	}
+	a := result.Anonymous[0]
+	if a.ShmID != 200 || a.Size != 0x2000 || len(a.Holders) != 1 || a.Holders[0].Mapping != "0x3000-0x5000" {
+		t.Errorf("Unexpected shared anonymous memory: %+v", a)
+	}
+}
+
+func TestBuildJSONSharedMemoryWithoutSharedMemory(t *testing.T) {
+	result, err := buildJSONSharedMemory(&crit.PsTree{}, t.TempDir())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result != nil {
+		t.Errorf("Expected no shared memory, got %+v", result)
+	}
+}
+
+func TestReadShmemContents(t *testing.T) {
+	dir := t.TempDir()
+	pageSize := os.Getpagesize()
+	writeMmImage(t, dir, 1, testVma(0x3000, 0x3000+2*uint64(pageSize), 0, 200, vmaAnonShared))
+	// Only the second page contains data
+	newImageWriter(t, "PAGEMAP").
+		entry(&pagemap.PagemapHead{PagesId: proto.Uint32(3)}).
+		entry(&pagemap.PagemapEntry{
+			Vaddr:         proto.Uint64(uint64(pageSize)),
+			CompatNrPages: proto.Uint32(1),
+			NrPages:       proto.Uint64(1),
+			Flags:         proto.Uint32(pePresent),
+		}).
+		write(dir, "pagemap-shmem-200.img")
+	page := bytes.Repeat([]byte("x"), pageSize)
+	if err := os.WriteFile(filepath.Join(dir, metadata.CheckpointDirectory, "pages-3.img"), page, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	buf, err := ReadShmemContents(dir, 200)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := append(make([]byte, pageSize), page...)
+	if !bytes.Equal(buf.Bytes(), expected) {
+		t.Errorf("Unexpected contents of shared anonymous memory")
+	}
+
+	if _, err := ReadShmemContents(dir, 201); err == nil || !strings.Contains(err.Error(), "no memfd or shared anonymous memory with ID 201") {
+		t.Errorf("Expected an error for missing shared memory, got %v", err)
+	}
+}
+
+func TestExtractShmem(t *testing.T) {
+	dir := t.TempDir()
+	pageSize := os.Getpagesize()
+	// The inode is larger than the pages which are stored
+	newImageWriter(t, "MEMFD_INODE").entry(&memfd.MemfdInodeEntry{
+		Name:    proto.String("buffer"),
+		Uid:     proto.Uint32(0),
+		Gid:     proto.Uint32(0),
+		Size:    proto.Uint64(3 * uint64(pageSize)),
+		Shmid:   proto.Uint32(100),
+		Seals:   proto.Uint32(0),
+		InodeId: proto.Uint64(5),
+	}).write(dir, "memfd.img")
+	newImageWriter(t, "PAGEMAP").
+		entry(&pagemap.PagemapHead{PagesId: proto.Uint32(3)}).
+		entry(&pagemap.PagemapEntry{
+			Vaddr:         proto.Uint64(uint64(pageSize)),
+			CompatNrPages: proto.Uint32(1),
+			NrPages:       proto.Uint64(1),
+			Flags:         proto.Uint32(pePresent),
+		}).
+		write(dir, "pagemap-shmem-100.img")
+	page := bytes.Repeat([]byte("x"), pageSize)
+	if err := os.WriteFile(filepath.Join(dir, metadata.CheckpointDirectory, "pages-3.img"), page, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	output := filepath.Join(t.TempDir(), "shmem.bin")
+	if err := ExtractShmem(dir, 100, output); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	content, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := append(append(make([]byte, pageSize), page...), make([]byte, pageSize)...)
+	if !bytes.Equal(content, expected) {
+		t.Errorf("Unexpected contents of the extracted memfd")
+	}
+}
+
+func TestAddSharedMemoryToTree(t *testing.T) {
+	fd := uint32(4)
+	tree := treeprint.New()
+	addSharedMemoryToTree(tree, &SharedMemoryNode{
+		Memfds: []MemfdNode{
+			{
+				ShmID: 100, Name: "buffer", Size: 4096, Mode: "0600",
+				Seals:   []string{"F_SEAL_SHRINK", "F_SEAL_GROW"},
+				Holders: []ShmemHolderNode{{PID: 1, Comm: "app", FD: &fd}},
+			},
+		},
+		Anonymous: []ShmemSegmentNode{
+			{ShmID: 200, Size: 8192, Holders: []ShmemHolderNode{{PID: 2, Comm: "worker", Mapping: "0x3000-0x5000"}}},
+		},
+	})
+	result := tree.String()
+
+	expectedStrings := []string{
+		"Shared memory",
+		"[100]  memfd:buffer",
+		"Size: 4.0 KiB",
+		"Permissions: 0600 (UID 0, GID 0)",
+		"Seals: F_SEAL_SHRINK|F_SEAL_GROW",
+		"Used by: app (PID 1, fd 4)",
+		"[200]  shared anonymous memory",
+		"Mapped by: worker (PID 2, 0x3000-0x5000)",
+	}
+	for _, expected := range expectedStrings {
+		if !strings.Contains(result, expected) {
+			t.Errorf("Expected tree to contain %q, but it didn't.\nTree:\n%s", expected, result)
+		}
+	}
+}
@@ -0,0 +1,330 @@
+// SPDX-License-Identifier: Apache-2.0
+
+// This file is used to sign checkpoint archives and to verify their signatures
+
+package internal
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// signatureVersion is the version of the signature file format
+const signatureVersion = 1
+
+// CheckpointSignature is a detached signature of a checkpoint archive. The
+// signature is calculated over the canonical encoding of the manifest of
+// the archive. The manifest is included to report which members of an
+// archive were changed, but it is not required for the verification.
+type CheckpointSignature struct {
+	Version        int             `json:"version"`
+	Algorithm      string          `json:"algorithm"`
+	KeyID          string          `json:"key_id"`
+	ManifestDigest string          `json:"manifest_digest"`
+	Signature      string          `json:"signature"`
+	Manifest       []ManifestEntry `json:"manifest,omitempty"`
+}
+
+// LoadSigningKey reads an ed25519 or ECDSA private key from a PEM file.
+// PKCS #8 and SEC 1 encoded keys are supported.
+func LoadSigningKey(path string) (crypto.Signer, error) {
+	blocks, err := readPEMBlocks(path)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, block := range blocks {
+		var key any
+		switch block.Type {
+		case "PRIVATE KEY":
+			key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+		case "EC PRIVATE KEY":
+			key, err = x509.ParseECPrivateKey(block.Bytes)
+		case "ENCRYPTED PRIVATE KEY":
+			return nil, fmt.Errorf("encrypted private keys are not supported: %s", path)
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse private key %s: %w", path, err)
+		}
+		switch k := key.(type) {
+		case ed25519.PrivateKey:
+			return k, nil
+		case *ecdsa.PrivateKey:
+			return k, nil
+		default:
+			return nil, fmt.Errorf("unsupported key type %T in %s: only ed25519 and ECDSA keys are supported", key, path)
+		}
+	}
+
+	return nil, fmt.Errorf("no private key found in %s", path)
+}
+
+// LoadVerificationKey reads an ed25519 or ECDSA public key from a PEM file.
+// Public keys, certificates and private keys are supported.
+func LoadVerificationKey(path string) (crypto.PublicKey, error) {
+	blocks, err := readPEMBlocks(path)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, block := range blocks {
+		var key crypto.PublicKey
+		switch block.Type {
+		case "PUBLIC KEY":
+			key, err = x509.ParsePKIXPublicKey(block.Bytes)
+		case "CERTIFICATE":
+			var cert *x509.Certificate
+			cert, err = x509.ParseCertificate(block.Bytes)
+			if err == nil {
+				key = cert.PublicKey
+			}
+		case "PRIVATE KEY", "EC PRIVATE KEY", "ENCRYPTED PRIVATE KEY":
+			var signer crypto.Signer
+			signer, err = LoadSigningKey(path)
+			if err == nil {
+				key = signer.Public()
+			}
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse public key %s: %w", path, err)
+		}
+		if _, _, err := signatureAlgorithm(key); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		return key, nil
+	}
+
+	return nil, fmt.Errorf("no public key found in %s", path)
+}
+
+func readPEMBlocks(path string) ([]*pem.Block, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var blocks []*pem.Block
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		blocks = append(blocks, block)
+	}
+	if len(blocks) == 0 {
+		return nil, fmt.Errorf("no PEM data found in %s", path)
+	}
+
+	return blocks, nil
+}
+
+// signatureAlgorithm returns the name of the signature algorithm of a public
+// key and the hash function used for ECDSA signatures.
+func signatureAlgorithm(key crypto.PublicKey) (string, crypto.Hash, error) {
+	switch k := key.(type) {
+	case ed25519.PublicKey:
+		return "ed25519", 0, nil
+	case *ecdsa.PublicKey:
+		switch k.Curve {
+		case elliptic.P256():
+			return "ecdsa-p256-sha256", crypto.SHA256, nil
+		case elliptic.P384():
+			return "ecdsa-p384-sha384", crypto.SHA384, nil
+		case elliptic.P521():
+			return "ecdsa-p521-sha512", crypto.SHA512, nil
+		}
+		return "", 0, fmt.Errorf("unsupported ECDSA curve %s", k.Curve.Params().Name)
+	default:
+		return "", 0, fmt.Errorf("unsupported key type %T: only ed25519 and ECDSA keys are supported", key)
+	}
+}
+
+// keyID returns the SHA-256 digest of the PKIX encoding of a public key.
+func keyID(key crypto.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		return "", err
+	}
+	return sha256Digest(der), nil
+}
+
+// sha256Digest returns the SHA-256 digest of data with the algorithm prefix.
+func sha256Digest(data []byte) string {
+	digest := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(digest[:])
+}
+
+// messageDigest returns the data which is signed for a manifest.
+func messageDigest(message []byte, hash crypto.Hash) []byte {
+	if hash == 0 {
+		// ed25519 signs the message itself
+		return message
+	}
+	h := hash.New()
+	h.Write(message)
+	return h.Sum(nil)
+}
+
+// SignCheckpoint creates a detached signature of a checkpoint archive.
+func SignCheckpoint(archivePath string, key crypto.Signer) (*CheckpointSignature, error) {
+	algorithm, hash, err := signatureAlgorithm(key.Public())
+	if err != nil {
+		return nil, err
+	}
+	id, err := keyID(key.Public())
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := BuildManifest(archivePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create manifest of %s: %w", archivePath, err)
+	}
+	message := encodeManifest(entries)
+
+	signature, err := key.Sign(rand.Reader, messageDigest(message, hash), hash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign manifest: %w", err)
+	}
+
+	return &CheckpointSignature{
+		Version:        signatureVersion,
+		Algorithm:      algorithm,
+		KeyID:          id,
+		ManifestDigest: sha256Digest(message),
+		Signature:      base64.StdEncoding.EncodeToString(signature),
+		Manifest:       entries,
+	}, nil
+}
+
+// ErrManifestMismatch is returned by VerifyCheckpointSignature if the
+// members of the archive differ from the signed manifest.
+var ErrManifestMismatch = errors.New("checkpoint does not match the signed manifest")
+
+// VerifyCheckpointSignature verifies a detached signature of a checkpoint
+// archive. If the members of the archive differ from the signed manifest,
+// the differences are returned together with ErrManifestMismatch. They are
+// only known if the signature contains the manifest.
+func VerifyCheckpointSignature(archivePath string, signature *CheckpointSignature, key crypto.PublicKey) (*ManifestDifference, error) {
+	if signature.Version != signatureVersion {
+		return nil, fmt.Errorf("unsupported signature version %d", signature.Version)
+	}
+	algorithm, hash, err := signatureAlgorithm(key)
+	if err != nil {
+		return nil, err
+	}
+	if algorithm != signature.Algorithm {
+		return nil, fmt.Errorf("the signature uses %s, but the key is for %s", signature.Algorithm, algorithm)
+	}
+	id, err := keyID(key)
+	if err != nil {
+		return nil, err
+	}
+	if id != signature.KeyID {
+		return nil, fmt.Errorf("the signature was created with key %s, not with key %s", signature.KeyID, id)
+	}
+
+	entries, err := BuildManifest(archivePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create manifest of %s: %w", archivePath, err)
+	}
+	message := encodeManifest(entries)
+
+	if sha256Digest(message) != signature.ManifestDigest {
+		if signature.Manifest != nil {
+			return CompareManifests(signature.Manifest, entries), ErrManifestMismatch
+		}
+		return nil, ErrManifestMismatch
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(signature.Signature)
+	if err != nil {
+		return nil, fmt.Errorf("invalid signature encoding: %w", err)
+	}
+
+	var valid bool
+	switch k := key.(type) {
+	case ed25519.PublicKey:
+		valid = ed25519.Verify(k, message, sig)
+	case *ecdsa.PublicKey:
+		valid = ecdsa.VerifyASN1(k, messageDigest(message, hash), sig)
+	}
+	if !valid {
+		return nil, fmt.Errorf("invalid signature")
+	}
+
+	return nil, nil
+}
+
+// ReadCheckpointSignature reads a signature file.
+func ReadCheckpointSignature(path string) (*CheckpointSignature, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseCheckpointSignature(data)
+}
+
+// ParseCheckpointSignature decodes a signature file or the value of the
+// signature annotation of a checkpoint image.
+func ParseCheckpointSignature(data []byte) (*CheckpointSignature, error) {
+	var signature CheckpointSignature
+	if err := json.Unmarshal(data, &signature); err != nil {
+		return nil, fmt.Errorf("failed to decode signature: %w", err)
+	}
+	if signature.Signature == "" || signature.ManifestDigest == "" {
+		return nil, fmt.Errorf("failed to decode signature: missing signature or manifest digest")
+	}
+	return &signature, nil
+}
+
+// WriteCheckpointSignature writes a signature file.
+func WriteCheckpointSignature(path string, signature *CheckpointSignature) error {
+	data, err := json.MarshalIndent(signature, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+// signatureAnnotation returns the value of the signature annotation of a
+// checkpoint image. The manifest is omitted to keep the annotation small.
+func signatureAnnotation(signature *CheckpointSignature) (string, error) {
+	compact := *signature
+	compact.Manifest = nil
+	data, err := json.Marshal(&compact)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// checkSignatureMatches checks whether a signature was created for a
+// checkpoint archive without verifying the signature itself.
+func checkSignatureMatches(archivePath string, signature *CheckpointSignature) error {
+	entries, err := BuildManifest(archivePath)
+	if err != nil {
+		return err
+	}
+	if sha256Digest(encodeManifest(entries)) != signature.ManifestDigest {
+		return fmt.Errorf("the signature was not created for %s", archivePath)
+	}
+	return nil
+}
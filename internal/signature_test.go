@@ -0,0 +1,348 @@
+package internal
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestBuildAndCompareManifests(t *testing.T) {
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a.tar")
+	b := filepath.Join(dir, "b.tar")
+	writeArchive(t, a, map[string][]byte{
+		"./config.dump":          []byte("{}"),
+		"checkpoint/pages-1.img": []byte("pages"),
+		"rootfs-diff.tar":        []byte("rootfs"),
+	})
+	writeArchive(t, b, map[string][]byte{
+		"config.dump":            []byte("{}"),
+		"checkpoint/pages-1.img": []byte("PAGES"),
+		"checkpoint/core-1.img":  []byte("core"),
+	})
+
+	manifestA, err := BuildManifest(a)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := []ManifestEntry{
+		{Path: "checkpoint/pages-1.img", Size: 5},
+		{Path: "config.dump", Size: 2},
+		{Path: "rootfs-diff.tar", Size: 6},
+	}
+	if len(manifestA) != len(expected) {
+		t.Fatalf("Expected %d entries, got %+v", len(expected), manifestA)
+	}
+	for i := range expected {
+		if manifestA[i].Path != expected[i].Path || manifestA[i].Size != expected[i].Size {
+			t.Errorf("Expected entry %+v, got %+v", expected[i], manifestA[i])
+		}
+	}
+	if manifestA[1].SHA256 != "44136fa355b3678a1146ad16f7e8649e94fb4fc21fe77e8310c060f61caaff8a" {
+		t.Errorf("Unexpected digest of config.dump %s", manifestA[1].SHA256)
+	}
+
+	manifestB, err := BuildManifest(b)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	diff := CompareManifests(manifestA, manifestB)
+	expectedDiff := &ManifestDifference{
+		Added:    []string{"checkpoint/core-1.img"},
+		Removed:  []string{"rootfs-diff.tar"},
+		Modified: []string{"checkpoint/pages-1.img"},
+	}
+	if !reflect.DeepEqual(diff, expectedDiff) {
+		t.Errorf("Expected %+v, got %+v", expectedDiff, diff)
+	}
+	if !CompareManifests(manifestA, manifestA).IsEmpty() {
+		t.Error("Expected no differences between identical manifests")
+	}
+}
+
+// writeKeys writes a private key in PKCS #8 format and the public key in
+// PKIX format and returns the paths.
+func writeKeys(t *testing.T, dir string, key crypto.Signer) (string, string) {
+	t.Helper()
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	privatePath := filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(privatePath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	der, err = x509.MarshalPKIXPublicKey(key.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicPath := filepath.Join(dir, "key.pub")
+	if err := os.WriteFile(publicPath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return privatePath, publicPath
+}
+
+func TestSignAndVerifyCheckpoint(t *testing.T) {
+	_, ed25519Key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		key       crypto.Signer
+		algorithm string
+	}{
+		{ed25519Key, "ed25519"},
+		{ecdsaKey, "ecdsa-p384-sha384"},
+	}
+
+	for _, tt := range tests {
+		dir := t.TempDir()
+		archive := filepath.Join(dir, "checkpoint.tar")
+		files := map[string][]byte{
+			"config.dump":            []byte("{}"),
+			"checkpoint/pages-1.img": []byte("pages"),
+		}
+		writeArchive(t, archive, files)
+
+		privatePath, publicPath := writeKeys(t, dir, tt.key)
+		signingKey, err := LoadSigningKey(privatePath)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		signature, err := SignCheckpoint(archive, signingKey)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if signature.Algorithm != tt.algorithm {
+			t.Errorf("Expected algorithm %s, got %s", tt.algorithm, signature.Algorithm)
+		}
+
+		signaturePath := filepath.Join(dir, "checkpoint.tar.sig")
+		if err := WriteCheckpointSignature(signaturePath, signature); err != nil {
+			t.Fatal(err)
+		}
+		signature, err = ReadCheckpointSignature(signaturePath)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		publicKey, err := LoadVerificationKey(publicPath)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if _, err := VerifyCheckpointSignature(archive, signature, publicKey); err != nil {
+			t.Errorf("Expected a valid %s signature, got %v", tt.algorithm, err)
+		}
+
+		// The signature in the image annotation does not contain the manifest
+		annotation, err := signatureAnnotation(signature)
+		if err != nil {
+			t.Fatal(err)
+		}
+		compact, err := ParseCheckpointSignature([]byte(annotation))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if _, err := VerifyCheckpointSignature(archive, compact, publicKey); err != nil {
+			t.Errorf("Expected a valid %s signature from the annotation, got %v", tt.algorithm, err)
+		}
+
+		// A forged signature is rejected
+		forged := *signature
+		forged.Signature = compact.Signature[:8] + "AAAA" + compact.Signature[12:]
+		if _, err := VerifyCheckpointSignature(archive, &forged, publicKey); err == nil {
+			t.Errorf("Expected an error for a forged %s signature", tt.algorithm)
+		}
+
+		// A modified checkpoint is rejected and the changes are reported
+		files["checkpoint/pages-1.img"] = []byte("PAGES")
+		writeArchive(t, archive, files)
+		diff, err := VerifyCheckpointSignature(archive, signature, publicKey)
+		if !errors.Is(err, ErrManifestMismatch) {
+			t.Errorf("Expected a manifest mismatch, got %v", err)
+		}
+		if diff == nil || !reflect.DeepEqual(diff.Modified, []string{"checkpoint/pages-1.img"}) {
+			t.Errorf("Unexpected differences %+v", diff)
+		}
+		if err := checkSignatureMatches(archive, signature); err == nil {
+			t.Error("Expected the signature not to match the modified checkpoint")
+		}
+	}
+}
+
+func TestVerifyCheckpointSignatureWrongKey(t *testing.T) {
+	dir := t.TempDir()
+	archive := filepath.Join(dir, "checkpoint.tar")
+	writeArchive(t, archive, map[string][]byte{"config.dump": []byte("{}")})
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signature, err := SignCheckpoint(archive, key)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	otherKey, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := VerifyCheckpointSignature(archive, signature, otherKey); err == nil {
+		t.Error("Expected an error for a different key")
+	}
+
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := VerifyCheckpointSignature(archive, signature, ecdsaKey.Public()); err == nil {
+		t.Error("Expected an error for a key of a different algorithm")
+	}
+}
+
+func TestLoadSigningKeySEC1(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// openssl ecparam -genkey writes the curve parameters before the key
+	path := filepath.Join(t.TempDir(), "key.pem")
+	content := append(pem.EncodeToMemory(&pem.Block{Type: "EC PARAMETERS", Bytes: []byte{0x06, 0x08}}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})...)
+	if err := os.WriteFile(path, content, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	signer, err := LoadSigningKey(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !key.Equal(signer) {
+		t.Error("Loaded key differs from the written key")
+	}
+
+	publicKey, err := LoadVerificationKey(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !key.PublicKey.Equal(publicKey) {
+		t.Error("Loaded public key differs from the written key")
+	}
+
+	if _, err := LoadSigningKey(filepath.Join(t.TempDir(), "missing.pem")); err == nil {
+		t.Error("Expected an error for a missing key")
+	}
+}
+
+func TestVerifyCheckpointSignatureMembers(t *testing.T) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	members := func() []*tar.Header {
+		return []*tar.Header{
+			{Name: "checkpoint/", Typeflag: tar.TypeDir, Mode: 0o755},
+			{Name: "checkpoint/pages-1.img", Typeflag: tar.TypeReg, Mode: 0o600},
+			{Name: "config.dump", Typeflag: tar.TypeReg, Mode: 0o600},
+		}
+	}
+
+	tests := []struct {
+		name     string
+		change   func([]*tar.Header) []*tar.Header
+		added    []string
+		modified []string
+	}{
+		{
+			name: "mode of a file",
+			change: func(headers []*tar.Header) []*tar.Header {
+				headers[2].Mode = 0o666
+				return headers
+			},
+			modified: []string{"config.dump"},
+		},
+		{
+			name: "mode of a directory",
+			change: func(headers []*tar.Header) []*tar.Header {
+				headers[0].Mode = 0o777
+				return headers
+			},
+			modified: []string{"checkpoint/"},
+		},
+		{
+			name: "injected symlink",
+			change: func(headers []*tar.Header) []*tar.Header {
+				return append(headers, &tar.Header{Name: "rootfs-diff.tar", Typeflag: tar.TypeSymlink, Linkname: "/etc/shadow", Mode: 0o777})
+			},
+			added: []string{"rootfs-diff.tar"},
+		},
+		{
+			name: "injected device",
+			change: func(headers []*tar.Header) []*tar.Header {
+				return append(headers, &tar.Header{Name: "checkpoint/tty", Typeflag: tar.TypeChar, Devmajor: 5, Mode: 0o666})
+			},
+			added: []string{"checkpoint/tty"},
+		},
+	}
+
+	for _, tt := range tests {
+		archive := filepath.Join(t.TempDir(), "checkpoint.tar")
+		writeHeaders(t, archive, members())
+		signature, err := SignCheckpoint(archive, key)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if len(signature.Manifest) != 3 {
+			t.Fatalf("Expected all 3 members in the manifest, got %+v", signature.Manifest)
+		}
+
+		writeHeaders(t, archive, tt.change(members()))
+		diff, err := VerifyCheckpointSignature(archive, signature, key.Public())
+		if !errors.Is(err, ErrManifestMismatch) {
+			t.Errorf("%s: expected a manifest mismatch, got %v", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(diff.Added, tt.added) || !reflect.DeepEqual(diff.Modified, tt.modified) {
+			t.Errorf("%s: unexpected differences %+v", tt.name, diff)
+		}
+	}
+}
+
+func TestEncodeManifestUnambiguous(t *testing.T) {
+	one := []ManifestEntry{{Path: "a,\n1:b", Type: ManifestTypeFile, Mode: "0644"}}
+	two := []ManifestEntry{
+		{Path: "a", Type: ManifestTypeFile, Mode: "0644"},
+		{Path: "b", Type: ManifestTypeFile, Mode: "0644"},
+	}
+	if bytes.Equal(encodeManifest(one), encodeManifest(two)) {
+		t.Error("Expected different encodings for different manifests")
+	}
+	link := []ManifestEntry{{Path: "a", Type: ManifestTypeSymlink, Mode: "0777", Link: "b"}}
+	file := []ManifestEntry{{Path: "a", Type: ManifestTypeFile, Mode: "0777", SHA256: "b"}}
+	if bytes.Equal(encodeManifest(link), encodeManifest(file)) {
+		t.Error("Expected different encodings for a link and a file")
+	}
+}
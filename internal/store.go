@@ -0,0 +1,628 @@
+// SPDX-License-Identifier: Apache-2.0
+
+// This file is used to store checkpoint archives deduplicated on disk
+
+package internal
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	metadata "github.com/checkpoint-restore/checkpointctl/lib"
+)
+
+const (
+	storeBlobsDirectory       = "blobs"
+	storeCheckpointsDirectory = "checkpoints"
+	storeTmpDirectory         = "tmp"
+	storeInfoFile             = "info.json"
+	storeSegmentsFile         = "segments.json"
+	// storeChunkSize is the size in which files are copied to the store
+	storeChunkSize = 1 << 20
+	// ShortIDLength is the length of the abbreviated ID of a stored checkpoint
+	ShortIDLength = 12
+)
+
+// CheckpointStore stores checkpoint archives in a directory. The files and
+// memory pages of all checkpoints are stored once per content as blobs named
+// by their SHA-256 digest. For each checkpoint, the segments of its
+// uncompressed tar stream are recorded, so that the archive can be
+// reconstructed byte by byte.
+type CheckpointStore struct {
+	dir string
+}
+
+// StoredCheckpoint describes a checkpoint archive in a store. The ID is the
+// SHA-256 digest of the uncompressed tar stream.
+type StoredCheckpoint struct {
+	ID          string       `json:"id"`
+	Name        string       `json:"name"`
+	Added       time.Time    `json:"added"`
+	Size        int64        `json:"size"`
+	ArchiveSize int64        `json:"archive_size"`
+	Compression string       `json:"compression"`
+	Data        string       `json:"data"`
+	Config      *ChkptConfig `json:"config,omitempty"`
+}
+
+// ShortID returns the abbreviated ID of a stored checkpoint.
+func (c *StoredCheckpoint) ShortID() string {
+	if len(c.ID) > ShortIDLength {
+		return c.ID[:ShortIDLength]
+	}
+	return c.ID
+}
+
+// storeSegment is a part of the tar stream of a stored checkpoint. It is a
+// sequence of page blobs, a range of a file blob or, without a blob, a
+// range of the data blob of the checkpoint.
+type storeSegment struct {
+	Blob   string   `json:"blob,omitempty"`
+	Pages  []string `json:"pages,omitempty"`
+	Offset int64    `json:"offset,omitempty"`
+	Size   int64    `json:"size"`
+}
+
+// StoreAddResult describes a checkpoint archive added to a store.
+type StoreAddResult struct {
+	Checkpoint *StoredCheckpoint
+	// NewSize is the size of the blobs which were not yet in the store
+	NewSize int64
+	// Exists reports whether the checkpoint was already in the store
+	Exists bool
+}
+
+// StoreStats describes the disk usage of a store.
+type StoreStats struct {
+	Checkpoints int
+	// Size is the sum of the uncompressed sizes of all checkpoints
+	Size  int64
+	Blobs int
+	// BlobSize is the size of all blobs on disk
+	BlobSize int64
+}
+
+// DedupRatio returns the ratio of the size of all checkpoints to the size
+// of the stored data.
+func (s StoreStats) DedupRatio() float64 {
+	if s.BlobSize == 0 {
+		return 0
+	}
+	return float64(s.Size) / float64(s.BlobSize)
+}
+
+// NewCheckpointStore returns the store in a directory.
+func NewCheckpointStore(dir string) *CheckpointStore {
+	return &CheckpointStore{dir: dir}
+}
+
+func (s *CheckpointStore) blobPath(digest string) string {
+	return filepath.Join(s.dir, storeBlobsDirectory, digest[:2], digest)
+}
+
+func (s *CheckpointStore) checkpointPath(id string) string {
+	return filepath.Join(s.dir, storeCheckpointsDirectory, id)
+}
+
+func (s *CheckpointStore) init() error {
+	for _, dir := range []string{storeBlobsDirectory, storeCheckpointsDirectory, storeTmpDirectory} {
+		if err := os.MkdirAll(filepath.Join(s.dir, dir), 0o700); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// putBlobFile moves a temporary file to the blob with the digest unless the
+// blob exists. It returns the number of bytes added to the store.
+func (s *CheckpointStore) putBlobFile(tmpPath, digest string) (int64, error) {
+	path := s.blobPath(digest)
+	if _, err := os.Stat(path); err == nil {
+		return 0, os.Remove(tmpPath)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return 0, err
+	}
+	info, err := os.Stat(tmpPath)
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), os.Rename(tmpPath, path)
+}
+
+// putBlob writes data to the blob with its digest unless the blob exists.
+func (s *CheckpointStore) putBlob(data []byte) (string, int64, error) {
+	digest := sha256.Sum256(data)
+	name := hex.EncodeToString(digest[:])
+	if _, err := os.Stat(s.blobPath(name)); err == nil {
+		return name, 0, nil
+	}
+
+	f, err := os.CreateTemp(filepath.Join(s.dir, storeTmpDirectory), "blob-")
+	if err != nil {
+		return "", 0, err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return "", 0, err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return "", 0, err
+	}
+	written, err := s.putBlobFile(f.Name(), name)
+	return name, written, err
+}
+
+// storeWriter collects the segments of a checkpoint which is added to a
+// store. The bytes of the tar stream which are not stored as blobs of files
+// or pages are written to the data file.
+type storeWriter struct {
+	tarStreamSplitter
+	store    *CheckpointStore
+	segments []storeSegment
+	newSize  int64
+}
+
+// addData adds the pending bytes to the data of the checkpoint.
+func (w *storeWriter) addData() error {
+	offset, size, err := w.writeData()
+	if err != nil || size == 0 {
+		return err
+	}
+
+	if n := len(w.segments); n > 0 && w.segments[n-1].Blob == "" && w.segments[n-1].Pages == nil {
+		w.segments[n-1].Size += size
+	} else {
+		w.segments = append(w.segments, storeSegment{Offset: offset, Size: size})
+	}
+	return nil
+}
+
+// addPage stores the pending bytes as a page blob.
+func (w *storeWriter) addPage() error {
+	digest, written, err := w.store.putBlob(w.pending.Bytes())
+	if err != nil {
+		return err
+	}
+	w.newSize += written
+	size := w.discard()
+
+	if n := len(w.segments); n > 0 && w.segments[n-1].Pages != nil {
+		w.segments[n-1].Pages = append(w.segments[n-1].Pages, digest)
+		w.segments[n-1].Size += size
+		return nil
+	}
+	w.segments = append(w.segments, storeSegment{Pages: []string{digest}, Size: size})
+	return nil
+}
+
+// addFile stores the content of a member as a file blob.
+func (w *storeWriter) addFile(r io.Reader) error {
+	f, err := os.CreateTemp(filepath.Join(w.store.dir, storeTmpDirectory), "blob-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	hash := sha256.New()
+	chunk := make([]byte, storeChunkSize)
+	var size int64
+	for {
+		n, err := r.Read(chunk)
+		if n > 0 {
+			hash.Write(chunk[:n])
+			if _, err := f.Write(chunk[:n]); err != nil {
+				return err
+			}
+			size += int64(n)
+			// The content is stored in the blob instead of the data
+			w.discard()
+		}
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if size == 0 {
+		return nil
+	}
+
+	digest := hex.EncodeToString(hash.Sum(nil))
+	written, err := w.store.putBlobFile(f.Name(), digest)
+	if err != nil {
+		return err
+	}
+	w.newSize += written
+	w.segments = append(w.segments, storeSegment{Blob: digest, Size: size})
+	return nil
+}
+
+// Add adds a checkpoint archive to the store.
+func (s *CheckpointStore) Add(archivePath string) (*StoreAddResult, error) {
+	if err := s.init(); err != nil {
+		return nil, err
+	}
+
+	compression, err := detectArchiveCompression(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	if err := ValidateCompressionLevel(compression, 0); err != nil {
+		return nil, fmt.Errorf("%s cannot be stored: %w", archivePath, err)
+	}
+
+	data, err := os.CreateTemp(filepath.Join(s.dir, storeTmpDirectory), "data-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(data.Name())
+	defer data.Close()
+
+	w := &storeWriter{tarStreamSplitter: tarStreamSplitter{data: data}, store: s}
+	streamHash := sha256.New()
+	err = w.split(archivePath, streamHash, w.addData, func(r io.Reader, path string) error {
+		if !isPagesImage(path) {
+			return w.addFile(r)
+		}
+
+		page := make([]byte, pageSize)
+		for {
+			n, err := io.ReadFull(r, page)
+			if n == pageSize {
+				if err := w.addPage(); err != nil {
+					return err
+				}
+			} else if err := w.addData(); err != nil {
+				return err
+			}
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+		}
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read checkpoint %s: %w", archivePath, err)
+	}
+
+	id := hex.EncodeToString(streamHash.Sum(nil))
+	if checkpoint, err := s.readCheckpoint(id); err == nil {
+		return &StoreAddResult{Checkpoint: checkpoint, NewSize: w.newSize, Exists: true}, nil
+	}
+
+	if _, err := data.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	dataHash := sha256.New()
+	if _, err := io.Copy(dataHash, data); err != nil {
+		return nil, err
+	}
+	if err := data.Close(); err != nil {
+		return nil, err
+	}
+	dataDigest := hex.EncodeToString(dataHash.Sum(nil))
+	written, err := s.putBlobFile(data.Name(), dataDigest)
+	if err != nil {
+		return nil, err
+	}
+	w.newSize += written
+
+	info, err := os.Stat(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	checkpoint := &StoredCheckpoint{
+		ID:          id,
+		Name:        filepath.Base(archivePath),
+		Added:       time.Now().UTC(),
+		ArchiveSize: info.Size(),
+		Compression: compression,
+		Data:        dataDigest,
+	}
+	for _, segment := range w.segments {
+		checkpoint.Size += segment.Size
+	}
+	// Archives without container metadata can be stored as well
+	if config, err := ExtractConfigDump(archivePath); err == nil {
+		checkpoint.Config = config
+	}
+
+	if err := s.writeCheckpoint(checkpoint, w.segments); err != nil {
+		return nil, err
+	}
+
+	return &StoreAddResult{Checkpoint: checkpoint, NewSize: w.newSize}, nil
+}
+
+// writeCheckpoint writes the description and the segments of a checkpoint
+// to a temporary directory which is renamed afterwards, so that incomplete
+// checkpoints are never visible.
+func (s *CheckpointStore) writeCheckpoint(checkpoint *StoredCheckpoint, segments []storeSegment) error {
+	tmpDir, err := os.MkdirTemp(filepath.Join(s.dir, storeTmpDirectory), "checkpoint-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	if _, err := metadata.WriteJSONFile(checkpoint, tmpDir, storeInfoFile); err != nil {
+		return err
+	}
+	segmentsData, err := json.Marshal(segments)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(tmpDir, storeSegmentsFile), segmentsData, 0o600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpDir, s.checkpointPath(checkpoint.ID))
+}
+
+func (s *CheckpointStore) readCheckpoint(id string) (*StoredCheckpoint, error) {
+	var checkpoint StoredCheckpoint
+	if _, err := metadata.ReadJSONFile(&checkpoint, s.checkpointPath(id), storeInfoFile); err != nil {
+		return nil, err
+	}
+	return &checkpoint, nil
+}
+
+func (s *CheckpointStore) readSegments(id string) ([]storeSegment, error) {
+	var segments []storeSegment
+	if _, err := metadata.ReadJSONFile(&segments, s.checkpointPath(id), storeSegmentsFile); err != nil {
+		return nil, err
+	}
+	return segments, nil
+}
+
+// List returns all checkpoints in the store sorted by the time they were
+// added.
+func (s *CheckpointStore) List() ([]*StoredCheckpoint, error) {
+	entries, err := os.ReadDir(filepath.Join(s.dir, storeCheckpointsDirectory))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var checkpoints []*StoredCheckpoint
+	for _, entry := range entries {
+		checkpoint, err := s.readCheckpoint(entry.Name())
+		if err != nil {
+			return nil, err
+		}
+		checkpoints = append(checkpoints, checkpoint)
+	}
+	sort.Slice(checkpoints, func(i, j int) bool { return checkpoints[i].Added.Before(checkpoints[j].Added) })
+
+	return checkpoints, nil
+}
+
+// Lookup returns the checkpoint with an ID starting with ref or with the
+// name ref.
+func (s *CheckpointStore) Lookup(ref string) (*StoredCheckpoint, error) {
+	checkpoints, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+
+	var found []*StoredCheckpoint
+	for _, checkpoint := range checkpoints {
+		if checkpoint.ID == ref {
+			return checkpoint, nil
+		}
+		if strings.HasPrefix(checkpoint.ID, ref) || checkpoint.Name == ref {
+			found = append(found, checkpoint)
+		}
+	}
+
+	switch len(found) {
+	case 0:
+		return nil, fmt.Errorf("no checkpoint %s in store %s", ref, s.dir)
+	case 1:
+		return found[0], nil
+	default:
+		return nil, fmt.Errorf("%s matches %d checkpoints in store %s, please use the ID", ref, len(found), s.dir)
+	}
+}
+
+// Get reconstructs a stored checkpoint archive with its original
+// compression and verifies that the uncompressed tar stream is identical.
+func (s *CheckpointStore) Get(ref, output string) (*StoredCheckpoint, error) {
+	checkpoint, err := s.Lookup(ref)
+	if err != nil {
+		return nil, err
+	}
+	segments, err := s.readSegments(checkpoint.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.writeSegments(checkpoint, segments, output); err != nil {
+		os.Remove(output)
+		return nil, err
+	}
+
+	return checkpoint, nil
+}
+
+func (s *CheckpointStore) writeSegments(checkpoint *StoredCheckpoint, segments []storeSegment, output string) error {
+	out, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	stream, err := newCompressWriter(out, checkpoint.Compression, 0)
+	if err != nil {
+		return err
+	}
+	streamHash := sha256.New()
+	w := io.MultiWriter(stream, streamHash)
+
+	data, err := os.Open(s.blobPath(checkpoint.Data))
+	if err != nil {
+		return err
+	}
+	defer data.Close()
+
+	copyBlob := func(digest string, offset, size int64) error {
+		f, err := os.Open(s.blobPath(digest))
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(w, io.NewSectionReader(f, offset, size))
+		return err
+	}
+
+	for _, segment := range segments {
+		var err error
+		switch {
+		case segment.Pages != nil:
+			for _, page := range segment.Pages {
+				if err = copyBlob(page, 0, int64(pageSize)); err != nil {
+					break
+				}
+			}
+		case segment.Blob != "":
+			err = copyBlob(segment.Blob, segment.Offset, segment.Size)
+		default:
+			_, err = io.Copy(w, io.NewSectionReader(data, segment.Offset, segment.Size))
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := stream.Close(); err != nil {
+		return err
+	}
+	if hex.EncodeToString(streamHash.Sum(nil)) != checkpoint.ID {
+		return fmt.Errorf("the reconstructed checkpoint %s does not match the stored checkpoint", checkpoint.ShortID())
+	}
+
+	return out.Close()
+}
+
+// Remove removes a checkpoint from the store. Its blobs are removed by GC.
+func (s *CheckpointStore) Remove(ref string) (*StoredCheckpoint, error) {
+	checkpoint, err := s.Lookup(ref)
+	if err != nil {
+		return nil, err
+	}
+	return checkpoint, os.RemoveAll(s.checkpointPath(checkpoint.ID))
+}
+
+// GC removes all blobs which are not used by a checkpoint in the store and
+// returns the number and the size of the removed blobs.
+func (s *CheckpointStore) GC() (int, int64, error) {
+	checkpoints, err := s.List()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	used := make(map[string]bool)
+	for _, checkpoint := range checkpoints {
+		used[checkpoint.Data] = true
+		segments, err := s.readSegments(checkpoint.ID)
+		if err != nil {
+			return 0, 0, err
+		}
+		for _, segment := range segments {
+			if segment.Blob != "" {
+				used[segment.Blob] = true
+			}
+			for _, page := range segment.Pages {
+				used[page] = true
+			}
+		}
+	}
+
+	var removed int
+	var freed int64
+	err = s.walkBlobs(func(path string, info fs.FileInfo) error {
+		if used[info.Name()] {
+			return nil
+		}
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+		removed++
+		freed += info.Size()
+		return nil
+	})
+	if err != nil {
+		return removed, freed, err
+	}
+
+	// Remove the leftovers of interrupted commands
+	if err := os.RemoveAll(filepath.Join(s.dir, storeTmpDirectory)); err != nil {
+		return removed, freed, err
+	}
+
+	return removed, freed, nil
+}
+
+func (s *CheckpointStore) walkBlobs(fn func(path string, info fs.FileInfo) error) error {
+	err := filepath.WalkDir(filepath.Join(s.dir, storeBlobsDirectory), func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		return fn(path, info)
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// Stats returns the disk usage of the store.
+func (s *CheckpointStore) Stats() (*StoreStats, error) {
+	checkpoints, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &StoreStats{Checkpoints: len(checkpoints)}
+	for _, checkpoint := range checkpoints {
+		stats.Size += checkpoint.Size
+	}
+	err = s.walkBlobs(func(_ string, info fs.FileInfo) error {
+		stats.Blobs++
+		stats.BlobSize += info.Size()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return stats, nil
+}
@@ -0,0 +1,117 @@
+package internal
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckpointStore(t *testing.T) {
+	dir := t.TempDir()
+	store := NewCheckpointStore(filepath.Join(dir, "store"))
+	pages := randomPages(t, 16)
+	core := bytes.Repeat([]byte("core"), 1000)
+	specDump := []byte(`{"annotations":{"io.container.manager":"libpod"}}`)
+
+	first := filepath.Join(dir, "first.tar")
+	writeArchive(t, first, map[string][]byte{
+		"config.dump":            []byte(`{"name":"first"}`),
+		"spec.dump":              specDump,
+		"checkpoint/core-1.img":  core,
+		"checkpoint/pages-1.img": bytes.Join(pages, nil),
+	})
+	second := filepath.Join(dir, "second.tar")
+	writeArchive(t, second, map[string][]byte{
+		"config.dump":            []byte(`{"name":"second"}`),
+		"spec.dump":              specDump,
+		"checkpoint/core-1.img":  core,
+		"checkpoint/pages-1.img": bytes.Join(append(randomPages(t, 1), pages[1:]...), nil),
+	})
+
+	firstResult, err := store.Add(first)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if firstResult.Exists || firstResult.Checkpoint.Config == nil || firstResult.Checkpoint.Config.Container != "first" {
+		t.Errorf("Unexpected result %+v", firstResult)
+	}
+
+	// Only the changed page and the metadata of the second checkpoint are new
+	secondResult, err := store.Add(second)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if secondResult.NewSize < int64(pageSize) || secondResult.NewSize > int64(pageSize+8*1024) {
+		t.Errorf("Unexpected size of new data %d", secondResult.NewSize)
+	}
+
+	again, err := store.Add(first)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !again.Exists || again.Checkpoint.ID != firstResult.Checkpoint.ID {
+		t.Errorf("Expected the checkpoint to exist in the store, got %+v", again)
+	}
+
+	stats, err := store.Stats()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if stats.Checkpoints != 2 || stats.DedupRatio() < 1.5 {
+		t.Errorf("Unexpected store statistics %+v", stats)
+	}
+
+	// Checkpoints are found by a prefix of the ID and by name
+	for _, ref := range []string{firstResult.Checkpoint.ID[:8], "first.tar"} {
+		checkpoint, err := store.Lookup(ref)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if checkpoint.ID != firstResult.Checkpoint.ID {
+			t.Errorf("Expected checkpoint %s for %s, got %s", firstResult.Checkpoint.ID, ref, checkpoint.ID)
+		}
+	}
+	if _, err := store.Lookup("missing.tar"); err == nil {
+		t.Error("Expected an error for a missing checkpoint")
+	}
+
+	output := filepath.Join(dir, "output.tar")
+	if _, err := store.Get("second.tar", output); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected, err := os.ReadFile(second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reconstructed, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(expected, reconstructed) {
+		t.Error("The reconstructed checkpoint differs from the original checkpoint")
+	}
+
+	// Removing a checkpoint frees only the data which is not shared
+	if _, err := store.Remove("first.tar"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	removed, freed, err := store.GC()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if removed == 0 || freed < int64(pageSize) || freed > int64(pageSize+8*1024) {
+		t.Errorf("Unexpected garbage collection of %d blobs with %d bytes", removed, freed)
+	}
+
+	if _, err := store.Get("second.tar", output); err != nil {
+		t.Fatalf("Unexpected error after garbage collection: %v", err)
+	}
+	reconstructed, err = os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(expected, reconstructed) {
+		t.Error("The reconstructed checkpoint differs after garbage collection")
+	}
+}
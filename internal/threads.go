@@ -0,0 +1,103 @@
+// SPDX-License-Identifier: Apache-2.0
+
+// This file is used to collect information about the threads of checkpointed processes
+
+package internal
+
+import (
+	"fmt"
+
+	"github.com/checkpoint-restore/go-criu/v8/crit"
+)
+
+type ThreadNode struct {
+	TID            uint32   `json:"tid"`
+	Comm           string   `json:"command"`
+	State          string   `json:"state,omitempty"`
+	BlockedSigmask string   `json:"blocked_sigmask,omitempty"`
+	BlockedSignals []string `json:"blocked_signals,omitempty"`
+}
+
+// signalNames maps standard Linux signal numbers to their names.
+var signalNames = map[int]string{
+	1: "SIGHUP", 2: "SIGINT", 3: "SIGQUIT", 4: "SIGILL", 5: "SIGTRAP",
+	6: "SIGABRT", 7: "SIGBUS", 8: "SIGFPE", 9: "SIGKILL", 10: "SIGUSR1",
+	11: "SIGSEGV", 12: "SIGUSR2", 13: "SIGPIPE", 14: "SIGALRM", 15: "SIGTERM",
+	16: "SIGSTKFLT", 17: "SIGCHLD", 18: "SIGCONT", 19: "SIGSTOP", 20: "SIGTSTP",
+	21: "SIGTTIN", 22: "SIGTTOU", 23: "SIGURG", 24: "SIGXCPU", 25: "SIGXFSZ",
+	26: "SIGVTALRM", 27: "SIGPROF", 28: "SIGWINCH", 29: "SIGIO", 30: "SIGPWR",
+	31: "SIGSYS",
+}
+
+// sigrtmin is the first real-time signal number as defined by the kernel.
+const sigrtmin = 32
+
+// signalName returns the name of the given signal number.
+func signalName(signo int) string {
+	if name, ok := signalNames[signo]; ok {
+		return name
+	}
+	if signo == sigrtmin {
+		return "SIGRTMIN"
+	}
+	if signo > sigrtmin {
+		return fmt.Sprintf("SIGRTMIN+%d", signo-sigrtmin)
+	}
+	return fmt.Sprintf("SIG%d", signo)
+}
+
+// formatSigset converts a kernel signal mask into a list of signal names.
+// Bit N-1 of the mask corresponds to signal N.
+func formatSigset(mask uint64) []string {
+	var result []string
+	for bit := 0; bit < 64; bit++ {
+		if mask&(1<<uint(bit)) != 0 {
+			result = append(result, signalName(bit+1))
+		}
+	}
+	return result
+}
+
+// buildJSONThreads collects the threads of the given process.
+func buildJSONThreads(ps *crit.PsTree, checkpointOutputDir string) ([]ThreadNode, error) {
+	var result []ThreadNode
+
+	taskState := crit.TaskState(ps.Core.GetTc().GetTaskState())
+
+	for _, tid := range getThreadIDs(ps) {
+		core := ps.Core
+		if tid != ps.PID {
+			var err error
+			core, err = readCoreEntry(checkpointOutputDir, tid)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read thread %d: %w", tid, err)
+			}
+		}
+
+		// Threads share the state of their thread group. The comm of a
+		// thread may differ from its thread group leader.
+		thread := ThreadNode{
+			TID:   tid,
+			Comm:  core.GetThreadCore().GetComm(),
+			State: taskState.String(),
+		}
+		if thread.Comm == "" {
+			thread.Comm = ps.Comm
+		}
+
+		// The thread core contains the per-thread signal mask; older
+		// images only store the mask of the leader in the task core.
+		blkSigset := core.GetTc().GetBlkSigset()
+		if tc := core.GetThreadCore(); tc != nil && tc.BlkSigset != nil {
+			blkSigset = tc.GetBlkSigset()
+		}
+		if blkSigset != 0 {
+			thread.BlockedSigmask = fmt.Sprintf("0x%016x", blkSigset)
+			thread.BlockedSignals = formatSigset(blkSigset)
+		}
+
+		result = append(result, thread)
+	}
+
+	return result, nil
+}
@@ -0,0 +1,100 @@
+package internal
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/checkpoint-restore/go-criu/v8/crit"
+	criu_core "github.com/checkpoint-restore/go-criu/v8/crit/images/criu-core"
+	"github.com/checkpoint-restore/go-criu/v8/crit/images/pstree"
+	"github.com/xlab/treeprint"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestFormatSigset(t *testing.T) {
+	tests := []struct {
+		mask     uint64
+		expected []string
+	}{
+		{0, nil},
+		{1 << 1, []string{"SIGINT"}},
+		{(1 << 1) | (1 << 14), []string{"SIGINT", "SIGTERM"}},
+		{1 << 31, []string{"SIGRTMIN"}},
+		{1 << 33, []string{"SIGRTMIN+2"}},
+	}
+
+	for _, test := range tests {
+		result := formatSigset(test.mask)
+		if !reflect.DeepEqual(result, test.expected) {
+			t.Errorf("formatSigset(%#x): expected %v, got %v", test.mask, test.expected, result)
+		}
+	}
+}
+
+func TestBuildJSONThreadsSingleThread(t *testing.T) {
+	ps := &crit.PsTree{
+		PID:     1,
+		Comm:    "piggie",
+		Process: &pstree.PstreeEntry{Pid: proto.Uint32(1)},
+		Core: &criu_core.CoreEntry{
+			Tc: &criu_core.TaskCoreEntry{
+				TaskState: proto.Uint32(1),
+				BlkSigset: proto.Uint64(1 << 9),
+			},
+			ThreadCore: &criu_core.ThreadCoreEntry{},
+		},
+	}
+
+	threads, err := buildJSONThreads(ps, t.TempDir())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := []ThreadNode{
+		{
+			TID:            1,
+			Comm:           "piggie",
+			State:          "Alive",
+			BlockedSigmask: "0x0000000000000200",
+			BlockedSignals: []string{"SIGUSR1"},
+		},
+	}
+	if !reflect.DeepEqual(threads, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, threads)
+	}
+}
+
+func TestBuildJSONThreadsMissingCore(t *testing.T) {
+	ps := &crit.PsTree{
+		PID:     1,
+		Comm:    "piggie",
+		Process: &pstree.PstreeEntry{Pid: proto.Uint32(1), Threads: []uint32{1, 2}},
+		Core:    &criu_core.CoreEntry{},
+	}
+
+	if _, err := buildJSONThreads(ps, t.TempDir()); err == nil {
+		t.Error("Expected an error when the core image of a thread is missing")
+	}
+}
+
+func TestAddThreadsToTree(t *testing.T) {
+	tree := treeprint.New()
+	addThreadsToTree(tree, []ThreadNode{
+		{TID: 10, Comm: "java", State: "Alive"},
+		{TID: 11, Comm: "GC Thread#0", State: "Stopped", BlockedSignals: []string{"SIGINT", "SIGQUIT"}},
+	})
+	result := tree.String()
+
+	expectedStrings := []string{
+		"Threads",
+		"[10]  java",
+		"[11 (Stopped)]  GC Thread#0",
+		"Blocked signals: SIGINT, SIGQUIT",
+	}
+	for _, expected := range expectedStrings {
+		if !strings.Contains(result, expected) {
+			t.Errorf("Expected tree to contain %q, but it didn't.\nTree:\n%s", expected, result)
+		}
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"sort"
+	"strings"
 
 	metadata "github.com/checkpoint-restore/checkpointctl/lib"
 	"github.com/xlab/treeprint"
@@ -79,6 +80,37 @@ func buildTreeFromDisplayNode(node DisplayNode) treeprint.Tree {
 		addMountNodesToTree(tree, node.Mounts)
 	}
 
+	if len(node.MountTree) > 0 {
+		addMountTreeToTree(tree, node.MountTree)
+	}
+
+	if len(node.Namespaces) > 0 {
+		addNamespaceNodesToTree(tree, node.Namespaces)
+	}
+
+	if len(node.IPC) > 0 {
+		addIpcNodesToTree(tree, node.IPC)
+	}
+
+	if len(node.Ttys) > 0 {
+		addTtyNodesToTree(tree, node.Ttys)
+	}
+
+	if len(node.GhostFiles) > 0 {
+		addGhostFilesToTree(tree, node.GhostFiles)
+	}
+
+	if node.SharedMemory != nil {
+		addSharedMemoryToTree(tree, node.SharedMemory)
+	}
+
+	if len(node.Warnings) > 0 {
+		warningsTree := tree.AddBranch("Warnings")
+		for _, warning := range node.Warnings {
+			warningsTree.AddBranch(warning)
+		}
+	}
+
 	return tree
 }
 
@@ -171,6 +203,14 @@ func addPsNodeBranch(tree treeprint.Tree, ps *PsNode, fds []FdNode, sks []SkNode
 		}
 	}
 
+	if len(ps.Threads) > 0 {
+		addThreadsToTree(node, ps.Threads)
+	}
+
+	if len(ps.Registers) > 0 {
+		addRegistersToTree(node, ps.Registers)
+	}
+
 	// Add file descriptors for this process
 	for _, fd := range fds {
 		if fd.PID != ps.PID {
@@ -179,9 +219,13 @@ func addPsNodeBranch(tree treeprint.Tree, ps *PsNode, fds []FdNode, sks []SkNode
 		if len(fd.OpenFiles) > 0 {
 			filesTree := node.AddBranch("Open files")
 			for _, file := range fd.OpenFiles {
-				filesTree.AddMetaBranch(file.FD, file.Path)
+				fileTree := filesTree.AddMetaBranch(file.FD, file.Path)
+				addFdDetailsToTree(fileTree, file)
 			}
 		}
+		if len(fd.Timers) > 0 {
+			addTimersToTree(node, fd.Timers)
+		}
 	}
 
 	// Add sockets for this process
@@ -211,6 +255,47 @@ func addPsNodeBranch(tree treeprint.Tree, ps *PsNode, fds []FdNode, sks []SkNode
 	}
 }
 
+func addThreadsToTree(tree treeprint.Tree, threads []ThreadNode) {
+	threadsTree := tree.AddBranch("Threads")
+	for _, thread := range threads {
+		metaBranchTag := fmt.Sprintf("%d", thread.TID)
+		if thread.State != "" && thread.State != "Alive" {
+			metaBranchTag = fmt.Sprintf("%d (%s)", thread.TID, thread.State)
+		}
+		threadTree := threadsTree.AddMetaBranch(metaBranchTag, thread.Comm)
+		if len(thread.BlockedSignals) > 0 {
+			threadTree.AddBranch(fmt.Sprintf("Blocked signals: %s", strings.Join(thread.BlockedSignals, ", ")))
+		}
+	}
+}
+
+func addRegistersToTree(tree treeprint.Tree, threads []ThreadRegistersNode) {
+	registersTree := tree.AddBranch("Registers")
+	for _, thread := range threads {
+		threadTree := registersTree.AddBranch(fmt.Sprintf("Thread %d (%s)", thread.TID, thread.Arch))
+		if thread.UnsupportedArchError != "" {
+			threadTree.AddBranch(thread.UnsupportedArchError)
+			continue
+		}
+		threadTree.AddBranch(fmt.Sprintf("IP: %s", thread.InstructionPointer))
+		if thread.StackPointer != "" {
+			threadTree.AddBranch(fmt.Sprintf("SP: %s", thread.StackPointer))
+		}
+		gpTree := threadTree.AddBranch("General purpose registers")
+		for _, reg := range thread.GeneralPurpose {
+			gpTree.AddMetaBranch(reg.Name, reg.Value)
+		}
+		if thread.FPUState {
+			threadTree.AddBranch("FPU state: present")
+		} else {
+			threadTree.AddBranch("FPU state: absent")
+		}
+		if len(thread.ExtendedStates) > 0 {
+			threadTree.AddBranch(fmt.Sprintf("Extended state: %s", strings.Join(thread.ExtendedStates, ", ")))
+		}
+	}
+}
+
 func formatSocketForTree(socket SocketNode) (protocol, data string) {
 	protocol = socket.Protocol
 	skData := socket.Data
@@ -273,9 +358,248 @@ func addMountNodesToTree(tree treeprint.Tree, mounts []MountNode) {
 		mountTree := mountsTree.AddBranch(fmt.Sprintf("Destination: %s", mount.Destination))
 		mountTree.AddBranch(fmt.Sprintf("Type: %s", mount.Type))
 		mountTree.AddBranch(fmt.Sprintf("Source: %s", mount.Source))
+		if len(mount.Options) > 0 {
+			mountTree.AddBranch(fmt.Sprintf("Options: %s", strings.Join(mount.Options, ",")))
+		}
+	}
+}
+
+func addFdDetailsToTree(tree treeprint.Tree, file OpenFileNode) {
+	switch {
+	case file.Timerfd != nil:
+		tree.AddBranch(fmt.Sprintf("Clock: %s", file.Timerfd.Clock))
+		value := file.Timerfd.Value
+		if file.Timerfd.Absolute {
+			value += " (absolute)"
+		}
+		tree.AddBranch(fmt.Sprintf("Remaining: %s", value))
+		tree.AddBranch(fmt.Sprintf("Interval: %s", file.Timerfd.Interval))
+		tree.AddBranch(fmt.Sprintf("Ticks: %d", file.Timerfd.Ticks))
+	case file.Eventfd != nil:
+		tree.AddBranch(fmt.Sprintf("Counter: %d", file.Eventfd.Counter))
+	case file.Eventpoll != nil:
+		for _, target := range file.Eventpoll.Targets {
+			tree.AddBranch(fmt.Sprintf("Watching fd %d: %s (data %s)", target.FD, strings.Join(target.Events, "|"), target.Data))
+		}
+	case file.Signalfd != nil:
+		if len(file.Signalfd.Signals) > 0 {
+			tree.AddBranch(fmt.Sprintf("Signals: %s", strings.Join(file.Signalfd.Signals, ", ")))
+		} else {
+			tree.AddBranch("Signals: none")
+		}
+	case file.Inotify != nil:
+		for _, watch := range file.Inotify.Watches {
+			tree.AddBranch(fmt.Sprintf("Watch %d: inode %d on %s: %s", watch.WD, watch.Inode, watch.Device, strings.Join(watch.Events, "|")))
+		}
+	case file.Fanotify != nil:
+		for _, mark := range file.Fanotify.Marks {
+			tree.AddBranch(fmt.Sprintf("Mark on %s: %s", mark.Target, strings.Join(mark.Events, "|")))
+		}
+	}
+}
+
+func addTimersToTree(tree treeprint.Tree, timers []TimerNode) {
+	timersTree := tree.AddBranch("Timers")
+	for _, t := range timers {
+		name := t.Type
+		if t.Type == "POSIX" {
+			name = fmt.Sprintf("POSIX %d", t.ID)
+		}
+		timerTree := timersTree.AddMetaBranch(name, fmt.Sprintf("remaining %s, interval %s", t.Value, t.Interval))
+		if t.Clock != "" {
+			timerTree.AddBranch(fmt.Sprintf("Clock: %s", t.Clock))
+		}
+		if t.Notify != "" {
+			notify := t.Notify
+			if t.Signal != "" {
+				notify += " " + t.Signal
+			}
+			timerTree.AddBranch(fmt.Sprintf("Notify: %s", notify))
+		}
+		if t.Overrun != 0 {
+			timerTree.AddBranch(fmt.Sprintf("Overrun: %d", t.Overrun))
+		}
+	}
+}
+
+func addMountTreeToTree(tree treeprint.Tree, namespaces []MountNamespaceMountsNode) {
+	mountTree := tree.AddBranch("Mount tree")
+	for _, ns := range namespaces {
+		nsTree := mountTree.AddBranch(fmt.Sprintf("Mount namespace %d", ns.ID))
+		for _, m := range ns.Mounts {
+			addCriuMountToTree(nsTree, m)
+		}
+	}
+}
+
+func addCriuMountToTree(tree treeprint.Tree, m CriuMountNode) {
+	mountpoint := m.Mountpoint
+	if !m.InSpec {
+		mountpoint += " (not in OCI spec)"
+	}
+	mountTree := tree.AddMetaBranch(m.ID, mountpoint)
+	mountTree.AddBranch(fmt.Sprintf("Type: %s", m.Fstype))
+	mountTree.AddBranch(fmt.Sprintf("Source: %s", m.Source))
+	if m.Root != "/" {
+		mountTree.AddBranch(fmt.Sprintf("Root: %s", m.Root))
+	}
+	mountTree.AddBranch(fmt.Sprintf("Options: %s", m.Options))
+	mountTree.AddBranch(fmt.Sprintf("Propagation: %s", m.Propagation))
+	if m.External {
+		if m.ExternalKey != "" {
+			mountTree.AddBranch(fmt.Sprintf("External mount: %s", m.ExternalKey))
+		} else {
+			mountTree.AddBranch("External mount")
+		}
+	}
+	if m.Deleted {
+		mountTree.AddBranch("Mountpoint deleted")
+	}
+	for _, child := range m.Children {
+		addCriuMountToTree(mountTree, child)
+	}
+}
+
+func addNamespaceNodesToTree(tree treeprint.Tree, namespaces []NamespaceNode) {
+	namespacesTree := tree.AddBranch("Namespaces")
+	for _, ns := range namespaces {
+		nsTree := namespacesTree.AddMetaBranch(ns.Type, fmt.Sprintf("ID %d", ns.ID))
+		if ns.Hostname != "" {
+			nsTree.AddBranch(fmt.Sprintf("Hostname: %s", ns.Hostname))
+		}
+		if ns.Domainname != "" && ns.Domainname != "(none)" {
+			nsTree.AddBranch(fmt.Sprintf("Domainname: %s", ns.Domainname))
+		}
+		for _, m := range ns.UIDMap {
+			nsTree.AddBranch(fmt.Sprintf("UID map: %d -> %d (%d)", m.ContainerID, m.HostID, m.Size))
+		}
+		for _, m := range ns.GIDMap {
+			nsTree.AddBranch(fmt.Sprintf("GID map: %d -> %d (%d)", m.ContainerID, m.HostID, m.Size))
+		}
+		pids := make([]string, 0, len(ns.PIDs))
+		for _, pid := range ns.PIDs {
+			pids = append(pids, fmt.Sprintf("%d", pid))
+		}
+		nsTree.AddBranch(fmt.Sprintf("PIDs: %s", strings.Join(pids, ", ")))
+	}
+}
+
+func addTtyNodesToTree(tree treeprint.Tree, ttys []TtyNode) {
+	ttysTree := tree.AddBranch("Terminals")
+	for _, t := range ttys {
+		name := t.Type
+		if t.Role != "" {
+			name += " " + t.Role
+		}
+		if t.Index != nil {
+			name += fmt.Sprintf(" %d", *t.Index)
+		}
+		ttyTree := ttysTree.AddMetaBranch(t.ID, name)
+		ttyTree.AddBranch(fmt.Sprintf("Device: %s", t.Device))
+		ttyTree.AddBranch(fmt.Sprintf("Session: %d, process group: %d", t.SID, t.PGRP))
+		if t.Winsize != nil {
+			ttyTree.AddBranch(fmt.Sprintf("Window size: %dx%d", t.Winsize.Cols, t.Winsize.Rows))
+		}
+		if t.Termios != nil {
+			termiosTree := ttyTree.AddBranch(fmt.Sprintf("Termios: %s mode, speed %d", t.Termios.Mode, t.Termios.Speed))
+			if len(t.Termios.Flags) > 0 {
+				termiosTree.AddBranch(fmt.Sprintf("Flags: %s", strings.Join(t.Termios.Flags, " ")))
+			}
+		}
+		for _, fd := range t.FDs {
+			ttyTree.AddBranch(fmt.Sprintf("Used by: %s (PID %d, fd %d)", fd.Comm, fd.PID, fd.FD))
+		}
+	}
+}
+
+func addGhostFilesToTree(tree treeprint.Tree, ghostFiles []GhostFileNode) {
+	ghostTree := tree.AddBranch("Ghost files")
+	for _, g := range ghostFiles {
+		fileTree := ghostTree.AddMetaBranch(g.ID, g.Path)
+		fileTree.AddBranch(fmt.Sprintf("Size: %s", metadata.ByteToString(int64(g.Size))))
+		fileTree.AddBranch(fmt.Sprintf("Mode: %s (UID %d, GID %d)", g.Mode, g.UID, g.GID))
+		if g.Modified != "" {
+			fileTree.AddBranch(fmt.Sprintf("Modified: %s", g.Modified))
+		}
+		if g.SymlinkTarget != "" {
+			fileTree.AddBranch(fmt.Sprintf("Symlink target: %s", g.SymlinkTarget))
+		}
+		for _, holder := range g.Holders {
+			fileTree.AddBranch(fmt.Sprintf("Held by: %s (PID %d, fd %d)", holder.Comm, holder.PID, holder.FD))
+		}
+	}
+}
+
+func addSharedMemoryToTree(tree treeprint.Tree, shmem *SharedMemoryNode) {
+	shmemTree := tree.AddBranch("Shared memory")
+	for _, m := range shmem.Memfds {
+		memfdTree := shmemTree.AddMetaBranch(m.ShmID, fmt.Sprintf("memfd:%s", m.Name))
+		memfdTree.AddBranch(fmt.Sprintf("Size: %s", metadata.ByteToString(int64(m.Size))))
+		memfdTree.AddBranch(fmt.Sprintf("Permissions: %s (UID %d, GID %d)", m.Mode, m.UID, m.GID))
+		if len(m.Seals) > 0 {
+			memfdTree.AddBranch(fmt.Sprintf("Seals: %s", strings.Join(m.Seals, "|")))
+		}
+		if m.Hugetlb {
+			memfdTree.AddBranch("Backed by huge pages")
+		}
+		addShmemHoldersToTree(memfdTree, m.Holders)
+	}
+	for _, a := range shmem.Anonymous {
+		anonTree := shmemTree.AddMetaBranch(a.ShmID, "shared anonymous memory")
+		anonTree.AddBranch(fmt.Sprintf("Size: %s", metadata.ByteToString(int64(a.Size))))
+		addShmemHoldersToTree(anonTree, a.Holders)
+	}
+}
+
+func addShmemHoldersToTree(tree treeprint.Tree, holders []ShmemHolderNode) {
+	for _, h := range holders {
+		if h.FD != nil {
+			tree.AddBranch(fmt.Sprintf("Used by: %s (PID %d, fd %d)", h.Comm, h.PID, *h.FD))
+		} else {
+			tree.AddBranch(fmt.Sprintf("Mapped by: %s (PID %d, %s)", h.Comm, h.PID, h.Mapping))
+		}
+	}
+}
+
+func addIpcNodesToTree(tree treeprint.Tree, namespaces []IpcNamespaceNode) {
+	ipcTree := tree.AddBranch("IPC objects")
+	for _, ns := range namespaces {
+		nsTree := ipcTree.AddBranch(fmt.Sprintf("IPC namespace %d", ns.ID))
+		if len(ns.SharedMemory) > 0 {
+			shmTree := nsTree.AddBranch("Shared memory")
+			for _, shm := range ns.SharedMemory {
+				segmentTree := addIpcOwnerToTree(shmTree, shm.IpcOwnerNode)
+				segmentTree.AddBranch(fmt.Sprintf("Size: %s", metadata.ByteToString(int64(shm.Size))))
+			}
+		}
+		if len(ns.Semaphores) > 0 {
+			semTree := nsTree.AddBranch("Semaphores")
+			for _, sem := range ns.Semaphores {
+				setTree := addIpcOwnerToTree(semTree, sem.IpcOwnerNode)
+				values := make([]string, 0, len(sem.Values))
+				for _, value := range sem.Values {
+					values = append(values, fmt.Sprintf("%d", value))
+				}
+				setTree.AddBranch(fmt.Sprintf("Values: %s", strings.Join(values, ", ")))
+			}
+		}
+		if len(ns.MessageQueues) > 0 {
+			msgTree := nsTree.AddBranch("Message queues")
+			for _, queue := range ns.MessageQueues {
+				queueTree := addIpcOwnerToTree(msgTree, queue.IpcOwnerNode)
+				queueTree.AddBranch(fmt.Sprintf("Messages: %d (%s)", queue.Messages, metadata.ByteToString(int64(queue.Bytes))))
+				queueTree.AddBranch(fmt.Sprintf("Max size: %s", metadata.ByteToString(int64(queue.MaxBytes))))
+			}
+		}
 	}
 }
 
+func addIpcOwnerToTree(tree treeprint.Tree, owner IpcOwnerNode) treeprint.Tree {
+	objectTree := tree.AddMetaBranch(owner.ID, fmt.Sprintf("Key: %s", owner.Key))
+	objectTree.AddBranch(fmt.Sprintf("Permissions: %s (UID %d, GID %d)", owner.Mode, owner.UID, owner.GID))
+	return objectTree
+}
+
 // Taken from the CRI API
 type mountAnnotations struct {
 	ContainerPath     string `json:"container_path,omitempty"`
@@ -0,0 +1,231 @@
+// SPDX-License-Identifier: Apache-2.0
+
+// This file is used to collect the terminals of a checkpoint
+
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/checkpoint-restore/go-criu/v8/crit"
+	"github.com/checkpoint-restore/go-criu/v8/crit/images/fdinfo"
+	"github.com/checkpoint-restore/go-criu/v8/crit/images/tty"
+)
+
+type TtyNode struct {
+	ID         uint32       `json:"id"`
+	Type       string       `json:"type"`
+	Role       string       `json:"role,omitempty"`
+	Index      *uint32      `json:"index,omitempty"`
+	Device     string       `json:"device"`
+	SID        uint32       `json:"sid"`
+	PGRP       uint32       `json:"pgrp"`
+	Locked     bool         `json:"locked,omitempty"`
+	Exclusive  bool         `json:"exclusive,omitempty"`
+	PacketMode bool         `json:"packet_mode,omitempty"`
+	Termios    *TermiosNode `json:"termios,omitempty"`
+	Winsize    *WinsizeNode `json:"winsize,omitempty"`
+	FDs        []TtyFdNode  `json:"fds,omitempty"`
+}
+
+type TermiosNode struct {
+	Iflag string   `json:"iflag"`
+	Oflag string   `json:"oflag"`
+	Cflag string   `json:"cflag"`
+	Lflag string   `json:"lflag"`
+	Speed uint32   `json:"speed"`
+	Mode  string   `json:"mode"`
+	Flags []string `json:"flags,omitempty"`
+}
+
+type WinsizeNode struct {
+	Rows uint32 `json:"rows"`
+	Cols uint32 `json:"cols"`
+}
+
+type TtyFdNode struct {
+	PID  uint32 `json:"pid"`
+	FD   uint32 `json:"fd"`
+	Comm string `json:"command"`
+}
+
+// Selected termios flags which are relevant for the behaviour of a terminal
+var (
+	termiosIflags = []flagName{{0x100, "ICRNL"}, {0x400, "IXON"}, {0x1000, "IXOFF"}, {0x4000, "IUTF8"}}
+	termiosOflags = []flagName{{0x1, "OPOST"}, {0x4, "ONLCR"}}
+	termiosLflags = []flagName{
+		{0x1, "ISIG"}, {0x2, "ICANON"}, {0x8, "ECHO"}, {0x10, "ECHOE"}, {0x20, "ECHOK"},
+		{0x40, "ECHONL"}, {0x80, "NOFLSH"}, {0x100, "TOSTOP"}, {0x8000, "IEXTEN"},
+	}
+)
+
+// Device major numbers of pseudo terminals
+const (
+	ttyAuxMajor        = 5
+	ptmxMinor          = 2
+	unix98PtySlaveBase = 136
+	unix98PtySlaveEnd  = 143
+)
+
+// decodeRdev splits a device number as returned by stat(2) into
+// its major and minor number.
+func decodeRdev(rdev uint32) (uint32, uint32) {
+	return (rdev >> 8) & 0xfff, (rdev & 0xff) | ((rdev >> 12) & 0xfff00)
+}
+
+// readTtyInfoEntries reads the terminals from tty-info.img. Checkpoints of
+// processes without a terminal have no tty-info.img.
+func readTtyInfoEntries(checkpointOutputDir string) ([]*tty.TtyInfoEntry, error) {
+	img, err := readCriuImage(checkpointOutputDir, "tty-info.img", &tty.TtyInfoEntry{})
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	infos := make([]*tty.TtyInfoEntry, 0, len(img.Entries))
+	for _, entry := range img.Entries {
+		infos = append(infos, entry.Message.(*tty.TtyInfoEntry))
+	}
+	return infos, nil
+}
+
+// buildTtyWarnings returns a warning for every external terminal in
+// tty-info.img. These warnings are shown without --ttys, because the
+// checkpoint cannot be restored without the terminal.
+func buildTtyWarnings(checkpointOutputDir string) ([]string, error) {
+	infos, err := readTtyInfoEntries(checkpointOutputDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var warnings []string
+	for _, info := range infos {
+		if info.GetType() != tty.TtyType_EXT_TTY {
+			continue
+		}
+		node := buildTtyNode(info)
+		warnings = append(warnings, fmt.Sprintf(
+			"checkpoint depends on an external terminal (tty %d, device %s) which has to be provided on restore",
+			node.ID, node.Device,
+		))
+	}
+	return warnings, nil
+}
+
+// buildJSONTtys reads the terminals from tty-info.img and attaches the file
+// descriptors that reference them.
+func buildJSONTtys(psTree *crit.PsTree, checkpointOutputDir string) ([]TtyNode, error) {
+	infos, err := readTtyInfoEntries(checkpointOutputDir)
+	if err != nil || infos == nil {
+		return nil, err
+	}
+
+	var result []TtyNode
+	index := make(map[uint32]int)
+	for _, info := range infos {
+		node := buildTtyNode(info)
+		index[node.ID] = len(result)
+		result = append(result, node)
+	}
+
+	files, err := readFileEntries(checkpointOutputDir)
+	if err != nil {
+		return nil, err
+	}
+
+	err = walkProcessFds(checkpointOutputDir, psTree, func(ps *crit.PsTree, fdinfos map[string]*fdinfo.FdinfoEntry) error {
+		for _, fd := range fdinfos {
+			if fd.GetType() != fdinfo.FdTypes_TTY {
+				continue
+			}
+			i, ok := index[files[fd.GetId()].GetTty().GetTtyInfoId()]
+			if !ok {
+				continue
+			}
+			result[i].FDs = append(result[i].FDs, TtyFdNode{PID: ps.PID, FD: fd.GetFd(), Comm: ps.Comm})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range result {
+		sort.Slice(result[i].FDs, func(a, b int) bool {
+			if result[i].FDs[a].PID != result[i].FDs[b].PID {
+				return result[i].FDs[a].PID < result[i].FDs[b].PID
+			}
+			return result[i].FDs[a].FD < result[i].FDs[b].FD
+		})
+	}
+
+	return result, nil
+}
+
+func buildTtyNode(info *tty.TtyInfoEntry) TtyNode {
+	major, minor := decodeRdev(info.GetRdev())
+	node := TtyNode{
+		ID:         info.GetId(),
+		Type:       info.GetType().String(),
+		Device:     fmt.Sprintf("%d:%d", major, minor),
+		SID:        info.GetSid(),
+		PGRP:       info.GetPgrp(),
+		Locked:     info.GetLocked(),
+		Exclusive:  info.GetExclusive(),
+		PacketMode: info.GetPacketMode(),
+	}
+
+	if info.GetType() == tty.TtyType_PTY {
+		switch {
+		case major == ttyAuxMajor && minor == ptmxMinor:
+			node.Role = "master"
+		case major >= unix98PtySlaveBase && major <= unix98PtySlaveEnd:
+			node.Role = "slave"
+		}
+	}
+	if info.GetPty() != nil {
+		ptyIndex := info.GetPty().GetIndex()
+		node.Index = &ptyIndex
+	}
+
+	if termios := info.GetTermios(); termios != nil {
+		node.Termios = &TermiosNode{
+			Iflag: fmt.Sprintf("0x%x", termios.GetCIflag()),
+			Oflag: fmt.Sprintf("0x%x", termios.GetCOflag()),
+			Cflag: fmt.Sprintf("0x%x", termios.GetCCflag()),
+			Lflag: fmt.Sprintf("0x%x", termios.GetCLflag()),
+			Speed: termios.GetCOspeed(),
+			Mode:  "raw",
+		}
+		// ICANON
+		if termios.GetCLflag()&0x2 != 0 {
+			node.Termios.Mode = "canonical"
+		}
+		node.Termios.Flags = append(node.Termios.Flags, termiosFlagNames(termios.GetCIflag(), termiosIflags)...)
+		node.Termios.Flags = append(node.Termios.Flags, termiosFlagNames(termios.GetCOflag(), termiosOflags)...)
+		node.Termios.Flags = append(node.Termios.Flags, termiosFlagNames(termios.GetCLflag(), termiosLflags)...)
+	}
+
+	if winsize := info.GetWinsize(); winsize != nil {
+		node.Winsize = &WinsizeNode{Rows: winsize.GetWsRow(), Cols: winsize.GetWsCol()}
+	}
+
+	return node
+}
+
+// termiosFlagNames returns the names of the known flags that are set.
+// Unlike formatFlags, other bits are ignored as only a subset is listed.
+func termiosFlagNames(mask uint32, names []flagName) []string {
+	var result []string
+	for _, f := range names {
+		if mask&f.flag != 0 {
+			result = append(result, f.name)
+		}
+	}
+	return result
+}
@@ -0,0 +1,137 @@
+package internal
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/checkpoint-restore/go-criu/v8/crit"
+	"github.com/checkpoint-restore/go-criu/v8/crit/images/tty"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestBuildTtyNodePtySlave(t *testing.T) {
+	ttyType := tty.TtyType_PTY
+	node := buildTtyNode(&tty.TtyInfoEntry{
+		Id:         proto.Uint32(3),
+		Type:       &ttyType,
+		Locked:     proto.Bool(false),
+		Exclusive:  proto.Bool(false),
+		PacketMode: proto.Bool(false),
+		Sid:        proto.Uint32(1),
+		Pgrp:       proto.Uint32(1),
+		// /dev/pts/4
+		Rdev: proto.Uint32(136<<8 | 4),
+		Termios: &tty.TermiosEntry{
+			CIflag:  proto.Uint32(0x100 | 0x400),
+			COflag:  proto.Uint32(0x1 | 0x4),
+			CCflag:  proto.Uint32(0xbf),
+			CLflag:  proto.Uint32(0x1 | 0x2 | 0x8),
+			CLine:   proto.Uint32(0),
+			CIspeed: proto.Uint32(38400),
+			COspeed: proto.Uint32(38400),
+		},
+		Winsize: &tty.WinsizeEntry{
+			WsRow:    proto.Uint32(24),
+			WsCol:    proto.Uint32(80),
+			WsXpixel: proto.Uint32(0),
+			WsYpixel: proto.Uint32(0),
+		},
+		Pty: &tty.TtyPtyEntry{Index: proto.Uint32(4)},
+	})
+
+	if node.Type != "PTY" || node.Role != "slave" || node.Device != "136:4" || node.Index == nil || *node.Index != 4 {
+		t.Errorf("Unexpected terminal: %+v", node)
+	}
+	if node.Termios.Mode != "canonical" || node.Termios.Speed != 38400 {
+		t.Errorf("Unexpected termios: %+v", node.Termios)
+	}
+	expectedFlags := []string{"ICRNL", "IXON", "OPOST", "ONLCR", "ISIG", "ICANON", "ECHO"}
+	if !reflect.DeepEqual(node.Termios.Flags, expectedFlags) {
+		t.Errorf("Expected flags %v, got %v", expectedFlags, node.Termios.Flags)
+	}
+	if !reflect.DeepEqual(node.Winsize, &WinsizeNode{Rows: 24, Cols: 80}) {
+		t.Errorf("Unexpected window size: %+v", node.Winsize)
+	}
+}
+
+func TestBuildJSONTtysWithoutImage(t *testing.T) {
+	dir := t.TempDir()
+	ttys, err := buildJSONTtys(&crit.PsTree{}, dir)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	warnings, err := buildTtyWarnings(dir)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if ttys != nil || warnings != nil {
+		t.Errorf("Expected no terminals and warnings, got %+v %v", ttys, warnings)
+	}
+}
+
+func TestBuildTtyWarnings(t *testing.T) {
+	ptyType, extType := tty.TtyType_PTY, tty.TtyType_EXT_TTY
+	dir := t.TempDir()
+	newImageWriter(t, "TTY_INFO").
+		entry(&tty.TtyInfoEntry{
+			Id: proto.Uint32(1), Type: &ptyType, Locked: proto.Bool(false), Exclusive: proto.Bool(false),
+			PacketMode: proto.Bool(false), Sid: proto.Uint32(1), Pgrp: proto.Uint32(1), Rdev: proto.Uint32(136<<8 | 0),
+		}).
+		entry(&tty.TtyInfoEntry{
+			Id: proto.Uint32(2), Type: &extType, Locked: proto.Bool(false), Exclusive: proto.Bool(false),
+			PacketMode: proto.Bool(false), Sid: proto.Uint32(1), Pgrp: proto.Uint32(1), Rdev: proto.Uint32(136<<8 | 3),
+		}).
+		write(dir, "tty-info.img")
+
+	warnings, err := buildTtyWarnings(dir)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := []string{"checkpoint depends on an external terminal (tty 2, device 136:3) which has to be provided on restore"}
+	if !reflect.DeepEqual(warnings, expected) {
+		t.Errorf("Expected warnings %v, got %v", expected, warnings)
+	}
+}
+
+func TestBuildTreeFromDisplayNodeWithTtys(t *testing.T) {
+	index := uint32(0)
+	node := DisplayNode{
+		ContainerName: "test-container",
+		Ttys: []TtyNode{
+			{
+				ID:      5,
+				Type:    "PTY",
+				Role:    "master",
+				Index:   &index,
+				Device:  "5:2",
+				SID:     1,
+				PGRP:    1,
+				Winsize: &WinsizeNode{Rows: 24, Cols: 80},
+				Termios: &TermiosNode{Mode: "raw", Speed: 38400, Flags: []string{"OPOST"}},
+				FDs:     []TtyFdNode{{PID: 1, FD: 0, Comm: "bash"}},
+			},
+		},
+		Warnings: []string{"checkpoint depends on an external terminal"},
+	}
+
+	result := buildTreeFromDisplayNode(node).String()
+
+	expectedStrings := []string{
+		"Terminals",
+		"[5]  PTY master 0",
+		"Device: 5:2",
+		"Session: 1, process group: 1",
+		"Window size: 80x24",
+		"Termios: raw mode, speed 38400",
+		"Flags: OPOST",
+		"Used by: bash (PID 1, fd 0)",
+		"Warnings",
+		"checkpoint depends on an external terminal",
+	}
+	for _, expected := range expectedStrings {
+		if !strings.Contains(result, expected) {
+			t.Errorf("Expected tree to contain %q, but it didn't.\nTree:\n%s", expected, result)
+		}
+	}
+}
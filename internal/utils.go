@@ -9,6 +9,7 @@ import (
 	"time"
 
 	metadata "github.com/checkpoint-restore/checkpointctl/lib"
+	"github.com/checkpoint-restore/go-criu/v8/crit"
 )
 
 func FormatTime(microseconds uint32) string {
@@ -133,3 +134,20 @@ func WriteTableRows(w *tabwriter.Writer, rows [][]string) {
 		fmt.Fprintln(w)
 	}
 }
+
+// walkAliveProcesses calls fn for every process of the tree which is alive
+// or stopped. Zombies and dead processes have no images besides the core
+// image and are skipped.
+func walkAliveProcesses(ps *crit.PsTree, fn func(ps *crit.PsTree) error) error {
+	if crit.TaskState(ps.Core.GetTc().GetTaskState()).IsAliveOrStopped() {
+		if err := fn(ps); err != nil {
+			return err
+		}
+	}
+	for _, child := range ps.Children {
+		if err := walkAliveProcesses(child, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -65,4 +65,7 @@ const (
 
 	// CheckpointAnnotationDistributionVersion specifies the version of the host distribution on which the checkpoint was created.
 	CheckpointAnnotationDistributionVersion = "org.criu.checkpoint.distribution.version"
+
+	// CheckpointAnnotationSignature specifies the detached signature of the checkpoint archive created by checkpointctl sign.
+	CheckpointAnnotationSignature = "org.criu.checkpoint.signature"
 )
@@ -14,6 +14,10 @@
 #include <sys/types.h>
 #include <errno.h>
 #include <sys/wait.h>
+#include <sys/eventfd.h>
+#include <sys/timerfd.h>
+#include <sys/signalfd.h>
+#include <sys/epoll.h>
 
 #define STKS	(4*4096)
 #define MAX_EXTRA_CLIENTS 16
@@ -31,6 +35,9 @@ typedef struct {
 	char *log_file;
 	bool use_tcp_socket;
 	bool create_zombie;
+	bool create_anon_fds;
+	bool create_ghost_file;
+	bool create_shmem;
 } opts_t;
 
 static pid_t tcp_extras[MAX_EXTRA_CLIENTS];
@@ -213,6 +220,105 @@ static void create_zombie(void)
 	 */
 }
 
+#define GHOST_FILE_PATH "/tmp/piggie-ghost.log"
+#define GHOST_FILE_CONTENTS "piggie was here\n"
+
+/*
+ * Create a file which is deleted while it is still open. CRIU stores
+ * the contents of such files as ghost files. The descriptor is
+ * intentionally leaked.
+ */
+static void create_ghost_file(void)
+{
+	int fd;
+
+	fd = open(GHOST_FILE_PATH, O_RDWR | O_CREAT | O_TRUNC, 0640);
+	if (fd < 0) {
+		perror("open ghost file");
+		return;
+	}
+	if (write(fd, GHOST_FILE_CONTENTS, strlen(GHOST_FILE_CONTENTS)) < 0)
+		perror("write ghost file");
+	if (unlink(GHOST_FILE_PATH) < 0)
+		perror("unlink ghost file");
+}
+
+#define MEMFD_NAME "piggie-memfd"
+#define MEMFD_CONTENTS "piggie memfd\n"
+#define SHMEM_CONTENTS "piggie shmem\n"
+
+/*
+ * Create a sealed memfd which is also mapped and a shared anonymous
+ * mapping. The descriptor and the mappings are intentionally leaked.
+ */
+static void create_shmem(void)
+{
+	void *addr;
+	int fd;
+
+	fd = memfd_create(MEMFD_NAME, MFD_ALLOW_SEALING);
+	if (fd < 0) {
+		perror("memfd_create");
+		return;
+	}
+	if (write(fd, MEMFD_CONTENTS, strlen(MEMFD_CONTENTS)) < 0)
+		perror("write memfd");
+	if (fcntl(fd, F_ADD_SEALS, F_SEAL_SHRINK | F_SEAL_GROW) < 0)
+		perror("fcntl F_ADD_SEALS");
+	if (mmap(NULL, 4096, PROT_READ, MAP_SHARED, fd, 0) == MAP_FAILED)
+		perror("mmap memfd");
+
+	addr = mmap(NULL, 4096, PROT_READ | PROT_WRITE, MAP_SHARED | MAP_ANONYMOUS, -1, 0);
+	if (addr == MAP_FAILED) {
+		perror("mmap shared anonymous memory");
+		return;
+	}
+	memcpy(addr, SHMEM_CONTENTS, strlen(SHMEM_CONTENTS));
+}
+
+/*
+ * Create file descriptors backed by anonymous inodes to test decoding
+ * of their state. The descriptors are intentionally leaked.
+ */
+static void create_anon_fds(void)
+{
+	struct itimerspec its = {
+		.it_interval = { .tv_sec = 3600 },
+		.it_value = { .tv_sec = 3600 },
+	};
+	struct epoll_event ev = { .events = EPOLLIN };
+	int efd, tfd, epfd;
+	sigset_t mask;
+
+	efd = eventfd(42, 0);
+	if (efd < 0) {
+		perror("eventfd");
+		return;
+	}
+
+	tfd = timerfd_create(CLOCK_MONOTONIC, 0);
+	if (tfd < 0 || timerfd_settime(tfd, 0, &its, NULL) < 0) {
+		perror("timerfd");
+		return;
+	}
+
+	sigemptyset(&mask);
+	sigaddset(&mask, SIGUSR1);
+	if (signalfd(-1, &mask, 0) < 0) {
+		perror("signalfd");
+		return;
+	}
+
+	epfd = epoll_create1(0);
+	if (epfd < 0) {
+		perror("epoll_create1");
+		return;
+	}
+	ev.data.fd = efd;
+	if (epoll_ctl(epfd, EPOLL_CTL_ADD, efd, &ev) < 0)
+		perror("epoll_ctl");
+}
+
 void run_tcp_server(void)
 {
 	int server_socket, ret;
@@ -398,6 +504,18 @@ static int do_test(void *opts_ptr)
 		create_zombie();
 	}
 
+	if (opts->create_anon_fds) {
+		create_anon_fds();
+	}
+
+	if (opts->create_ghost_file) {
+		create_ghost_file();
+	}
+
+	if (opts->create_shmem) {
+		create_shmem();
+	}
+
 	/*
 	 * Optional synchronous command channel. The test script creates two
 	 * FIFOs, points $PIGGIE_CMD_FIFO / $PIGGIE_ACK_FIFO at them, then for
@@ -489,6 +607,24 @@ static int parse_options(int argc, char **argv, bool *usage_error, opts_t *opts)
 			continue;
 		}
 
+		if (!strcmp(argv[i], "--anon-fds") || !strcmp(argv[i], "-a")) {
+			opts->create_anon_fds = true;
+			i++;
+			continue;
+		}
+
+		if (!strcmp(argv[i], "--ghost-file") || !strcmp(argv[i], "-g")) {
+			opts->create_ghost_file = true;
+			i++;
+			continue;
+		}
+
+		if (!strcmp(argv[i], "--shmem") || !strcmp(argv[i], "-m")) {
+			opts->create_shmem = true;
+			i++;
+			continue;
+		}
+
 		printf("Unknown option: %s\n", argv[i]);
 		*usage_error = true;
 		goto out;
@@ -508,7 +644,7 @@ int main(int argc, char **argv) {
 
 	ret = parse_options(argc, argv, &usage_error, &opts);
 	if (ret) {
-		fprintf(stderr, "Usage: %s -o/--log-file <log_file> [-t/--tcp-socket] [-z|--zombie]\n", argv[0]);
+		fprintf(stderr, "Usage: %s -o/--log-file <log_file> [-t/--tcp-socket] [-z|--zombie] [-a|--anon-fds] [-g|--ghost-file] [-m|--shmem]\n", argv[0]);
 		return (usage_error != false);
 	}
 